@@ -6,12 +6,15 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service"
 	"github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/events"
 	"github.com/micro/micro/v3/service/logger"
 	"github.com/micro/micro/v3/service/store"
+	aipb "github.com/micro/services/ai/proto"
 	pb "github.com/micro/services/chat/proto"
 	"github.com/micro/services/pkg/tenant"
+	spampb "github.com/micro/services/spam/proto"
 )
 
 const (
@@ -20,12 +23,27 @@ const (
 	messageStoreKeyPrefix = "messages/"
 )
 
-type Chat struct{}
+type Chat struct {
+	// used to moderate messages
+	spam spampb.SpamService
+	ai   aipb.AiService
+}
+
+func New(srv *service.Service) *Chat {
+	return &Chat{
+		spam: spampb.NewSpamService("spam", srv.Client()),
+		ai:   aipb.NewAiService("ai", srv.Client()),
+	}
+}
 
 func (c *Chat) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.CreateResponse) error {
 	// get the tenant
 	tenantId := tenant.Id(ctx)
 
+	if req.SlowMode < 0 || req.SlowMode > maxSlowMode {
+		return errors.BadRequest("chat.new", "slow mode must be between 0 and %d seconds", maxSlowMode)
+	}
+
 	// generate a unique id for the chat
 	groupId := uuid.New().String()
 
@@ -37,8 +55,19 @@ func (c *Chat) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Create
 		UserIds:     req.UserIds,
 		Private:     req.Private,
 		CreatedAt:   time.Now().Format(time.RFC3339Nano),
+		SlowMode:    req.SlowMode,
+		Moderated:   req.Moderated,
 	}
 
+	// the owner is a member of the group, otherwise the first member owns it
+	if len(req.OwnerId) > 0 {
+		if len(roleOf(group, req.OwnerId)) == 0 {
+			group.UserIds = append(group.UserIds, req.OwnerId)
+		}
+		group.Roles = map[string]string{req.OwnerId: roleOwner}
+	}
+	ensureOwner(group)
+
 	// key to lookup the chat in the store using, e.g. "chat/usera-userb-userc"
 	key := path.Join(chatStoreKeyPrefix, tenantId, groupId)
 
@@ -51,6 +80,11 @@ func (c *Chat) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Create
 		return errors.InternalServerError("chat.new", "error creating chat group")
 	}
 
+	if err := addMembers(tenantId, groupId, group.UserIds...); err != nil {
+		logger.Errorf("Error indexing members. Group ID: %v. Error: %v", groupId, err)
+		return errors.InternalServerError("chat.new", "error creating chat group")
+	}
+
 	// return the group
 	rsp.Group = group
 
@@ -81,6 +115,14 @@ func (c *Chat) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.Delete
 	if err != nil {
 		return errors.InternalServerError("chat.delete", "error reading chat group")
 	}
+
+	migrateOwner(tenantId, group)
+
+	// only the owner can delete an owned group
+	if err := authorize("chat.delete", group, req.ActorId, roleOwner); err != nil {
+		return err
+	}
+
 	// set response
 	rsp.Group = group
 
@@ -89,21 +131,54 @@ func (c *Chat) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.Delete
 		return errors.InternalServerError("chat.delete", "error deleting chat group")
 	}
 
+	if err := removeMembers(tenantId, req.GroupId, group.UserIds...); err != nil {
+		logger.Errorf("Error deleting members. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.delete", "error deleting chat group")
+	}
+
 	// get all messages
 	// TODO: paginate the list
 	key = path.Join(messageStoreKeyPrefix, tenantId, req.GroupId)
-	srecs, err := store.List(store.ListPrefix(key))
-	if err != nil {
+	srecs, err := store.Read(key+"/", store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
 		return errors.InternalServerError("chat.delete", "failed to list messages")
 	}
 
+	var msgs []*pb.Message
+	for _, rec := range srecs {
+		msg := new(pb.Message)
+		if err := rec.Decode(msg); err != nil {
+			return errors.InternalServerError("chat.delete", "failed to decode message")
+		}
+		msgs = append(msgs, msg)
+	}
+
+	// delete the timeline and search index
+	if err := deleteIndex(tenantId, req.GroupId, msgs); err != nil {
+		logger.Errorf("Error deleting message index. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.delete", "failed to delete messages")
+	}
+
 	// delete all the messages
 	for _, rec := range srecs {
-		if err := store.Delete(rec); err != nil {
+		if err := store.Delete(rec.Key); err != nil {
 			return errors.InternalServerError("chat.delete", "failed to list messages")
 		}
 	}
 
+	// delete the read cursors, presence and moderation
+	for _, prefix := range []string{readStoreKeyPrefix, presenceStoreKeyPrefix, muteStoreKeyPrefix, banStoreKeyPrefix, slowModeStoreKeyPrefix} {
+		keys, err := store.List(store.ListPrefix(path.Join(prefix, tenantId, req.GroupId) + "/"))
+		if err != nil {
+			return errors.InternalServerError("chat.delete", "failed to list read cursors")
+		}
+		for _, key := range keys {
+			if err := store.Delete(key); err != nil {
+				return errors.InternalServerError("chat.delete", "failed to delete read cursors")
+			}
+		}
+	}
+
 	// TODO: notify users of the event that the group is deleted
 
 	return nil
@@ -137,6 +212,12 @@ func (c *Chat) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListRespon
 		// check if there's a user id match
 		for _, user := range group.UserIds {
 			if user == req.UserId {
+				count, err := unread(tenantId, group.Id, req.UserId)
+				if err != nil {
+					logger.Errorf("Error counting unread messages. Group ID: %v. Error: %v", group.Id, err)
+					return errors.InternalServerError("chat.list", "error listing chat groups")
+				}
+				group.Unread = count
 				rsp.Groups = append(rsp.Groups, group)
 				break
 			}
@@ -166,22 +247,18 @@ func (c *Chat) History(ctx context.Context, req *pb.HistoryRequest, rsp *pb.Hist
 		return errors.InternalServerError("chat.history", "error reading chat group")
 	}
 
-	// lookup the messages
-	key = path.Join(messageStoreKeyPrefix, tenantId, req.GroupId)
-	recs, err := store.Read(key+"/", store.ReadPrefix())
+	// lookup a page of messages
+	msgs, more, err := history(tenantId, req)
 	if err != nil {
+		if _, ok := err.(*errors.Error); ok {
+			return err
+		}
 		logger.Errorf("Error reading messages the store. Group ID: %v. Error: %v", req.GroupId, err)
 		return errors.InternalServerError("chat.history", "failed to read messages")
 	}
 
-	for _, rec := range recs {
-		msg := new(pb.Message)
-		err := rec.Decode(msg)
-		if err != nil {
-			return errors.InternalServerError("chat.history", "failed to decode message")
-		}
-		rsp.Messages = append(rsp.Messages, msg)
-	}
+	rsp.Messages = msgs
+	rsp.More = more
 
 	return nil
 }
@@ -217,6 +294,26 @@ func (c *Chat) Invite(ctx context.Context, req *pb.InviteRequest, rsp *pb.Invite
 		return errors.InternalServerError("chat.invite", "Error reading group")
 	}
 
+	migrateOwner(tenantId, group)
+
+	// members can invite to public groups and admins to private ones
+	role := roleMember
+	if group.Private {
+		role = roleAdmin
+	}
+	if err := authorize("chat.invite", group, req.ActorId, role); err != nil {
+		return err
+	}
+
+	banned, err := restricted(banStoreKeyPrefix, tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		logger.Errorf("Error reading ban. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.invite", "Error reading group")
+	}
+	if banned {
+		return errors.Forbidden("chat.invite", "user is banned from the group")
+	}
+
 	var exists bool
 
 	// check the user is in the group
@@ -230,11 +327,16 @@ func (c *Chat) Invite(ctx context.Context, req *pb.InviteRequest, rsp *pb.Invite
 	// TODO: send join message
 	if !exists {
 		group.UserIds = append(group.UserIds, req.UserId)
+		// the first to join a group nobody is in owns it
+		ensureOwner(group)
 		// write the record
 		rec := store.NewRecord(key, group)
 		if err := store.Write(rec); err != nil {
 			return errors.InternalServerError("chat.invite", "Error adding user to group")
 		}
+		if err := addMembers(tenantId, req.GroupId, req.UserId); err != nil {
+			return errors.InternalServerError("chat.invite", "Error adding user to group")
+		}
 	}
 
 	rsp.Group = group
@@ -277,6 +379,8 @@ func (c *Chat) Send(ctx context.Context, req *pb.SendRequest, rsp *pb.SendRespon
 		return errors.InternalServerError("chat.send", "error reading chat group")
 	}
 
+	migrateOwner(tenantId, group)
+
 	var exists bool
 
 	// check the user is in the group
@@ -291,6 +395,22 @@ func (c *Chat) Send(ctx context.Context, req *pb.SendRequest, rsp *pb.SendRespon
 		return errors.BadRequest("chat.send", "user is not in the group")
 	}
 
+	// check the user can send right now
+	if err := checkSend(tenantId, group, req.UserId); err != nil {
+		return err
+	}
+
+	// check the message being replied to is in the group
+	if len(req.ReplyTo) > 0 {
+		if _, err := readMessage(tenantId, req.GroupId, req.ReplyTo); err != nil {
+			return errors.BadRequest("chat.send", "reply_to message not found")
+		}
+	}
+
+	if err := c.moderate(ctx, "chat.send", group, req.Subject, req.Text); err != nil {
+		return err
+	}
+
 	// construct the message
 	msg := &pb.Message{
 		Id:      uuid.New().String(),
@@ -300,6 +420,7 @@ func (c *Chat) Send(ctx context.Context, req *pb.SendRequest, rsp *pb.SendRespon
 		Subject: req.Subject,
 		Text:    req.Text,
 		SentAt:  time.Now().Format(time.RFC3339Nano),
+		ReplyTo: req.ReplyTo,
 	}
 
 	// default the client id if not provided
@@ -348,6 +469,8 @@ func (c *Chat) Join(ctx context.Context, req *pb.JoinRequest, stream pb.Chat_Joi
 		return errors.InternalServerError("chat.join", "Error reading group")
 	}
 
+	migrateOwner(tenantId, group)
+
 	var exists bool
 
 	// check the user is in the group
@@ -360,12 +483,31 @@ func (c *Chat) Join(ctx context.Context, req *pb.JoinRequest, stream pb.Chat_Joi
 
 	// TODO: send join message
 	if !exists {
+		// private groups must be joined by invite
+		if group.Private && owned(group) {
+			return errors.Forbidden("chat.join", "user is not in the group")
+		}
+
+		banned, err := restricted(banStoreKeyPrefix, tenantId, req.GroupId, req.UserId)
+		if err != nil {
+			logger.Errorf("Error reading ban. Group ID: %v. Error: %v", req.GroupId, err)
+			return errors.InternalServerError("chat.join", "Error reading group")
+		}
+		if banned {
+			return errors.Forbidden("chat.join", "user is banned from the group")
+		}
+
 		group.UserIds = append(group.UserIds, req.UserId)
+		// the first to join a group nobody is in owns it
+		ensureOwner(group)
 		// write the record
 		rec := store.NewRecord(key, group)
 		if err := store.Write(rec); err != nil {
 			return errors.InternalServerError("chat.join", "Error adding user to group")
 		}
+		if err := addMembers(tenantId, req.GroupId, req.UserId); err != nil {
+			return errors.InternalServerError("chat.join", "Error adding user to group")
+		}
 	}
 
 	// create a channel to send errors on, because the subscriber / publisher will run in seperate go-
@@ -382,12 +524,37 @@ func (c *Chat) Join(ctx context.Context, req *pb.JoinRequest, stream pb.Chat_Joi
 		return errors.InternalServerError("chat.join", "Error joining the group")
 	}
 
+	// the user is online while joined
+	go presence(ctx, tenantId, req.GroupId, req.UserId)
+
 	for {
 		select {
 		case <-ctx.Done():
 			// the context has been cancelled or timed out, stop subscribing to new messages
 			return nil
 		case ev := <-evStream:
+			typ := ev.Metadata["type"]
+			if len(typ) == 0 {
+				typ = eventMessage
+			}
+
+			// presence, typing and read events are about a member rather than a message
+			if typ == eventPresence || typ == eventTyping || typ == eventRead {
+				var rsp pb.JoinResponse
+				if err := ev.Unmarshal(&rsp); err != nil {
+					logger.Errorf("Error unmarshaling event. Group ID: %v. Error: %v", req.GroupId, err)
+					continue
+				}
+				if rsp.UserId == req.UserId {
+					continue
+				}
+				if err := stream.Send(&rsp); err != nil {
+					logger.Errorf("Error sending event to stream. Group ID: %v. Error: %v", req.GroupId, err)
+					return nil
+				}
+				continue
+			}
+
 			// recieved a message, unmarshal it into a message struct. if an error occurs log it and
 			// cancel the context
 			var msg pb.Message
@@ -397,13 +564,14 @@ func (c *Chat) Join(ctx context.Context, req *pb.JoinRequest, stream pb.Chat_Joi
 				return nil
 			}
 
-			// ignore any messages published by the current user
-			if msg.UserId == req.UserId {
+			// ignore any messages published by the current user, reactions
+			// are by other users to the message
+			if msg.UserId == req.UserId && typ != eventReaction {
 				continue
 			}
 
 			// publish the message to the stream
-			if err := stream.Send(&pb.JoinResponse{Message: &msg}); err != nil {
+			if err := stream.Send(&pb.JoinResponse{Message: &msg, Type: typ}); err != nil {
 				logger.Errorf("Error sending message to stream. ChatID: %v. Message ID: %v. Error: %v", msg.GroupId, msg.Id, err)
 				errChan <- err
 				return nil
@@ -444,22 +612,25 @@ func (c *Chat) Kick(ctx context.Context, req *pb.KickRequest, rsp *pb.KickRespon
 		return errors.InternalServerError("chat.kick", "Error reading group")
 	}
 
-	var users []string
+	migrateOwner(tenantId, group)
 
-	// check the user is in the group
-	for _, user := range group.UserIds {
-		if user == req.UserId {
-			continue
-		}
-		users = append(users, user)
+	// admins can kick members and the owner can kick admins
+	if err := authorizeOver("chat.kick", group, req.ActorId, req.UserId); err != nil {
+		return err
+	}
+	if roleOf(group, req.UserId) == roleOwner {
+		return errors.BadRequest("chat.kick", "the owner can't be kicked")
 	}
 
-	group.UserIds = users
+	removeUser(group, req.UserId)
 
 	rec := store.NewRecord(key, group)
 	if err := store.Write(rec); err != nil {
 		return errors.InternalServerError("chat.kick", "Error leaveing from group")
 	}
+	if err := removeMembers(tenantId, req.GroupId, req.UserId); err != nil {
+		return errors.InternalServerError("chat.kick", "Error leaveing from group")
+	}
 
 	// TODO: send leave message
 	// TODO: disconnect the actual event consumption
@@ -497,22 +668,22 @@ func (c *Chat) Leave(ctx context.Context, req *pb.LeaveRequest, rsp *pb.LeaveRes
 		return errors.InternalServerError("chat.leave", "Error reading group")
 	}
 
-	var users []string
+	migrateOwner(tenantId, group)
 
-	// check the user is in the group
-	for _, user := range group.UserIds {
-		if user == req.UserId {
-			continue
-		}
-		users = append(users, user)
+	// the owner has to hand over the group before leaving
+	if roleOf(group, req.UserId) == roleOwner && len(group.UserIds) > 1 {
+		return errors.BadRequest("chat.leave", "transfer ownership before leaving the group")
 	}
 
-	group.UserIds = users
+	removeUser(group, req.UserId)
 
 	rec := store.NewRecord(key, group)
 	if err := store.Write(rec); err != nil {
 		return errors.InternalServerError("chat.leave", "Error leaveing from group")
 	}
+	if err := removeMembers(tenantId, req.GroupId, req.UserId); err != nil {
+		return errors.InternalServerError("chat.leave", "Error leaveing from group")
+	}
 
 	// TODO: send leave message
 	// TODO: disconnect the actual event consumption
@@ -525,10 +696,14 @@ func (c *Chat) Leave(ctx context.Context, req *pb.LeaveRequest, rsp *pb.LeaveRes
 // logic for ensuring client id is unique.
 func (c *Chat) createMessage(tenantId string, msg *pb.Message) error {
 	storekey := path.Join(messageStoreKeyPrefix, tenantId, msg.GroupId, msg.Id)
-	eventKey := path.Join(chatEventKeyPrefix, tenantId, msg.GroupId)
+
+	// index the earlier messages before adding this one
+	if err := ensureTimeline(tenantId, msg.GroupId); err != nil {
+		return err
+	}
 
 	// send the message to the event stream
-	if err := events.Publish(eventKey, msg); err != nil {
+	if err := publishMessage(tenantId, msg, eventMessage); err != nil {
 		return err
 	}
 
@@ -536,5 +711,10 @@ func (c *Chat) createMessage(tenantId string, msg *pb.Message) error {
 	rec := store.NewRecord(storekey, msg)
 
 	// record the messages client id
-	return store.Write(rec)
+	if err := store.Write(rec); err != nil {
+		return err
+	}
+
+	// add to the timeline and search index
+	return indexMessage(tenantId, msg)
 }
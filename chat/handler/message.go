@@ -0,0 +1,331 @@
+package handler
+
+import (
+	"context"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/chat/proto"
+	"github.com/micro/services/pkg/tenant"
+)
+
+// types of events on the join stream
+const (
+	eventMessage  = "message"
+	eventEdit     = "edit"
+	eventDelete   = "delete"
+	eventReaction = "reaction"
+)
+
+const maxEmojiLength = 32
+
+// lookupGroup reads the group returning errors with the id
+func lookupGroup(id, tenantId, groupId string) (*pb.Group, error) {
+	key := path.Join(chatStoreKeyPrefix, tenantId, groupId)
+
+	recs, err := store.Read(key, store.ReadLimit(1))
+	if err == store.ErrNotFound {
+		return nil, errors.BadRequest(id, "group not found")
+	} else if err != nil {
+		logger.Errorf("Error reading from the store. Group ID: %v. Error: %v", groupId, err)
+		return nil, errors.InternalServerError(id, "error reading chat group")
+	}
+
+	group := new(pb.Group)
+	if err := recs[0].Decode(group); err != nil {
+		return nil, errors.InternalServerError(id, "error reading chat group")
+	}
+
+	migrateOwner(tenantId, group)
+
+	return group, nil
+}
+
+// readGroup looks up the group and checks the user is a member
+func readGroup(tenantId, groupId, userId string) (*pb.Group, error) {
+	group, err := lookupGroup("chat.message", tenantId, groupId)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range group.UserIds {
+		if user == userId {
+			return group, nil
+		}
+	}
+
+	return nil, errors.BadRequest("chat.message", "user is not in the group")
+}
+
+// readMessage looks up a message in the group
+func readMessage(tenantId, groupId, messageId string) (*pb.Message, error) {
+	key := path.Join(messageStoreKeyPrefix, tenantId, groupId, messageId)
+
+	recs, err := store.Read(key, store.ReadLimit(1))
+	if err == store.ErrNotFound {
+		return nil, errors.NotFound("chat.message", "message not found")
+	} else if err != nil {
+		logger.Errorf("Error reading from the store. Message ID: %v. Error: %v", messageId, err)
+		return nil, errors.InternalServerError("chat.message", "error reading message")
+	}
+
+	msg := new(pb.Message)
+	if err := recs[0].Decode(msg); err != nil {
+		return nil, errors.InternalServerError("chat.message", "error reading message")
+	}
+
+	return msg, nil
+}
+
+// updateMessage stores the message and notifies the members of the change
+func updateMessage(tenantId string, msg *pb.Message, typ string) error {
+	storeKey := path.Join(messageStoreKeyPrefix, tenantId, msg.GroupId, msg.Id)
+
+	if err := store.Write(store.NewRecord(storeKey, msg)); err != nil {
+		logger.Errorf("Error writing message %v: %v", msg.Id, err)
+		return errors.InternalServerError("chat.message", "error updating message")
+	}
+
+	// deleted messages aren't unread
+	if err := writeTimeline(tenantId, msg); err != nil {
+		logger.Errorf("Error updating the timeline of message %v: %v", msg.Id, err)
+	}
+
+	if err := publishMessage(tenantId, msg, typ); err != nil {
+		logger.Errorf("Error publishing %v of message %v: %v", typ, msg.Id, err)
+	}
+
+	return nil
+}
+
+// publishMessage sends the message to the group's event stream with the event type
+func publishMessage(tenantId string, msg *pb.Message, typ string) error {
+	eventKey := path.Join(chatEventKeyPrefix, tenantId, msg.GroupId)
+	return events.Publish(eventKey, msg, events.WithMetadata(map[string]string{"type": typ}))
+}
+
+func (c *Chat) EditMessage(ctx context.Context, req *pb.EditMessageRequest, rsp *pb.EditMessageResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.edit", "missing group id")
+	}
+	if len(req.MessageId) == 0 {
+		return errors.BadRequest("chat.edit", "missing message id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.edit", "missing user id")
+	}
+	if len(req.Text) == 0 {
+		return errors.BadRequest("chat.edit", "missing text")
+	}
+
+	group, err := readGroup(tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	msg, err := readMessage(tenantId, req.GroupId, req.MessageId)
+	if err != nil {
+		return err
+	}
+
+	// only the sender can edit a message
+	if msg.UserId != req.UserId {
+		return errors.Forbidden("chat.edit", "only the sender can edit the message")
+	}
+	if msg.Deleted {
+		return errors.BadRequest("chat.edit", "message was deleted")
+	}
+
+	muted, err := restricted(muteStoreKeyPrefix, tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		logger.Errorf("Error reading mute. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.edit", "error reading chat group")
+	}
+	if muted {
+		return errors.Forbidden("chat.edit", "user is muted")
+	}
+
+	if err := c.moderate(ctx, "chat.edit", group, msg.Subject, req.Text); err != nil {
+		return err
+	}
+
+	if err := unindexTerms(tenantId, msg); err != nil {
+		logger.Errorf("Error removing message %v from the index: %v", msg.Id, err)
+	}
+
+	msg.Text = req.Text
+	msg.EditedAt = time.Now().Format(time.RFC3339Nano)
+
+	if err := indexTerms(tenantId, msg); err != nil {
+		logger.Errorf("Error indexing message %v: %v", msg.Id, err)
+	}
+
+	if err := updateMessage(tenantId, msg, eventEdit); err != nil {
+		return err
+	}
+
+	rsp.Message = msg
+
+	return nil
+}
+
+func (c *Chat) DeleteMessage(ctx context.Context, req *pb.DeleteMessageRequest, rsp *pb.DeleteMessageResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.deletemessage", "missing group id")
+	}
+	if len(req.MessageId) == 0 {
+		return errors.BadRequest("chat.deletemessage", "missing message id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.deletemessage", "missing user id")
+	}
+
+	group, err := readGroup(tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	msg, err := readMessage(tenantId, req.GroupId, req.MessageId)
+	if err != nil {
+		return err
+	}
+
+	// only the sender or an admin can delete a message
+	if msg.UserId != req.UserId && authorizeOver("chat.deletemessage", group, req.UserId, msg.UserId) != nil {
+		return errors.Forbidden("chat.deletemessage", "only the sender or an admin can delete the message")
+	}
+
+	if err := unindexTerms(tenantId, msg); err != nil {
+		logger.Errorf("Error removing message %v from the index: %v", msg.Id, err)
+	}
+
+	// keep a tombstone so replies still refer to the message
+	msg.Deleted = true
+	msg.Subject = ""
+	msg.Text = ""
+	msg.Reactions = nil
+
+	if err := updateMessage(tenantId, msg, eventDelete); err != nil {
+		return err
+	}
+
+	rsp.Message = msg
+
+	return nil
+}
+
+func (c *Chat) React(ctx context.Context, req *pb.ReactRequest, rsp *pb.ReactResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.react", "missing group id")
+	}
+	if len(req.MessageId) == 0 {
+		return errors.BadRequest("chat.react", "missing message id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.react", "missing user id")
+	}
+	if len(req.Emoji) == 0 || len(req.Emoji) > maxEmojiLength {
+		return errors.BadRequest("chat.react", "invalid emoji")
+	}
+
+	if _, err := readGroup(tenantId, req.GroupId, req.UserId); err != nil {
+		return err
+	}
+
+	msg, err := readMessage(tenantId, req.GroupId, req.MessageId)
+	if err != nil {
+		return err
+	}
+	if msg.Deleted {
+		return errors.BadRequest("chat.react", "message was deleted")
+	}
+
+	if !react(msg, req.UserId, req.Emoji, req.Remove) {
+		// nothing changed
+		rsp.Message = msg
+		return nil
+	}
+
+	if err := updateMessage(tenantId, msg, eventReaction); err != nil {
+		return err
+	}
+
+	rsp.Message = msg
+
+	return nil
+}
+
+// react adds or removes the user's reaction returning whether it changed
+func react(msg *pb.Message, userId, emoji string, remove bool) bool {
+	var reaction *pb.Reaction
+	for _, r := range msg.Reactions {
+		if r.Emoji == emoji {
+			reaction = r
+			break
+		}
+	}
+
+	if remove {
+		if reaction == nil {
+			return false
+		}
+
+		var users []string
+		for _, u := range reaction.UserIds {
+			if u != userId {
+				users = append(users, u)
+			}
+		}
+		if len(users) == len(reaction.UserIds) {
+			return false
+		}
+		reaction.UserIds = users
+		reaction.Count = int32(len(users))
+
+		// drop reactions no one has left
+		var reactions []*pb.Reaction
+		for _, r := range msg.Reactions {
+			if r.Count > 0 {
+				reactions = append(reactions, r)
+			}
+		}
+		msg.Reactions = reactions
+
+		return true
+	}
+
+	if reaction == nil {
+		reaction = &pb.Reaction{Emoji: emoji}
+		msg.Reactions = append(msg.Reactions, reaction)
+	}
+
+	for _, u := range reaction.UserIds {
+		if u == userId {
+			return false
+		}
+	}
+
+	reaction.UserIds = append(reaction.UserIds, userId)
+	reaction.Count = int32(len(reaction.UserIds))
+
+	// most popular first
+	sort.SliceStable(msg.Reactions, func(i, j int) bool {
+		return msg.Reactions[i].Count > msg.Reactions[j].Count
+	})
+
+	return true
+}
@@ -0,0 +1,120 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	pb "github.com/micro/services/chat/proto"
+)
+
+// reactions prints the reactions of a message e.g [+1 alice,bob 2]
+func reactions(msg *pb.Message) string {
+	var parts []string
+	for _, r := range msg.Reactions {
+		parts = append(parts, fmt.Sprintf("%s %s %d", r.Emoji, strings.Join(r.UserIds, ","), r.Count))
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestReact(t *testing.T) {
+	setup(t, "alice", "bob")
+	send(t, "m1", "alice", time.Now())
+
+	tcs := []struct {
+		name      string
+		userId    string
+		emoji     string
+		remove    bool
+		reactions string
+	}{
+		{"add", "alice", "+1", false, "[+1 alice 1]"},
+		{"dedupe", "alice", "+1", false, "[+1 alice 1]"},
+		{"another user", "bob", "+1", false, "[+1 alice,bob 2]"},
+		{"another emoji", "bob", "tada", false, "[+1 alice,bob 2 tada bob 1]"},
+		{"remove", "alice", "+1", true, "[+1 bob 1 tada bob 1]"},
+		{"remove again", "alice", "+1", true, "[+1 bob 1 tada bob 1]"},
+		{"remove missing emoji", "alice", "heart", true, "[+1 bob 1 tada bob 1]"},
+		{"remove last", "bob", "tada", true, "[+1 bob 1]"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &pb.ReactRequest{GroupId: "g", MessageId: "m1", UserId: tc.userId, Emoji: tc.emoji, Remove: tc.remove}
+			rsp := new(pb.ReactResponse)
+			if err := new(Chat).React(context.Background(), req, rsp); err != nil {
+				t.Fatal(err)
+			}
+			if got := reactions(rsp.Message); got != tc.reactions {
+				t.Errorf("got %v, want %v", got, tc.reactions)
+			}
+
+			// the reactions are stored
+			msg, err := readMessage("micro", "g", "m1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := reactions(msg); got != tc.reactions {
+				t.Errorf("stored %v, want %v", got, tc.reactions)
+			}
+		})
+	}
+
+	// deleted messages can't be reacted to
+	if err := new(Chat).DeleteMessage(context.Background(), &pb.DeleteMessageRequest{GroupId: "g", MessageId: "m1", UserId: "alice"}, &pb.DeleteMessageResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := new(Chat).React(context.Background(), &pb.ReactRequest{GroupId: "g", MessageId: "m1", UserId: "bob", Emoji: "+1"}, &pb.ReactResponse{}); err == nil {
+		t.Errorf("expected an error reacting to a deleted message")
+	}
+}
+
+func TestEditMessage(t *testing.T) {
+	setup(t, "alice", "bob")
+	send(t, "m1", "alice", time.Now())
+
+	search := func(query string) int {
+		rsp := new(pb.SearchResponse)
+		if err := new(Chat).Search(context.Background(), &pb.SearchRequest{UserId: "bob", Query: query}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		return len(rsp.Messages)
+	}
+
+	tcs := []struct {
+		name   string
+		userId string
+		text   string
+		err    bool
+		found  []string
+		gone   []string
+	}{
+		{"not the sender", "bob", "hijacked", true, []string{"message"}, []string{"hijacked"}},
+		{"reindexed", "alice", "edited text", false, []string{"edited", "text"}, []string{"message"}},
+		{"edited again", "alice", "final text", false, []string{"final", "text"}, []string{"edited"}},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			req := &pb.EditMessageRequest{GroupId: "g", MessageId: "m1", UserId: tc.userId, Text: tc.text}
+			rsp := new(pb.EditMessageResponse)
+			err := new(Chat).EditMessage(context.Background(), req, rsp)
+			if (err != nil) != tc.err {
+				t.Fatalf("err = %v, want error %v", err, tc.err)
+			}
+			if err == nil && (rsp.Message.Text != tc.text || len(rsp.Message.EditedAt) == 0) {
+				t.Errorf("got %q edited at %q, want %q", rsp.Message.Text, rsp.Message.EditedAt, tc.text)
+			}
+			for _, word := range tc.found {
+				if n := search(word); n != 1 {
+					t.Errorf("%q found %d messages, want 1", word, n)
+				}
+			}
+			for _, word := range tc.gone {
+				if n := search(word); n != 0 {
+					t.Errorf("%q found %d messages, want 0", word, n)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	aipb "github.com/micro/services/ai/proto"
+	pb "github.com/micro/services/chat/proto"
+	"github.com/micro/services/pkg/tenant"
+	spampb "github.com/micro/services/spam/proto"
+)
+
+const (
+	muteStoreKeyPrefix     = "mutes/"
+	banStoreKeyPrefix      = "bans/"
+	slowModeStoreKeyPrefix = "slowmode/"
+
+	// max seconds between messages in slow mode
+	maxSlowMode = 6 * 60 * 60
+)
+
+// roles of members in a group
+const (
+	roleOwner  = "owner"
+	roleAdmin  = "admin"
+	roleMember = "member"
+)
+
+// restriction is a mute or ban of a user in a group
+type restriction struct {
+	ActorId string
+	// RFC3339 time it ends, blank if it doesn't
+	Until string
+}
+
+// rank orders the roles so a higher role can moderate a lower one
+func rank(role string) int {
+	switch role {
+	case roleOwner:
+		return 3
+	case roleAdmin:
+		return 2
+	case roleMember:
+		return 1
+	}
+	return 0
+}
+
+// roleOf returns the role of the user, blank if they aren't in the group
+func roleOf(group *pb.Group, userId string) string {
+	if role, ok := group.Roles[userId]; ok {
+		return role
+	}
+	for _, user := range group.UserIds {
+		if user == userId {
+			return roleMember
+		}
+	}
+	return ""
+}
+
+// owned returns whether the group has an owner. Only a group without members
+// has none.
+func owned(group *pb.Group) bool {
+	for _, role := range group.Roles {
+		if role == roleOwner {
+			return true
+		}
+	}
+	return false
+}
+
+// ensureOwner makes the first member the owner of a group which has none,
+// e.g. one created before groups had owners. It returns whether it did.
+func ensureOwner(group *pb.Group) bool {
+	if owned(group) || len(group.UserIds) == 0 {
+		return false
+	}
+	if group.Roles == nil {
+		group.Roles = map[string]string{}
+	}
+	group.Roles[group.UserIds[0]] = roleOwner
+	return true
+}
+
+// migrateOwner stores the owner given to a group which had none
+func migrateOwner(tenantId string, group *pb.Group) {
+	if !ensureOwner(group) {
+		return
+	}
+	if err := writeGroup(tenantId, group); err != nil {
+		logger.Errorf("Error writing group owner. Group ID: %v. Error: %v", group.Id, err)
+	}
+}
+
+// authorize checks the actor has at least the role in the group
+func authorize(id string, group *pb.Group, actorId, role string) error {
+	// nobody is left to protect in a group without members
+	if len(group.UserIds) == 0 {
+		return nil
+	}
+	if len(actorId) == 0 {
+		return errors.BadRequest(id, "missing actor id")
+	}
+	if rank(roleOf(group, actorId)) < rank(role) {
+		return errors.Forbidden(id, "%s role required", role)
+	}
+	return nil
+}
+
+// authorizeOver checks the actor is an admin with a higher role than the user
+func authorizeOver(id string, group *pb.Group, actorId, userId string) error {
+	if err := authorize(id, group, actorId, roleAdmin); err != nil {
+		return err
+	}
+	if actorId == userId {
+		return nil
+	}
+	if rank(roleOf(group, actorId)) <= rank(roleOf(group, userId)) {
+		return errors.Forbidden(id, "can't moderate a user with the same or a higher role")
+	}
+	return nil
+}
+
+// writeGroup stores the group
+func writeGroup(tenantId string, group *pb.Group) error {
+	key := path.Join(chatStoreKeyPrefix, tenantId, group.Id)
+	return store.Write(store.NewRecord(key, group))
+}
+
+// removeUser removes the user and their role from the group
+func removeUser(group *pb.Group, userId string) {
+	var users []string
+	for _, user := range group.UserIds {
+		if user == userId {
+			continue
+		}
+		users = append(users, user)
+	}
+	group.UserIds = users
+	delete(group.Roles, userId)
+}
+
+// restrict records a mute or ban which expires after the duration in seconds, if any
+func restrict(prefix, tenantId, groupId, userId, actorId string, duration int64) error {
+	r := &restriction{ActorId: actorId}
+
+	var expiry time.Duration
+	if duration > 0 {
+		expiry = time.Duration(duration) * time.Second
+		r.Until = time.Now().Add(expiry).Format(time.RFC3339)
+	}
+
+	rec := store.NewRecord(path.Join(prefix, tenantId, groupId, userId), r)
+	rec.Expiry = expiry
+	return store.Write(rec)
+}
+
+// restricted returns whether the user is muted or banned
+func restricted(prefix, tenantId, groupId, userId string) (bool, error) {
+	_, err := store.Read(path.Join(prefix, tenantId, groupId, userId), store.ReadLimit(1))
+	if err == store.ErrNotFound {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// checkSend enforces mutes and slow mode before a member sends a message
+func checkSend(tenantId string, group *pb.Group, userId string) error {
+	muted, err := restricted(muteStoreKeyPrefix, tenantId, group.Id, userId)
+	if err != nil {
+		logger.Errorf("Error reading mute. Group ID: %v. Error: %v", group.Id, err)
+		return errors.InternalServerError("chat.send", "error reading chat group")
+	}
+	if muted {
+		return errors.Forbidden("chat.send", "user is muted")
+	}
+
+	// admins aren't slowed down
+	if group.SlowMode <= 0 || rank(roleOf(group, userId)) >= rank(roleAdmin) {
+		return nil
+	}
+
+	key := path.Join(slowModeStoreKeyPrefix, tenantId, group.Id, userId)
+	if _, err := store.Read(key, store.ReadLimit(1)); err == nil {
+		return errors.New("chat.send", fmt.Sprintf("slow mode is on, wait %d seconds between messages", group.SlowMode), 429)
+	} else if err != store.ErrNotFound {
+		logger.Errorf("Error reading slow mode. Group ID: %v. Error: %v", group.Id, err)
+		return errors.InternalServerError("chat.send", "error reading chat group")
+	}
+
+	rec := &store.Record{Key: key, Expiry: time.Duration(group.SlowMode) * time.Second}
+	if err := store.Write(rec); err != nil {
+		logger.Errorf("Error writing slow mode. Group ID: %v. Error: %v", group.Id, err)
+	}
+
+	return nil
+}
+
+// moderate checks the text with the spam and ai services for moderated groups. Messages
+// are allowed through if the services can't be reached
+func (c *Chat) moderate(ctx context.Context, id string, group *pb.Group, subject, text string) error {
+	if !group.Moderated {
+		return nil
+	}
+
+	spam, err := c.spam.Classify(ctx, &spampb.ClassifyRequest{
+		Subject:  subject,
+		TextBody: text,
+	})
+	if err != nil {
+		logger.Errorf("Error classifying message. Group ID: %v. Error: %v", group.Id, err)
+	} else if spam.IsSpam {
+		return errors.BadRequest(id, "message rejected as spam")
+	}
+
+	mod, err := c.ai.Moderate(ctx, &aipb.ModerateRequest{Text: subject + "\n" + text})
+	if err != nil {
+		logger.Errorf("Error moderating message. Group ID: %v. Error: %v", group.Id, err)
+	} else if mod.Flagged {
+		return errors.BadRequest(id, "message rejected by moderation")
+	}
+
+	return nil
+}
+
+func (c *Chat) Update(ctx context.Context, req *pb.UpdateRequest, rsp *pb.UpdateResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.update", "missing group id")
+	}
+	if req.SlowMode < 0 || req.SlowMode > maxSlowMode {
+		return errors.BadRequest("chat.update", "slow mode must be between 0 and %d seconds", maxSlowMode)
+	}
+
+	group, err := lookupGroup("chat.update", tenantId, req.GroupId)
+	if err != nil {
+		return err
+	}
+	if err := authorize("chat.update", group, req.ActorId, roleAdmin); err != nil {
+		return err
+	}
+
+	if len(req.Name) > 0 {
+		group.Name = req.Name
+	}
+	if len(req.Description) > 0 {
+		group.Description = req.Description
+	}
+	group.Private = req.Private
+	group.SlowMode = req.SlowMode
+	group.Moderated = req.Moderated
+
+	if err := writeGroup(tenantId, group); err != nil {
+		logger.Errorf("Error writing group. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.update", "error updating chat group")
+	}
+
+	rsp.Group = group
+
+	return nil
+}
+
+func (c *Chat) SetRole(ctx context.Context, req *pb.SetRoleRequest, rsp *pb.SetRoleResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.setrole", "missing group id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.setrole", "missing user id")
+	}
+	if rank(req.Role) == 0 {
+		return errors.BadRequest("chat.setrole", "role must be owner, admin or member")
+	}
+
+	group, err := readGroup(tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		return err
+	}
+
+	if len(req.ActorId) == 0 {
+		return errors.BadRequest("chat.setrole", "missing actor id")
+	}
+	if roleOf(group, req.ActorId) != roleOwner {
+		return errors.Forbidden("chat.setrole", "only the owner can set roles")
+	}
+	if req.ActorId == req.UserId {
+		return errors.BadRequest("chat.setrole", "the owner can't change their own role")
+	}
+
+	if group.Roles == nil {
+		group.Roles = map[string]string{}
+	}
+
+	switch req.Role {
+	case roleOwner:
+		// transfer ownership, the previous owner stays an admin
+		group.Roles[req.ActorId] = roleAdmin
+		group.Roles[req.UserId] = roleOwner
+	case roleAdmin:
+		group.Roles[req.UserId] = roleAdmin
+	default:
+		delete(group.Roles, req.UserId)
+	}
+
+	if err := writeGroup(tenantId, group); err != nil {
+		logger.Errorf("Error writing group. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.setrole", "error updating chat group")
+	}
+
+	rsp.Group = group
+
+	return nil
+}
+
+func (c *Chat) Mute(ctx context.Context, req *pb.MuteRequest, rsp *pb.MuteResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.mute", "missing group id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.mute", "missing user id")
+	}
+	if req.Duration < 0 {
+		return errors.BadRequest("chat.mute", "invalid duration")
+	}
+
+	group, err := readGroup(tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		return err
+	}
+	if err := authorizeOver("chat.mute", group, req.ActorId, req.UserId); err != nil {
+		return err
+	}
+
+	if req.Remove {
+		key := path.Join(muteStoreKeyPrefix, tenantId, req.GroupId, req.UserId)
+		if err := store.Delete(key); err != nil && err != store.ErrNotFound {
+			logger.Errorf("Error deleting mute. Group ID: %v. Error: %v", req.GroupId, err)
+			return errors.InternalServerError("chat.mute", "error unmuting user")
+		}
+		return nil
+	}
+
+	if err := restrict(muteStoreKeyPrefix, tenantId, req.GroupId, req.UserId, req.ActorId, req.Duration); err != nil {
+		logger.Errorf("Error writing mute. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.mute", "error muting user")
+	}
+
+	return nil
+}
+
+func (c *Chat) Ban(ctx context.Context, req *pb.BanRequest, rsp *pb.BanResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.ban", "missing group id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.ban", "missing user id")
+	}
+	if req.Duration < 0 {
+		return errors.BadRequest("chat.ban", "invalid duration")
+	}
+
+	group, err := lookupGroup("chat.ban", tenantId, req.GroupId)
+	if err != nil {
+		return err
+	}
+	if err := authorizeOver("chat.ban", group, req.ActorId, req.UserId); err != nil {
+		return err
+	}
+	if req.ActorId == req.UserId {
+		return errors.BadRequest("chat.ban", "can't ban yourself")
+	}
+
+	rsp.Group = group
+
+	if req.Remove {
+		key := path.Join(banStoreKeyPrefix, tenantId, req.GroupId, req.UserId)
+		if err := store.Delete(key); err != nil && err != store.ErrNotFound {
+			logger.Errorf("Error deleting ban. Group ID: %v. Error: %v", req.GroupId, err)
+			return errors.InternalServerError("chat.ban", "error unbanning user")
+		}
+		return nil
+	}
+
+	if err := restrict(banStoreKeyPrefix, tenantId, req.GroupId, req.UserId, req.ActorId, req.Duration); err != nil {
+		logger.Errorf("Error writing ban. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.ban", "error banning user")
+	}
+
+	// banned users are removed from the group
+	if len(roleOf(group, req.UserId)) > 0 {
+		removeUser(group, req.UserId)
+		if err := writeGroup(tenantId, group); err != nil {
+			logger.Errorf("Error writing group. Group ID: %v. Error: %v", req.GroupId, err)
+			return errors.InternalServerError("chat.ban", "error removing user from group")
+		}
+		if err := removeMembers(tenantId, req.GroupId, req.UserId); err != nil {
+			logger.Errorf("Error removing member. Group ID: %v. Error: %v", req.GroupId, err)
+			return errors.InternalServerError("chat.ban", "error removing user from group")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/micro/services/chat/proto"
+)
+
+func TestRank(t *testing.T) {
+	tcs := []struct {
+		role string
+		rank int
+	}{
+		{roleOwner, 3},
+		{roleAdmin, 2},
+		{roleMember, 1},
+		{"", 0},
+		{"unknown", 0},
+	}
+	for _, tc := range tcs {
+		if got := rank(tc.role); got != tc.rank {
+			t.Errorf("rank(%q) = %d, want %d", tc.role, got, tc.rank)
+		}
+	}
+}
+
+func TestAuthorizeOver(t *testing.T) {
+	group := &pb.Group{
+		UserIds: []string{"owner", "admin", "admin2", "member"},
+		Roles:   map[string]string{"owner": roleOwner, "admin": roleAdmin, "admin2": roleAdmin},
+	}
+
+	tcs := []struct {
+		name    string
+		group   *pb.Group
+		actorId string
+		userId  string
+		ok      bool
+	}{
+		{"owner over admin", group, "owner", "admin", true},
+		{"owner over member", group, "owner", "member", true},
+		{"admin over member", group, "admin", "member", true},
+		{"admin over admin", group, "admin", "admin2", false},
+		{"admin over owner", group, "admin", "owner", false},
+		{"member over member", group, "member", "member2", false},
+		{"member over self", group, "member", "member", false},
+		{"admin over self", group, "admin", "admin", true},
+		{"outsider", group, "stranger", "member", false},
+		{"missing actor", group, "", "member", false},
+		{"empty group", &pb.Group{}, "", "member", false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := authorizeOver("chat.test", tc.group, tc.actorId, tc.userId)
+			if (err == nil) != tc.ok {
+				t.Errorf("authorizeOver(%v, %v) = %v, want ok %v", tc.actorId, tc.userId, err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestUnownedGroup(t *testing.T) {
+	// a group stored before groups had owners
+	setup(t, "alice", "bob", "carol")
+	c := new(Chat)
+	ctx := context.Background()
+
+	// a plain member can't kick or make themselves owner
+	if err := c.Kick(ctx, &pb.KickRequest{GroupId: "g", UserId: "carol", ActorId: "bob"}, &pb.KickResponse{}); err == nil {
+		t.Error("member kicked a member of an unowned group")
+	}
+	if err := c.SetRole(ctx, &pb.SetRoleRequest{GroupId: "g", UserId: "bob", Role: roleOwner, ActorId: "bob"}, &pb.SetRoleResponse{}); err == nil {
+		t.Error("member made themselves owner of an unowned group")
+	}
+	if err := c.SetRole(ctx, &pb.SetRoleRequest{GroupId: "g", UserId: "bob", Role: roleOwner}, &pb.SetRoleResponse{}); err == nil {
+		t.Error("owner set without an actor")
+	}
+
+	// the first member became the owner and can moderate
+	group, err := lookupGroup("chat.test", "micro", "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role := roleOf(group, "alice"); role != roleOwner {
+		t.Fatalf("first member has role %q, want owner", role)
+	}
+	if err := c.Kick(ctx, &pb.KickRequest{GroupId: "g", UserId: "carol", ActorId: "alice"}, &pb.KickResponse{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestEnsureOwner(t *testing.T) {
+	tcs := []struct {
+		name    string
+		group   *pb.Group
+		changed bool
+		owner   string
+	}{
+		{"no members", &pb.Group{}, false, ""},
+		{"first member", &pb.Group{UserIds: []string{"a", "b"}}, true, "a"},
+		{"owned", &pb.Group{UserIds: []string{"a", "b"}, Roles: map[string]string{"b": roleOwner}}, false, "b"},
+		{"admin only", &pb.Group{UserIds: []string{"a", "b"}, Roles: map[string]string{"b": roleAdmin}}, true, "a"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if changed := ensureOwner(tc.group); changed != tc.changed {
+				t.Errorf("changed = %v, want %v", changed, tc.changed)
+			}
+			if len(tc.owner) > 0 && roleOf(tc.group, tc.owner) != roleOwner {
+				t.Errorf("owner = %v, roles %v", tc.owner, tc.group.Roles)
+			}
+		})
+	}
+}
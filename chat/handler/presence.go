@@ -0,0 +1,315 @@
+package handler
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/chat/proto"
+	"github.com/micro/services/pkg/tenant"
+)
+
+const (
+	presenceStoreKeyPrefix = "presence/"
+	readStoreKeyPrefix     = "reads/"
+
+	// joined users are online while their presence record is refreshed
+	presenceExpiry   = time.Minute
+	presenceInterval = presenceExpiry / 2
+
+	// unread counts stop at
+	maxUnread = 1000
+)
+
+// types of ephemeral events on the join stream
+const (
+	eventPresence = "presence"
+	eventTyping   = "typing"
+	eventRead     = "read"
+)
+
+// cursor is the last message read by a user in a group
+type cursor struct {
+	MessageId string
+	SentAt    string
+}
+
+// sentAt parses the RFC3339 time a message was sent
+func sentAt(t string) time.Time {
+	v, _ := time.Parse(time.RFC3339Nano, t)
+	return v
+}
+
+// publishEvent sends an event about a member to the group which isn't stored
+func publishEvent(tenantId, groupId string, ev *pb.JoinResponse) error {
+	eventKey := path.Join(chatEventKeyPrefix, tenantId, groupId)
+	return events.Publish(eventKey, ev, events.WithMetadata(map[string]string{"type": ev.Type}))
+}
+
+func presenceKey(tenantId, groupId, userId, joinId string) string {
+	return path.Join(presenceStoreKeyPrefix, tenantId, groupId, userId, joinId)
+}
+
+// online records the join as online until the presence expires
+func online(tenantId, groupId, userId, joinId string) error {
+	rec := store.NewRecord(presenceKey(tenantId, groupId, userId, joinId), time.Now().Format(time.RFC3339Nano))
+	rec.Expiry = presenceExpiry
+	return store.Write(rec)
+}
+
+// joined returns whether the user is joined on any stream
+func joined(tenantId, groupId, userId string) (bool, error) {
+	keys, err := store.List(store.ListPrefix(presenceKey(tenantId, groupId, userId, "")+"/"), store.ListLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return len(keys) > 0, nil
+}
+
+// presence keeps the user online while they're joined and notifies the group when they come and go.
+// A user can be joined on several streams at once and is online until the last one ends.
+func presence(ctx context.Context, tenantId, groupId, userId string) {
+	joinId := uuid.New().String()
+
+	if err := online(tenantId, groupId, userId, joinId); err != nil {
+		logger.Errorf("Error recording presence. Group ID: %v. Error: %v", groupId, err)
+	}
+	if err := publishEvent(tenantId, groupId, &pb.JoinResponse{Type: eventPresence, UserId: userId, Online: true}); err != nil {
+		logger.Errorf("Error publishing presence. Group ID: %v. Error: %v", groupId, err)
+	}
+
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			store.Delete(presenceKey(tenantId, groupId, userId, joinId))
+			if ok, err := joined(tenantId, groupId, userId); err != nil || ok {
+				return
+			}
+			if err := publishEvent(tenantId, groupId, &pb.JoinResponse{Type: eventPresence, UserId: userId}); err != nil {
+				logger.Errorf("Error publishing presence. Group ID: %v. Error: %v", groupId, err)
+			}
+			return
+		case <-ticker.C:
+			if err := online(tenantId, groupId, userId, joinId); err != nil {
+				logger.Errorf("Error recording presence. Group ID: %v. Error: %v", groupId, err)
+			}
+		}
+	}
+}
+
+// readCursor returns the last message read by the user, nil if they haven't read any
+func readCursor(tenantId, groupId, userId string) (*cursor, error) {
+	key := path.Join(readStoreKeyPrefix, tenantId, groupId, userId)
+
+	recs, err := store.Read(key, store.ReadLimit(1))
+	if err == store.ErrNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	cur := new(cursor)
+	if err := recs[0].Decode(cur); err != nil {
+		return nil, err
+	}
+	return cur, nil
+}
+
+// unread counts the messages by other users sent after the user's read cursor.
+// The timeline is read back from the latest message so only unread messages
+// are visited, up to maxUnread of them, and its entries say who sent them.
+func unread(tenantId, groupId, userId string) (int64, error) {
+	cur, err := readCursor(tenantId, groupId, userId)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := ensureTimeline(tenantId, groupId); err != nil {
+		return 0, err
+	}
+
+	var after string
+	if cur != nil {
+		after = timelineKey(tenantId, &pb.Message{GroupId: groupId, Id: cur.MessageId, SentAt: cur.SentAt})
+	}
+
+	prefix := path.Join(timelineStoreKeyPrefix, tenantId, groupId) + "/"
+
+	var count int64
+	for offset := uint(0); ; offset += timelinePage {
+		recs, err := store.Read(prefix,
+			store.ReadPrefix(),
+			store.ReadOrder(store.OrderDesc),
+			store.ReadLimit(timelinePage),
+			store.ReadOffset(offset),
+		)
+		if err == store.ErrNotFound {
+			return count, nil
+		} else if err != nil {
+			return 0, err
+		}
+
+		for _, rec := range recs {
+			if rec.Key <= after || count == maxUnread {
+				return count, nil
+			}
+
+			entry, err := readEntry(tenantId, groupId, rec)
+			if err != nil {
+				// deleted along with the group
+				continue
+			}
+			if entry.UserId == userId || entry.Deleted {
+				continue
+			}
+			count++
+		}
+
+		if len(recs) < timelinePage {
+			return count, nil
+		}
+	}
+}
+
+// readEntry decodes the timeline entry of a message, filling in the entries
+// written before they had the sender from the message
+func readEntry(tenantId, groupId string, rec *store.Record) (*timelineEntry, error) {
+	entry := new(timelineEntry)
+	if len(rec.Value) > 0 {
+		return entry, rec.Decode(entry)
+	}
+
+	msg, err := readMessage(tenantId, groupId, rec.Key[strings.LastIndex(rec.Key, "/")+1:])
+	if err != nil {
+		return nil, err
+	}
+	if err := writeTimeline(tenantId, msg); err != nil {
+		return nil, err
+	}
+	return &timelineEntry{UserId: msg.UserId, Deleted: msg.Deleted}, nil
+}
+
+func (c *Chat) Typing(ctx context.Context, req *pb.TypingRequest, rsp *pb.TypingResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.typing", "missing group id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.typing", "missing user id")
+	}
+
+	if _, err := readGroup(tenantId, req.GroupId, req.UserId); err != nil {
+		return err
+	}
+
+	if err := publishEvent(tenantId, req.GroupId, &pb.JoinResponse{
+		Type:   eventTyping,
+		UserId: req.UserId,
+		Typing: req.Typing,
+	}); err != nil {
+		logger.Errorf("Error publishing typing. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.typing", "error notifying group")
+	}
+
+	return nil
+}
+
+func (c *Chat) MarkRead(ctx context.Context, req *pb.MarkReadRequest, rsp *pb.MarkReadResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.markread", "missing group id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.markread", "missing user id")
+	}
+	if len(req.MessageId) == 0 {
+		return errors.BadRequest("chat.markread", "missing message id")
+	}
+
+	if _, err := readGroup(tenantId, req.GroupId, req.UserId); err != nil {
+		return err
+	}
+
+	msg, err := readMessage(tenantId, req.GroupId, req.MessageId)
+	if err != nil {
+		return err
+	}
+
+	cur, err := readCursor(tenantId, req.GroupId, req.UserId)
+	if err != nil {
+		logger.Errorf("Error reading read cursor. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.markread", "error reading read cursor")
+	}
+
+	// the cursor only moves forward
+	if cur != nil && !sentAt(msg.SentAt).After(sentAt(cur.SentAt)) {
+		return nil
+	}
+
+	key := path.Join(readStoreKeyPrefix, tenantId, req.GroupId, req.UserId)
+	if err := store.Write(store.NewRecord(key, &cursor{MessageId: msg.Id, SentAt: msg.SentAt})); err != nil {
+		logger.Errorf("Error writing read cursor. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.markread", "error marking read")
+	}
+
+	// let the group know for read receipts
+	if err := publishEvent(tenantId, req.GroupId, &pb.JoinResponse{
+		Type:      eventRead,
+		UserId:    req.UserId,
+		MessageId: msg.Id,
+	}); err != nil {
+		logger.Errorf("Error publishing read. Group ID: %v. Error: %v", req.GroupId, err)
+	}
+
+	return nil
+}
+
+func (c *Chat) Presence(ctx context.Context, req *pb.PresenceRequest, rsp *pb.PresenceResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.GroupId) == 0 {
+		return errors.BadRequest("chat.presence", "missing group id")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.presence", "missing user id")
+	}
+
+	if _, err := readGroup(tenantId, req.GroupId, req.UserId); err != nil {
+		return err
+	}
+
+	key := path.Join(presenceStoreKeyPrefix, tenantId, req.GroupId) + "/"
+
+	keys, err := store.List(store.ListPrefix(key))
+	if err != nil {
+		logger.Errorf("Error listing presence. Group ID: %v. Error: %v", req.GroupId, err)
+		return errors.InternalServerError("chat.presence", "error reading presence")
+	}
+
+	// keys are per join stream, after the user id
+	seen := map[string]bool{}
+	for _, k := range keys {
+		userId := strings.SplitN(strings.TrimPrefix(k, key), "/", 2)[0]
+		if seen[userId] {
+			continue
+		}
+		seen[userId] = true
+		rsp.UserIds = append(rsp.UserIds, userId)
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/events/stream/memory"
+	"github.com/micro/micro/v3/service/store"
+	smem "github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/chat/proto"
+)
+
+// setup stores a group of the users with no owner
+func setup(t *testing.T, userIds ...string) *pb.Group {
+	store.DefaultStore = smem.NewStore()
+	events.DefaultStream, _ = memory.NewStream()
+
+	group := &pb.Group{Id: "g", Name: "group", UserIds: userIds}
+	if err := store.Write(store.NewRecord(path.Join(chatStoreKeyPrefix, "micro", group.Id), group)); err != nil {
+		t.Fatal(err)
+	}
+	return group
+}
+
+// send stores a message sent by the user at the time
+func send(t *testing.T, id, userId string, at time.Time) *pb.Message {
+	msg := &pb.Message{Id: id, GroupId: "g", UserId: userId, Text: "message " + id, SentAt: at.Format(time.RFC3339Nano)}
+	if err := new(Chat).createMessage("micro", msg); err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func TestUnread(t *testing.T) {
+	setup(t, "alice", "bob")
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 250; i++ {
+		user := "alice"
+		if i%5 == 0 {
+			user = "bob"
+		}
+		send(t, fmt.Sprintf("m%03d", i), user, start.Add(time.Duration(i)*time.Second))
+	}
+
+	// deleted messages aren't counted
+	msg, _ := readMessage("micro", "g", "m249")
+	msg.Deleted = true
+	if err := updateMessage("micro", msg, eventDelete); err != nil {
+		t.Fatal(err)
+	}
+
+	// timeline entries from before they had the sender
+	for _, id := range []string{"m245", "m246"} {
+		msg, _ := readMessage("micro", "g", id)
+		store.Write(&store.Record{Key: timelineKey("micro", msg)})
+	}
+
+	tcs := []struct {
+		name   string
+		userId string
+		read   string
+		count  int64
+	}{
+		{name: "nothing read", userId: "bob", count: 199},
+		{name: "own messages", userId: "alice", count: 50},
+		{name: "read some", userId: "bob", read: "m239", count: 7},
+		{name: "read all", userId: "bob", read: "m248", count: 0},
+	}
+
+	for _, tc := range tcs {
+		store.Delete(path.Join(readStoreKeyPrefix, "micro", "g", tc.userId))
+		if len(tc.read) > 0 {
+			if err := new(Chat).MarkRead(context.Background(), &pb.MarkReadRequest{GroupId: "g", UserId: tc.userId, MessageId: tc.read}, &pb.MarkReadResponse{}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		count, err := unread("micro", "g", tc.userId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count != tc.count {
+			t.Fatalf("%s: expected %d unread, got %d", tc.name, tc.count, count)
+		}
+	}
+
+	// the entries are filled in once counted
+	recs, _ := store.Read(path.Join(timelineStoreKeyPrefix, "micro", "g")+"/", store.ReadPrefix())
+	for _, rec := range recs {
+		if len(rec.Value) == 0 {
+			t.Fatalf("timeline entry %v has no sender", rec.Key)
+		}
+	}
+}
+
+func TestPresence(t *testing.T) {
+	setup(t, "alice", "bob")
+
+	// alice is joined on two streams
+	first, cancelFirst := context.WithCancel(context.Background())
+	second, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	go presence(first, "micro", "g", "alice")
+	go presence(second, "micro", "g", "alice")
+
+	online := func() []string {
+		time.Sleep(50 * time.Millisecond)
+		rsp := new(pb.PresenceResponse)
+		if err := new(Chat).Presence(context.Background(), &pb.PresenceRequest{GroupId: "g", UserId: "bob"}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		return rsp.UserIds
+	}
+
+	if ids := online(); len(ids) != 1 || ids[0] != "alice" {
+		t.Fatalf("Expected alice online once, got %v", ids)
+	}
+
+	// closing one stream leaves her online
+	cancelFirst()
+	if ids := online(); len(ids) != 1 {
+		t.Fatalf("Expected alice to stay online, got %v", ids)
+	}
+
+	cancelSecond()
+	if ids := online(); len(ids) != 0 {
+		t.Fatalf("Expected nobody online, got %v", ids)
+	}
+
+	// only members can see who's online
+	if err := new(Chat).Presence(context.Background(), &pb.PresenceRequest{GroupId: "g", UserId: "eve"}, &pb.PresenceResponse{}); err == nil {
+		t.Fatal("Expected a non member to be refused")
+	}
+	if err := new(Chat).Presence(context.Background(), &pb.PresenceRequest{GroupId: "g"}, &pb.PresenceResponse{}); err == nil {
+		t.Fatal("Expected a missing user id to be refused")
+	}
+}
@@ -0,0 +1,529 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/chat/proto"
+	"github.com/micro/services/pkg/index"
+	"github.com/micro/services/pkg/tenant"
+)
+
+const (
+	// time ordered keys of the messages in a group
+	timelineStoreKeyPrefix = "timeline/"
+	// message ids by the words of their text, replaced by the search keys
+	indexStoreKeyPrefix = "index/"
+	// time ordered message ids by their group and the words of their text
+	searchStoreKeyPrefix = "search/"
+	// group ids by the users in them
+	memberStoreKeyPrefix = "members/"
+
+	// timeline keys listed at a time
+	timelinePage = 100
+	// search keys listed at a time
+	searchPage = 100
+
+	defaultHistoryLimit = 50
+	maxHistoryLimit     = 1000
+	defaultSearchLimit  = 25
+	maxSearchLimit      = 100
+)
+
+// timelineEntry is the sender of a message on the timeline so unread
+// messages can be counted without reading them
+type timelineEntry struct {
+	UserId  string
+	Deleted bool
+}
+
+func timelineKey(tenantId string, msg *pb.Message) string {
+	return fmt.Sprintf("%s%s/%s/%019d/%s", timelineStoreKeyPrefix, tenantId, msg.GroupId, sentAt(msg.SentAt).UnixNano(), msg.Id)
+}
+
+// indexKey is the key of a message in the index searches used to read
+func indexKey(tenantId, term, groupId, messageId string) string {
+	return path.Join(indexStoreKeyPrefix, tenantId, term, groupId, messageId)
+}
+
+func searchPrefix(tenantId, groupId, term string) string {
+	return path.Join(searchStoreKeyPrefix, tenantId, groupId, term) + "/"
+}
+
+// searchKey orders the group's messages with the term by when they were sent
+func searchKey(tenantId, term string, msg *pb.Message) string {
+	return fmt.Sprintf("%s%019d/%s", searchPrefix(tenantId, msg.GroupId, term), sentAt(msg.SentAt).UnixNano(), msg.Id)
+}
+
+func memberKey(tenantId, userId, groupId string) string {
+	return path.Join(memberStoreKeyPrefix, tenantId, userId, groupId)
+}
+
+// addMembers indexes the users as members of the group
+func addMembers(tenantId, groupId string, userIds ...string) error {
+	for _, userId := range userIds {
+		if err := store.Write(&store.Record{Key: memberKey(tenantId, userId, groupId)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeMembers removes the users from the group's members in the index
+func removeMembers(tenantId, groupId string, userIds ...string) error {
+	for _, userId := range userIds {
+		if err := store.Delete(memberKey(tenantId, userId, groupId)); err != nil && err != store.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureMembers indexes the members of the groups created before the index
+func ensureMembers(tenantId string) error {
+	// the marker is outside the prefix of the member keys
+	return index.Backfill(path.Join(memberStoreKeyPrefix, tenantId), func() error {
+		recs, err := store.Read(path.Join(chatStoreKeyPrefix, tenantId)+"/", store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		for _, rec := range recs {
+			group := new(pb.Group)
+			if err := rec.Decode(group); err != nil {
+				continue
+			}
+			if err := addMembers(tenantId, group.Id, group.UserIds...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// memberGroups returns the ids of the groups the user is in
+func memberGroups(tenantId, userId string) ([]string, error) {
+	if err := ensureMembers(tenantId); err != nil {
+		return nil, err
+	}
+
+	prefix := path.Join(memberStoreKeyPrefix, tenantId, userId) + "/"
+
+	keys, err := store.List(store.ListPrefix(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(keys))
+	for _, key := range keys {
+		ids = append(ids, strings.TrimPrefix(key, prefix))
+	}
+	return ids, nil
+}
+
+// indexMessage adds the message to the group's timeline and the search index
+func indexMessage(tenantId string, msg *pb.Message) error {
+	if err := writeTimeline(tenantId, msg); err != nil {
+		return err
+	}
+	return indexTerms(tenantId, msg)
+}
+
+// writeTimeline adds the message to the group's timeline or updates its entry
+func writeTimeline(tenantId string, msg *pb.Message) error {
+	return store.Write(store.NewRecord(timelineKey(tenantId, msg), &timelineEntry{UserId: msg.UserId, Deleted: msg.Deleted}))
+}
+
+func indexTerms(tenantId string, msg *pb.Message) error {
+	for _, term := range index.Terms(msg.Subject + " " + msg.Text) {
+		if err := store.Write(&store.Record{Key: searchKey(tenantId, term, msg)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindexTerms removes the message's current text from the search index
+func unindexTerms(tenantId string, msg *pb.Message) error {
+	// the message may still be in the index searches used to read
+	if err := ensureSearch(tenantId, msg.GroupId); err != nil {
+		return err
+	}
+
+	for _, term := range index.Terms(msg.Subject + " " + msg.Text) {
+		if err := store.Delete(searchKey(tenantId, term, msg)); err != nil && err != store.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureSearch indexes the group's messages by group and term, dropping
+// them from the index searches used to read which listed every group
+func ensureSearch(tenantId, groupId string) error {
+	// the marker is outside the prefix of the search keys
+	return index.Backfill(path.Join(searchStoreKeyPrefix, tenantId, groupId), func() error {
+		recs, err := store.Read(path.Join(messageStoreKeyPrefix, tenantId, groupId)+"/", store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		for _, rec := range recs {
+			msg := new(pb.Message)
+			if err := rec.Decode(msg); err != nil {
+				return err
+			}
+			for _, term := range index.Terms(msg.Subject + " " + msg.Text) {
+				if err := store.Delete(indexKey(tenantId, term, groupId, msg.Id)); err != nil && err != store.ErrNotFound {
+					return err
+				}
+			}
+			if msg.Deleted {
+				continue
+			}
+			if err := indexTerms(tenantId, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// searchGroup returns up to limit of the group's messages with every term
+// sent between the times, most recent first
+func searchGroup(tenantId, groupId string, words []string, from, to time.Time, senderId string, limit int) ([]*pb.Message, error) {
+	if err := ensureSearch(tenantId, groupId); err != nil {
+		return nil, err
+	}
+
+	prefix := searchPrefix(tenantId, groupId, words[0])
+
+	var ret []*pb.Message
+	for offset := uint(0); ; offset += searchPage {
+		keys, err := store.List(store.ListPrefix(prefix), store.ListOrder(store.OrderDesc), store.ListOffset(offset), store.ListLimit(searchPage))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range keys {
+			ref := strings.TrimPrefix(key, prefix)
+			parts := strings.SplitN(ref, "/", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			nanos, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			sent := time.Unix(0, nanos)
+			if !to.IsZero() && sent.After(to) {
+				continue
+			}
+			if !from.IsZero() && sent.Before(from) {
+				return ret, nil
+			}
+
+			// the message has the other terms at the same place in their keys
+			all := true
+			for _, word := range words[1:] {
+				if _, err := store.Read(searchPrefix(tenantId, groupId, word) + ref); err == store.ErrNotFound {
+					all = false
+					break
+				} else if err != nil {
+					return nil, err
+				}
+			}
+			if !all {
+				continue
+			}
+
+			msg, err := readMessage(tenantId, groupId, parts[1])
+			if err != nil || msg.Deleted {
+				continue
+			}
+			if len(senderId) > 0 && msg.UserId != senderId {
+				continue
+			}
+
+			ret = append(ret, msg)
+			if len(ret) == limit {
+				return ret, nil
+			}
+		}
+
+		if len(keys) < searchPage {
+			return ret, nil
+		}
+	}
+}
+
+// ensureTimeline indexes the messages sent before the group had a timeline
+func ensureTimeline(tenantId, groupId string) error {
+	// the marker is outside the prefix of the timeline keys
+	return index.Backfill(path.Join(timelineStoreKeyPrefix, tenantId, groupId), func() error {
+		recs, err := store.Read(path.Join(messageStoreKeyPrefix, tenantId, groupId)+"/", store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		for _, rec := range recs {
+			msg := new(pb.Message)
+			if err := rec.Decode(msg); err != nil {
+				return err
+			}
+			if err := indexMessage(tenantId, msg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// seek returns up to limit of the group's timeline keys after the key, or
+// before it when desc, nearest first. The store can't start listing from a
+// key so the keys are listed by the prefixes of the timestamps either side
+// of it, e.g. after 0123 come those starting 0124 to 0129, then 013 to 019,
+// then 02 to 09. An empty key starts from the first or last message.
+func seek(tenantId, groupId, key string, desc bool, limit int) ([]string, error) {
+	if err := ensureTimeline(tenantId, groupId); err != nil {
+		return nil, err
+	}
+
+	prefix := path.Join(timelineStoreKeyPrefix, tenantId, groupId) + "/"
+
+	order := store.OrderAsc
+	if desc {
+		order = store.OrderDesc
+	}
+	list := func(p string, n int) ([]string, error) {
+		return store.List(store.ListPrefix(p), store.ListOrder(order), store.ListLimit(uint(n)))
+	}
+
+	if len(key) == 0 {
+		return list(prefix, limit)
+	}
+
+	ts := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)[0]
+
+	// messages sent at the same time as the key are ordered by id
+	same, err := store.List(store.ListPrefix(prefix+ts+"/"), store.ListOrder(order))
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, k := range same {
+		if len(keys) < limit && ((desc && k < key) || (!desc && k > key)) {
+			keys = append(keys, k)
+		}
+	}
+
+	for i := len(ts) - 1; i >= 0 && len(keys) < limit; i-- {
+		for d := 1; d <= 9 && len(keys) < limit; d++ {
+			c := int(ts[i]-'0') + d
+			if desc {
+				c = int(ts[i]-'0') - d
+			}
+			if c < 0 || c > 9 {
+				break
+			}
+
+			found, err := list(prefix+ts[:i]+strconv.Itoa(c), limit-len(keys))
+			if err != nil {
+				return nil, err
+			}
+			keys = append(keys, found...)
+		}
+	}
+
+	return keys, nil
+}
+
+// deleteIndex removes the timeline and search index of the group's messages
+func deleteIndex(tenantId, groupId string, msgs []*pb.Message) error {
+	for _, msg := range msgs {
+		if err := store.Delete(timelineKey(tenantId, msg)); err != nil && err != store.ErrNotFound {
+			return err
+		}
+		if err := unindexTerms(tenantId, msg); err != nil {
+			return err
+		}
+	}
+	// unindexing moves the messages to the index by group first
+	for _, marker := range []string{path.Join(timelineStoreKeyPrefix, tenantId, groupId), path.Join(searchStoreKeyPrefix, tenantId, groupId)} {
+		if err := store.Delete(marker); err != nil && err != store.ErrNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+// history pages through the group's timeline returning the messages in the order sent
+func history(tenantId string, req *pb.HistoryRequest) ([]*pb.Message, bool, error) {
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	// the timeline key of a cursor message
+	position := func(id string) (string, error) {
+		msg, err := readMessage(tenantId, req.GroupId, id)
+		if err != nil {
+			return "", err
+		}
+		return timelineKey(tenantId, msg), nil
+	}
+
+	var keys []string
+	var more bool
+
+	// page forward from after, otherwise back from before or the latest message
+	if len(req.After) > 0 && len(req.Before) == 0 {
+		after, err := position(req.After)
+		if err != nil {
+			return nil, false, err
+		}
+		keys, err = seek(tenantId, req.GroupId, after, false, limit+1)
+		if err != nil {
+			return nil, false, err
+		}
+		if len(keys) > limit {
+			keys = keys[:limit]
+			more = true
+		}
+	} else {
+		var before, after string
+		var err error
+		if len(req.Before) > 0 {
+			if before, err = position(req.Before); err != nil {
+				return nil, false, err
+			}
+		}
+		if len(req.After) > 0 {
+			if after, err = position(req.After); err != nil {
+				return nil, false, err
+			}
+		}
+
+		keys, err = seek(tenantId, req.GroupId, before, true, limit+1)
+		if err != nil {
+			return nil, false, err
+		}
+		// stop at the after cursor
+		for i, k := range keys {
+			if len(after) > 0 && k <= after {
+				keys = keys[:i]
+				break
+			}
+		}
+		if len(keys) > limit {
+			keys = keys[:limit]
+			more = true
+		}
+
+		// in the order sent
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+
+	var msgs []*pb.Message
+	for _, key := range keys {
+		id := key[strings.LastIndex(key, "/")+1:]
+		msg, err := readMessage(tenantId, req.GroupId, id)
+		if err != nil {
+			// deleted along with the group
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, more, nil
+}
+
+func (c *Chat) Search(ctx context.Context, req *pb.SearchRequest, rsp *pb.SearchResponse) error {
+	tenantId := tenant.Id(ctx)
+
+	// validate the request
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("chat.search", "missing user id")
+	}
+
+	words := index.Terms(req.Query)
+	if len(words) == 0 {
+		return errors.BadRequest("chat.search", "missing query")
+	}
+
+	var from, to time.Time
+	if len(req.From) > 0 {
+		t, err := time.Parse(time.RFC3339, req.From)
+		if err != nil {
+			return errors.BadRequest("chat.search", "invalid from time")
+		}
+		from = t
+	}
+	if len(req.To) > 0 {
+		t, err := time.Parse(time.RFC3339, req.To)
+		if err != nil {
+			return errors.BadRequest("chat.search", "invalid to time")
+		}
+		to = t
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if limit > maxSearchLimit {
+		limit = maxSearchLimit
+	}
+
+	// only search the groups the user is in
+	var groups []string
+	if len(req.GroupId) > 0 {
+		groups = []string{req.GroupId}
+	} else {
+		ids, err := memberGroups(tenantId, req.UserId)
+		if err != nil {
+			logger.Errorf("Error reading member groups: %v", err)
+			return errors.InternalServerError("chat.search", "error listing chat groups")
+		}
+		groups = ids
+	}
+
+	for _, groupId := range groups {
+		// the index is checked against the group
+		if _, err := readGroup(tenantId, groupId, req.UserId); err != nil {
+			if len(req.GroupId) > 0 {
+				return err
+			}
+			continue
+		}
+
+		msgs, err := searchGroup(tenantId, groupId, words, from, to, req.SenderId, limit)
+		if err != nil {
+			logger.Errorf("Error searching group %v: %v", groupId, err)
+			return errors.InternalServerError("chat.search", "error searching messages")
+		}
+		rsp.Messages = append(rsp.Messages, msgs...)
+	}
+
+	// most recent first
+	sort.Slice(rsp.Messages, func(i, j int) bool {
+		return sentAt(rsp.Messages[i].SentAt).After(sentAt(rsp.Messages[j].SentAt))
+	})
+
+	if len(rsp.Messages) > limit {
+		rsp.Messages = rsp.Messages[:limit]
+	}
+
+	return nil
+}
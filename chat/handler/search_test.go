@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/chat/proto"
+	"github.com/micro/services/pkg/index"
+)
+
+func TestHistory(t *testing.T) {
+	setup(t, "alice")
+
+	// times far enough apart to differ in many digits of their timestamps
+	start := time.Now().Add(-time.Hour * 24 * 30)
+	for i := 0; i < 120; i++ {
+		send(t, fmt.Sprintf("m%03d", i), "alice", start.Add(time.Duration(i*i)*time.Minute+time.Duration(i)*time.Millisecond))
+	}
+
+	tcs := []struct {
+		name  string
+		req   *pb.HistoryRequest
+		first string
+		last  string
+		count int
+		more  bool
+	}{
+		{name: "latest", req: &pb.HistoryRequest{Limit: 10}, first: "m110", last: "m119", count: 10, more: true},
+		{name: "everything", req: &pb.HistoryRequest{Limit: 500}, first: "m000", last: "m119", count: 120},
+		{name: "after", req: &pb.HistoryRequest{After: "m009", Limit: 5}, first: "m010", last: "m014", count: 5, more: true},
+		{name: "after to the end", req: &pb.HistoryRequest{After: "m115", Limit: 10}, first: "m116", last: "m119", count: 4},
+		{name: "before", req: &pb.HistoryRequest{Before: "m050", Limit: 20}, first: "m030", last: "m049", count: 20, more: true},
+		{name: "before the start", req: &pb.HistoryRequest{Before: "m003", Limit: 20}, first: "m000", last: "m002", count: 3},
+		{name: "between", req: &pb.HistoryRequest{After: "m020", Before: "m030", Limit: 20}, first: "m021", last: "m029", count: 9},
+		{name: "between over the limit", req: &pb.HistoryRequest{After: "m020", Before: "m030", Limit: 4}, first: "m026", last: "m029", count: 4, more: true},
+	}
+
+	for _, tc := range tcs {
+		tc.req.GroupId = "g"
+		msgs, more, err := history("micro", tc.req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(msgs) != tc.count || more != tc.more {
+			t.Fatalf("%s: expected %d messages more %v, got %d more %v", tc.name, tc.count, tc.more, len(msgs), more)
+		}
+		if msgs[0].Id != tc.first || msgs[len(msgs)-1].Id != tc.last {
+			t.Fatalf("%s: expected %s to %s, got %s to %s", tc.name, tc.first, tc.last, msgs[0].Id, msgs[len(msgs)-1].Id)
+		}
+		for i := 1; i < len(msgs); i++ {
+			if msgs[i].Id <= msgs[i-1].Id {
+				t.Fatalf("%s: out of order at %s", tc.name, msgs[i].Id)
+			}
+		}
+	}
+}
+
+func TestSeekSameTime(t *testing.T) {
+	setup(t, "alice")
+
+	at := time.Now()
+	for _, id := range []string{"b", "a", "c"} {
+		send(t, id, "alice", at)
+	}
+	send(t, "d", "alice", at.Add(time.Second))
+
+	b, _ := readMessage("micro", "g", "b")
+	keys, err := seek("micro", "g", timelineKey("micro", b), false, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || !strings.HasSuffix(keys[0], "/c") || !strings.HasSuffix(keys[1], "/d") {
+		t.Fatalf("Expected c then d, got %v", keys)
+	}
+}
+
+func TestSearchMembers(t *testing.T) {
+	setup(t, "alice", "bob")
+
+	// a group from before the member index
+	other := &pb.Group{Id: "h", Name: "other", UserIds: []string{"bob"}}
+	store.Write(store.NewRecord(path.Join(chatStoreKeyPrefix, "micro", other.Id), other))
+
+	send(t, "m1", "alice", time.Now())
+	msg := &pb.Message{Id: "m2", GroupId: "h", UserId: "bob", Text: "message m2", SentAt: time.Now().Format(time.RFC3339Nano)}
+	if err := new(Chat).createMessage("micro", msg); err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(userId string) []string {
+		rsp := new(pb.SearchResponse)
+		if err := new(Chat).Search(context.Background(), &pb.SearchRequest{UserId: userId, Query: "message"}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range rsp.Messages {
+			ids = append(ids, m.Id)
+		}
+		return ids
+	}
+
+	if ids := search("alice"); len(ids) != 1 || ids[0] != "m1" {
+		t.Fatalf("Expected alice to find m1, got %v", ids)
+	}
+	if ids := search("bob"); len(ids) != 2 {
+		t.Fatalf("Expected bob to find both, got %v", ids)
+	}
+
+	// leaving the group takes it out of the search
+	if err := new(Chat).Leave(context.Background(), &pb.LeaveRequest{GroupId: "h", UserId: "bob"}, &pb.LeaveResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	if ids := search("bob"); len(ids) != 1 || ids[0] != "m1" {
+		t.Fatalf("Expected bob to find m1 only, got %v", ids)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	setup(t, "alice", "bob")
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 30; i++ {
+		user := "alice"
+		if i%3 == 0 {
+			user = "bob"
+		}
+		send(t, fmt.Sprintf("m%02d", i), user, start.Add(time.Duration(i)*time.Minute))
+	}
+
+	// a message indexed before the index was kept by group
+	old := &pb.Message{Id: "old", GroupId: "g", UserId: "alice", Text: "legacy message", SentAt: start.Add(-time.Hour).Format(time.RFC3339Nano)}
+	store.Write(store.NewRecord(path.Join(messageStoreKeyPrefix, "micro", "g", old.Id), old))
+	for _, term := range index.Terms(old.Text) {
+		store.Write(&store.Record{Key: indexKey("micro", term, "g", old.Id)})
+	}
+	store.Delete(path.Join(searchStoreKeyPrefix, "micro", "g"))
+
+	ids := func(msgs []*pb.Message) string {
+		var ret []string
+		for _, m := range msgs {
+			ret = append(ret, m.Id)
+		}
+		return strings.Join(ret, " ")
+	}
+
+	tcs := []struct {
+		name string
+		req  *pb.SearchRequest
+		ids  string
+	}{
+		{"latest first", &pb.SearchRequest{Query: "message", Limit: 3}, "m29 m28 m27"},
+		{"every word", &pb.SearchRequest{Query: "message m05"}, "m05"},
+		{"no match", &pb.SearchRequest{Query: "message nothing"}, ""},
+		{"sender", &pb.SearchRequest{Query: "message", SenderId: "bob", Limit: 2}, "m27 m24"},
+		{"between", &pb.SearchRequest{Query: "message", From: start.Add(9 * time.Minute).Format(time.RFC3339), To: start.Add(12*time.Minute + time.Second).Format(time.RFC3339)}, "m12 m11 m10 m09"},
+		{"legacy", &pb.SearchRequest{Query: "legacy"}, "old"},
+		{"group", &pb.SearchRequest{Query: "m01", GroupId: "g"}, "m01"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.req.UserId = "alice"
+			rsp := new(pb.SearchResponse)
+			if err := new(Chat).Search(context.Background(), tc.req, rsp); err != nil {
+				t.Fatal(err)
+			}
+			if got := ids(rsp.Messages); got != tc.ids {
+				t.Errorf("got %v, want %v", got, tc.ids)
+			}
+		})
+	}
+
+	// the index searches used to read is gone
+	keys, _ := store.List(store.ListPrefix(indexStoreKeyPrefix))
+	if len(keys) > 0 {
+		t.Errorf("legacy index keys left: %v", keys)
+	}
+}
+
+func TestDeleteIndex(t *testing.T) {
+	setup(t, "alice")
+
+	msgs := []*pb.Message{send(t, "m1", "alice", time.Now()), send(t, "m2", "alice", time.Now())}
+	// indexed before the index was kept by group
+	store.Delete(path.Join(searchStoreKeyPrefix, "micro", "g"))
+	for _, msg := range msgs {
+		store.Write(&store.Record{Key: indexKey("micro", "message", "g", msg.Id)})
+	}
+
+	if err := deleteIndex("micro", "g", msgs); err != nil {
+		t.Fatal(err)
+	}
+	for _, prefix := range []string{timelineStoreKeyPrefix, indexStoreKeyPrefix, searchStoreKeyPrefix} {
+		if keys, _ := store.List(store.ListPrefix(prefix)); len(keys) > 0 {
+			t.Errorf("keys left: %v", keys)
+		}
+	}
+}
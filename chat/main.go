@@ -15,7 +15,7 @@ func main() {
 	)
 
 	// Register the handler against the server
-	pb.RegisterChatHandler(srv.Server(), new(handler.Chat))
+	pb.RegisterChatHandler(srv.Server(), handler.New(srv))
 
 	// Run the service
 	if err := srv.Run(); err != nil {
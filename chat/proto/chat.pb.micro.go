@@ -51,6 +51,17 @@ type ChatService interface {
 	Invite(ctx context.Context, in *InviteRequest, opts ...client.CallOption) (*InviteResponse, error)
 	Leave(ctx context.Context, in *LeaveRequest, opts ...client.CallOption) (*LeaveResponse, error)
 	Kick(ctx context.Context, in *KickRequest, opts ...client.CallOption) (*KickResponse, error)
+	EditMessage(ctx context.Context, in *EditMessageRequest, opts ...client.CallOption) (*EditMessageResponse, error)
+	DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...client.CallOption) (*DeleteMessageResponse, error)
+	React(ctx context.Context, in *ReactRequest, opts ...client.CallOption) (*ReactResponse, error)
+	Typing(ctx context.Context, in *TypingRequest, opts ...client.CallOption) (*TypingResponse, error)
+	MarkRead(ctx context.Context, in *MarkReadRequest, opts ...client.CallOption) (*MarkReadResponse, error)
+	Presence(ctx context.Context, in *PresenceRequest, opts ...client.CallOption) (*PresenceResponse, error)
+	Search(ctx context.Context, in *SearchRequest, opts ...client.CallOption) (*SearchResponse, error)
+	Update(ctx context.Context, in *UpdateRequest, opts ...client.CallOption) (*UpdateResponse, error)
+	SetRole(ctx context.Context, in *SetRoleRequest, opts ...client.CallOption) (*SetRoleResponse, error)
+	Mute(ctx context.Context, in *MuteRequest, opts ...client.CallOption) (*MuteResponse, error)
+	Ban(ctx context.Context, in *BanRequest, opts ...client.CallOption) (*BanResponse, error)
 }
 
 type chatService struct {
@@ -194,6 +205,116 @@ func (c *chatService) Kick(ctx context.Context, in *KickRequest, opts ...client.
 	return out, nil
 }
 
+func (c *chatService) EditMessage(ctx context.Context, in *EditMessageRequest, opts ...client.CallOption) (*EditMessageResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.EditMessage", in)
+	out := new(EditMessageResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, opts ...client.CallOption) (*DeleteMessageResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.DeleteMessage", in)
+	out := new(DeleteMessageResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) React(ctx context.Context, in *ReactRequest, opts ...client.CallOption) (*ReactResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.React", in)
+	out := new(ReactResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) Typing(ctx context.Context, in *TypingRequest, opts ...client.CallOption) (*TypingResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.Typing", in)
+	out := new(TypingResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) MarkRead(ctx context.Context, in *MarkReadRequest, opts ...client.CallOption) (*MarkReadResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.MarkRead", in)
+	out := new(MarkReadResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) Presence(ctx context.Context, in *PresenceRequest, opts ...client.CallOption) (*PresenceResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.Presence", in)
+	out := new(PresenceResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) Search(ctx context.Context, in *SearchRequest, opts ...client.CallOption) (*SearchResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.Search", in)
+	out := new(SearchResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) Update(ctx context.Context, in *UpdateRequest, opts ...client.CallOption) (*UpdateResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.Update", in)
+	out := new(UpdateResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) SetRole(ctx context.Context, in *SetRoleRequest, opts ...client.CallOption) (*SetRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.SetRole", in)
+	out := new(SetRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) Mute(ctx context.Context, in *MuteRequest, opts ...client.CallOption) (*MuteResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.Mute", in)
+	out := new(MuteResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chatService) Ban(ctx context.Context, in *BanRequest, opts ...client.CallOption) (*BanResponse, error) {
+	req := c.c.NewRequest(c.name, "Chat.Ban", in)
+	out := new(BanResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Chat service
 
 type ChatHandler interface {
@@ -206,6 +327,17 @@ type ChatHandler interface {
 	Invite(context.Context, *InviteRequest, *InviteResponse) error
 	Leave(context.Context, *LeaveRequest, *LeaveResponse) error
 	Kick(context.Context, *KickRequest, *KickResponse) error
+	EditMessage(context.Context, *EditMessageRequest, *EditMessageResponse) error
+	DeleteMessage(context.Context, *DeleteMessageRequest, *DeleteMessageResponse) error
+	React(context.Context, *ReactRequest, *ReactResponse) error
+	Typing(context.Context, *TypingRequest, *TypingResponse) error
+	MarkRead(context.Context, *MarkReadRequest, *MarkReadResponse) error
+	Presence(context.Context, *PresenceRequest, *PresenceResponse) error
+	Search(context.Context, *SearchRequest, *SearchResponse) error
+	Update(context.Context, *UpdateRequest, *UpdateResponse) error
+	SetRole(context.Context, *SetRoleRequest, *SetRoleResponse) error
+	Mute(context.Context, *MuteRequest, *MuteResponse) error
+	Ban(context.Context, *BanRequest, *BanResponse) error
 }
 
 func RegisterChatHandler(s server.Server, hdlr ChatHandler, opts ...server.HandlerOption) error {
@@ -219,6 +351,17 @@ func RegisterChatHandler(s server.Server, hdlr ChatHandler, opts ...server.Handl
 		Invite(ctx context.Context, in *InviteRequest, out *InviteResponse) error
 		Leave(ctx context.Context, in *LeaveRequest, out *LeaveResponse) error
 		Kick(ctx context.Context, in *KickRequest, out *KickResponse) error
+		EditMessage(ctx context.Context, in *EditMessageRequest, out *EditMessageResponse) error
+		DeleteMessage(ctx context.Context, in *DeleteMessageRequest, out *DeleteMessageResponse) error
+		React(ctx context.Context, in *ReactRequest, out *ReactResponse) error
+		Typing(ctx context.Context, in *TypingRequest, out *TypingResponse) error
+		MarkRead(ctx context.Context, in *MarkReadRequest, out *MarkReadResponse) error
+		Presence(ctx context.Context, in *PresenceRequest, out *PresenceResponse) error
+		Search(ctx context.Context, in *SearchRequest, out *SearchResponse) error
+		Update(ctx context.Context, in *UpdateRequest, out *UpdateResponse) error
+		SetRole(ctx context.Context, in *SetRoleRequest, out *SetRoleResponse) error
+		Mute(ctx context.Context, in *MuteRequest, out *MuteResponse) error
+		Ban(ctx context.Context, in *BanRequest, out *BanResponse) error
 	}
 	type Chat struct {
 		chat
@@ -302,3 +445,47 @@ func (h *chatHandler) Leave(ctx context.Context, in *LeaveRequest, out *LeaveRes
 func (h *chatHandler) Kick(ctx context.Context, in *KickRequest, out *KickResponse) error {
 	return h.ChatHandler.Kick(ctx, in, out)
 }
+
+func (h *chatHandler) EditMessage(ctx context.Context, in *EditMessageRequest, out *EditMessageResponse) error {
+	return h.ChatHandler.EditMessage(ctx, in, out)
+}
+
+func (h *chatHandler) DeleteMessage(ctx context.Context, in *DeleteMessageRequest, out *DeleteMessageResponse) error {
+	return h.ChatHandler.DeleteMessage(ctx, in, out)
+}
+
+func (h *chatHandler) React(ctx context.Context, in *ReactRequest, out *ReactResponse) error {
+	return h.ChatHandler.React(ctx, in, out)
+}
+
+func (h *chatHandler) Typing(ctx context.Context, in *TypingRequest, out *TypingResponse) error {
+	return h.ChatHandler.Typing(ctx, in, out)
+}
+
+func (h *chatHandler) MarkRead(ctx context.Context, in *MarkReadRequest, out *MarkReadResponse) error {
+	return h.ChatHandler.MarkRead(ctx, in, out)
+}
+
+func (h *chatHandler) Presence(ctx context.Context, in *PresenceRequest, out *PresenceResponse) error {
+	return h.ChatHandler.Presence(ctx, in, out)
+}
+
+func (h *chatHandler) Search(ctx context.Context, in *SearchRequest, out *SearchResponse) error {
+	return h.ChatHandler.Search(ctx, in, out)
+}
+
+func (h *chatHandler) Update(ctx context.Context, in *UpdateRequest, out *UpdateResponse) error {
+	return h.ChatHandler.Update(ctx, in, out)
+}
+
+func (h *chatHandler) SetRole(ctx context.Context, in *SetRoleRequest, out *SetRoleResponse) error {
+	return h.ChatHandler.SetRole(ctx, in, out)
+}
+
+func (h *chatHandler) Mute(ctx context.Context, in *MuteRequest, out *MuteResponse) error {
+	return h.ChatHandler.Mute(ctx, in, out)
+}
+
+func (h *chatHandler) Ban(ctx context.Context, in *BanRequest, out *BanResponse) error {
+	return h.ChatHandler.Ban(ctx, in, out)
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"path"
 	"time"
 
@@ -14,28 +13,49 @@ import (
 	pb "github.com/micro/services/comments/proto"
 	streamPb "github.com/micro/services/mq/proto"
 	pauth "github.com/micro/services/pkg/auth"
+	"github.com/micro/services/pkg/document"
+	"github.com/micro/services/pkg/redis"
 	adminpb "github.com/micro/services/pkg/service/proto"
 	"github.com/micro/services/pkg/tenant"
-	"google.golang.org/protobuf/types/known/structpb"
+	spampb "github.com/micro/services/spam/proto"
 )
 
 // New returns an initialized Comments
 func New(c client.Client) *Comments {
 	return &Comments{
-		Stream: streamPb.NewMqService("mq", c),
+		docs:    newCollection(streamPb.NewMqService("mq", c)),
+		spam:    spampb.NewSpamService("spam", c),
+		upvotes: redis.NewCounter("comments"),
 	}
 }
 
-// Comments implements the comments proto definition
-type Comments struct {
-	Stream streamPb.MqService
+// newCollection returns the comments publishing events on the stream
+func newCollection(stream streamPb.MqService) *document.Collection {
+	return &document.Collection{
+		Service: "comments",
+		Type:    "comment",
+		Key: func(tnt, id string) string {
+			return path.Join("comment", tnt) + "/" + id
+		},
+		New: func() document.Doc {
+			return new(pb.Comment)
+		},
+		Title: func(d document.Doc) string {
+			return d.(*pb.Comment).Subject
+		},
+		Text: func(d document.Doc) string {
+			return d.(*pb.Comment).Text
+		},
+		Stream: stream,
+	}
 }
 
-func newMessage(ev map[string]interface{}) *structpb.Struct {
-	st := new(structpb.Struct)
-	b, _ := json.Marshal(ev)
-	json.Unmarshal(b, st)
-	return st
+// Comments implements the comments proto definition
+type Comments struct {
+	docs *document.Collection
+	spam spampb.SpamService
+	// the upvotes of each comment
+	upvotes counter
 }
 
 // Create inserts a new comment in the store
@@ -44,45 +64,64 @@ func (h *Comments) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Cr
 		return errors.BadRequest("comments.create", "missing name and text")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
 	// generate a key (uuid v4)
 	id, err := uuid.NewUUID()
 	if err != nil {
 		return err
 	}
 
+	resourceId := req.ResourceId
+
+	// replies are on the same resource as the comment replied to
+	if len(req.ParentId) > 0 {
+		doc, err := h.docs.Read(ctx, "comments.create", req.ParentId, req.UserId, document.Read)
+		if err != nil {
+			return err
+		}
+		parent := doc.(*pb.Comment)
+		if len(resourceId) == 0 {
+			resourceId = parent.ResourceId
+		}
+		if resourceId != parent.ResourceId {
+			return errors.BadRequest("comments.create", "parent comment is on another resource")
+		}
+	}
+
+	authorId := req.AuthorId
+	if len(authorId) == 0 {
+		authorId = req.UserId
+	}
+
 	t := time.Now().Format(time.RFC3339)
 	// set the generated fields on the comment
 	comment := &pb.Comment{
-		Id:      id.String(),
-		Created: t,
-		Updated: t,
-		Subject: req.Subject,
-		Text:    req.Text,
+		Id:         id.String(),
+		Created:    t,
+		Updated:    t,
+		Subject:    req.Subject,
+		Text:       req.Text,
+		OwnerId:    req.UserId,
+		Tags:       document.Tags(req.Tags),
+		Labels:     req.Labels,
+		ResourceId: resourceId,
+		ParentId:   req.ParentId,
+		AuthorId:   authorId,
+		Status:     h.classify(ctx, req.Subject, req.Text),
 	}
 
-	key := path.Join("comment", tnt, id.String())
-	rec := store.NewRecord(key, comment)
+	if err := h.docs.Create(ctx, "comments.create", comment); err != nil {
+		return err
+	}
 
-	if err = store.Write(rec); err != nil {
-		return errors.InternalServerError("comments.created", "failed to create comment")
+	if len(resourceId) > 0 {
+		if err := store.Write(resourceRecord(tenant.OrDefault(ctx), comment)); err != nil {
+			logger.Errorf("Error indexing comment %v on %v: %v", comment.Id, resourceId, err)
+		}
 	}
 
 	// return the comment in the response
 	rsp.Comment = comment
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "comments",
-		Message: newMessage(map[string]interface{}{
-			"event":   "create",
-			"comment": comment,
-		}),
-	})
-
 	return nil
 }
 
@@ -91,29 +130,15 @@ func (h *Comments) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadRe
 		return errors.BadRequest("comments.read", "Missing Comment ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("comment", tnt, req.Id)
-
 	// read the specific comment
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return errors.NotFound("comments.read", "Comment not found")
-	} else if err != nil {
-		return errors.InternalServerError("comments.read", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the comment
-	var comment *pb.Comment
-	if err := recs[0].Decode(&comment); err != nil {
-		return errors.InternalServerError("comments.update", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Read(ctx, "comments.read", req.Id, req.UserId, document.Read)
+	if err != nil {
+		return err
 	}
 
 	// return the comment
-	rsp.Comment = comment
+	rsp.Comment = doc.(*pb.Comment)
+	h.countUpvotes(ctx, rsp.Comment)
 
 	return nil
 }
@@ -128,98 +153,68 @@ func (h *Comments) Update(ctx context.Context, req *pb.UpdateRequest, rsp *pb.Up
 		return errors.BadRequest("comments.update", "Missing Comment ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("comment", tnt, req.Comment.Id)
-
 	// read the specific comment
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return errors.NotFound("comments.update", "Comment not found")
-	} else if err != nil {
-		return errors.InternalServerError("comments.update", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the comment
-	var comment *pb.Comment
-	if err := recs[0].Decode(&comment); err != nil {
-		return errors.InternalServerError("comments.update", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Read(ctx, "comments.update", req.Comment.Id, req.UserId, document.Write)
+	if err != nil {
+		return err
 	}
+	comment := doc.(*pb.Comment)
 
-	// Update the comments name and text
+	// Update the comments subject, text, tags and labels
 	comment.Subject = req.Comment.Subject
 	comment.Text = req.Comment.Text
+	comment.Status = h.classify(ctx, comment.Subject, comment.Text)
+	comment.Tags = document.Tags(req.Comment.Tags)
+	comment.Labels = req.Comment.Labels
 	comment.Updated = time.Now().Format(time.RFC3339)
 
-	rec := store.NewRecord(key, comment)
-
 	// Write the updated comment to the store
-	if err = store.Write(rec); err != nil {
-		return errors.InternalServerError("comments.update", "Error writing to store: %v", err.Error())
+	if err := h.docs.Update(ctx, "comments.update", document.EventUpdate, comment); err != nil {
+		return err
 	}
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "comments",
-		Message: newMessage(map[string]interface{}{
-			"event":   "update",
-			"comment": comment,
-		}),
-	})
-
 	rsp.Comment = comment
+	h.countUpvotes(ctx, comment)
 
 	return nil
 }
 
-func (h *Comments) Events(ctx context.Context, req *pb.EventsRequest, stream pb.Comments_EventsStream) error {
-	backendStream, err := h.Stream.Subscribe(ctx, &streamPb.SubscribeRequest{
-		Topic: "comments",
-	})
-	if err != nil {
-		return errors.InternalServerError("comments.subscribe", "Failed to subscribe to comments")
+// Share gives another user access to the comment
+func (h *Comments) Share(ctx context.Context, req *pb.ShareRequest, rsp *pb.ShareResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("comments.share", "Missing Comment ID")
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
-
-		// receive messages from the stream
-		msg, err := backendStream.Recv()
-		if err != nil {
-			return nil
-		}
-
-		v, err := msg.Message.MarshalJSON()
-		if err != nil {
-			continue
-		}
+	doc, err := h.docs.Read(ctx, "comments.share", req.Id, req.UserId, document.Owner)
+	if err != nil {
+		return err
+	}
+	comment := doc.(*pb.Comment)
 
-		rsp := new(pb.EventsResponse)
+	shares, err := document.Share("comments.share", comment, req.ShareWith, req.Access)
+	if err != nil {
+		return err
+	}
+	comment.Shares = shares
+	comment.Updated = time.Now().Format(time.RFC3339)
 
-		if err := json.Unmarshal(v, rsp); err != nil {
-			continue
-		}
+	if err := h.docs.Update(ctx, "comments.share", document.EventUpdate, comment); err != nil {
+		return err
+	}
 
-		comment := rsp.Comment
+	rsp.Comment = comment
+	h.countUpvotes(ctx, comment)
 
-		// filter if necessary by id
-		if len(req.Id) > 0 && comment.Id != req.Id {
-			continue
-		}
+	return nil
+}
 
+func (h *Comments) Events(ctx context.Context, req *pb.EventsRequest, stream pb.Comments_EventsStream) error {
+	return h.docs.Events(ctx, "comments.subscribe", req.Id, req.UserId, func(event string, doc document.Doc) error {
+		comment := doc.(*pb.Comment)
+		h.countUpvotes(ctx, comment)
 		// send back the event to the client
-		if err := stream.Send(rsp); err != nil {
-			return nil
-		}
-	}
-
-	return nil
+		return stream.Send(&pb.EventsResponse{Event: event, Comment: comment})
+	})
 }
 
 // Delete removes the comment from the store, looking up using ID
@@ -229,73 +224,62 @@ func (h *Comments) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.De
 		return errors.BadRequest("comments.delete", "Missing Comment ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("comment", tnt, req.Id)
-
-	// read the specific comment
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return nil
-	} else if err != nil {
-		return errors.InternalServerError("comments.delete", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the comment
-	var comment *pb.Comment
-	if err := recs[0].Decode(&comment); err != nil {
-		return errors.InternalServerError("comments.delete", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Delete(ctx, "comments.delete", req.Id, req.UserId)
+	if err != nil {
+		return err
 	}
-
-	// now delete it
-	if err := store.Delete(key); err != nil && err != store.ErrNotFound {
-		return errors.InternalServerError("comments.delete", "Failed to delete comment")
+	if doc != nil {
+		rsp.Comment = doc.(*pb.Comment)
+		if err := h.unindex(ctx, tenant.OrDefault(ctx), rsp.Comment); err != nil {
+			logger.Errorf("Error removing the index and upvotes of comment %v: %v", req.Id, err)
+		}
 	}
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "comments",
-		Message: newMessage(map[string]interface{}{
-			"event":   "delete",
-			"comment": comment,
-		}),
-	})
-
-	rsp.Comment = comment
-
 	return nil
 }
 
-// Comment returns all of the comments in the store
+// List returns the comments in the store the user can read
 func (h *Comments) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListResponse) error {
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
+	query := &document.Query{
+		UserId:  req.UserId,
+		Tags:    req.Tags,
+		Labels:  req.Labels,
+		Search:  req.Search,
+		OrderBy: orderBy(req.OrderBy),
+		Order:   req.Order,
+		Limit:   int(req.Limit),
+		Offset:  int(req.Offset),
 	}
 
-	key := path.Join("comment", tnt) + "/"
+	if len(req.ResourceId) > 0 {
+		return h.listThread(ctx, req, query, rsp)
+	}
 
-	// Retrieve all of the records in the store
-	recs, err := store.Read(key, store.ReadPrefix())
+	docs, total, err := h.docs.List(ctx, "comments.list", query)
 	if err != nil {
-		return errors.InternalServerError("comments.list", "Error reading from store: %v", err.Error())
+		return err
 	}
 
 	// Initialize the response comments slice
-	rsp.Comments = make([]*pb.Comment, len(recs))
+	rsp.Comments = make([]*pb.Comment, len(docs))
+	rsp.Total = int32(total)
 
-	// Unmarshal the comments into the response
-	for i, r := range recs {
-		if err := r.Decode(&rsp.Comments[i]); err != nil {
-			return errors.InternalServerError("comments.list", "Error decoding comment: %v", err.Error())
-		}
+	for i, doc := range docs {
+		rsp.Comments[i] = doc.(*pb.Comment)
 	}
+	h.countUpvotes(ctx, rsp.Comments...)
 
 	return nil
 }
 
+// orderBy maps the subject of a comment to the title documents are ordered by
+func orderBy(field string) string {
+	if field == "subject" {
+		return "title"
+	}
+	return field
+}
+
 func (h *Comments) DeleteData(ctx context.Context, request *adminpb.DeleteDataRequest, response *adminpb.DeleteDataResponse) error {
 	method := "admin.DeleteData"
 	_, err := pauth.VerifyMicroAdmin(ctx, method)
@@ -307,18 +291,27 @@ func (h *Comments) DeleteData(ctx context.Context, request *adminpb.DeleteDataRe
 		return errors.BadRequest(method, "Missing tenant ID")
 	}
 
-	keys, err := store.List(store.ListPrefix(path.Join("comment", request.TenantId) + "/"))
+	deleted, err := h.docs.DeleteTenant(request.TenantId)
 	if err != nil {
 		return err
 	}
 
-	for _, k := range keys {
-		if err := store.Delete(k); err != nil {
+	// the resource index, its marker and the upvotes of the comments
+	if err := store.Delete(path.Join(resourcePrefix, request.TenantId)); err != nil && err != store.ErrNotFound {
+		return err
+	}
+	for _, prefix := range []string{path.Join(resourcePrefix, request.TenantId) + "/", path.Join(upvotePrefix, request.TenantId) + "/"} {
+		n, err := deleteKeys(prefix)
+		if err != nil {
 			return err
 		}
+		deleted += n
+	}
+	if err := h.upvotes.Delete(ctx, request.TenantId); err != nil {
+		return err
 	}
 
-	logger.Infof("Deleted %d keys for %s", len(keys), request.TenantId)
+	logger.Infof("Deleted %d keys for %s", deleted, request.TenantId)
 	return nil
 }
 
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"context"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/comments/proto"
+	"github.com/micro/services/pkg/document"
+	"github.com/micro/services/pkg/index"
+	"github.com/micro/services/pkg/redis"
+	"github.com/micro/services/pkg/tenant"
+	spampb "github.com/micro/services/spam/proto"
+)
+
+// moderation status of a comment
+const (
+	statusApproved = "approved"
+	statusSpam     = "spam"
+)
+
+const (
+	// comment ids by the resource they're on
+	resourcePrefix = "resource/"
+	// a record of each user's upvote of a comment
+	upvotePrefix = "upvote/"
+)
+
+// counter counts the upvotes of comments
+type counter interface {
+	Incr(ctx context.Context, key, path string, delta int64) (int64, error)
+	Decr(ctx context.Context, key, path string, delta int64) (int64, error)
+	Read(ctx context.Context, key, path string) (int64, error)
+	Remove(ctx context.Context, key, path string) error
+	Delete(ctx context.Context, key string) error
+}
+
+func resourceKey(tnt, resourceId, id string) string {
+	return path.Join(resourcePrefix, tnt, resourceId) + "/" + id
+}
+
+// resourceRecord indexes the comment on its resource with the id of its parent
+func resourceRecord(tnt string, c *pb.Comment) *store.Record {
+	return &store.Record{Key: resourceKey(tnt, c.ResourceId, c.Id), Value: []byte(c.ParentId)}
+}
+
+// ensureResources indexes the comments created before the resource index
+func ensureResources(tnt string) error {
+	// the marker is outside the prefix of the resource keys
+	return index.Backfill(path.Join(resourcePrefix, tnt), func() error {
+		recs, err := store.Read(path.Join("comment", tnt)+"/", store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		for _, rec := range recs {
+			c := new(pb.Comment)
+			if err := rec.Decode(c); err != nil || len(c.ResourceId) == 0 {
+				continue
+			}
+			if err := store.Write(resourceRecord(tnt, c)); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// resourceComments returns the ids of the top level comments on the resource
+// and the ids of the replies to each comment
+func resourceComments(tnt, resourceId string) ([]string, map[string][]string, error) {
+	if err := ensureResources(tnt); err != nil {
+		return nil, nil, err
+	}
+
+	prefix := resourceKey(tnt, resourceId, "")
+	recs, err := store.Read(prefix, store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, nil, err
+	}
+
+	roots := []string{}
+	replies := map[string][]string{}
+	for _, rec := range recs {
+		id := strings.TrimPrefix(rec.Key, prefix)
+		if parent := string(rec.Value); len(parent) > 0 {
+			replies[parent] = append(replies[parent], id)
+			continue
+		}
+		roots = append(roots, id)
+	}
+	return roots, replies, nil
+}
+
+// deleteKeys removes the records with the prefix
+func deleteKeys(prefix string) (int, error) {
+	keys, err := store.List(store.ListPrefix(prefix))
+	if err != nil {
+		return 0, err
+	}
+	for _, k := range keys {
+		if err := store.Delete(k); err != nil && err != store.ErrNotFound {
+			return 0, err
+		}
+	}
+	return len(keys), nil
+}
+
+// unindex removes the resource index and upvotes of a deleted comment
+func (h *Comments) unindex(ctx context.Context, tnt string, c *pb.Comment) error {
+	if len(c.ResourceId) > 0 {
+		if err := store.Delete(resourceKey(tnt, c.ResourceId, c.Id)); err != nil && err != store.ErrNotFound {
+			return err
+		}
+	}
+	if _, err := deleteKeys(path.Join(upvotePrefix, tnt, c.Id) + "/"); err != nil {
+		return err
+	}
+	return h.upvotes.Remove(ctx, redis.Key(tnt, c.Id), "upvotes")
+}
+
+// countUpvotes adds the upvotes counted since upvotes stopped being
+// stored with the comments to the stored ones
+func (h *Comments) countUpvotes(ctx context.Context, comments ...*pb.Comment) {
+	tnt := tenant.OrDefault(ctx)
+	for _, c := range comments {
+		n, err := h.upvotes.Read(ctx, redis.Key(tnt, c.Id), "upvotes")
+		if err != nil {
+			logger.Errorf("Error reading upvotes of %v: %v", c.Id, err)
+			continue
+		}
+		c.Upvotes += int32(n)
+	}
+}
+
+// classify returns the moderation status of the comment text. Comments
+// are approved if the spam service can't be reached
+func (h *Comments) classify(ctx context.Context, subject, text string) string {
+	rsp, err := h.spam.Classify(ctx, &spampb.ClassifyRequest{
+		Subject:  subject,
+		TextBody: text,
+	})
+	if err != nil {
+		logger.Errorf("Error classifying comment: %v", err)
+		return statusApproved
+	}
+	if rsp.IsSpam {
+		return statusSpam
+	}
+	return statusApproved
+}
+
+// listThread lists the comments on a resource as a tree, paging through the top level comments
+func (h *Comments) listThread(ctx context.Context, req *pb.ListRequest, query *document.Query, rsp *pb.ListResponse) error {
+	limit, offset := query.Limit, query.Offset
+	if limit < 0 || offset < 0 {
+		return errors.BadRequest("comments.list", "invalid limit or offset")
+	}
+
+	roots, replies, err := resourceComments(tenant.OrDefault(ctx), req.ResourceId)
+	if err != nil {
+		logger.Errorf("Error reading comments on %v: %v", req.ResourceId, err)
+		return errors.InternalServerError("comments.list", "Error reading from store: %v", err.Error())
+	}
+
+	// page through the top level comments then read only the replies to them
+	query.Ids = roots
+	query.Limit, query.Offset = 0, 0
+
+	top, err := h.thread(ctx, req, query)
+	if err != nil {
+		return err
+	}
+
+	rsp.Total = int32(len(top))
+
+	if offset > len(top) {
+		offset = len(top)
+	}
+	top = top[offset:]
+	if limit > 0 && len(top) > limit {
+		top = top[:limit]
+	}
+
+	comments := map[string]*pb.Comment{}
+	for _, c := range top {
+		comments[c.Id] = c
+	}
+
+	// replies to deleted or hidden comments are left out
+	parents := top
+	for len(parents) > 0 {
+		query.Ids = []string{}
+		for _, c := range parents {
+			query.Ids = append(query.Ids, replies[c.Id]...)
+		}
+		if len(query.Ids) == 0 {
+			break
+		}
+
+		next, err := h.thread(ctx, req, query)
+		if err != nil {
+			return err
+		}
+
+		parents = nil
+		for _, c := range next {
+			parent, ok := comments[c.ParentId]
+			if !ok {
+				continue
+			}
+			comments[c.Id] = c
+			parents = append(parents, c)
+			parent.Replies = append(parent.Replies, c)
+			parent.ReplyCount++
+		}
+	}
+
+	// replies are in the order they were made
+	for _, c := range comments {
+		sort.SliceStable(c.Replies, func(i, j int) bool {
+			return c.Replies[i].Created < c.Replies[j].Created
+		})
+	}
+
+	rsp.Comments = top
+
+	return nil
+}
+
+// thread returns the comments of the query on the resource, without spam
+// unless it's included, and counts their upvotes
+func (h *Comments) thread(ctx context.Context, req *pb.ListRequest, query *document.Query) ([]*pb.Comment, error) {
+	docs, _, err := h.docs.List(ctx, "comments.list", query)
+	if err != nil {
+		return nil, err
+	}
+
+	var comments []*pb.Comment
+	for _, doc := range docs {
+		c := doc.(*pb.Comment)
+		if c.ResourceId != req.ResourceId {
+			continue
+		}
+		if c.Status == statusSpam && !req.IncludeSpam {
+			continue
+		}
+		comments = append(comments, c)
+	}
+
+	h.countUpvotes(ctx, comments...)
+
+	return comments, nil
+}
+
+// Upvote adds or removes the user's upvote of a comment
+func (h *Comments) Upvote(ctx context.Context, req *pb.UpvoteRequest, rsp *pb.UpvoteResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("comments.upvote", "Missing Comment ID")
+	}
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("comments.upvote", "Missing User ID")
+	}
+
+	doc, err := h.docs.Read(ctx, "comments.upvote", req.Id, req.UserId, document.Read)
+	if err != nil {
+		return err
+	}
+	comment := doc.(*pb.Comment)
+
+	tnt := tenant.OrDefault(ctx)
+
+	// a record of each upvote so users only upvote once
+	key := path.Join(upvotePrefix, tnt, req.Id, req.UserId)
+
+	_, err = store.Read(key, store.ReadLimit(1))
+	if err != nil && err != store.ErrNotFound {
+		return errors.InternalServerError("comments.upvote", "Error reading from store: %v", err.Error())
+	}
+	upvoted := err == nil
+
+	// the count is kept apart from the comment so upvotes don't overwrite each other
+	counterKey := redis.Key(tnt, req.Id)
+
+	switch {
+	case req.Remove && upvoted:
+		if err := store.Delete(key); err != nil {
+			return errors.InternalServerError("comments.upvote", "Error writing to store: %v", err.Error())
+		}
+		if _, err := h.upvotes.Decr(ctx, counterKey, "upvotes", 1); err != nil {
+			return errors.InternalServerError("comments.upvote", "Error counting upvotes: %v", err.Error())
+		}
+	case !req.Remove && !upvoted:
+		if err := store.Write(&store.Record{Key: key}); err != nil {
+			return errors.InternalServerError("comments.upvote", "Error writing to store: %v", err.Error())
+		}
+		if _, err := h.upvotes.Incr(ctx, counterKey, "upvotes", 1); err != nil {
+			return errors.InternalServerError("comments.upvote", "Error counting upvotes: %v", err.Error())
+		}
+	default:
+		// nothing changed
+		h.countUpvotes(ctx, comment)
+		rsp.Comment = comment
+		return nil
+	}
+
+	// the comment is published as stored, subscribers add the counted upvotes
+	h.docs.Publish(ctx, document.EventUpdate, comment)
+
+	h.countUpvotes(ctx, comment)
+	rsp.Comment = comment
+
+	return nil
+}
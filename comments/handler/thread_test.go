@@ -0,0 +1,232 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/micro/micro/v3/service/client"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/comments/proto"
+	mqpb "github.com/micro/services/mq/proto"
+	spampb "github.com/micro/services/spam/proto"
+)
+
+// counts keeps the counters in memory
+type counts struct {
+	sync.Mutex
+	values map[string]int64
+}
+
+func (c *counts) Incr(ctx context.Context, key, path string, delta int64) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[key+":"+path] += delta
+	return c.values[key+":"+path], nil
+}
+
+func (c *counts) Decr(ctx context.Context, key, path string, delta int64) (int64, error) {
+	return c.Incr(ctx, key, path, -delta)
+}
+
+func (c *counts) Read(ctx context.Context, key, path string) (int64, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.values[key+":"+path], nil
+}
+
+func (c *counts) Remove(ctx context.Context, key, path string) error {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.values, key+":"+path)
+	return nil
+}
+
+func (c *counts) Delete(ctx context.Context, key string) error {
+	c.Lock()
+	defer c.Unlock()
+	for k := range c.values {
+		if strings.HasPrefix(k, key+":") {
+			delete(c.values, k)
+		}
+	}
+	return nil
+}
+
+// stream drops the events published
+type stream struct {
+	mqpb.MqService
+}
+
+func (s *stream) Publish(ctx context.Context, req *mqpb.PublishRequest, opts ...client.CallOption) (*mqpb.PublishResponse, error) {
+	return &mqpb.PublishResponse{}, nil
+}
+
+// spam classifies comments containing spam as spam
+type spam struct {
+	spampb.SpamService
+}
+
+func (s *spam) Classify(ctx context.Context, req *spampb.ClassifyRequest, opts ...client.CallOption) (*spampb.ClassifyResponse, error) {
+	return &spampb.ClassifyResponse{IsSpam: strings.Contains(req.TextBody, "spam")}, nil
+}
+
+func newComments() *Comments {
+	store.DefaultStore = memory.NewStore()
+
+	return &Comments{
+		docs:    newCollection(new(stream)),
+		spam:    new(spam),
+		upvotes: &counts{values: map[string]int64{}},
+	}
+}
+
+// tree prints the comments and their replies e.g [a [b c]]
+func tree(comments []*pb.Comment) string {
+	var parts []string
+	for _, c := range comments {
+		parts = append(parts, c.Text)
+		if len(c.Replies) > 0 {
+			parts = append(parts, tree(c.Replies))
+		}
+	}
+	return "[" + strings.Join(parts, " ") + "]"
+}
+
+func TestListThread(t *testing.T) {
+	h := newComments()
+	ctx := context.Background()
+
+	var ids []string
+	create := func(text, resourceId, parent string) string {
+		rsp := new(pb.CreateResponse)
+		if err := h.Create(ctx, &pb.CreateRequest{Text: text, ResourceId: resourceId, ParentId: parent}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, rsp.Comment.Id)
+		return rsp.Comment.Id
+	}
+
+	a := create("a", "post", "")
+	b := create("b", "", a)
+	create("c", "", b)
+	create("d", "", a)
+	spam := create("spam", "post", "")
+	create("e", "", spam)
+	f := create("f", "post", "")
+	create("g", "other", "")
+
+	// comments made within a second are ordered as they were made
+	for i, id := range ids {
+		rsp := new(pb.ReadResponse)
+		if err := h.Read(ctx, &pb.ReadRequest{Id: id}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		rsp.Comment.Created = fmt.Sprintf("%02d", i)
+		store.Write(store.NewRecord(h.docs.Key("default", id), rsp.Comment))
+	}
+
+	if err := h.Upvote(ctx, &pb.UpvoteRequest{Id: f, UserId: "alice"}, &pb.UpvoteResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name  string
+		req   *pb.ListRequest
+		tree  string
+		total int32
+	}{
+		{"thread", &pb.ListRequest{ResourceId: "post"}, "[a [b [c] d] f]", 2},
+		{"spam", &pb.ListRequest{ResourceId: "post", IncludeSpam: true, Order: "desc"}, "[f spam [e] a [b [c] d]]", 3},
+		{"first page", &pb.ListRequest{ResourceId: "post", Limit: 1}, "[a [b [c] d]]", 2},
+		{"page", &pb.ListRequest{ResourceId: "post", Limit: 1, Offset: 1}, "[f]", 2},
+		{"other", &pb.ListRequest{ResourceId: "other"}, "[g]", 1},
+		{"search", &pb.ListRequest{ResourceId: "post", Search: "spam", IncludeSpam: true}, "[spam]", 1},
+		{"none", &pb.ListRequest{ResourceId: "none"}, "[]", 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			rsp := new(pb.ListResponse)
+			if err := h.List(ctx, tc.req, rsp); err != nil {
+				t.Fatal(err)
+			}
+			if got := tree(rsp.Comments); got != tc.tree || rsp.Total != tc.total {
+				t.Errorf("got %v of %d, want %v of %d", got, rsp.Total, tc.tree, tc.total)
+			}
+		})
+	}
+
+	rsp := new(pb.ListResponse)
+	if err := h.List(ctx, &pb.ListRequest{ResourceId: "post"}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	if root := rsp.Comments[0]; root.ReplyCount != 2 || root.Replies[0].ReplyCount != 1 {
+		t.Errorf("reply counts %d and %d, want 2 and 1", root.ReplyCount, root.Replies[0].ReplyCount)
+	}
+	if up := rsp.Comments[1].Upvotes; up != 1 {
+		t.Errorf("upvotes = %d, want 1", up)
+	}
+}
+
+func TestUpvote(t *testing.T) {
+	h := newComments()
+	ctx := context.Background()
+
+	crsp := new(pb.CreateResponse)
+	if err := h.Create(ctx, &pb.CreateRequest{Text: "hello", ResourceId: "post"}, crsp); err != nil {
+		t.Fatal(err)
+	}
+	id := crsp.Comment.Id
+
+	// concurrent upvotes are all counted
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := h.Upvote(ctx, &pb.UpvoteRequest{Id: id, UserId: fmt.Sprintf("user%d", i)}, &pb.UpvoteResponse{}); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	tcs := []struct {
+		name    string
+		userId  string
+		remove  bool
+		upvotes int32
+	}{
+		{"counted", "user0", false, 10},
+		{"again", "user0", false, 10},
+		{"remove", "user0", true, 9},
+		{"remove again", "user0", true, 9},
+		{"new user", "user10", false, 10},
+	}
+	for _, tc := range tcs {
+		rsp := new(pb.UpvoteResponse)
+		if err := h.Upvote(ctx, &pb.UpvoteRequest{Id: id, UserId: tc.userId, Remove: tc.remove}, rsp); err != nil {
+			t.Fatal(err)
+		}
+		if rsp.Comment.Upvotes != tc.upvotes {
+			t.Errorf("%s: upvotes = %d, want %d", tc.name, rsp.Comment.Upvotes, tc.upvotes)
+		}
+	}
+
+	// the upvotes and resource index go with the comment
+	if err := h.Delete(ctx, &pb.DeleteRequest{Id: id}, &pb.DeleteResponse{}); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := store.List()
+	for _, k := range keys {
+		if strings.HasPrefix(k, upvotePrefix) || strings.HasPrefix(k, resourcePrefix+"default/") {
+			t.Errorf("key %v left after deleting the comment", k)
+		}
+	}
+	if n, _ := h.upvotes.Read(ctx, "default:"+id, "upvotes"); n != 0 {
+		t.Errorf("upvote count %d left after deleting the comment", n)
+	}
+}
@@ -48,6 +48,8 @@ type CommentsService interface {
 	Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error)
 	Update(ctx context.Context, in *UpdateRequest, opts ...client.CallOption) (*UpdateResponse, error)
 	Events(ctx context.Context, in *EventsRequest, opts ...client.CallOption) (Comments_EventsService, error)
+	Share(ctx context.Context, in *ShareRequest, opts ...client.CallOption) (*ShareResponse, error)
+	Upvote(ctx context.Context, in *UpvoteRequest, opts ...client.CallOption) (*UpvoteResponse, error)
 }
 
 type commentsService struct {
@@ -161,6 +163,26 @@ func (x *commentsServiceEvents) Recv() (*EventsResponse, error) {
 	return m, nil
 }
 
+func (c *commentsService) Share(ctx context.Context, in *ShareRequest, opts ...client.CallOption) (*ShareResponse, error) {
+	req := c.c.NewRequest(c.name, "Comments.Share", in)
+	out := new(ShareResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *commentsService) Upvote(ctx context.Context, in *UpvoteRequest, opts ...client.CallOption) (*UpvoteResponse, error) {
+	req := c.c.NewRequest(c.name, "Comments.Upvote", in)
+	out := new(UpvoteResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Comments service
 
 type CommentsHandler interface {
@@ -170,6 +192,8 @@ type CommentsHandler interface {
 	Delete(context.Context, *DeleteRequest, *DeleteResponse) error
 	Update(context.Context, *UpdateRequest, *UpdateResponse) error
 	Events(context.Context, *EventsRequest, Comments_EventsStream) error
+	Share(context.Context, *ShareRequest, *ShareResponse) error
+	Upvote(context.Context, *UpvoteRequest, *UpvoteResponse) error
 }
 
 func RegisterCommentsHandler(s server.Server, hdlr CommentsHandler, opts ...server.HandlerOption) error {
@@ -180,6 +204,8 @@ func RegisterCommentsHandler(s server.Server, hdlr CommentsHandler, opts ...serv
 		Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error
 		Update(ctx context.Context, in *UpdateRequest, out *UpdateResponse) error
 		Events(ctx context.Context, stream server.Stream) error
+		Share(ctx context.Context, in *ShareRequest, out *ShareResponse) error
+		Upvote(ctx context.Context, in *UpvoteRequest, out *UpvoteResponse) error
 	}
 	type Comments struct {
 		comments
@@ -251,3 +277,11 @@ func (x *commentsEventsStream) RecvMsg(m interface{}) error {
 func (x *commentsEventsStream) Send(m *EventsResponse) error {
 	return x.stream.Send(m)
 }
+
+func (h *commentsHandler) Share(ctx context.Context, in *ShareRequest, out *ShareResponse) error {
+	return h.CommentsHandler.Share(ctx, in, out)
+}
+
+func (h *commentsHandler) Upvote(ctx context.Context, in *UpvoteRequest, out *UpvoteResponse) error {
+	return h.CommentsHandler.Upvote(ctx, in, out)
+}
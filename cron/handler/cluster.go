@@ -0,0 +1,288 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/cron/proto"
+	"github.com/robfig/cron/v3"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	leaderLease = "leader"
+	// the leader renews its lease well before it expires
+	leaseTTL   = time.Second * 15
+	leaseRenew = time.Second * 5
+	// how often the leader reloads all jobs in case a change was missed
+	syncInterval = time.Minute
+	// how long a fired tick is remembered
+	tickTTL = time.Hour
+
+	// topic job changes are published to
+	changesTopic = "cron.changes"
+)
+
+// change tells the leader to reload a job
+type change struct {
+	Tenant string `json:"tenant"`
+	ID     string `json:"id"`
+}
+
+func publishChange(tnt, id string) error {
+	return events.Publish(changesTopic, &change{Tenant: tnt, ID: id})
+}
+
+// tenantFromKey returns the tenant of a job key. Keys are job/<tenant>/<id>
+// and tenants contain a slash.
+func tenantFromKey(key string) string {
+	k := strings.TrimPrefix(key, jobPrefix+"/")
+	return k[:strings.LastIndex(k, "/")]
+}
+
+// lead keeps trying to become or stay the leader. Only the leader schedules
+// jobs; a replica which can't renew its lease stops all of them.
+func (c *Cron) lead() {
+	var synced time.Time
+
+	for {
+		ok, err := c.leases.Acquire(context.Background(), leaderLease, c.id, leaseTTL)
+		if err != nil {
+			log.Errorf("Failed to acquire leader lease: %v", err)
+		}
+
+		c.Lock()
+		select {
+		case <-c.done:
+			// stopped while acquiring, don't keep a lease taken since
+			if ok {
+				c.leases.Release(context.Background(), leaderLease, c.id)
+			}
+			c.Unlock()
+			return
+		default:
+		}
+		was := c.leader
+		c.leader = ok
+		if was && !ok {
+			log.Infof("Replica %s is no longer the leader", c.id)
+			for key, s := range c.jobs {
+				s.cron.Stop()
+				delete(c.jobs, key)
+			}
+		}
+		c.Unlock()
+
+		if ok && !was {
+			log.Infof("Replica %s is now the leader", c.id)
+		}
+
+		if ok && (!was || time.Since(synced) > syncInterval) {
+			c.sync()
+			synced = time.Now()
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-time.After(leaseRenew):
+		}
+	}
+}
+
+// Stop stops the jobs scheduled on this replica and gives up the leader lease
+// so another replica can take over without waiting for it to expire.
+func (c *Cron) Stop() {
+	close(c.done)
+
+	c.Lock()
+	defer c.Unlock()
+
+	for key := range c.jobs {
+		c.unschedule(key)
+	}
+	if c.leader {
+		c.leader = false
+		if err := c.leases.Release(context.Background(), leaderLease, c.id); err != nil {
+			log.Errorf("Failed to release leader lease: %v", err)
+		}
+	}
+}
+
+// watch applies job changes published by any replica
+func (c *Cron) watch() {
+	sub, err := events.Consume(changesTopic)
+	if err != nil {
+		log.Fatalf("Failed to consume job changes: %v", err)
+	}
+
+	for ev := range sub {
+		ch := new(change)
+		if err := ev.Unmarshal(ch); err != nil {
+			log.Errorf("Failed to decode job change: %v", err)
+			continue
+		}
+		c.reload(ch.Tenant, ch.ID)
+	}
+}
+
+// readJobs returns every job by key
+func readJobs() (map[string]*pb.Job, error) {
+	limit := uint(100)
+	offset := uint(0)
+	jobs := map[string]*pb.Job{}
+
+	for {
+		recs, err := store.Read(jobPrefix+"/", store.ReadPrefix(), store.ReadLimit(limit), store.ReadOffset(offset))
+		if err != nil && err != store.ErrNotFound {
+			return nil, err
+		}
+
+		// when no records are left leave
+		if len(recs) == 0 {
+			return jobs, nil
+		}
+
+		for _, rec := range recs {
+			job := new(pb.Job)
+			if err := rec.Decode(job); err != nil {
+				return nil, err
+			}
+			jobs[rec.Key] = job
+		}
+
+		// update the offset
+		offset += limit
+	}
+}
+
+// sync schedules every job on the leader
+func (c *Cron) sync() {
+	jobs, err := readJobs()
+	if err != nil {
+		log.Errorf("Failed to read jobs: %v", err)
+		return
+	}
+
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.leader {
+		return
+	}
+
+	for key := range c.jobs {
+		if _, ok := jobs[key]; !ok {
+			c.unschedule(key)
+		}
+	}
+
+	for key, job := range jobs {
+		c.schedule(key, job)
+	}
+}
+
+// reload schedules the current version of a job on the leader
+func (c *Cron) reload(tnt, id string) {
+	c.Lock()
+	defer c.Unlock()
+
+	if !c.leader {
+		return
+	}
+
+	key := jobKey(tnt, id)
+
+	job, err := readJob(tnt, id)
+	if err != nil {
+		c.unschedule(key)
+		return
+	}
+
+	c.schedule(key, job)
+}
+
+// schedule sets up the job unless it's already scheduled. Must hold the lock.
+func (c *Cron) schedule(key string, job *pb.Job) {
+	if s, ok := c.jobs[key]; ok {
+		if proto.Equal(s.job, job) {
+			return
+		}
+		s.cron.Stop()
+	}
+
+	cr, err := c.Setup(tenantFromKey(key), job)
+	if err != nil {
+		log.Errorf("Failed to set up job id: %s error: %v", job.Id, err)
+		delete(c.jobs, key)
+		return
+	}
+
+	c.jobs[key] = &scheduled{cron: cr, job: job}
+}
+
+// unschedule stops the job. Must hold the lock.
+func (c *Cron) unschedule(key string) {
+	if s, ok := c.jobs[key]; ok {
+		s.cron.Stop()
+		delete(c.jobs, key)
+	}
+}
+
+// ticks follows the times a job is scheduled at so every replica names a
+// run the same way, however late its timer fires.
+type ticks struct {
+	sync.Mutex
+	schedule cron.Schedule
+	// the last tick handed out or when the job was set up
+	prev time.Time
+}
+
+// next returns the latest scheduled time after the previous tick which isn't
+// after now. Ticks missed in between are skipped, as the scheduler does.
+func (t *ticks) next(now time.Time) time.Time {
+	t.Lock()
+	defer t.Unlock()
+
+	tick := t.schedule.Next(t.prev)
+	if tick.IsZero() || tick.After(now) {
+		return time.Time{}
+	}
+	for {
+		n := t.schedule.Next(tick)
+		if n.IsZero() || n.After(now) {
+			break
+		}
+		tick = n
+	}
+	t.prev = tick
+	return tick
+}
+
+// fire runs the job for the scheduled tick unless another replica already
+// did, e.g. while leadership changes hands.
+func (c *Cron) fire(tnt string, job *pb.Job, tick time.Time) {
+	if tick.IsZero() {
+		log.Infof("Job id: %s fired with no tick due", job.Id)
+		return
+	}
+
+	ok, err := c.leases.Claim(context.Background(), fmt.Sprintf("%s:%d", jobKey(tnt, job.Id), tick.Unix()), tickTTL)
+	if err != nil {
+		// rather skip a run than risk running it twice
+		log.Errorf("Failed to claim job id: %s error: %v", job.Id, err)
+		return
+	}
+	if !ok {
+		log.Infof("Job id: %s already ran at %s", job.Id, tick)
+		return
+	}
+
+	c.execute(tnt, job)
+}
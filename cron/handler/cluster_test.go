@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+func TestTicks(t *testing.T) {
+	every, _ := cron.ParseStandard("*/5 * * * *")
+	setup := time.Date(2021, 1, 1, 10, 2, 0, 0, time.UTC)
+	at := func(min, sec int) time.Time {
+		return time.Date(2021, 1, 1, 10, min, sec, 0, time.UTC)
+	}
+
+	tcs := []struct {
+		name string
+		now  time.Time
+		tick time.Time
+	}{
+		{name: "early", now: at(4, 59)},
+		{name: "on time", now: at(5, 0), tick: at(5, 0)},
+		{name: "late timer", now: at(10, 2), tick: at(10, 0)},
+		{name: "already handed out", now: at(10, 3)},
+		{name: "missed ticks", now: at(27, 0), tick: at(25, 0)},
+	}
+
+	tk := &ticks{schedule: every, prev: setup}
+	for _, tc := range tcs {
+		if got := tk.next(tc.now); !got.Equal(tc.tick) {
+			t.Fatalf("%s: expected tick %s, got %s", tc.name, tc.tick, got)
+		}
+	}
+
+	// a run_at job has a single tick
+	once := &ticks{schedule: onceSchedule{at: at(30, 0)}, prev: setup}
+	if got := once.next(at(30, 1)); !got.Equal(at(30, 0)) {
+		t.Fatalf("Expected the run_at tick, got %s", got)
+	}
+	if got := once.next(at(31, 0)); !got.IsZero() {
+		t.Fatalf("Expected no second tick, got %s", got)
+	}
+}
@@ -3,27 +3,47 @@ package handler
 import (
 	"context"
 	"fmt"
-	"net/http"
-	"io/ioutil"
 	"sync"
+	"time"
 
 	"github.com/robfig/cron/v3"
 	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service"
 	"github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/pkg/redis"
 	"github.com/micro/services/pkg/tenant"
 	log "github.com/micro/micro/v3/service/logger"
 	pb "github.com/micro/services/cron/proto"
+	secret "github.com/micro/services/secret/proto"
 )
 
 type Cron struct{
 	sync.Mutex
-	jobs map[string]*cron.Cron
+	// jobs scheduled on this replica, only the leader schedules jobs
+	jobs map[string]*scheduled
+	secret   secret.SecretService
+	leases   *redis.Leases
+	// unique id of this replica
+	id     string
+	leader bool
+	// closed when the replica stops
+	done chan struct{}
 }
 
-func New() *Cron {
+// scheduled is a job running on the leader
+type scheduled struct {
+	cron *cron.Cron
+	job  *pb.Job
+}
+
+func New(srv *service.Service) *Cron {
 	c := &Cron{
-		jobs: make(map[string]*cron.Cron),
+		jobs:     make(map[string]*scheduled),
+		secret:   secret.NewSecretService("secret", srv.Client()),
+		leases:   redis.NewLeases("cron"),
+		id:       uuid.New().String(),
+		done:     make(chan struct{}),
 	}
 	c.Start()
 	return c
@@ -33,63 +53,28 @@ var (
 	jobPrefix = "job"
 )
 
+// Start competes for leadership and follows job changes made on any replica
 func (c *Cron) Start() {
-	go func() {
-		limit := uint(100)
-		offset := uint(0)
-		// read all jobs
-
-		for {
-			recs, err := store.Read(jobPrefix + "/", store.ReadPrefix(), store.ReadLimit(limit), store.ReadOffset(offset))
-			if err != nil {
-				log.Errorf("Failed to start: %v", err)
-				return
-			}
-
-			// when no records are left leave
-			if len(recs) == 0 {
-				break
-			}
-
-			c.Lock()
-			for _, rec := range recs {
-				job := new(pb.Job)
-				rec.Decode(&job)
-				cr := c.Setup(job)
-				c.jobs[rec.Key] = cr
-			}
-			c.Unlock()
-
-			// update the offset
-			offset += 100
-		}
-
-	}()
+	go c.lead()
+	go c.watch()
 }
 
-func (c *Cron) Setup(job *pb.Job) *cron.Cron {
+func (c *Cron) Setup(tnt string, job *pb.Job) (*cron.Cron, error) {
 	log.Infof("Setting up job id: %s", job.Id)
+	sched, loc, err := schedule(job)
+	if err != nil {
+		return nil, err
+	}
 	// schedule the job
-	cr := cron.New()
-	cr.AddFunc(job.Interval, func() {
-		log.Infof("Running job id: %s", job.Id)
-		rsp, err := http.Get(job.Callback)
-		if err != nil {
-			log.Errorf("Failed job id: %s error: %v", job.Id, err)
-			return
-		}
-		defer rsp.Body.Close()
-		b, _ := ioutil.ReadAll(rsp.Body)
-		if rsp.StatusCode != 200 {
-			log.Errorf("Non 200 job id: %s error: %s", job.Id, string(b))
-			return
-		}
-
-		// TODO: save job state
-		log.Infof("Successful job id: %s", job.Id)
-	})
-	cr.Start()
-	return cr
+	cr := cron.New(cron.WithLocation(loc))
+	t := &ticks{schedule: sched, prev: time.Now().In(loc)}
+	cr.Schedule(sched, cron.FuncJob(func() {
+		c.fire(tnt, job, t.next(time.Now().In(loc)))
+	}))
+	if !job.Paused {
+		cr.Start()
+	}
+	return cr, nil
 }
 
 func (c *Cron) Schedule(ctx context.Context, req *pb.ScheduleRequest, rsp *pb.ScheduleResponse) error {
@@ -101,54 +86,63 @@ func (c *Cron) Schedule(ctx context.Context, req *pb.ScheduleRequest, rsp *pb.Sc
 		req.Id = uuid.New().String()
 	}
 
-	if len(req.Interval) == 0 {
-		return errors.BadRequest("cron.schedule", "missing interval")
-	}
-
 	if len(req.Callback) == 0 {
 		return errors.BadRequest("cron.schedule", "missing callback")
 	}
 
+	job := &pb.Job{
+		Id: req.Id,
+		Name: req.Name,
+		Description: req.Description,
+		Interval: req.Interval,
+		Callback: req.Callback,
+		Retry: req.Retry,
+		Alert: req.Alert,
+		Method: req.Method,
+		Headers: req.Headers,
+		Body: req.Body,
+		Timeout: req.Timeout,
+		Timezone: req.Timezone,
+		StartAt: req.StartAt,
+		EndAt: req.EndAt,
+		RunAt: req.RunAt,
+	}
+
+	if err := validateJob(job); err != nil {
+		return err
+	}
+
 	tnt, _ := tenant.FromContext(ctx)
 
-	key := fmt.Sprintf("%s/%s/%s", jobPrefix, tnt, req.Id)
+	key := jobKey(tnt, req.Id)
 
 	c.Lock()
 	defer c.Unlock()
 
-	// check local
-	if _, ok := c.jobs[key]; ok {
-		return errors.BadRequest("cron.schedule", "job already exists")
-	}
-
-	// check if it exists in store and unscheduled
+	// check if it exists in store
 	recs, err := store.Read(key, store.ReadLimit(1))
 	if err != store.ErrNotFound || len(recs) > 0 {
 		return errors.BadRequest("cron.schedule", "job already exists")
 	}
 
-	job := &pb.Job{
-		Id: req.Id,
-		Name: req.Name,
-		Description: req.Description,
-		Interval: req.Interval,
-		Callback: req.Callback,
+	if _, _, err := schedule(job); err != nil {
+		return errors.BadRequest("cron.schedule", "invalid schedule: %v", err)
 	}
 
-	// start the job
-	cr := c.Setup(job)
-	// save the job
-	c.jobs[key] = cr
-
 	rec := store.NewRecord(
 		key,
 		job,
 	)
 
+	// save in store
+	if err := store.Write(rec); err != nil {
+		return err
+	}
+
 	rsp.Job = job
 
-	// save in store
-	return store.Write(rec)
+	// let the leader schedule it
+	return publishChange(tnt, req.Id)
 }
 
 func (c *Cron) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.DeleteResponse) error {
@@ -158,18 +152,20 @@ func (c *Cron) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.Delete
 
 
 	tnt, _ := tenant.FromContext(ctx)
-	key := fmt.Sprintf("%s/%s/%s", jobPrefix, tnt, req.Id)
+	key := jobKey(tnt, req.Id)
 
-	c.Lock()
-	defer c.Unlock()
+	// delete from store
+	if err := store.Delete(key); err != nil {
+		return err
+	}
 
-	if cr, ok := c.jobs[key]; ok {
-		cr.Stop()
-		delete(c.jobs, key)
+	// let the leader unschedule it
+	if err := publishChange(tnt, req.Id); err != nil {
+		return err
 	}
 
-	// delete from store
-	return store.Delete(key)
+	// delete the history
+	return deleteRuns(tnt, req.Id)
 }
 
 func (c *Cron) Jobs(ctx context.Context, req *pb.JobsRequest, rsp *pb.JobsResponse) error {
@@ -189,3 +185,87 @@ func (c *Cron) Jobs(ctx context.Context, req *pb.JobsRequest, rsp *pb.JobsRespon
 
 	return nil
 }
+
+func readJob(tnt, id string) (*pb.Job, error) {
+	recs, err := store.Read(jobKey(tnt, id), store.ReadLimit(1))
+	if err == store.ErrNotFound || (err == nil && len(recs) == 0) {
+		return nil, errors.NotFound("cron.job", "job not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+	job := new(pb.Job)
+	if err := recs[0].Decode(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// setPaused pauses or resumes a job
+func (c *Cron) setPaused(ctx context.Context, id string, paused bool) (*pb.Job, error) {
+	tnt, _ := tenant.FromContext(ctx)
+	key := jobKey(tnt, id)
+
+	c.Lock()
+	defer c.Unlock()
+
+	job, err := readJob(tnt, id)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Paused = paused
+	if err := store.Write(store.NewRecord(key, job)); err != nil {
+		return nil, err
+	}
+
+	return job, publishChange(tnt, id)
+}
+
+func (c *Cron) Pause(ctx context.Context, req *pb.PauseRequest, rsp *pb.PauseResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("cron.pause", "missing id")
+	}
+
+	job, err := c.setPaused(ctx, req.Id, true)
+	if err != nil {
+		return err
+	}
+
+	rsp.Job = job
+
+	return nil
+}
+
+func (c *Cron) Resume(ctx context.Context, req *pb.ResumeRequest, rsp *pb.ResumeResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("cron.resume", "missing id")
+	}
+
+	job, err := c.setPaused(ctx, req.Id, false)
+	if err != nil {
+		return err
+	}
+
+	rsp.Job = job
+
+	return nil
+}
+
+func (c *Cron) Trigger(ctx context.Context, req *pb.TriggerRequest, rsp *pb.TriggerResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("cron.trigger", "missing id")
+	}
+
+	tnt, _ := tenant.FromContext(ctx)
+
+	job, err := readJob(tnt, req.Id)
+	if err != nil {
+		return err
+	}
+
+	// run it now, the outcome is recorded in the history
+	go c.execute(tnt, job)
+
+	return nil
+}
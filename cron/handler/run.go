@@ -0,0 +1,408 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/client"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/events"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/cron/proto"
+	"github.com/micro/services/pkg/network"
+	"github.com/micro/services/pkg/tenant"
+	secret "github.com/micro/services/secret/proto"
+)
+
+const (
+	runPrefix = "run"
+	// how long the run history is kept
+	runExpiry = time.Hour * 24 * 7
+	// max bytes of the response body recorded
+	maxBodySize = 1024
+
+	maxRetries        = 10
+	defaultBackoff    = time.Second
+	defaultMaxBackoff = time.Minute
+
+	defaultHistoryLimit = 25
+	maxHistoryLimit     = 1000
+
+	// topic of the event service alerts are published to
+	failureTopic = "cron.failures"
+	alertTimeout = 10 * time.Second
+)
+
+// alertClient calls the user provided alert webhooks
+var alertClient = newClient(alertTimeout, network.IsPrivateIP)
+
+// privateCallback returns whether a job callback host is a private address
+var privateCallback = network.IsPrivateIP
+
+// newClient returns a client for user provided urls which won't follow
+// redirects to private addresses
+func newClient(timeout time.Duration, private func(host string) bool) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			if private(req.URL.Host) {
+				return fmt.Errorf("redirected to a private address")
+			}
+			return nil
+		},
+	}
+}
+
+// secretRef matches references to secrets in header values e.g {{secret.token}}
+var secretRef = regexp.MustCompile(`{{\s*secret\.([^}\s]+)\s*}}`)
+
+// FailureAlert is sent when a job failed too many times in a row
+type FailureAlert struct {
+	JobID    string  `json:"job_id"`
+	Name     string  `json:"name"`
+	Failures int32   `json:"failures"`
+	Run      *pb.Run `json:"run"`
+}
+
+func jobKey(tnt, id string) string {
+	return fmt.Sprintf("%s/%s/%s", jobPrefix, tnt, id)
+}
+
+func runKey(tnt, jobID string, started time.Time, id string) string {
+	return fmt.Sprintf("%s%019d/%s", runsPrefix(tnt, jobID), started.UnixNano(), id)
+}
+
+func runsPrefix(tnt, jobID string) string {
+	return fmt.Sprintf("%s/%s/%s/", runPrefix, tnt, jobID)
+}
+
+// validatePolicy checks the retry policy and alert of a job
+func validatePolicy(retry *pb.RetryPolicy, alert *pb.Alert) error {
+	if retry != nil {
+		if retry.MaxRetries < 0 || retry.MaxRetries > maxRetries {
+			return errors.BadRequest("cron.schedule", "max retries must be between 0 and %d", maxRetries)
+		}
+		for _, d := range []string{retry.InitialBackoff, retry.MaxBackoff} {
+			if len(d) == 0 {
+				continue
+			}
+			if v, err := time.ParseDuration(d); err != nil || v <= 0 {
+				return errors.BadRequest("cron.schedule", "invalid backoff %s", d)
+			}
+		}
+	}
+
+	if alert != nil {
+		if alert.AfterFailures < 1 {
+			return errors.BadRequest("cron.schedule", "alert after failures must be at least 1")
+		}
+		if len(alert.Webhook) > 0 {
+			u, err := url.Parse(alert.Webhook)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return errors.BadRequest("cron.schedule", "invalid alert webhook")
+			}
+			if network.IsPrivateIP(u.Host) {
+				return errors.BadRequest("cron.schedule", "alert webhook resolves to a private address")
+			}
+		}
+	}
+
+	return nil
+}
+
+func backoffs(retry *pb.RetryPolicy) (time.Duration, time.Duration) {
+	backoff, maxBackoff := defaultBackoff, defaultMaxBackoff
+	if retry == nil {
+		return backoff, maxBackoff
+	}
+	if d, err := time.ParseDuration(retry.InitialBackoff); err == nil {
+		backoff = d
+	}
+	if d, err := time.ParseDuration(retry.MaxBackoff); err == nil {
+		maxBackoff = d
+	}
+	return backoff, maxBackoff
+}
+
+// execute runs the job, retrying failed attempts with exponential backoff
+func (c *Cron) execute(tnt string, job *pb.Job) {
+	backoff, maxBackoff := backoffs(job.Retry)
+
+	// the streak is kept in the run history so it survives restarts and
+	// changes of leader
+	failures, err := lastFailures(tnt, job.Id)
+	if err != nil {
+		log.Errorf("Failed to read the last run of job id: %s error: %v", job.Id, err)
+	}
+
+	var run *pb.Run
+	for attempt := int32(1); ; attempt++ {
+		log.Infof("Running job id: %s attempt: %d", job.Id, attempt)
+
+		run = c.call(tnt, job, attempt)
+		if !run.Success {
+			run.Failures = failures + 1
+		}
+		if err := saveRun(tnt, run); err != nil {
+			log.Errorf("Failed to save run of job id: %s error: %v", job.Id, err)
+		}
+
+		if run.Success {
+			log.Infof("Successful job id: %s", job.Id)
+			break
+		}
+		log.Errorf("Failed job id: %s status: %d error: %s", job.Id, run.StatusCode, run.Error)
+
+		if attempt > job.GetRetry().GetMaxRetries() {
+			break
+		}
+
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+
+		// stop retrying deleted jobs
+		if _, err := readJob(tnt, job.Id); err != nil {
+			return
+		}
+	}
+
+	// alert once per streak of failures
+	if job.Alert != nil && run.Failures == job.Alert.AfterFailures {
+		alert(tnt, job, &FailureAlert{
+			JobID:    job.Id,
+			Name:     job.Name,
+			Failures: run.Failures,
+			Run:      run,
+		})
+	}
+}
+
+// lastFailures returns the consecutive failures recorded by the latest run of the job
+func lastFailures(tnt, jobID string) (int32, error) {
+	keys, err := store.List(store.ListPrefix(runsPrefix(tnt, jobID)), store.ListOrder(store.OrderDesc), store.ListLimit(1))
+	if err != nil || len(keys) == 0 {
+		return 0, err
+	}
+
+	recs, err := store.Read(keys[0], store.ReadLimit(1))
+	if err == store.ErrNotFound || (err == nil && len(recs) == 0) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	run := new(pb.Run)
+	if err := recs[0].Decode(run); err != nil {
+		return 0, err
+	}
+	return run.Failures, nil
+}
+
+// call the callback of the job once
+func (c *Cron) call(tnt string, job *pb.Job, attempt int32) *pb.Run {
+	started := time.Now()
+	run := &pb.Run{
+		Id:      uuid.New().String(),
+		JobId:   job.Id,
+		Started: started.Format(time.RFC3339Nano),
+		Attempt: attempt,
+	}
+
+	req, err := c.request(tnt, job)
+	if err != nil {
+		run.Error = err.Error()
+		return run
+	}
+
+	timeout := defaultTimeout
+	if d, err := time.ParseDuration(job.Timeout); err == nil {
+		timeout = d
+	}
+
+	// the host may resolve differently than when the job was scheduled
+	if privateCallback(req.URL.Host) {
+		run.Error = "callback resolves to a private address"
+		return run
+	}
+
+	rsp, err := newClient(timeout, privateCallback).Do(req)
+	if err != nil {
+		run.Duration = time.Since(started).Milliseconds()
+		run.Error = err.Error()
+		return run
+	}
+	defer rsp.Body.Close()
+
+	b, _ := ioutil.ReadAll(io.LimitReader(rsp.Body, maxBodySize))
+	run.Duration = time.Since(started).Milliseconds()
+	run.StatusCode = int32(rsp.StatusCode)
+	run.Body = string(b)
+	run.Success = rsp.StatusCode >= 200 && rsp.StatusCode < 300
+
+	return run
+}
+
+// request builds the http request of the job, resolving secrets in the headers
+func (c *Cron) request(tnt string, job *pb.Job) (*http.Request, error) {
+	method := job.Method
+	if len(method) == 0 {
+		method = http.MethodGet
+	}
+
+	var body io.Reader
+	if len(job.Body) > 0 {
+		body = strings.NewReader(job.Body)
+	}
+
+	req, err := http.NewRequest(method, job.Callback, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for k, v := range job.Headers {
+		var rerr error
+		v = secretRef.ReplaceAllStringFunc(v, func(ref string) string {
+			key := secretRef.FindStringSubmatch(ref)[1]
+			rsp, err := c.secret.Resolve(context.Background(), &secret.ResolveRequest{
+				TenantId: tnt,
+				Key:      key,
+			}, client.WithAuthToken())
+			if err != nil {
+				rerr = fmt.Errorf("failed to resolve secret %s: %v", key, err)
+				return ""
+			}
+			return rsp.Value
+		})
+		if rerr != nil {
+			return nil, rerr
+		}
+		req.Header.Set(k, v)
+	}
+
+	return req, nil
+}
+
+func saveRun(tnt string, run *pb.Run) error {
+	started, _ := time.Parse(time.RFC3339Nano, run.Started)
+	rec := store.NewRecord(runKey(tnt, run.JobId, started, run.Id), run)
+	rec.Expiry = runExpiry
+	return store.Write(rec)
+}
+
+// deleteRuns removes the history of a job
+func deleteRuns(tnt, jobID string) error {
+	keys, err := store.List(store.ListPrefix(runsPrefix(tnt, jobID)))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := store.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// alert publishes the failure to the tenant's event stream and calls the webhook
+func alert(tnt string, job *pb.Job, a *FailureAlert) {
+	log.Infof("Alerting on job id: %s after %d failures", job.Id, a.Failures)
+
+	if err := events.Publish(path.Join("event", tnt, failureTopic), a); err != nil {
+		log.Errorf("Failed to publish alert for job id: %s error: %v", job.Id, err)
+	}
+
+	if len(job.Alert.Webhook) == 0 {
+		return
+	}
+
+	b, err := json.Marshal(a)
+	if err != nil {
+		log.Errorf("Failed to encode alert for job id: %s error: %v", job.Id, err)
+		return
+	}
+
+	uri, err := url.Parse(job.Alert.Webhook)
+	if err != nil {
+		log.Errorf("Invalid alert webhook for job id: %s error: %v", job.Id, err)
+		return
+	}
+
+	// the host may resolve differently than when the job was scheduled
+	if network.IsPrivateIP(uri.Host) {
+		log.Errorf("Alert webhook for job id: %s resolves to a private address", job.Id)
+		return
+	}
+
+	rsp, err := alertClient.Post(job.Alert.Webhook, "application/json", bytes.NewReader(b))
+	if err != nil {
+		log.Errorf("Failed to call alert webhook for job id: %s error: %v", job.Id, err)
+		return
+	}
+	rsp.Body.Close()
+
+	if rsp.StatusCode < 200 || rsp.StatusCode >= 300 {
+		log.Errorf("Alert webhook for job id: %s returned %d", job.Id, rsp.StatusCode)
+	}
+}
+
+func (c *Cron) History(ctx context.Context, req *pb.HistoryRequest, rsp *pb.HistoryResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("cron.history", "missing id")
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultHistoryLimit
+	}
+	if limit > maxHistoryLimit {
+		limit = maxHistoryLimit
+	}
+
+	tnt, _ := tenant.FromContext(ctx)
+
+	recs, err := store.Read(runsPrefix(tnt, req.Id), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	// most recent first
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Key > recs[j].Key
+	})
+
+	for _, rec := range recs {
+		if len(rsp.Runs) == limit {
+			break
+		}
+		run := new(pb.Run)
+		if err := rec.Decode(run); err != nil {
+			return err
+		}
+		rsp.Runs = append(rsp.Runs, run)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/events/stream/memory"
+	"github.com/micro/micro/v3/service/store"
+	smem "github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/cron/proto"
+)
+
+func TestValidatePolicy(t *testing.T) {
+	tcs := []struct {
+		name  string
+		retry *pb.RetryPolicy
+		alert *pb.Alert
+		ok    bool
+	}{
+		{name: "none", ok: true},
+		{name: "retries", retry: &pb.RetryPolicy{MaxRetries: 3, InitialBackoff: "1s", MaxBackoff: "1m"}, ok: true},
+		{name: "too many retries", retry: &pb.RetryPolicy{MaxRetries: maxRetries + 1}},
+		{name: "bad backoff", retry: &pb.RetryPolicy{InitialBackoff: "-1s"}},
+		{name: "alert", alert: &pb.Alert{AfterFailures: 3}, ok: true},
+		{name: "alert after no failures", alert: &pb.Alert{}},
+		{name: "webhook scheme", alert: &pb.Alert{AfterFailures: 1, Webhook: "ftp://example.com"}},
+		{name: "private webhook", alert: &pb.Alert{AfterFailures: 1, Webhook: "http://127.0.0.1:8080/alert"}},
+		{name: "internal webhook", alert: &pb.Alert{AfterFailures: 1, Webhook: "http://10.0.0.1/alert"}},
+	}
+
+	for _, tc := range tcs {
+		err := validatePolicy(tc.retry, tc.alert)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: expected ok %v, got %v", tc.name, tc.ok, err)
+		}
+	}
+}
+
+func TestFailureStreak(t *testing.T) {
+	store.DefaultStore = smem.NewStore()
+	events.DefaultStream, _ = memory.NewStream()
+
+	var status, alerts int32 = http.StatusInternalServerError, 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/alert" {
+			atomic.AddInt32(&alerts, 1)
+			return
+		}
+		w.WriteHeader(int(atomic.LoadInt32(&status)))
+	}))
+	defer srv.Close()
+
+	// the callback is on a private address, the alert webhook isn't allowed to be
+	allowHost(t, srv.URL)
+
+	job := &pb.Job{
+		Id:       "job",
+		Callback: srv.URL,
+		Alert:    &pb.Alert{AfterFailures: 2, Webhook: srv.URL + "/alert"},
+	}
+	c := new(Cron)
+
+	// a new replica picks up the streak from the run history
+	for want := int32(1); want <= 3; want++ {
+		c.execute("t", job)
+		got, err := lastFailures("t", job.Id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Fatalf("Expected %d failures, got %d", want, got)
+		}
+		c = new(Cron)
+	}
+
+	atomic.StoreInt32(&status, http.StatusOK)
+	c.execute("t", job)
+	if got, _ := lastFailures("t", job.Id); got != 0 {
+		t.Fatalf("Expected the streak to reset, got %d", got)
+	}
+
+	// the webhook is on a private address so it's never called
+	if n := atomic.LoadInt32(&alerts); n != 0 {
+		t.Fatalf("Expected no calls to a private webhook, got %d", n)
+	}
+}
+
+// allowHost lets jobs call back the private test server
+func allowHost(t *testing.T, rawurl string) {
+	u, _ := url.Parse(rawurl)
+	private := privateCallback
+	privateCallback = func(host string) bool {
+		return host != u.Host && private(host)
+	}
+	t.Cleanup(func() { privateCallback = private })
+}
+
+func TestPrivateCallback(t *testing.T) {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/redirect" {
+			// the same server by another name
+			http.Redirect(w, r, strings.Replace(srv.URL, "127.0.0.1", "localhost", 1)+"/secret", http.StatusFound)
+			return
+		}
+		w.Write([]byte("secret"))
+	}))
+	defer srv.Close()
+
+	tcs := []struct {
+		name     string
+		callback string
+		allow    bool
+		valid    bool
+		body     string
+	}{
+		{name: "metadata", callback: "http://169.254.169.254/latest/meta-data/"},
+		{name: "loopback", callback: srv.URL},
+		{name: "internal", callback: "http://10.0.0.1/"},
+		{name: "allowed", callback: srv.URL, allow: true, valid: true, body: "secret"},
+		{name: "redirect to private", callback: srv.URL + "/redirect", allow: true, valid: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.allow {
+				allowHost(t, srv.URL)
+			}
+
+			job := &pb.Job{Id: "job", Callback: tc.callback, Interval: "* * * * *"}
+			if err := validateJob(job); (err == nil) != tc.valid {
+				t.Fatalf("validateJob = %v, want valid %v", err, tc.valid)
+			}
+
+			run := new(Cron).call("t", job, 0)
+			if run.Body != tc.body {
+				t.Errorf("body = %q, want %q", run.Body, tc.body)
+			}
+			if len(tc.body) == 0 && (run.Success || len(run.Error) == 0) {
+				t.Errorf("expected the call to fail, got %+v", run)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	pb "github.com/micro/services/cron/proto"
+	"github.com/robfig/cron/v3"
+)
+
+const (
+	defaultTimeout = time.Second * 30
+	maxTimeout     = time.Minute * 5
+)
+
+var methods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+	http.MethodHead:   true,
+}
+
+// onceSchedule fires a single time
+type onceSchedule struct {
+	at time.Time
+}
+
+func (s onceSchedule) Next(t time.Time) time.Time {
+	if t.Before(s.at) {
+		return s.at
+	}
+	// never again
+	return time.Time{}
+}
+
+// windowSchedule limits a schedule to the time between start and end
+type windowSchedule struct {
+	cron.Schedule
+	start time.Time
+	end   time.Time
+}
+
+func (s windowSchedule) Next(t time.Time) time.Time {
+	if !s.start.IsZero() && t.Before(s.start) {
+		t = s.start.Add(-time.Second)
+	}
+	next := s.Schedule.Next(t)
+	if !s.end.IsZero() && !next.Before(s.end) {
+		return time.Time{}
+	}
+	return next
+}
+
+func parseTime(val string) (time.Time, error) {
+	if len(val) == 0 {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, val)
+}
+
+// schedule returns when the job runs and the location it's scheduled in
+func schedule(job *pb.Job) (cron.Schedule, *time.Location, error) {
+	loc, err := time.LoadLocation(job.Timezone)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if len(job.RunAt) > 0 {
+		at, err := parseTime(job.RunAt)
+		if err != nil {
+			return nil, nil, err
+		}
+		return onceSchedule{at: at}, loc, nil
+	}
+
+	sched, err := cron.ParseStandard(job.Interval)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	start, err := parseTime(job.StartAt)
+	if err != nil {
+		return nil, nil, err
+	}
+	end, err := parseTime(job.EndAt)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return windowSchedule{Schedule: sched, start: start, end: end}, loc, nil
+}
+
+// validateJob checks the job definition and sets the defaults
+func validateJob(job *pb.Job) error {
+	if len(job.Interval) == 0 && len(job.RunAt) == 0 {
+		return errors.BadRequest("cron.schedule", "missing interval or run_at")
+	}
+	if len(job.Interval) > 0 && len(job.RunAt) > 0 {
+		return errors.BadRequest("cron.schedule", "only one of interval and run_at can be set")
+	}
+	if len(job.RunAt) > 0 && (len(job.StartAt) > 0 || len(job.EndAt) > 0) {
+		return errors.BadRequest("cron.schedule", "start_at and end_at can't be set for run_at jobs")
+	}
+
+	u, err := url.Parse(job.Callback)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return errors.BadRequest("cron.schedule", "invalid callback")
+	}
+	if privateCallback(u.Host) {
+		return errors.BadRequest("cron.schedule", "callback resolves to a private address")
+	}
+
+	job.Method = strings.ToUpper(job.Method)
+	if len(job.Method) == 0 {
+		job.Method = http.MethodGet
+	}
+	if !methods[job.Method] {
+		return errors.BadRequest("cron.schedule", "unsupported method %s", job.Method)
+	}
+
+	if len(job.Body) > 0 && !json.Valid([]byte(job.Body)) {
+		return errors.BadRequest("cron.schedule", "body must be JSON")
+	}
+
+	if len(job.Timeout) == 0 {
+		job.Timeout = defaultTimeout.String()
+	}
+	if d, err := time.ParseDuration(job.Timeout); err != nil || d <= 0 || d > maxTimeout {
+		return errors.BadRequest("cron.schedule", "timeout must be a duration up to %s", maxTimeout)
+	}
+
+	if len(job.Timezone) == 0 {
+		job.Timezone = "UTC"
+	}
+	if _, err := time.LoadLocation(job.Timezone); err != nil {
+		return errors.BadRequest("cron.schedule", "invalid timezone %s", job.Timezone)
+	}
+
+	var start, end, runAt time.Time
+	for _, t := range []struct {
+		name string
+		val  string
+		dst  *time.Time
+	}{
+		{"start_at", job.StartAt, &start},
+		{"end_at", job.EndAt, &end},
+		{"run_at", job.RunAt, &runAt},
+	} {
+		v, err := parseTime(t.val)
+		if err != nil {
+			return errors.BadRequest("cron.schedule", "%s must be an RFC3339 time", t.name)
+		}
+		*t.dst = v
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return errors.BadRequest("cron.schedule", "start_at must be before end_at")
+	}
+	if !runAt.IsZero() && runAt.Before(time.Now()) {
+		return errors.BadRequest("cron.schedule", "run_at must be in the future")
+	}
+
+	if len(job.Interval) > 0 {
+		if _, err := cron.ParseStandard(job.Interval); err != nil {
+			return errors.BadRequest("cron.schedule", "invalid interval: %v", err)
+		}
+	}
+
+	return validatePolicy(job.Retry, job.Alert)
+}
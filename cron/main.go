@@ -15,10 +15,14 @@ func main() {
 	)
 
 	// Register handler
-	pb.RegisterCronHandler(srv.Server(), handler.New())
+	h := handler.New(srv)
+	pb.RegisterCronHandler(srv.Server(), h)
 
 	// Run service
 	if err := srv.Run(); err != nil {
 		logger.Fatal(err)
 	}
+
+	// let another replica take over straight away
+	h.Stop()
 }
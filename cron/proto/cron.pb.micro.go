@@ -45,6 +45,10 @@ type CronService interface {
 	Schedule(ctx context.Context, in *ScheduleRequest, opts ...client.CallOption) (*ScheduleResponse, error)
 	Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error)
 	Jobs(ctx context.Context, in *JobsRequest, opts ...client.CallOption) (*JobsResponse, error)
+	History(ctx context.Context, in *HistoryRequest, opts ...client.CallOption) (*HistoryResponse, error)
+	Pause(ctx context.Context, in *PauseRequest, opts ...client.CallOption) (*PauseResponse, error)
+	Resume(ctx context.Context, in *ResumeRequest, opts ...client.CallOption) (*ResumeResponse, error)
+	Trigger(ctx context.Context, in *TriggerRequest, opts ...client.CallOption) (*TriggerResponse, error)
 }
 
 type cronService struct {
@@ -89,12 +93,56 @@ func (c *cronService) Jobs(ctx context.Context, in *JobsRequest, opts ...client.
 	return out, nil
 }
 
+func (c *cronService) History(ctx context.Context, in *HistoryRequest, opts ...client.CallOption) (*HistoryResponse, error) {
+	req := c.c.NewRequest(c.name, "Cron.History", in)
+	out := new(HistoryResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cronService) Pause(ctx context.Context, in *PauseRequest, opts ...client.CallOption) (*PauseResponse, error) {
+	req := c.c.NewRequest(c.name, "Cron.Pause", in)
+	out := new(PauseResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cronService) Resume(ctx context.Context, in *ResumeRequest, opts ...client.CallOption) (*ResumeResponse, error) {
+	req := c.c.NewRequest(c.name, "Cron.Resume", in)
+	out := new(ResumeResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *cronService) Trigger(ctx context.Context, in *TriggerRequest, opts ...client.CallOption) (*TriggerResponse, error) {
+	req := c.c.NewRequest(c.name, "Cron.Trigger", in)
+	out := new(TriggerResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Cron service
 
 type CronHandler interface {
 	Schedule(context.Context, *ScheduleRequest, *ScheduleResponse) error
 	Delete(context.Context, *DeleteRequest, *DeleteResponse) error
 	Jobs(context.Context, *JobsRequest, *JobsResponse) error
+	History(context.Context, *HistoryRequest, *HistoryResponse) error
+	Pause(context.Context, *PauseRequest, *PauseResponse) error
+	Resume(context.Context, *ResumeRequest, *ResumeResponse) error
+	Trigger(context.Context, *TriggerRequest, *TriggerResponse) error
 }
 
 func RegisterCronHandler(s server.Server, hdlr CronHandler, opts ...server.HandlerOption) error {
@@ -102,6 +150,10 @@ func RegisterCronHandler(s server.Server, hdlr CronHandler, opts ...server.Handl
 		Schedule(ctx context.Context, in *ScheduleRequest, out *ScheduleResponse) error
 		Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error
 		Jobs(ctx context.Context, in *JobsRequest, out *JobsResponse) error
+		History(ctx context.Context, in *HistoryRequest, out *HistoryResponse) error
+		Pause(ctx context.Context, in *PauseRequest, out *PauseResponse) error
+		Resume(ctx context.Context, in *ResumeRequest, out *ResumeResponse) error
+		Trigger(ctx context.Context, in *TriggerRequest, out *TriggerResponse) error
 	}
 	type Cron struct {
 		cron
@@ -125,3 +177,19 @@ func (h *cronHandler) Delete(ctx context.Context, in *DeleteRequest, out *Delete
 func (h *cronHandler) Jobs(ctx context.Context, in *JobsRequest, out *JobsResponse) error {
 	return h.CronHandler.Jobs(ctx, in, out)
 }
+
+func (h *cronHandler) History(ctx context.Context, in *HistoryRequest, out *HistoryResponse) error {
+	return h.CronHandler.History(ctx, in, out)
+}
+
+func (h *cronHandler) Pause(ctx context.Context, in *PauseRequest, out *PauseResponse) error {
+	return h.CronHandler.Pause(ctx, in, out)
+}
+
+func (h *cronHandler) Resume(ctx context.Context, in *ResumeRequest, out *ResumeResponse) error {
+	return h.CronHandler.Resume(ctx, in, out)
+}
+
+func (h *cronHandler) Trigger(ctx context.Context, in *TriggerRequest, out *TriggerResponse) error {
+	return h.CronHandler.Trigger(ctx, in, out)
+}
@@ -14,6 +14,7 @@ import (
 	db "github.com/micro/services/db/proto"
 	pauth "github.com/micro/services/pkg/auth"
 	gorm2 "github.com/micro/services/pkg/gorm"
+	pquery "github.com/micro/services/pkg/query"
 	adminpb "github.com/micro/services/pkg/service/proto"
 	"github.com/micro/services/pkg/tenant"
 	"github.com/patrickmn/go-cache"
@@ -203,7 +204,7 @@ func (e *Db) Update(ctx context.Context, req *db.UpdateRequest, rsp *db.UpdateRe
 
 func (e *Db) Read(ctx context.Context, req *db.ReadRequest, rsp *db.ReadResponse) error {
 	recs := []Record{}
-	queries, err := Parse(req.Query)
+	queries, err := pquery.Parse(req.Query)
 	if err != nil {
 		return err
 	}
@@ -246,17 +247,17 @@ func (e *Db) Read(ctx context.Context, req *db.ReadRequest, rsp *db.ReadResponse
 			}
 			op := ""
 			switch query.Op {
-			case itemEquals:
+			case pquery.Equals:
 				op = "="
-			case itemGreaterThan:
+			case pquery.GreaterThan:
 				op = ">"
-			case itemGreaterThanEquals:
+			case pquery.GreaterThanEquals:
 				op = ">="
-			case itemLessThan:
+			case pquery.LessThan:
 				op = "<"
-			case itemLessThanEquals:
+			case pquery.LessThanEquals:
 				op = "<="
-			case itemNotEquals:
+			case pquery.NotEquals:
 				op = "!="
 			}
 			queryField := correctFieldName(query.Field, typ == "text")
@@ -0,0 +1,422 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/events"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/event/proto"
+	"github.com/micro/services/pkg/index"
+	"github.com/micro/services/pkg/query"
+	"github.com/micro/services/pkg/tenant"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	pendingPrefix = "pending"
+	// pending messages ordered by when they're due for redelivery
+	duePrefix = "due"
+
+	defaultVisibilityTimeout = 30
+	maxVisibilityTimeout     = 60 * 60 * 12
+	defaultMaxAttempts       = 5
+	maxMaxAttempts           = 100
+
+	// how often unacked messages are checked for redelivery
+	redeliverInterval = time.Second
+	// number of due keys listed at a time
+	dueBatch = 100
+	// how long a redelivery claim outlives the visibility timeout, long
+	// enough for every consumer to see the bumped attempt
+	claimTTL = time.Minute
+
+	dlqSuffix = ".dlq"
+)
+
+// pending is a message delivered to a group which hasn't been acked yet
+type pending struct {
+	ID        string
+	Topic     string
+	Group     string
+	Payload   []byte
+	Timestamp time.Time
+	Attempt   int32
+	Deadline  time.Time
+}
+
+// claimer hands each key to a single caller, see redis.Leases
+type claimer interface {
+	Claim(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
+
+// pendingKey escapes the topic and group so neither can reach into the
+// keys of another e.g. group a/b of topic x and group b of topic x/a
+func pendingKey(tnt, topic, group, id string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/%s", pendingPrefix, tnt, url.PathEscape(topic), url.PathEscape(group), id)
+}
+
+func duePrefixKey(tnt, topic, group string) string {
+	return fmt.Sprintf("%s/%s/%s/%s/", duePrefix, tnt, url.PathEscape(topic), url.PathEscape(group))
+}
+
+// dueKey orders the message of the group by its deadline
+func dueKey(tnt string, p *pending) string {
+	return fmt.Sprintf("%s%019d/%s", duePrefixKey(tnt, p.Topic, p.Group), p.Deadline.UnixNano(), p.ID)
+}
+
+// writePending tracks the message and indexes it by its deadline. A
+// deadline indexed before is left for duePending to clean up.
+func writePending(tnt string, p *pending) error {
+	if err := store.Write(store.NewRecord(pendingKey(tnt, p.Topic, p.Group, p.ID), p)); err != nil {
+		return err
+	}
+	return store.Write(&store.Record{Key: dueKey(tnt, p), Value: []byte(p.ID)})
+}
+
+// indexPending indexes the deadlines of the group's messages tracked before
+// the deadlines were indexed
+func indexPending(tnt, topic, group string) error {
+	// the marker is outside the prefix of the due keys
+	return index.Backfill(strings.TrimSuffix(duePrefixKey(tnt, topic, group), "/"), func() error {
+		recs, err := store.Read(pendingKey(tnt, topic, group, ""), store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+
+		for _, rec := range recs {
+			p := new(pending)
+			if err := json.Unmarshal(rec.Value, p); err != nil {
+				return err
+			}
+			if err := store.Write(&store.Record{Key: dueKey(tnt, p), Value: []byte(p.ID)}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// consumeAcked streams messages which have to be acked, redelivering the
+// ones which weren't acked in time and dead lettering them after max attempts.
+func (s *Event) consumeAcked(ctx context.Context, tnt string, req *pb.ConsumeRequest, filter []query.Query, opts []events.ConsumeOption, stream pb.Event_ConsumeStream) error {
+	visibility := time.Duration(req.VisibilityTimeout) * time.Second
+	maxAttempts := req.MaxAttempts
+
+	topic := path.Join("event", tnt, req.Topic)
+
+	// messages are only acked on the stream once they're tracked as pending
+	opts = append(opts, events.WithAutoAck(false, visibility), events.WithContext(ctx))
+
+	if err := indexPending(tnt, req.Topic, req.Group); err != nil {
+		log.Errorf("Error indexing pending messages: %v", err)
+		return errors.InternalServerError("event.subscribe", "failed to subscribe to event")
+	}
+
+	sub, err := events.Consume(topic, opts...)
+	if err != nil {
+		return errors.InternalServerError("event.subscribe", "failed to subscribe to event")
+	}
+
+	send := func(p *pending) error {
+		d := &structpb.Struct{}
+		d.UnmarshalJSON(p.Payload)
+
+		return stream.Send(&pb.ConsumeResponse{
+			Topic:     req.Topic,
+			Id:        p.ID,
+			Timestamp: p.Timestamp.Format(time.RFC3339Nano),
+			Message:   d,
+			Attempt:   p.Attempt,
+		})
+	}
+
+	t := retention(tnt, req.Topic)
+
+	ticker := time.NewTicker(redeliverInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-sub:
+			if !ok {
+				return nil
+			}
+
+			if !t.retained(msg.Timestamp) {
+				msg.Ack()
+				continue
+			}
+
+			// filtered out messages count as consumed
+			if !matches(filter, msg.Payload) {
+				msg.Ack()
+				writeOffset(tnt, req.Topic, req.Group, &msg)
+				continue
+			}
+
+			p := &pending{
+				ID:        msg.ID,
+				Topic:     req.Topic,
+				Group:     req.Group,
+				Payload:   msg.Payload,
+				Timestamp: msg.Timestamp,
+				Attempt:   1,
+				Deadline:  time.Now().Add(visibility),
+			}
+			if err := writePending(tnt, p); err != nil {
+				log.Errorf("Error tracking message %s: %v", msg.ID, err)
+				msg.Nack()
+				continue
+			}
+			msg.Ack()
+			writeOffset(tnt, req.Topic, req.Group, &msg)
+
+			if err := send(p); err != nil {
+				return err
+			}
+		case <-ticker.C:
+			due, err := s.claimDue(tnt, req.Topic, req.Group, visibility, maxAttempts)
+			if err != nil {
+				log.Errorf("Error reading pending messages: %v", err)
+				continue
+			}
+
+			for _, p := range due {
+				if err := send(p); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// claimDue claims the group's messages which weren't acked in time and
+// returns the ones to redeliver. Every consumer of the group checks for them,
+// so each attempt is claimed first for only one of them to redeliver it.
+func (s *Event) claimDue(tnt, topic, group string, visibility time.Duration, maxAttempts int32) ([]*pending, error) {
+	due, err := duePending(tnt, topic, group)
+	if err != nil {
+		return nil, err
+	}
+
+	var claimed []*pending
+	for _, p := range due {
+		key := fmt.Sprintf("%s:%d", pendingKey(tnt, p.Topic, p.Group, p.ID), p.Attempt)
+		ok, err := s.claims.Claim(context.Background(), key, visibility+claimTTL)
+		if err != nil {
+			log.Errorf("Error claiming message %s: %v", p.ID, err)
+			continue
+		}
+		if !ok {
+			continue
+		}
+
+		if p.Attempt >= maxAttempts {
+			if err := deadLetter(tnt, p); err != nil {
+				log.Errorf("Error dead lettering message %s: %v", p.ID, err)
+			}
+			continue
+		}
+
+		store.Delete(dueKey(tnt, p))
+		p.Attempt++
+		p.Deadline = time.Now().Add(visibility)
+		if err := writePending(tnt, p); err != nil {
+			log.Errorf("Error tracking message %s: %v", p.ID, err)
+			continue
+		}
+		claimed = append(claimed, p)
+	}
+	return claimed, nil
+}
+
+// duePending returns the messages of a group which weren't acked in time,
+// reading only as far as the first deadline still to come
+func duePending(tnt, topic, group string) ([]*pending, error) {
+	prefix := duePrefixKey(tnt, topic, group)
+	now := time.Now()
+
+	var due []*pending
+	for offset := uint(0); ; offset += dueBatch {
+		keys, err := store.List(store.ListPrefix(prefix), store.ListOffset(offset), store.ListLimit(dueBatch))
+		if err != nil {
+			return nil, err
+		}
+
+		stale := 0
+		for _, key := range keys {
+			parts := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			nanos, err := strconv.ParseInt(parts[0], 10, 64)
+			if err != nil {
+				continue
+			}
+			deadline := time.Unix(0, nanos)
+			if deadline.After(now) {
+				return due, nil
+			}
+
+			recs, err := store.Read(pendingKey(tnt, topic, group, parts[1]))
+			if err != nil && err != store.ErrNotFound {
+				return nil, err
+			}
+
+			var p *pending
+			if len(recs) > 0 {
+				p = new(pending)
+				if err := json.Unmarshal(recs[0].Value, p); err != nil {
+					return nil, err
+				}
+			}
+
+			// acked, or redelivered since with a new deadline
+			if p == nil || !p.Deadline.Equal(deadline) {
+				if err := store.Delete(key); err != nil {
+					return nil, err
+				}
+				stale++
+				continue
+			}
+			due = append(due, p)
+		}
+
+		if len(keys) < dueBatch {
+			return due, nil
+		}
+		// deleted keys no longer count towards the offset
+		offset -= uint(stale)
+	}
+}
+
+// deadLetter moves the message to the <topic>.dlq topic
+func deadLetter(tnt string, p *pending) error {
+	if err := publishDeadLetter(tnt, p); err != nil {
+		return err
+	}
+	if err := store.Delete(pendingKey(tnt, p.Topic, p.Group, p.ID)); err != nil {
+		return err
+	}
+	return store.Delete(dueKey(tnt, p))
+}
+
+// publishDeadLetter moves the message to the <topic>.dlq topic
+func publishDeadLetter(tnt string, p *pending) error {
+	log.Infof("Tenant %v dead lettering %v on %v after %d attempts", tnt, p.ID, p.Topic, p.Attempt)
+
+	var msg map[string]interface{}
+	if err := json.Unmarshal(p.Payload, &msg); err != nil {
+		return err
+	}
+
+	return events.Publish(path.Join("event", tnt, p.Topic+dlqSuffix), msg, events.WithMetadata(map[string]string{
+		"id":       p.ID,
+		"group":    p.Group,
+		"attempts": fmt.Sprintf("%d", p.Attempt),
+	}))
+}
+
+func (s *Event) Ack(ctx context.Context, req *pb.AckRequest, rsp *pb.AckResponse) error {
+	if len(req.Topic) == 0 {
+		return errors.BadRequest("event.ack", "topic is blank")
+	}
+	if len(req.Group) == 0 {
+		return errors.BadRequest("event.ack", "group is blank")
+	}
+	if len(req.Id) == 0 {
+		return errors.BadRequest("event.ack", "id is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	key := pendingKey(id, req.Topic, req.Group, req.Id)
+
+	if !req.Nack {
+		return store.Delete(key)
+	}
+
+	recs, err := store.Read(key)
+	if err == store.ErrNotFound {
+		return errors.NotFound("event.ack", "message not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	p := new(pending)
+	if err := json.Unmarshal(recs[0].Value, p); err != nil {
+		return err
+	}
+
+	// make it due for redelivery
+	store.Delete(dueKey(id, p))
+	p.Deadline = time.Now()
+	return writePending(id, p)
+}
+
+func (s *Event) Replay(ctx context.Context, req *pb.ReplayRequest, rsp *pb.ReplayResponse) error {
+	if len(req.Topic) == 0 {
+		return errors.BadRequest("event.replay", "topic is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	var opts []events.ReadOption
+	if req.Limit > 0 {
+		opts = append(opts, events.ReadLimit(uint(req.Limit)))
+	}
+	if req.Offset > 0 {
+		opts = append(opts, events.ReadOffset(uint(req.Offset)))
+	}
+
+	evs, err := events.Read(path.Join("event", id, req.Topic+dlqSuffix), opts...)
+	if err != nil {
+		return err
+	}
+
+	ids := map[string]bool{}
+	for _, i := range req.Ids {
+		ids[i] = true
+	}
+
+	topic := path.Join("event", id, req.Topic)
+
+	for _, ev := range evs {
+		if len(ids) > 0 && !ids[ev.ID] && !ids[ev.Metadata["id"]] {
+			continue
+		}
+
+		var msg map[string]interface{}
+		if err := json.Unmarshal(ev.Payload, &msg); err != nil {
+			return err
+		}
+
+		if err := events.Publish(topic, msg); err != nil {
+			return err
+		}
+
+		rsp.Replayed++
+	}
+
+	log.Infof("Tenant %v replayed %d messages to %v", id, rsp.Replayed, req.Topic)
+
+	return nil
+}
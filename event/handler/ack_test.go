@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/events/stream/memory"
+	"github.com/micro/micro/v3/service/store"
+	smem "github.com/micro/micro/v3/service/store/memory"
+)
+
+// claims is an in process claimer
+type claims struct {
+	sync.Mutex
+	keys map[string]bool
+}
+
+func (c *claims) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	c.Lock()
+	defer c.Unlock()
+	if c.keys[key] {
+		return false, nil
+	}
+	c.keys[key] = true
+	return true, nil
+}
+
+func TestClaimDue(t *testing.T) {
+	store.DefaultStore = smem.NewStore()
+	events.DefaultStream, _ = memory.NewStream()
+
+	s := &Event{claims: &claims{keys: map[string]bool{}}}
+	past := time.Now().Add(-time.Second)
+	for _, p := range []*pending{
+		{ID: "due", Topic: "orders", Group: "g", Payload: []byte(`{}`), Attempt: 1, Deadline: past},
+		{ID: "last", Topic: "orders", Group: "g", Payload: []byte(`{}`), Attempt: 3, Deadline: past},
+		{ID: "waiting", Topic: "orders", Group: "g", Payload: []byte(`{}`), Attempt: 1, Deadline: time.Now().Add(time.Minute)},
+	} {
+		if err := writePending("t", p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// consumers of the group check at the same time
+	var total int
+	var mtx sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			due, err := s.claimDue("t", "orders", "g", time.Minute, 3)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			mtx.Lock()
+			defer mtx.Unlock()
+			for _, p := range due {
+				if p.ID != "due" || p.Attempt != 2 {
+					t.Errorf("Unexpected redelivery %s attempt %d", p.ID, p.Attempt)
+				}
+				total++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if total != 1 {
+		t.Fatalf("Expected one redelivery, got %d", total)
+	}
+
+	recs, err := store.Read(pendingKey("t", "orders", "g", ""), store.ReadPrefix())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("Expected the last attempt to be dead lettered, got %d pending", len(recs))
+	}
+}
+
+func TestDuePending(t *testing.T) {
+	store.DefaultStore = smem.NewStore()
+
+	now := time.Now()
+	write := func(id string, deadline time.Time) *pending {
+		p := &pending{ID: id, Topic: "orders", Group: "g", Payload: []byte(`{}`), Attempt: 1, Deadline: deadline}
+		if err := writePending("t", p); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	write("a", now.Add(-time.Minute))
+	write("b", now.Add(-time.Second))
+	write("later", now.Add(time.Minute))
+	acked := write("acked", now.Add(-time.Hour))
+	store.Delete(pendingKey("t", acked.Topic, acked.Group, acked.ID))
+	// redelivered since with a new deadline
+	moved := write("moved", now.Add(-2*time.Minute))
+	moved.Deadline = now.Add(time.Hour)
+	writePending("t", moved)
+
+	// tracked before deadlines were indexed
+	legacy := &pending{ID: "legacy", Topic: "orders", Group: "g", Payload: []byte(`{}`), Attempt: 1, Deadline: now.Add(-time.Hour)}
+	store.Write(store.NewRecord(pendingKey("t", "orders", "g", "legacy"), legacy))
+	if err := indexPending("t", "orders", "g"); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := duePending("t", "orders", "g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, p := range due {
+		ids = append(ids, p.ID)
+	}
+	if got := strings.Join(ids, " "); got != "legacy a b" {
+		t.Fatalf("due = %v, want legacy a b", got)
+	}
+
+	// the stale deadlines are cleaned up
+	keys, _ := store.List(store.ListPrefix(duePrefixKey("t", "orders", "g")))
+	if len(keys) != 5 {
+		t.Errorf("Expected 5 indexed deadlines, got %v", keys)
+	}
+}
@@ -2,19 +2,37 @@ package handler
 
 import (
 	"context"
-	"fmt"
+	"encoding/json"
 	"path"
+	"sync"
 	"time"
 
 	"github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/events"
 	log "github.com/micro/micro/v3/service/logger"
 	pb "github.com/micro/services/event/proto"
+	"github.com/micro/services/pkg/query"
+	"github.com/micro/services/pkg/redis"
 	"github.com/micro/services/pkg/tenant"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-type Event struct{}
+type Event struct {
+	sync.Mutex
+	// webhook consumers running on this replica by key
+	webhooks map[string]context.CancelFunc
+	// claims of due messages so only one consumer redelivers them
+	claims claimer
+}
+
+func NewEvent() *Event {
+	e := &Event{
+		webhooks: map[string]context.CancelFunc{},
+		claims:   redis.NewLeases("event"),
+	}
+	go e.runWebhooks()
+	return e
+}
 
 func (s *Event) Publish(ctx context.Context, req *pb.PublishRequest, rsp *pb.PublishResponse) error {
 	if len(req.Topic) == 0 {
@@ -27,13 +45,28 @@ func (s *Event) Publish(ctx context.Context, req *pb.PublishRequest, rsp *pb.Pub
 		id = "default"
 	}
 
+	if wildcard(req.Topic) {
+		return errors.BadRequest("event.publish", "can't publish to a wildcard topic")
+	}
+
 	// create tenant based topics
 	topic := path.Join("event", id, req.Topic)
 
 	log.Infof("Tenant %v publishing to %v\n", id, req.Topic)
 
+	t, err := registerTopic(id, req.Topic)
+	if err != nil {
+		log.Errorf("Error registering topic %v: %v", req.Topic, err)
+		return errors.InternalServerError("event.publish", "failed to publish event")
+	}
+
+	msg := req.Message.AsMap()
+	if err := t.validate(id, msg); err != nil {
+		return errors.BadRequest("event.publish", err.Error())
+	}
+
 	// publish the message
-	return events.Publish(topic, req.Message.AsMap())
+	return events.Publish(topic, msg)
 }
 
 func (s *Event) Consume(ctx context.Context, req *pb.ConsumeRequest, stream pb.Event_ConsumeStream) error {
@@ -46,11 +79,13 @@ func (s *Event) Consume(ctx context.Context, req *pb.ConsumeRequest, stream pb.E
 		id = "default"
 	}
 
-	// create tenant based topics
-	topic := path.Join("event", id, req.Topic)
-
 	log.Infof("Tenant %v subscribing to %v\n", id, req.Topic)
 
+	filter, err := query.Parse(req.Filter)
+	if err != nil {
+		return errors.BadRequest("event.consume", "invalid filter: %v", err)
+	}
+
 	// check if a group os provided
 	opts := []events.ConsumeOption{}
 	offset := time.Now()
@@ -65,14 +100,76 @@ func (s *Event) Consume(ctx context.Context, req *pb.ConsumeRequest, stream pb.E
 	}
 	opts = append(opts, events.WithOffset(offset))
 
+	if req.ManualAck {
+		if len(req.Group) == 0 {
+			return errors.BadRequest("event.consume", "group is required to ack messages")
+		}
+		if req.VisibilityTimeout == 0 {
+			req.VisibilityTimeout = defaultVisibilityTimeout
+		}
+		if req.VisibilityTimeout < 0 || req.VisibilityTimeout > maxVisibilityTimeout {
+			return errors.BadRequest("event.consume", "visibility timeout must be between 1 and %d seconds", maxVisibilityTimeout)
+		}
+		if req.MaxAttempts == 0 {
+			req.MaxAttempts = defaultMaxAttempts
+		}
+		if req.MaxAttempts < 0 || req.MaxAttempts > maxMaxAttempts {
+			return errors.BadRequest("event.consume", "max attempts must be between 1 and %d", maxMaxAttempts)
+		}
+	}
+
+	if wildcard(req.Topic) {
+		if !validPattern(req.Topic) {
+			return errors.BadRequest("event.consume", "invalid topic pattern")
+		}
+		return s.consumePattern(ctx, id, req, filter, opts, stream)
+	}
+
+	return s.consumeTopic(ctx, id, req, filter, opts, stream)
+}
+
+// consumeTopic streams the messages of a single topic
+func (s *Event) consumeTopic(ctx context.Context, id string, req *pb.ConsumeRequest, filter []query.Query, opts []events.ConsumeOption, stream pb.Event_ConsumeStream) error {
+	if req.ManualAck {
+		return s.consumeAcked(ctx, id, req, filter, opts, stream)
+	}
+
+	// create tenant based topics
+	topic := path.Join("event", id, req.Topic)
+
+	// stop consuming when the stream ends
+	opts = append(opts, events.WithContext(ctx))
+
 	sub, err := events.Consume(topic, opts...)
 	if err != nil {
 		return errors.InternalServerError("event.subscribe", "failed to subscribe to event")
 	}
 
+	t := retention(id, req.Topic)
+
 	// range over the messages until the subscriber is closed
-	for msg := range sub {
-		fmt.Println("got message, sending")
+	for {
+		var msg events.Event
+		select {
+		case <-ctx.Done():
+			return nil
+		case m, ok := <-sub:
+			if !ok {
+				return nil
+			}
+			msg = m
+		}
+
+		if !t.retained(msg.Timestamp) {
+			continue
+		}
+		if len(req.Group) > 0 {
+			writeOffset(id, req.Topic, req.Group, &msg)
+		}
+		if !matches(filter, msg.Payload) {
+			continue
+		}
+
 		// unmarshal the message into a struct
 		d := &structpb.Struct{}
 		d.UnmarshalJSON(msg.Payload)
@@ -86,8 +183,6 @@ func (s *Event) Consume(ctx context.Context, req *pb.ConsumeRequest, stream pb.E
 			return err
 		}
 	}
-
-	return nil
 }
 
 func (s *Event) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadResponse) error {
@@ -117,14 +212,51 @@ func (s *Event) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadRespo
 
 	log.Infof("Tenant %v reading %v limit: %v offset: %v\n", id, req.Topic, req.Limit, req.Offset)
 
-	events, err := events.Read(topic, opts...)
+	filter, err := query.Parse(req.Filter)
 	if err != nil {
-		return err
+		return errors.BadRequest("event.read", "invalid filter: %v", err)
+	}
+
+	var evs []*events.Event
+
+	// apply the retention of the topic and the filter before paging
+	if t := retention(id, req.Topic); t.limited() || len(filter) > 0 {
+		evs, err = readRetained(id, t)
+		if err != nil {
+			return err
+		}
+
+		var matched []*events.Event
+		for _, ev := range evs {
+			if matches(filter, ev.Payload) {
+				matched = append(matched, ev)
+			}
+		}
+		evs = matched
+
+		limit := 25
+		if req.Limit > 0 {
+			limit = int(req.Limit)
+		}
+		start := int(req.Offset)
+		if start > len(evs) {
+			start = len(evs)
+		}
+		end := start + limit
+		if end > len(evs) {
+			end = len(evs)
+		}
+		evs = evs[start:end]
+	} else {
+		evs, err = events.Read(topic, opts...)
+		if err != nil {
+			return err
+		}
 	}
 
-	log.Infof("Events read %v", len(events))
+	log.Infof("Events read %v", len(evs))
 
-	for _, ev := range events {
+	for _, ev := range evs {
 		// unmarshal the message into a struct
 		d := &structpb.Struct{}
 		d.UnmarshalJSON(ev.Payload)
@@ -138,3 +270,15 @@ func (s *Event) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadRespo
 
 	return nil
 }
+
+// matches returns whether the JSON payload satisfies the filter
+func matches(filter []query.Query, payload []byte) bool {
+	if len(filter) == 0 {
+		return true
+	}
+	var msg map[string]interface{}
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return false
+	}
+	return query.Match(filter, msg)
+}
@@ -0,0 +1,153 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/event/proto"
+	"github.com/micro/services/pkg/query"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// separator of topic levels
+	levelSep = "."
+	// wildcard matching a single level
+	oneLevel = "*"
+	// wildcard matching the remaining levels
+	allLevels = ">"
+
+	// how often a pattern looks for new topics it matches
+	patternRefresh = 10 * time.Second
+)
+
+// wildcard returns whether the topic is a pattern
+func wildcard(topic string) bool {
+	for _, level := range strings.Split(topic, levelSep) {
+		if level == oneLevel || level == allLevels {
+			return true
+		}
+	}
+	return false
+}
+
+// validPattern returns whether the wildcards fill their level and > is last
+func validPattern(pattern string) bool {
+	levels := strings.Split(pattern, levelSep)
+	for i, level := range levels {
+		if level == allLevels && i != len(levels)-1 {
+			return false
+		}
+		if level != oneLevel && level != allLevels && strings.ContainsAny(level, oneLevel+allLevels) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchTopic returns whether the topic matches the pattern e.g orders.*
+// matches orders.created and orders.> matches orders.eu.created
+func matchTopic(pattern, topic string) bool {
+	p := strings.Split(pattern, levelSep)
+	t := strings.Split(topic, levelSep)
+
+	for i, level := range p {
+		if level == allLevels {
+			return len(t) > i
+		}
+		if i >= len(t) || (level != oneLevel && level != t[i]) {
+			return false
+		}
+	}
+	return len(p) == len(t)
+}
+
+// matchingTopics returns the registered topics matching the pattern
+func matchingTopics(tnt, pattern string) ([]string, error) {
+	recs, err := store.Read(topicKey(tnt, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	var topics []string
+	for _, rec := range recs {
+		t := new(Topic)
+		if err := json.Unmarshal(rec.Value, t); err != nil {
+			return nil, err
+		}
+		if t.Deleted || !matchTopic(pattern, t.Name) {
+			continue
+		}
+		topics = append(topics, t.Name)
+	}
+	return topics, nil
+}
+
+// lockedStream lets the consumers of many topics send on one stream
+type lockedStream struct {
+	sync.Mutex
+	pb.Event_ConsumeStream
+}
+
+func (s *lockedStream) Send(rsp *pb.ConsumeResponse) error {
+	s.Lock()
+	defer s.Unlock()
+	return s.Event_ConsumeStream.Send(rsp)
+}
+
+// consumePattern streams the messages of every topic matching the pattern,
+// consuming topics created later as they're found. Each message has the
+// topic it was published to and is acked on that topic.
+func (s *Event) consumePattern(ctx context.Context, tnt string, req *pb.ConsumeRequest, filter []query.Query, opts []events.ConsumeOption, stream pb.Event_ConsumeStream) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	locked := &lockedStream{Event_ConsumeStream: stream}
+	errs := make(chan error, 1)
+	consuming := map[string]bool{}
+
+	ticker := time.NewTicker(patternRefresh)
+	defer ticker.Stop()
+
+	for {
+		topics, err := matchingTopics(tnt, req.Topic)
+		if err != nil {
+			log.Errorf("Error reading topics matching %v: %v", req.Topic, err)
+		}
+
+		for _, topic := range topics {
+			if consuming[topic] {
+				continue
+			}
+			consuming[topic] = true
+
+			r := proto.Clone(req).(*pb.ConsumeRequest)
+			r.Topic = topic
+			// consumers append their own options
+			o := append([]events.ConsumeOption{}, opts...)
+
+			go func() {
+				if err := s.consumeTopic(ctx, tnt, r, filter, o, locked); err != nil {
+					select {
+					case errs <- err:
+					default:
+					}
+				}
+			}()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-errs:
+			return err
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/events/stream/memory"
+	"github.com/micro/micro/v3/service/store"
+	smem "github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/event/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestMatchTopic(t *testing.T) {
+	tcs := []struct {
+		pattern, topic string
+		match          bool
+	}{
+		{"orders.*", "orders.created", true},
+		{"orders.*", "orders.eu.created", false},
+		{"orders.*", "orders", false},
+		{"orders.>", "orders.eu.created", true},
+		{"orders.>", "orders", false},
+		{"*.created", "users.created", true},
+		{">", "orders", true},
+		{"orders.created", "orders.created", true},
+	}
+	for _, tc := range tcs {
+		if got := matchTopic(tc.pattern, tc.topic); got != tc.match {
+			t.Fatalf("%s on %s: expected %v, got %v", tc.pattern, tc.topic, tc.match, got)
+		}
+	}
+
+	for pattern, valid := range map[string]bool{"orders.*": true, "orders.>": true, "orders.>.eu": false, "orders.a*": false} {
+		if validPattern(pattern) != valid {
+			t.Fatalf("Expected %s valid %v", pattern, valid)
+		}
+	}
+}
+
+// consumeStream collects what's sent on a Consume stream
+type consumeStream struct {
+	pb.Event_ConsumeStream
+	ch chan *pb.ConsumeResponse
+}
+
+func (s *consumeStream) Send(rsp *pb.ConsumeResponse) error {
+	s.ch <- rsp
+	return nil
+}
+
+func TestConsumePattern(t *testing.T) {
+	store.DefaultStore = smem.NewStore()
+	events.DefaultStream, _ = memory.NewStream()
+
+	s := new(Event)
+	for _, topic := range []string{"orders.created", "users.created"} {
+		if _, err := registerTopic("default", topic); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream := &consumeStream{ch: make(chan *pb.ConsumeResponse, 10)}
+	go s.Consume(ctx, &pb.ConsumeRequest{Topic: "orders.*"}, stream)
+
+	// let the consumers subscribe
+	time.Sleep(100 * time.Millisecond)
+
+	msg, _ := structpb.NewStruct(map[string]interface{}{"id": "1"})
+	for _, topic := range []string{"users.created", "orders.created"} {
+		if err := s.Publish(ctx, &pb.PublishRequest{Topic: topic, Message: msg}, &pb.PublishResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	select {
+	case rsp := <-stream.ch:
+		if rsp.Topic != "orders.created" {
+			t.Fatalf("Expected the concrete topic, got %v", rsp.Topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message on orders.created")
+	}
+
+	select {
+	case rsp := <-stream.ch:
+		t.Fatalf("Unexpected message on %v", rsp.Topic)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := s.Publish(ctx, &pb.PublishRequest{Topic: "orders.*", Message: msg}, &pb.PublishResponse{}); err == nil {
+		t.Fatal("Expected publishing to a pattern to fail")
+	}
+}
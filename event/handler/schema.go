@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/hashicorp/golang-lru"
+	"github.com/micro/micro/v3/service/errors"
+	log "github.com/micro/micro/v3/service/logger"
+	pb "github.com/micro/services/event/proto"
+	"github.com/micro/services/pkg/tenant"
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	// max number of schema errors returned to the publisher
+	maxSchemaErrors = 5
+	// max number of compiled schemas kept in memory
+	maxSchemas = 1000
+)
+
+// compiled is a schema compiled from its JSON
+type compiled struct {
+	json   string
+	schema *gojsonschema.Schema
+}
+
+// compiled schemas by tenant and topic, the cache does its own locking
+var schemas, _ = lru.New(maxSchemas)
+
+// parseSchema compiles the schema. Only refs within the schema itself are
+// allowed, anything else would have us fetch it from wherever it points to.
+func parseSchema(schema string) (*gojsonschema.Schema, error) {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(schema), &doc); err != nil {
+		return nil, err
+	}
+	if err := localRefs(doc); err != nil {
+		return nil, err
+	}
+	return gojsonschema.NewSchema(gojsonschema.NewGoLoader(doc))
+}
+
+// localRefs returns an error for any $ref which isn't a fragment of the
+// schema or $id which would change where refs are resolved from
+func localRefs(doc interface{}) error {
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			if ref, ok := val.(string); ok && (k == "$ref" || k == "$id") && !strings.HasPrefix(ref, "#") {
+				return fmt.Errorf("%s %q is not local to the schema", k, ref)
+			}
+			if err := localRefs(val); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, val := range v {
+			if err := localRefs(val); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compileSchema returns the compiled schema of the topic
+func compileSchema(tnt string, t *Topic) (*gojsonschema.Schema, error) {
+	key := tnt + "/" + t.Name
+
+	if c, ok := schemas.Get(key); ok && c.(*compiled).json == t.Schema {
+		return c.(*compiled).schema, nil
+	}
+
+	s, err := parseSchema(t.Schema)
+	if err != nil {
+		return nil, err
+	}
+
+	schemas.Add(key, &compiled{json: t.Schema, schema: s})
+
+	return s, nil
+}
+
+// validate checks the message against the schema of the topic
+func (t *Topic) validate(tnt string, msg map[string]interface{}) error {
+	if len(t.Schema) == 0 {
+		return nil
+	}
+
+	s, err := compileSchema(tnt, t)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.Validate(gojsonschema.NewGoLoader(msg))
+	if err != nil {
+		return err
+	}
+	if res.Valid() {
+		return nil
+	}
+
+	var errs []string
+	for i, e := range res.Errors() {
+		if i == maxSchemaErrors {
+			break
+		}
+		errs = append(errs, e.String())
+	}
+
+	return fmt.Errorf("message doesn't match the schema: %s", strings.Join(errs, "; "))
+}
+
+func (s *Event) SetSchema(ctx context.Context, req *pb.SetSchemaRequest, rsp *pb.SetSchemaResponse) error {
+	if len(req.Topic) == 0 {
+		return errors.BadRequest("event.setschema", "topic is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	var schema string
+	if len(req.Schema.GetFields()) > 0 {
+		b, err := req.Schema.MarshalJSON()
+		if err != nil {
+			return errors.BadRequest("event.setschema", "invalid schema")
+		}
+		schema = string(b)
+
+		if _, err := parseSchema(schema); err != nil {
+			return errors.BadRequest("event.setschema", "invalid schema: %v", err)
+		}
+	}
+
+	// a schema can be set before publishing to the topic
+	t, err := registerTopic(id, req.Topic)
+	if err != nil {
+		return err
+	}
+
+	t.Schema = schema
+	if err := writeTopic(id, t); err != nil {
+		return err
+	}
+
+	log.Infof("Tenant %v set schema of %v", id, req.Topic)
+
+	rsp.Topic = t.proto()
+
+	return nil
+}
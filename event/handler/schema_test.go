@@ -0,0 +1,49 @@
+package handler
+
+import (
+	"testing"
+)
+
+func TestParseSchema(t *testing.T) {
+	tcs := []struct {
+		name   string
+		schema string
+		ok     bool
+	}{
+		{name: "plain", schema: `{"type":"object","properties":{"id":{"type":"string"}}}`, ok: true},
+		{name: "local ref", schema: `{"definitions":{"id":{"type":"string"}},"properties":{"id":{"$ref":"#/definitions/id"}}}`, ok: true},
+		{name: "property called $ref", schema: `{"properties":{"$ref":{"type":"string"}}}`, ok: true},
+		{name: "remote ref", schema: `{"properties":{"id":{"$ref":"http://169.254.169.254/latest/meta-data"}}}`},
+		{name: "relative ref", schema: `{"items":[{"$ref":"other.json"}]}`},
+		{name: "remote id", schema: `{"$id":"http://example.com/schema","properties":{"id":{"$ref":"#/definitions/id"}}}`},
+		{name: "invalid", schema: `{"type":1}`},
+	}
+
+	for _, tc := range tcs {
+		_, err := parseSchema(tc.schema)
+		if (err == nil) != tc.ok {
+			t.Fatalf("%s: expected ok %v, got %v", tc.name, tc.ok, err)
+		}
+	}
+}
+
+func TestCompileSchema(t *testing.T) {
+	topic := &Topic{Name: "orders", Schema: `{"required":["id"]}`}
+
+	s1, err := compileSchema("t", topic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s2, _ := compileSchema("t", topic); s2 != s1 {
+		t.Fatal("Expected the cached schema")
+	}
+
+	// a new schema for the topic is compiled again
+	topic.Schema = `{"required":["total"]}`
+	if err := topic.validate("t", map[string]interface{}{"id": "1"}); err == nil {
+		t.Fatal("Expected the new schema to be used")
+	}
+	if err := topic.validate("t", map[string]interface{}{"total": 1}); err != nil {
+		t.Fatal(err)
+	}
+}
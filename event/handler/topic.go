@@ -0,0 +1,525 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/events"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/event/proto"
+	pauth "github.com/micro/services/pkg/auth"
+	adminpb "github.com/micro/services/pkg/service/proto"
+	"github.com/micro/services/pkg/tenant"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	topicPrefix  = "topic"
+	offsetPrefix = "offset"
+
+	// events are read from the event store in pages
+	readPage = 250
+	// how long a read from the stream waits for the next event before
+	// taking it as caught up
+	readIdle = 250 * time.Millisecond
+)
+
+// Topic is a topic published to by a tenant. Events can't be removed from
+// the event store so deleted and expired events are hidden instead.
+type Topic struct {
+	Name    string
+	Created time.Time
+	// events before this time belong to a deleted incarnation of the topic
+	Since    time.Time
+	Deleted  bool
+	MaxAge   time.Duration
+	MaxCount int64
+	// JSON Schema messages must match
+	Schema string
+}
+
+// Offset is the last event consumed by a group
+type Offset struct {
+	Group     string
+	ID        string
+	Timestamp time.Time
+}
+
+func topicKey(tnt, topic string) string {
+	return fmt.Sprintf("%s/%s/%s", topicPrefix, tnt, topic)
+}
+
+func offsetKey(tnt, topic, group string) string {
+	return fmt.Sprintf("%s/%s/%s/%s", offsetPrefix, tnt, topic, group)
+}
+
+func (t *Topic) proto() *pb.Topic {
+	ret := &pb.Topic{
+		Name:     t.Name,
+		Created:  t.Created.Format(time.RFC3339Nano),
+		MaxAge:   int64(t.MaxAge / time.Second),
+		MaxCount: t.MaxCount,
+	}
+	if len(t.Schema) > 0 {
+		ret.Schema = &structpb.Struct{}
+		ret.Schema.UnmarshalJSON([]byte(t.Schema))
+	}
+	return ret
+}
+
+// retained returns whether an event published at ts is still kept by age
+func (t *Topic) retained(ts time.Time) bool {
+	if ts.Before(t.Since) {
+		return false
+	}
+	if t.MaxAge > 0 && ts.Before(time.Now().Add(-t.MaxAge)) {
+		return false
+	}
+	return true
+}
+
+// visible drops the events which aren't retained and sorts the rest oldest first
+func (t *Topic) visible(evs []*events.Event) []*events.Event {
+	ret := make([]*events.Event, 0, len(evs))
+	for _, ev := range evs {
+		if t.retained(ev.Timestamp) {
+			ret = append(ret, ev)
+		}
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Timestamp.Before(ret[j].Timestamp)
+	})
+
+	if t.MaxCount > 0 && int64(len(ret)) > t.MaxCount {
+		ret = ret[int64(len(ret))-t.MaxCount:]
+	}
+
+	return ret
+}
+
+// cutoff returns the time before which events aren't retained, zero if
+// they're only limited by count
+func (t *Topic) cutoff() time.Time {
+	cutoff := t.Since
+	if t.MaxAge > 0 {
+		if age := time.Now().Add(-t.MaxAge); age.After(cutoff) {
+			cutoff = age
+		}
+	}
+	return cutoff
+}
+
+// limited returns whether reading the topic needs the retention applied
+func (t *Topic) limited() bool {
+	return !t.Since.IsZero() || t.MaxAge > 0 || t.MaxCount > 0
+}
+
+func readTopic(tnt, name string) (*Topic, error) {
+	recs, err := store.Read(topicKey(tnt, name))
+	if err != nil {
+		return nil, err
+	}
+	t := new(Topic)
+	if err := json.Unmarshal(recs[0].Value, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// retention returns the topic to filter events by, which retains everything
+// if the topic wasn't published to yet
+func retention(tnt, name string) *Topic {
+	t, err := readTopic(tnt, name)
+	if err != nil {
+		return &Topic{Name: name}
+	}
+	return t
+}
+
+func writeTopic(tnt string, t *Topic) error {
+	return store.Write(store.NewRecord(topicKey(tnt, t.Name), t))
+}
+
+// registerTopic records the topic on publish
+func registerTopic(tnt, name string) (*Topic, error) {
+	t, err := readTopic(tnt, name)
+	if err == store.ErrNotFound {
+		t = &Topic{Name: name, Created: time.Now()}
+		return t, writeTopic(tnt, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if !t.Deleted {
+		return t, nil
+	}
+	t.Deleted = false
+	t.Created = time.Now()
+	return t, writeTopic(tnt, t)
+}
+
+// readEvents reads every stored event of the topic
+func readEvents(topic string) ([]*events.Event, error) {
+	var ret []*events.Event
+	for offset := uint(0); ; offset += readPage {
+		evs, err := events.Read(topic, events.ReadLimit(readPage), events.ReadOffset(offset))
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, evs...)
+		if len(evs) < readPage {
+			return ret, nil
+		}
+	}
+}
+
+// readSince reads the events of the topic published from the time on. The
+// event store isn't ordered by time so the stream, which is, is consumed
+// from the time instead until it catches up with when the read started.
+func readSince(topic string, since time.Time) ([]*events.Event, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	sub, err := events.Consume(topic, events.WithOffset(since), events.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	idle := time.NewTimer(readIdle)
+	defer idle.Stop()
+
+	var ret []*events.Event
+	seen := map[string]bool{}
+	for {
+		select {
+		case ev, ok := <-sub:
+			if !ok {
+				return ret, nil
+			}
+			if !ev.Timestamp.Before(start) {
+				return ret, nil
+			}
+			if !seen[ev.ID] {
+				seen[ev.ID] = true
+				ret = append(ret, &ev)
+			}
+			if !idle.Stop() {
+				<-idle.C
+			}
+			idle.Reset(readIdle)
+		case <-idle.C:
+			return ret, nil
+		}
+	}
+}
+
+// readRetained returns the events the topic retains oldest first, seeking
+// past the ones older than its retention rather than reading them
+func readRetained(tnt string, t *Topic) ([]*events.Event, error) {
+	topic := path.Join("event", tnt, t.Name)
+
+	var evs []*events.Event
+	var err error
+	if cutoff := t.cutoff(); !cutoff.IsZero() {
+		evs, err = readSince(topic, cutoff)
+	} else {
+		evs, err = readEvents(topic)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t.visible(evs), nil
+}
+
+// writeOffset records the last event consumed by a group
+func writeOffset(tnt, topic, group string, ev *events.Event) {
+	if err := store.Write(store.NewRecord(offsetKey(tnt, topic, group), &Offset{
+		Group:     group,
+		ID:        ev.ID,
+		Timestamp: ev.Timestamp,
+	})); err != nil {
+		log.Errorf("Error writing offset of %v on %v: %v", group, topic, err)
+	}
+}
+
+// deletePrefix removes every record under the prefix
+func deletePrefix(prefix string) error {
+	keys, err := store.List(store.ListPrefix(prefix))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := store.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Event) ListTopics(ctx context.Context, req *pb.ListTopicsRequest, rsp *pb.ListTopicsResponse) error {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	recs, err := store.Read(topicKey(id, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	rsp.Topics = []*pb.Topic{}
+	for _, rec := range recs {
+		t := new(Topic)
+		if err := json.Unmarshal(rec.Value, t); err != nil {
+			return err
+		}
+		if t.Deleted {
+			continue
+		}
+		rsp.Topics = append(rsp.Topics, t.proto())
+	}
+
+	sort.Slice(rsp.Topics, func(i, j int) bool {
+		return rsp.Topics[i].Name < rsp.Topics[j].Name
+	})
+
+	return nil
+}
+
+func (s *Event) DeleteTopic(ctx context.Context, req *pb.DeleteTopicRequest, rsp *pb.DeleteTopicResponse) error {
+	if len(req.Topic) == 0 {
+		return errors.BadRequest("event.deletetopic", "topic is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	t, err := readTopic(id, req.Topic)
+	if err == store.ErrNotFound || (err == nil && t.Deleted) {
+		return errors.NotFound("event.deletetopic", "topic not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	// hide the existing events
+	t.Deleted = true
+	t.Since = time.Now()
+	if err := writeTopic(id, t); err != nil {
+		return err
+	}
+
+	if err := deletePrefix(offsetKey(id, req.Topic, "")); err != nil {
+		return err
+	}
+
+	log.Infof("Tenant %v deleted topic %v", id, req.Topic)
+
+	// pending messages of every group and their deadlines
+	for _, prefix := range []string{pendingPrefix, duePrefix} {
+		if err := deletePrefix(fmt.Sprintf("%s/%s/%s/", prefix, id, url.PathEscape(req.Topic))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Event) SetRetention(ctx context.Context, req *pb.SetRetentionRequest, rsp *pb.SetRetentionResponse) error {
+	if len(req.Topic) == 0 {
+		return errors.BadRequest("event.setretention", "topic is blank")
+	}
+
+	if req.MaxAge < 0 || req.MaxCount < 0 {
+		return errors.BadRequest("event.setretention", "retention can't be negative")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	t, err := readTopic(id, req.Topic)
+	if err == store.ErrNotFound || (err == nil && t.Deleted) {
+		return errors.NotFound("event.setretention", "topic not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	t.MaxAge = time.Duration(req.MaxAge) * time.Second
+	t.MaxCount = req.MaxCount
+	if err := writeTopic(id, t); err != nil {
+		return err
+	}
+
+	rsp.Topic = t.proto()
+
+	return nil
+}
+
+func (s *Event) Stats(ctx context.Context, req *pb.StatsRequest, rsp *pb.StatsResponse) error {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	var topics []*Topic
+	if len(req.Topic) > 0 {
+		t, err := readTopic(id, req.Topic)
+		if err == store.ErrNotFound || (err == nil && t.Deleted) {
+			return errors.NotFound("event.stats", "topic not found")
+		}
+		if err != nil {
+			return err
+		}
+		topics = append(topics, t)
+	} else {
+		recs, err := store.Read(topicKey(id, ""), store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		for _, rec := range recs {
+			t := new(Topic)
+			if err := json.Unmarshal(rec.Value, t); err != nil {
+				return err
+			}
+			if !t.Deleted {
+				topics = append(topics, t)
+			}
+		}
+	}
+
+	for _, t := range topics {
+		stats, err := topicStats(id, t)
+		if err != nil {
+			log.Errorf("Error reading stats of %v: %v", t.Name, err)
+			return errors.InternalServerError("event.stats", "failed to read stats")
+		}
+		rsp.Topics = append(rsp.Topics, stats)
+	}
+
+	return nil
+}
+
+func topicStats(tnt string, t *Topic) (*pb.TopicStats, error) {
+	evs, err := readRetained(tnt, t)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &pb.TopicStats{
+		Topic:    t.Name,
+		Messages: int64(len(evs)),
+		Groups:   []*pb.GroupStats{},
+	}
+	if len(evs) > 0 {
+		stats.Oldest = evs[0].Timestamp.Format(time.RFC3339Nano)
+		stats.Newest = evs[len(evs)-1].Timestamp.Format(time.RFC3339Nano)
+	}
+
+	recs, err := store.Read(offsetKey(tnt, t.Name, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	for _, rec := range recs {
+		o := new(Offset)
+		if err := json.Unmarshal(rec.Value, o); err != nil {
+			return nil, err
+		}
+
+		// events are sorted so everything after the offset is lag
+		consumed := sort.Search(len(evs), func(i int) bool {
+			return evs[i].Timestamp.After(o.Timestamp)
+		})
+
+		stats.Groups = append(stats.Groups, &pb.GroupStats{
+			Group:        o.Group,
+			Lag:          int64(len(evs) - consumed),
+			LastConsumed: o.Timestamp.Format(time.RFC3339Nano),
+		})
+	}
+
+	return stats, nil
+}
+
+func (s *Event) DeleteData(ctx context.Context, request *adminpb.DeleteDataRequest, response *adminpb.DeleteDataResponse) error {
+	method := "admin.DeleteData"
+	_, err := pauth.VerifyMicroAdmin(ctx, method)
+	if err != nil {
+		return err
+	}
+
+	if len(request.TenantId) < 10 { // deliberate length check so we don't delete all the things
+		return errors.BadRequest(method, "Missing tenant ID")
+	}
+
+	for _, prefix := range []string{topicPrefix, offsetPrefix, pendingPrefix, duePrefix, webhookPrefix, deliveryPrefix} {
+		if err := deletePrefix(prefix + "/" + request.TenantId + "/"); err != nil {
+			return err
+		}
+	}
+
+	log.Infof("Deleted topics and webhooks for %s", request.TenantId)
+	return nil
+}
+
+func (s *Event) Usage(ctx context.Context, request *adminpb.UsageRequest, response *adminpb.UsageResponse) error {
+	method := "admin.Usage"
+	_, err := pauth.VerifyMicroAdmin(ctx, method)
+	if err != nil {
+		return err
+	}
+
+	if len(request.TenantId) < 10 { // deliberate length check so we don't grab all the things
+		return errors.BadRequest(method, "Missing tenant ID")
+	}
+
+	recs, err := store.Read(topicKey(request.TenantId, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	var topics, messages int64
+	for _, rec := range recs {
+		t := new(Topic)
+		if err := json.Unmarshal(rec.Value, t); err != nil {
+			return err
+		}
+		if t.Deleted {
+			continue
+		}
+		topics++
+
+		evs, err := readRetained(request.TenantId, t)
+		if err != nil {
+			return err
+		}
+		messages += int64(len(evs))
+	}
+
+	hooks, err := store.List(store.ListPrefix(webhookKey(request.TenantId, "")))
+	if err != nil {
+		return err
+	}
+
+	response.Usage = map[string]*adminpb.Usage{
+		"Event.Publish": &adminpb.Usage{Usage: messages, Units: "messages"},
+		// topics are created by publishing
+		"Event.ListTopics":    &adminpb.Usage{Usage: topics, Units: "topics"},
+		"Event.CreateWebhook": &adminpb.Usage{Usage: int64(len(hooks)), Units: "webhooks"},
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/events/stream/memory"
+	"github.com/micro/micro/v3/service/store"
+	smem "github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/event/proto"
+)
+
+func TestPendingKey(t *testing.T) {
+	tcs := []struct {
+		topic, group, id string
+		key              string
+	}{
+		{"orders", "g", "1", "pending/t/orders/g/1"},
+		{"orders", "g", "", "pending/t/orders/g/"},
+		{"orders.dlq", "g", "1", "pending/t/orders.dlq/g/1"},
+		// slashes can't make one group's keys another's
+		{"x", "a/b", "1", "pending/t/x/a%2Fb/1"},
+		{"x/a", "b", "1", "pending/t/x%2Fa/b/1"},
+	}
+	for _, tc := range tcs {
+		if got := pendingKey("t", tc.topic, tc.group, tc.id); got != tc.key {
+			t.Fatalf("Expected %s, got %s", tc.key, got)
+		}
+	}
+}
+
+func TestDeleteTopicPending(t *testing.T) {
+	store.DefaultStore = smem.NewStore()
+
+	for _, topic := range []string{"orders", "ordersx"} {
+		if _, err := registerTopic("default", topic); err != nil {
+			t.Fatal(err)
+		}
+		for _, group := range []string{"a", "b"} {
+			p := &pending{ID: "1", Topic: topic, Group: group, Payload: []byte(`{}`), Attempt: 1, Deadline: time.Now()}
+			if err := writePending("default", p); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	if err := new(Event).DeleteTopic(context.Background(), &pb.DeleteTopicRequest{Topic: "orders"}, &pb.DeleteTopicResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	keys, err := store.List(store.ListPrefix(pendingPrefix + "/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "pending/default/ordersx/a/1" || keys[1] != "pending/default/ordersx/b/1" {
+		t.Fatalf("Expected only the other topic's pending messages, got %v", keys)
+	}
+}
+
+func TestReadRetained(t *testing.T) {
+	store.DefaultStore = smem.NewStore()
+	events.DefaultStream, _ = memory.NewStream()
+
+	now := time.Now()
+	for i, age := range []time.Duration{3 * time.Hour, 90 * time.Minute, 30 * time.Minute, time.Minute} {
+		msg := map[string]interface{}{"n": i}
+		if err := events.Publish("event/default/orders", msg, events.WithTimestamp(now.Add(-age))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name  string
+		topic *Topic
+		want  string
+	}{
+		{"max age", &Topic{Name: "orders", MaxAge: time.Hour}, "[2 3]"},
+		{"since", &Topic{Name: "orders", Since: now.Add(-2 * time.Hour)}, "[1 2 3]"},
+		{"since and max age", &Topic{Name: "orders", Since: now.Add(-10 * time.Minute), MaxAge: time.Hour}, "[3]"},
+		{"max age and count", &Topic{Name: "orders", MaxAge: 2 * time.Hour, MaxCount: 1}, "[3]"},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			evs, err := readRetained("default", tc.topic)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, ev := range evs {
+				var msg map[string]interface{}
+				json.Unmarshal(ev.Payload, &msg)
+				got = append(got, fmt.Sprint(msg["n"]))
+			}
+			if fmt.Sprint(got) != tc.want {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,535 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/events"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/event/proto"
+	"github.com/micro/services/pkg/network"
+	"github.com/micro/services/pkg/query"
+	"github.com/micro/services/pkg/tenant"
+)
+
+const (
+	webhookPrefix  = "webhook"
+	deliveryPrefix = "delivery"
+
+	signatureHeader = "X-Micro-Signature"
+
+	webhookTimeout  = 10 * time.Second
+	webhookAttempts = 5
+	// long enough for every attempt of a delivery to complete
+	webhookAckWait = 2 * time.Minute
+	// how often each replica checks for created and deleted webhooks
+	webhookSyncInterval = time.Minute
+
+	deliveryExpiry         = 7 * 24 * time.Hour
+	defaultDeliveriesLimit = 25
+	maxDeliveriesLimit     = 1000
+)
+
+var (
+	// wait before the second attempt of a delivery, doubled after each
+	webhookBackoff = time.Second
+	// whether a webhook host is private, only lifted in tests
+	privateWebhook = network.IsPrivateIP
+)
+
+// Webhook posts the messages of a topic to a url
+type Webhook struct {
+	ID      string
+	Tenant  string
+	Topic   string
+	URL     string
+	Secret  string
+	Filter  string
+	Created time.Time
+}
+
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		if network.IsPrivateIP(req.URL.Host) {
+			return fmt.Errorf("redirected to a private address")
+		}
+		return nil
+	},
+}
+
+func webhookKey(tnt, id string) string {
+	return fmt.Sprintf("%s/%s/%s", webhookPrefix, tnt, id)
+}
+
+func deliveryKey(tnt, webhook string, ts time.Time, id string) string {
+	return fmt.Sprintf("%s/%s/%s/%019d/%s", deliveryPrefix, tnt, webhook, ts.UnixNano(), id)
+}
+
+// group is the consumer group the webhook consumes the topic with
+func (w *Webhook) group() string {
+	return "webhook-" + w.ID
+}
+
+func (w *Webhook) proto() *pb.Webhook {
+	return &pb.Webhook{
+		Id:      w.ID,
+		Topic:   w.Topic,
+		Url:     w.URL,
+		Secret:  w.Secret,
+		Group:   w.group(),
+		Filter:  w.Filter,
+		Created: w.Created.Format(time.RFC3339Nano),
+	}
+}
+
+// sign returns the hmac of the body for the signature header
+func (w *Webhook) sign(body []byte) string {
+	mac := hmac.New(sha256.New, []byte(w.Secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// post makes a single delivery attempt returning the status code
+func (w *Webhook) post(ctx context.Context, id string, body []byte) (int, error) {
+	uri, err := url.Parse(w.URL)
+	if err != nil {
+		return 0, err
+	}
+
+	// the host may resolve differently than on creation
+	if privateWebhook(uri.Host) {
+		return 0, fmt.Errorf("url resolves to a private address")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Micro-Webhook", w.ID)
+	req.Header.Set("X-Micro-Event", id)
+	req.Header.Set(signatureHeader, w.sign(body))
+
+	rsp, err := webhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+	io.Copy(ioutil.Discard, rsp.Body)
+
+	if rsp.StatusCode < 200 || rsp.StatusCode > 299 {
+		return rsp.StatusCode, fmt.Errorf("unexpected status %d", rsp.StatusCode)
+	}
+
+	return rsp.StatusCode, nil
+}
+
+// deliver posts the message retrying with backoff, logs the delivery and dead
+// letters the message if every attempt failed
+func (w *Webhook) deliver(ctx context.Context, msg *events.Event) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"id":        msg.ID,
+		"topic":     w.Topic,
+		"timestamp": msg.Timestamp.Format(time.RFC3339Nano),
+		"message":   json.RawMessage(msg.Payload),
+	})
+	if err != nil {
+		return err
+	}
+
+	d := &pb.Delivery{
+		Id:        msg.ID,
+		WebhookId: w.ID,
+	}
+
+	backoff := webhookBackoff
+
+	for attempt := 1; ; attempt++ {
+		status, err := w.post(ctx, msg.ID, body)
+
+		d.Attempts = int32(attempt)
+		d.Status = int32(status)
+		d.Timestamp = time.Now().Format(time.RFC3339Nano)
+		d.Delivered = err == nil
+		d.Error = ""
+
+		if err == nil {
+			break
+		}
+
+		d.Error = err.Error()
+		log.Errorf("Tenant %v webhook %v failed to deliver %v attempt %d: %v", w.Tenant, w.ID, msg.ID, attempt, err)
+
+		if attempt == webhookAttempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	rec := store.NewRecord(deliveryKey(w.Tenant, w.ID, time.Now(), msg.ID), d)
+	rec.Expiry = deliveryExpiry
+	if err := store.Write(rec); err != nil {
+		log.Errorf("Error logging delivery of %v: %v", msg.ID, err)
+	}
+
+	if d.Delivered {
+		return nil
+	}
+
+	return publishDeadLetter(w.Tenant, &pending{
+		ID:        msg.ID,
+		Topic:     w.Topic,
+		Group:     w.group(),
+		Payload:   msg.Payload,
+		Timestamp: msg.Timestamp,
+		Attempt:   d.Attempts,
+	})
+}
+
+// consume delivers the messages of the topic until the context is cancelled
+func (w *Webhook) consume(ctx context.Context) {
+	filter, err := query.Parse(w.Filter)
+	if err != nil {
+		log.Errorf("Invalid filter for webhook %v: %v", w.ID, err)
+		return
+	}
+
+	topic := path.Join("event", w.Tenant, w.Topic)
+
+	var sub <-chan events.Event
+
+	for {
+		sub, err = events.Consume(topic,
+			events.WithGroup(w.group()),
+			events.WithAutoAck(false, webhookAckWait),
+			events.WithContext(ctx),
+		)
+		if err == nil {
+			break
+		}
+
+		log.Errorf("Error consuming %v for webhook %v: %v", topic, w.ID, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(webhookBackoff * 10):
+		}
+	}
+
+	t := retention(w.Tenant, w.Topic)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-sub:
+			if !ok {
+				return
+			}
+
+			if t.retained(msg.Timestamp) && matches(filter, msg.Payload) {
+				if err := w.deliver(ctx, &msg); err != nil {
+					log.Errorf("Error delivering %v for webhook %v: %v", msg.ID, w.ID, err)
+					msg.Nack()
+					continue
+				}
+			}
+
+			msg.Ack()
+			writeOffset(w.Tenant, w.Topic, w.group(), &msg)
+		}
+	}
+}
+
+// startWebhook runs the consumer of the webhook, must hold the lock
+func (s *Event) startWebhook(w *Webhook) {
+	key := webhookKey(w.Tenant, w.ID)
+	if _, ok := s.webhooks[key]; ok {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.webhooks[key] = cancel
+
+	go w.consume(ctx)
+}
+
+// stopWebhook stops the consumer of the webhook, must hold the lock
+func (s *Event) stopWebhook(key string) {
+	if cancel, ok := s.webhooks[key]; ok {
+		cancel()
+		delete(s.webhooks, key)
+	}
+}
+
+// runWebhooks keeps the consumers on this replica in line with the stored webhooks.
+// Every replica consumes with the webhook's group so each message is delivered once.
+func (s *Event) runWebhooks() {
+	ticker := time.NewTicker(webhookSyncInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.syncWebhooks(); err != nil {
+			log.Errorf("Error syncing webhooks: %v", err)
+		}
+		<-ticker.C
+	}
+}
+
+func (s *Event) syncWebhooks() error {
+	s.Lock()
+	defer s.Unlock()
+
+	recs, err := store.Read(webhookPrefix+"/", store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	seen := map[string]bool{}
+
+	for _, rec := range recs {
+		w := new(Webhook)
+		if err := rec.Decode(w); err != nil {
+			log.Errorf("Error decoding webhook %v: %v", rec.Key, err)
+			continue
+		}
+		seen[rec.Key] = true
+		s.startWebhook(w)
+	}
+
+	for key := range s.webhooks {
+		if !seen[key] {
+			s.stopWebhook(key)
+		}
+	}
+
+	return nil
+}
+
+func readWebhook(tnt, id string) (*Webhook, error) {
+	recs, err := store.Read(webhookKey(tnt, id))
+	if err != nil {
+		return nil, err
+	}
+	w := new(Webhook)
+	if err := recs[0].Decode(w); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func validateWebhookURL(u string) error {
+	uri, err := url.Parse(u)
+	if err != nil {
+		return err
+	}
+	if uri.Scheme != "http" && uri.Scheme != "https" {
+		return fmt.Errorf("scheme must be http or https")
+	}
+	if len(uri.Host) == 0 {
+		return fmt.Errorf("missing host")
+	}
+	if network.IsPrivateIP(uri.Host) {
+		return fmt.Errorf("url resolves to a private address")
+	}
+	return nil
+}
+
+func (s *Event) CreateWebhook(ctx context.Context, req *pb.CreateWebhookRequest, rsp *pb.CreateWebhookResponse) error {
+	if len(req.Topic) == 0 {
+		return errors.BadRequest("event.createwebhook", "topic is blank")
+	}
+	// webhooks consume a single topic
+	if wildcard(req.Topic) {
+		return errors.BadRequest("event.createwebhook", "topic can't have wildcards")
+	}
+	if err := validateWebhookURL(req.Url); err != nil {
+		return errors.BadRequest("event.createwebhook", "invalid url: %v", err)
+	}
+	if _, err := query.Parse(req.Filter); err != nil {
+		return errors.BadRequest("event.createwebhook", "invalid filter: %v", err)
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	secret := req.Secret
+	if len(secret) == 0 {
+		b := make([]byte, 32)
+		if _, err := rand.Read(b); err != nil {
+			return errors.InternalServerError("event.createwebhook", "failed to generate secret")
+		}
+		secret = hex.EncodeToString(b)
+	}
+
+	w := &Webhook{
+		ID:      uuid.New().String(),
+		Tenant:  id,
+		Topic:   req.Topic,
+		URL:     req.Url,
+		Secret:  secret,
+		Filter:  req.Filter,
+		Created: time.Now(),
+	}
+
+	if err := store.Write(store.NewRecord(webhookKey(id, w.ID), w)); err != nil {
+		return err
+	}
+
+	log.Infof("Tenant %v created webhook %v for %v", id, w.ID, req.Topic)
+
+	s.Lock()
+	s.startWebhook(w)
+	s.Unlock()
+
+	rsp.Webhook = w.proto()
+
+	return nil
+}
+
+func (s *Event) ListWebhooks(ctx context.Context, req *pb.ListWebhooksRequest, rsp *pb.ListWebhooksResponse) error {
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	recs, err := store.Read(webhookKey(id, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	var hooks []*Webhook
+	for _, rec := range recs {
+		w := new(Webhook)
+		if err := rec.Decode(w); err != nil {
+			return err
+		}
+		if len(req.Topic) > 0 && w.Topic != req.Topic {
+			continue
+		}
+		hooks = append(hooks, w)
+	}
+
+	sort.Slice(hooks, func(i, j int) bool {
+		return hooks[i].Created.Before(hooks[j].Created)
+	})
+
+	for _, w := range hooks {
+		rsp.Webhooks = append(rsp.Webhooks, w.proto())
+	}
+
+	return nil
+}
+
+func (s *Event) DeleteWebhook(ctx context.Context, req *pb.DeleteWebhookRequest, rsp *pb.DeleteWebhookResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("event.deletewebhook", "id is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	w, err := readWebhook(id, req.Id)
+	if err == store.ErrNotFound {
+		return errors.NotFound("event.deletewebhook", "webhook not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	key := webhookKey(id, w.ID)
+	if err := store.Delete(key); err != nil {
+		return err
+	}
+
+	s.Lock()
+	s.stopWebhook(key)
+	s.Unlock()
+
+	log.Infof("Tenant %v deleted webhook %v", id, w.ID)
+
+	if err := store.Delete(offsetKey(id, w.Topic, w.group())); err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	return deletePrefix(fmt.Sprintf("%s/%s/%s/", deliveryPrefix, id, w.ID))
+}
+
+func (s *Event) Deliveries(ctx context.Context, req *pb.DeliveriesRequest, rsp *pb.DeliveriesResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("event.deliveries", "id is blank")
+	}
+
+	limit := int(req.Limit)
+	if limit <= 0 {
+		limit = defaultDeliveriesLimit
+	}
+	if limit > maxDeliveriesLimit {
+		limit = maxDeliveriesLimit
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	if _, err := readWebhook(id, req.Id); err == store.ErrNotFound {
+		return errors.NotFound("event.deliveries", "webhook not found")
+	} else if err != nil {
+		return err
+	}
+
+	recs, err := store.Read(fmt.Sprintf("%s/%s/%s/", deliveryPrefix, id, req.Id), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	// most recent first
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].Key > recs[j].Key
+	})
+
+	for _, rec := range recs {
+		if len(rsp.Deliveries) == limit {
+			break
+		}
+		d := new(pb.Delivery)
+		if err := rec.Decode(d); err != nil {
+			return err
+		}
+		rsp.Deliveries = append(rsp.Deliveries, d)
+	}
+
+	return nil
+}
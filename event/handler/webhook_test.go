@@ -0,0 +1,148 @@
+package handler
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/events/stream/memory"
+	"github.com/micro/micro/v3/service/store"
+	smem "github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/event/proto"
+	"github.com/micro/services/pkg/network"
+)
+
+func TestSign(t *testing.T) {
+	tcs := []struct {
+		name   string
+		secret string
+		body   string
+	}{
+		{"message", "secret", `{"id":"1"}`},
+		{"empty body", "secret", ``},
+		{"other secret", "other", `{"id":"1"}`},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			mac := hmac.New(sha256.New, []byte(tc.secret))
+			mac.Write([]byte(tc.body))
+			want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+			w := &Webhook{Secret: tc.secret}
+			if got := w.sign([]byte(tc.body)); got != want {
+				t.Errorf("sign = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if a, b := (&Webhook{Secret: "a"}).sign([]byte("x")), (&Webhook{Secret: "b"}).sign([]byte("x")); a == b {
+		t.Error("different secrets signed alike")
+	}
+}
+
+func TestDeliver(t *testing.T) {
+	webhookBackoff = 10 * time.Millisecond
+	privateWebhook = func(string) bool { return false }
+	defer func() {
+		webhookBackoff = time.Second
+		privateWebhook = network.IsPrivateIP
+	}()
+
+	tcs := []struct {
+		name      string
+		failures  int
+		attempts  int32
+		delivered bool
+	}{
+		{"first attempt", 0, 1, true},
+		{"retried", 2, 3, true},
+		{"dead lettered", webhookAttempts, webhookAttempts, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			store.DefaultStore = smem.NewStore()
+			events.DefaultStream, _ = memory.NewStream()
+
+			w := &Webhook{ID: "w", Tenant: "t", Topic: "orders", Secret: "secret"}
+
+			var mtx sync.Mutex
+			var times []time.Time
+			srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				body, _ := ioutil.ReadAll(r.Body)
+				if r.Header.Get(signatureHeader) != w.sign(body) {
+					t.Error("request not signed with the secret")
+				}
+
+				mtx.Lock()
+				defer mtx.Unlock()
+				times = append(times, time.Now())
+				if len(times) <= tc.failures {
+					rw.WriteHeader(http.StatusInternalServerError)
+				}
+			}))
+			defer srv.Close()
+			w.URL = srv.URL
+
+			dlq, err := events.Consume("event/t/orders" + dlqSuffix)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			msg := &events.Event{ID: "1", Timestamp: time.Now(), Payload: []byte(`{"total":1}`)}
+			if err := w.deliver(context.Background(), msg); err != nil {
+				t.Fatal(err)
+			}
+
+			if int32(len(times)) != tc.attempts {
+				t.Fatalf("posted %d times, want %d", len(times), tc.attempts)
+			}
+			// each retry waits twice as long as the one before
+			for i := 1; i < len(times); i++ {
+				if wait := webhookBackoff << uint(i-1); times[i].Sub(times[i-1]) < wait {
+					t.Errorf("attempt %d after %v, want at least %v", i+1, times[i].Sub(times[i-1]), wait)
+				}
+			}
+
+			recs, err := store.Read(deliveryPrefix+"/t/w/", store.ReadPrefix())
+			if err != nil || len(recs) != 1 {
+				t.Fatalf("Expected a logged delivery, got %d: %v", len(recs), err)
+			}
+			d := new(pb.Delivery)
+			json.Unmarshal(recs[0].Value, d)
+			if d.Attempts != tc.attempts || d.Delivered != tc.delivered {
+				t.Errorf("logged %d attempts delivered %v, want %d %v", d.Attempts, d.Delivered, tc.attempts, tc.delivered)
+			}
+
+			select {
+			case ev := <-dlq:
+				if tc.delivered {
+					t.Errorf("delivered message %v dead lettered", ev.ID)
+				}
+			case <-time.After(100 * time.Millisecond):
+				if !tc.delivered {
+					t.Error("undelivered message not dead lettered")
+				}
+			}
+		})
+	}
+}
+
+func TestCreateWebhookWildcard(t *testing.T) {
+	s := &Event{webhooks: map[string]context.CancelFunc{}}
+
+	for _, topic := range []string{"orders.*", "orders.>", "*"} {
+		err := s.CreateWebhook(context.Background(), &pb.CreateWebhookRequest{Topic: topic, Url: "https://example.com"}, &pb.CreateWebhookResponse{})
+		if err == nil {
+			t.Errorf("created a webhook for %v", topic)
+		}
+	}
+}
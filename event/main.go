@@ -5,6 +5,7 @@ import (
 	"github.com/micro/micro/v3/service/logger"
 	"github.com/micro/services/event/handler"
 	pb "github.com/micro/services/event/proto"
+	adminpb "github.com/micro/services/pkg/service/proto"
 )
 
 func main() {
@@ -15,7 +16,9 @@ func main() {
 	)
 
 	// Register handler
-	pb.RegisterEventHandler(srv.Server(), new(handler.Event))
+	h := handler.NewEvent()
+	pb.RegisterEventHandler(srv.Server(), h)
+	adminpb.RegisterAdminHandler(srv.Server(), h)
 
 	// Run service
 	if err := srv.Run(); err != nil {
@@ -46,6 +46,17 @@ type EventService interface {
 	Publish(ctx context.Context, in *PublishRequest, opts ...client.CallOption) (*PublishResponse, error)
 	Consume(ctx context.Context, in *ConsumeRequest, opts ...client.CallOption) (Event_ConsumeService, error)
 	Read(ctx context.Context, in *ReadRequest, opts ...client.CallOption) (*ReadResponse, error)
+	Ack(ctx context.Context, in *AckRequest, opts ...client.CallOption) (*AckResponse, error)
+	Replay(ctx context.Context, in *ReplayRequest, opts ...client.CallOption) (*ReplayResponse, error)
+	ListTopics(ctx context.Context, in *ListTopicsRequest, opts ...client.CallOption) (*ListTopicsResponse, error)
+	DeleteTopic(ctx context.Context, in *DeleteTopicRequest, opts ...client.CallOption) (*DeleteTopicResponse, error)
+	SetRetention(ctx context.Context, in *SetRetentionRequest, opts ...client.CallOption) (*SetRetentionResponse, error)
+	Stats(ctx context.Context, in *StatsRequest, opts ...client.CallOption) (*StatsResponse, error)
+	SetSchema(ctx context.Context, in *SetSchemaRequest, opts ...client.CallOption) (*SetSchemaResponse, error)
+	CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...client.CallOption) (*CreateWebhookResponse, error)
+	ListWebhooks(ctx context.Context, in *ListWebhooksRequest, opts ...client.CallOption) (*ListWebhooksResponse, error)
+	DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...client.CallOption) (*DeleteWebhookResponse, error)
+	Deliveries(ctx context.Context, in *DeliveriesRequest, opts ...client.CallOption) (*DeliveriesResponse, error)
 }
 
 type eventService struct {
@@ -129,12 +140,133 @@ func (c *eventService) Read(ctx context.Context, in *ReadRequest, opts ...client
 	return out, nil
 }
 
+func (c *eventService) Ack(ctx context.Context, in *AckRequest, opts ...client.CallOption) (*AckResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.Ack", in)
+	out := new(AckResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) Replay(ctx context.Context, in *ReplayRequest, opts ...client.CallOption) (*ReplayResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.Replay", in)
+	out := new(ReplayResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) ListTopics(ctx context.Context, in *ListTopicsRequest, opts ...client.CallOption) (*ListTopicsResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.ListTopics", in)
+	out := new(ListTopicsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) DeleteTopic(ctx context.Context, in *DeleteTopicRequest, opts ...client.CallOption) (*DeleteTopicResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.DeleteTopic", in)
+	out := new(DeleteTopicResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) SetRetention(ctx context.Context, in *SetRetentionRequest, opts ...client.CallOption) (*SetRetentionResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.SetRetention", in)
+	out := new(SetRetentionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) Stats(ctx context.Context, in *StatsRequest, opts ...client.CallOption) (*StatsResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.Stats", in)
+	out := new(StatsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) SetSchema(ctx context.Context, in *SetSchemaRequest, opts ...client.CallOption) (*SetSchemaResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.SetSchema", in)
+	out := new(SetSchemaResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, opts ...client.CallOption) (*CreateWebhookResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.CreateWebhook", in)
+	out := new(CreateWebhookResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) ListWebhooks(ctx context.Context, in *ListWebhooksRequest, opts ...client.CallOption) (*ListWebhooksResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.ListWebhooks", in)
+	out := new(ListWebhooksResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, opts ...client.CallOption) (*DeleteWebhookResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.DeleteWebhook", in)
+	out := new(DeleteWebhookResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *eventService) Deliveries(ctx context.Context, in *DeliveriesRequest, opts ...client.CallOption) (*DeliveriesResponse, error) {
+	req := c.c.NewRequest(c.name, "Event.Deliveries", in)
+	out := new(DeliveriesResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Event service
 
 type EventHandler interface {
 	Publish(context.Context, *PublishRequest, *PublishResponse) error
 	Consume(context.Context, *ConsumeRequest, Event_ConsumeStream) error
 	Read(context.Context, *ReadRequest, *ReadResponse) error
+	Ack(context.Context, *AckRequest, *AckResponse) error
+	Replay(context.Context, *ReplayRequest, *ReplayResponse) error
+	ListTopics(context.Context, *ListTopicsRequest, *ListTopicsResponse) error
+	DeleteTopic(context.Context, *DeleteTopicRequest, *DeleteTopicResponse) error
+	SetRetention(context.Context, *SetRetentionRequest, *SetRetentionResponse) error
+	Stats(context.Context, *StatsRequest, *StatsResponse) error
+	SetSchema(context.Context, *SetSchemaRequest, *SetSchemaResponse) error
+	CreateWebhook(context.Context, *CreateWebhookRequest, *CreateWebhookResponse) error
+	ListWebhooks(context.Context, *ListWebhooksRequest, *ListWebhooksResponse) error
+	DeleteWebhook(context.Context, *DeleteWebhookRequest, *DeleteWebhookResponse) error
+	Deliveries(context.Context, *DeliveriesRequest, *DeliveriesResponse) error
 }
 
 func RegisterEventHandler(s server.Server, hdlr EventHandler, opts ...server.HandlerOption) error {
@@ -142,6 +274,17 @@ func RegisterEventHandler(s server.Server, hdlr EventHandler, opts ...server.Han
 		Publish(ctx context.Context, in *PublishRequest, out *PublishResponse) error
 		Consume(ctx context.Context, stream server.Stream) error
 		Read(ctx context.Context, in *ReadRequest, out *ReadResponse) error
+		Ack(ctx context.Context, in *AckRequest, out *AckResponse) error
+		Replay(ctx context.Context, in *ReplayRequest, out *ReplayResponse) error
+		ListTopics(ctx context.Context, in *ListTopicsRequest, out *ListTopicsResponse) error
+		DeleteTopic(ctx context.Context, in *DeleteTopicRequest, out *DeleteTopicResponse) error
+		SetRetention(ctx context.Context, in *SetRetentionRequest, out *SetRetentionResponse) error
+		Stats(ctx context.Context, in *StatsRequest, out *StatsResponse) error
+		SetSchema(ctx context.Context, in *SetSchemaRequest, out *SetSchemaResponse) error
+		CreateWebhook(ctx context.Context, in *CreateWebhookRequest, out *CreateWebhookResponse) error
+		ListWebhooks(ctx context.Context, in *ListWebhooksRequest, out *ListWebhooksResponse) error
+		DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, out *DeleteWebhookResponse) error
+		Deliveries(ctx context.Context, in *DeliveriesRequest, out *DeliveriesResponse) error
 	}
 	type Event struct {
 		event
@@ -201,3 +344,47 @@ func (x *eventConsumeStream) Send(m *ConsumeResponse) error {
 func (h *eventHandler) Read(ctx context.Context, in *ReadRequest, out *ReadResponse) error {
 	return h.EventHandler.Read(ctx, in, out)
 }
+
+func (h *eventHandler) Ack(ctx context.Context, in *AckRequest, out *AckResponse) error {
+	return h.EventHandler.Ack(ctx, in, out)
+}
+
+func (h *eventHandler) Replay(ctx context.Context, in *ReplayRequest, out *ReplayResponse) error {
+	return h.EventHandler.Replay(ctx, in, out)
+}
+
+func (h *eventHandler) ListTopics(ctx context.Context, in *ListTopicsRequest, out *ListTopicsResponse) error {
+	return h.EventHandler.ListTopics(ctx, in, out)
+}
+
+func (h *eventHandler) DeleteTopic(ctx context.Context, in *DeleteTopicRequest, out *DeleteTopicResponse) error {
+	return h.EventHandler.DeleteTopic(ctx, in, out)
+}
+
+func (h *eventHandler) SetRetention(ctx context.Context, in *SetRetentionRequest, out *SetRetentionResponse) error {
+	return h.EventHandler.SetRetention(ctx, in, out)
+}
+
+func (h *eventHandler) Stats(ctx context.Context, in *StatsRequest, out *StatsResponse) error {
+	return h.EventHandler.Stats(ctx, in, out)
+}
+
+func (h *eventHandler) SetSchema(ctx context.Context, in *SetSchemaRequest, out *SetSchemaResponse) error {
+	return h.EventHandler.SetSchema(ctx, in, out)
+}
+
+func (h *eventHandler) CreateWebhook(ctx context.Context, in *CreateWebhookRequest, out *CreateWebhookResponse) error {
+	return h.EventHandler.CreateWebhook(ctx, in, out)
+}
+
+func (h *eventHandler) ListWebhooks(ctx context.Context, in *ListWebhooksRequest, out *ListWebhooksResponse) error {
+	return h.EventHandler.ListWebhooks(ctx, in, out)
+}
+
+func (h *eventHandler) DeleteWebhook(ctx context.Context, in *DeleteWebhookRequest, out *DeleteWebhookResponse) error {
+	return h.EventHandler.DeleteWebhook(ctx, in, out)
+}
+
+func (h *eventHandler) Deliveries(ctx context.Context, in *DeliveriesRequest, out *DeliveriesResponse) error {
+	return h.EventHandler.Deliveries(ctx, in, out)
+}
@@ -2,40 +2,47 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"path"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/micro/micro/v3/service/client"
 	"github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/logger"
-	"github.com/micro/micro/v3/service/store"
 	pb "github.com/micro/services/lists/proto"
 	streamPb "github.com/micro/services/mq/proto"
 	pauth "github.com/micro/services/pkg/auth"
+	"github.com/micro/services/pkg/document"
 	adminpb "github.com/micro/services/pkg/service/proto"
-	"github.com/micro/services/pkg/tenant"
-	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // New returns an initialized Lists
 func New(c client.Client) *Lists {
 	return &Lists{
-		Stream: streamPb.NewMqService("mq", c),
+		docs: &document.Collection{
+			Service: "lists",
+			Type:    "list",
+			Key: func(tnt, id string) string {
+				return path.Join("list", tnt) + "/" + id
+			},
+			New: func() document.Doc {
+				return new(pb.List)
+			},
+			Title: func(d document.Doc) string {
+				return d.(*pb.List).Name
+			},
+			Text: func(d document.Doc) string {
+				return strings.Join(d.(*pb.List).Items, " ")
+			},
+			Stream: streamPb.NewMqService("mq", c),
+		},
 	}
 }
 
 // Lists implements the lists proto definition
 type Lists struct {
-	Stream streamPb.MqService
-}
-
-func newMessage(ev map[string]interface{}) *structpb.Struct {
-	st := new(structpb.Struct)
-	b, _ := json.Marshal(ev)
-	json.Unmarshal(b, st)
-	return st
+	docs *document.Collection
 }
 
 // Create inserts a new list in the store
@@ -44,11 +51,6 @@ func (h *Lists) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Creat
 		return errors.BadRequest("lists.create", "missing name and text")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
 	// generate a key (uuid v4)
 	id, err := uuid.NewUUID()
 	if err != nil {
@@ -63,26 +65,18 @@ func (h *Lists) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Creat
 		Updated: t,
 		Name:    req.Name,
 		Items:   req.Items,
+		OwnerId: req.UserId,
+		Tags:    document.Tags(req.Tags),
+		Labels:  req.Labels,
 	}
 
-	key := path.Join("list", tnt, id.String())
-	rec := store.NewRecord(key, list)
-
-	if err = store.Write(rec); err != nil {
-		return errors.InternalServerError("lists.created", "failed to create list")
+	if err := h.docs.Create(ctx, "lists.create", list); err != nil {
+		return err
 	}
 
 	// return the list in the response
 	rsp.List = list
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "lists",
-		Message: newMessage(map[string]interface{}{
-			"event": "create",
-			"list":  list,
-		}),
-	})
-
 	return nil
 }
 
@@ -91,29 +85,14 @@ func (h *Lists) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadRespo
 		return errors.BadRequest("lists.read", "Missing List ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("list", tnt, req.Id)
-
 	// read the specific list
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return errors.NotFound("lists.read", "List not found")
-	} else if err != nil {
-		return errors.InternalServerError("lists.read", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the list
-	var list *pb.List
-	if err := recs[0].Decode(&list); err != nil {
-		return errors.InternalServerError("lists.update", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Read(ctx, "lists.read", req.Id, req.UserId, document.Read)
+	if err != nil {
+		return err
 	}
 
 	// return the list
-	rsp.List = list
+	rsp.List = doc.(*pb.List)
 
 	return nil
 }
@@ -128,98 +107,63 @@ func (h *Lists) Update(ctx context.Context, req *pb.UpdateRequest, rsp *pb.Updat
 		return errors.BadRequest("lists.update", "Missing List ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("list", tnt, req.List.Id)
-
 	// read the specific list
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return errors.NotFound("lists.update", "List not found")
-	} else if err != nil {
-		return errors.InternalServerError("lists.update", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the list
-	var list *pb.List
-	if err := recs[0].Decode(&list); err != nil {
-		return errors.InternalServerError("lists.update", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Read(ctx, "lists.update", req.List.Id, req.UserId, document.Write)
+	if err != nil {
+		return err
 	}
+	list := doc.(*pb.List)
 
-	// Update the lists name and text
+	// Update the lists name, items, tags and labels
 	list.Name = req.List.Name
 	list.Items = req.List.Items
+	list.Tags = document.Tags(req.List.Tags)
+	list.Labels = req.List.Labels
 	list.Updated = time.Now().Format(time.RFC3339)
 
-	rec := store.NewRecord(key, list)
-
 	// Write the updated list to the store
-	if err = store.Write(rec); err != nil {
-		return errors.InternalServerError("lists.update", "Error writing to store: %v", err.Error())
+	if err := h.docs.Update(ctx, "lists.update", document.EventUpdate, list); err != nil {
+		return err
 	}
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "lists",
-		Message: newMessage(map[string]interface{}{
-			"event": "update",
-			"list":  list,
-		}),
-	})
-
 	rsp.List = list
 
 	return nil
 }
 
-func (h *Lists) Events(ctx context.Context, req *pb.EventsRequest, stream pb.Lists_EventsStream) error {
-	backendStream, err := h.Stream.Subscribe(ctx, &streamPb.SubscribeRequest{
-		Topic: "lists",
-	})
-	if err != nil {
-		return errors.InternalServerError("lists.subscribe", "Failed to subscribe to lists")
+// Share gives another user access to the list
+func (h *Lists) Share(ctx context.Context, req *pb.ShareRequest, rsp *pb.ShareResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("lists.share", "Missing List ID")
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
-
-		// receive messages from the stream
-		msg, err := backendStream.Recv()
-		if err != nil {
-			return nil
-		}
-
-		v, err := msg.Message.MarshalJSON()
-		if err != nil {
-			continue
-		}
+	doc, err := h.docs.Read(ctx, "lists.share", req.Id, req.UserId, document.Owner)
+	if err != nil {
+		return err
+	}
+	list := doc.(*pb.List)
 
-		rsp := new(pb.EventsResponse)
+	shares, err := document.Share("lists.share", list, req.ShareWith, req.Access)
+	if err != nil {
+		return err
+	}
+	list.Shares = shares
+	list.Updated = time.Now().Format(time.RFC3339)
 
-		if err := json.Unmarshal(v, rsp); err != nil {
-			continue
-		}
+	if err := h.docs.Update(ctx, "lists.share", document.EventUpdate, list); err != nil {
+		return err
+	}
 
-		list := rsp.List
+	rsp.List = list
 
-		// filter if necessary by id
-		if len(req.Id) > 0 && list.Id != req.Id {
-			continue
-		}
+	return nil
+}
 
+func (h *Lists) Events(ctx context.Context, req *pb.EventsRequest, stream pb.Lists_EventsStream) error {
+	return h.docs.Events(ctx, "lists.subscribe", req.Id, req.UserId, func(event string, doc document.Doc) error {
 		// send back the event to the client
-		if err := stream.Send(rsp); err != nil {
-			return nil
-		}
-	}
-
-	return nil
+		return stream.Send(&pb.EventsResponse{Event: event, List: doc.(*pb.List)})
+	})
 }
 
 // Delete removes the list from the store, looking up using ID
@@ -229,73 +173,52 @@ func (h *Lists) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.Delet
 		return errors.BadRequest("lists.delete", "Missing List ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("list", tnt, req.Id)
-
-	// read the specific list
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return nil
-	} else if err != nil {
-		return errors.InternalServerError("lists.delete", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the list
-	var list *pb.List
-	if err := recs[0].Decode(&list); err != nil {
-		return errors.InternalServerError("lists.delete", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Delete(ctx, "lists.delete", req.Id, req.UserId)
+	if err != nil {
+		return err
 	}
-
-	// now delete it
-	if err := store.Delete(key); err != nil && err != store.ErrNotFound {
-		return errors.InternalServerError("lists.delete", "Failed to delete list")
+	if doc != nil {
+		rsp.List = doc.(*pb.List)
 	}
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "lists",
-		Message: newMessage(map[string]interface{}{
-			"event": "delete",
-			"list":  list,
-		}),
-	})
-
-	rsp.List = list
-
 	return nil
 }
 
-// List returns all of the lists in the store
+// List returns the lists in the store the user can read
 func (h *Lists) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListResponse) error {
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := path.Join("list", tnt) + "/"
-
-	// Retrieve all of the records in the store
-	recs, err := store.Read(key, store.ReadPrefix())
+	docs, total, err := h.docs.List(ctx, "lists.list", &document.Query{
+		UserId:  req.UserId,
+		Tags:    req.Tags,
+		Labels:  req.Labels,
+		Search:  req.Search,
+		OrderBy: orderBy(req.OrderBy),
+		Order:   req.Order,
+		Limit:   int(req.Limit),
+		Offset:  int(req.Offset),
+	})
 	if err != nil {
-		return errors.InternalServerError("lists.list", "Error reading from store: %v", err.Error())
+		return err
 	}
 
 	// Initialize the response lists slice
-	rsp.Lists = make([]*pb.List, len(recs))
+	rsp.Lists = make([]*pb.List, len(docs))
+	rsp.Total = int32(total)
 
-	// Unmarshal the lists into the response
-	for i, r := range recs {
-		if err := r.Decode(&rsp.Lists[i]); err != nil {
-			return errors.InternalServerError("lists.list", "Error decoding list: %v", err.Error())
-		}
+	for i, doc := range docs {
+		rsp.Lists[i] = doc.(*pb.List)
 	}
 
 	return nil
 }
 
+// orderBy maps the name of a list to the title documents are ordered by
+func orderBy(field string) string {
+	if field == "name" {
+		return "title"
+	}
+	return field
+}
+
 func (h *Lists) DeleteData(ctx context.Context, request *adminpb.DeleteDataRequest, response *adminpb.DeleteDataResponse) error {
 	method := "admin.DeleteData"
 	_, err := pauth.VerifyMicroAdmin(ctx, method)
@@ -307,18 +230,12 @@ func (h *Lists) DeleteData(ctx context.Context, request *adminpb.DeleteDataReque
 		return errors.BadRequest(method, "Missing tenant ID")
 	}
 
-	keys, err := store.List(store.ListPrefix(path.Join("list", request.TenantId) + "/"))
+	deleted, err := h.docs.DeleteTenant(request.TenantId)
 	if err != nil {
 		return err
 	}
 
-	for _, k := range keys {
-		if err := store.Delete(k); err != nil {
-			return err
-		}
-	}
-
-	logger.Infof("Deleted %d keys for %s", len(keys), request.TenantId)
+	logger.Infof("Deleted %d keys for %s", deleted, request.TenantId)
 	return nil
 }
 
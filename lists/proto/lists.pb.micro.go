@@ -48,6 +48,7 @@ type ListsService interface {
 	Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error)
 	Update(ctx context.Context, in *UpdateRequest, opts ...client.CallOption) (*UpdateResponse, error)
 	Events(ctx context.Context, in *EventsRequest, opts ...client.CallOption) (Lists_EventsService, error)
+	Share(ctx context.Context, in *ShareRequest, opts ...client.CallOption) (*ShareResponse, error)
 }
 
 type listsService struct {
@@ -161,6 +162,16 @@ func (x *listsServiceEvents) Recv() (*EventsResponse, error) {
 	return m, nil
 }
 
+func (c *listsService) Share(ctx context.Context, in *ShareRequest, opts ...client.CallOption) (*ShareResponse, error) {
+	req := c.c.NewRequest(c.name, "Lists.Share", in)
+	out := new(ShareResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Lists service
 
 type ListsHandler interface {
@@ -170,6 +181,7 @@ type ListsHandler interface {
 	Delete(context.Context, *DeleteRequest, *DeleteResponse) error
 	Update(context.Context, *UpdateRequest, *UpdateResponse) error
 	Events(context.Context, *EventsRequest, Lists_EventsStream) error
+	Share(context.Context, *ShareRequest, *ShareResponse) error
 }
 
 func RegisterListsHandler(s server.Server, hdlr ListsHandler, opts ...server.HandlerOption) error {
@@ -180,6 +192,7 @@ func RegisterListsHandler(s server.Server, hdlr ListsHandler, opts ...server.Han
 		Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error
 		Update(ctx context.Context, in *UpdateRequest, out *UpdateResponse) error
 		Events(ctx context.Context, stream server.Stream) error
+		Share(ctx context.Context, in *ShareRequest, out *ShareResponse) error
 	}
 	type Lists struct {
 		lists
@@ -251,3 +264,7 @@ func (x *listsEventsStream) RecvMsg(m interface{}) error {
 func (x *listsEventsStream) Send(m *EventsResponse) error {
 	return x.stream.Send(m)
 }
+
+func (h *listsHandler) Share(ctx context.Context, in *ShareRequest, out *ShareResponse) error {
+	return h.ListsHandler.Share(ctx, in, out)
+}
@@ -5,21 +5,49 @@ import (
 	"encoding/json"
 	"fmt"
 	"path"
+	"sync"
 
 	"github.com/asim/mq/broker"
 	"github.com/micro/micro/v3/service/errors"
 	log "github.com/micro/micro/v3/service/logger"
 	pb "github.com/micro/services/mq/proto"
+	"github.com/micro/services/pkg/redis"
 	"github.com/micro/services/pkg/tenant"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-type Mq struct{}
+type Mq struct {
+	sync.Mutex
+	// durable queues by store prefix
+	queues map[string]*queue
+	// keys of the queued messages shared by every replica
+	keys queueKeys
+
+	// subscribers to wildcard patterns
+	patterns *trie
+	// subscribers to MQTT topic filters
+	filters *trie
+	// broker subscriptions of the tenants with subscribers on this replica
+	feeds map[string]*feed
+}
+
+func NewMq() *Mq {
+	return &Mq{
+		queues:   map[string]*queue{},
+		keys:     redis.NewQueues("mq"),
+		patterns: newPatterns(),
+		filters:  newFilters(),
+		feeds:    map[string]*feed{},
+	}
+}
 
 func (mq *Mq) Publish(ctx context.Context, req *pb.PublishRequest, rsp *pb.PublishResponse) error {
-	if len(req.Topic) == 0 {
+	if len(req.Topic) == 0 && len(req.Queue) == 0 {
 		return errors.BadRequest("mq.publish", "topic is blank")
 	}
+	if len(req.Topic) > 0 && len(req.Queue) > 0 {
+		return errors.BadRequest("mq.publish", "specify a topic or a queue")
+	}
 
 	// get the tenant
 	id, ok := tenant.FromContext(ctx)
@@ -27,30 +55,49 @@ func (mq *Mq) Publish(ctx context.Context, req *pb.PublishRequest, rsp *pb.Publi
 		id = "default"
 	}
 
-	// create tenant based topics
-	topic := path.Join("event", id, req.Topic)
+	if len(req.Queue) > 0 {
+		return mq.publishQueue(id, req)
+	}
+
+	if mq.patterns.wildcard(req.Topic) {
+		return errors.BadRequest("mq.publish", "can't publish to a wildcard topic")
+	}
 
 	// marshal the data
 	b, _ := json.Marshal(req.Message.AsMap())
 
 	log.Infof("Tenant %v publishing to %v\n", id, req.Topic)
 
-	// publish the message
-	broker.Publish(topic, b)
+	// publish the message to the tenant based topic
+	mq.publish(id, req.Topic, b)
 
 	return nil
 }
 
 func (mq *Mq) Subscribe(ctx context.Context, req *pb.SubscribeRequest, stream pb.Mq_SubscribeStream) error {
-	if len(req.Topic) == 0 {
+	if len(req.Topic) == 0 && len(req.Queue) == 0 {
 		return errors.BadRequest("mq.publish", "topic is blank")
 	}
+	if len(req.Topic) > 0 && len(req.Queue) > 0 {
+		return errors.BadRequest("mq.subscribe", "specify a topic or a queue")
+	}
 
 	id, ok := tenant.FromContext(ctx)
 	if !ok {
 		id = "default"
 	}
 
+	if len(req.Queue) > 0 {
+		return mq.subscribeQueue(ctx, id, req, stream)
+	}
+	if req.ManualAck {
+		return errors.BadRequest("mq.subscribe", "only queue messages are acked")
+	}
+
+	if mq.patterns.wildcard(req.Topic) {
+		return mq.subscribePattern(ctx, id, req, stream)
+	}
+
 	// create tenant based topics
 	topic := path.Join("event", id, req.Topic)
 
@@ -60,7 +107,7 @@ func (mq *Mq) Subscribe(ctx context.Context, req *pb.SubscribeRequest, stream pb
 	if err != nil {
 		return errors.InternalServerError("mq.subscribe", "failed to subscribe to mq")
 	}
-	defer broker.Unsubscribe(req.Topic, sub)
+	defer broker.Unsubscribe(topic, sub)
 
 	// range over the messages until the subscriber is closed
 	for msg := range sub {
@@ -79,3 +126,33 @@ func (mq *Mq) Subscribe(ctx context.Context, req *pb.SubscribeRequest, stream pb
 
 	return nil
 }
+
+// subscribePattern streams the messages of every topic matching the pattern
+// e.g orders.* matches orders.created and orders.> matches orders.eu.created
+func (mq *Mq) subscribePattern(ctx context.Context, tnt string, req *pb.SubscribeRequest, stream pb.Mq_SubscribeStream) error {
+	if !mq.patterns.valid(req.Topic) {
+		return errors.BadRequest("mq.subscribe", "invalid topic pattern")
+	}
+
+	log.Infof("Tenant %v subscribing to pattern %v\n", tnt, req.Topic)
+
+	sub := mq.subscribe(mq.patterns, tnt, req.Topic, false)
+	defer mq.unsubscribe(sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg := <-sub.ch:
+			d := &structpb.Struct{}
+			d.UnmarshalJSON(msg.payload)
+
+			if err := stream.Send(&pb.SubscribeResponse{
+				Topic:   msg.topic,
+				Message: d,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
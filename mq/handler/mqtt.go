@@ -0,0 +1,486 @@
+package handler
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/auth"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/mq/mqtt"
+	"github.com/micro/services/pkg/tenant"
+)
+
+const (
+	retainedPrefix = "retained"
+
+	// time allowed to send CONNECT after connecting
+	connectTimeout = 10 * time.Second
+	// unacked QoS 1 messages are resent after
+	retryInterval = 20 * time.Second
+	// max unacked QoS 1 messages per connection, more wait for acks
+	maxInflight = 100
+)
+
+var (
+	errClosed    = errors.New("connection closed")
+	errNotAcking = errors.New("client isn't acking messages")
+)
+
+// mqttConn is an MQTT client connection authenticated as a tenant
+type mqttConn struct {
+	mq     *Mq
+	conn   net.Conn
+	tenant string
+	client string
+	will   *mqtt.Publish
+
+	// guards writes to the connection
+	wmtx sync.Mutex
+
+	sync.Mutex
+	subs     map[string]*mqttSub
+	inflight map[uint16]*inflight
+	packetID uint16
+	// signalled when a QoS 1 message is acked
+	acked chan struct{}
+
+	done chan struct{}
+}
+
+// mqttSub is a subscription of a connection
+type mqttSub struct {
+	sub  *subscriber
+	qos  byte
+	exit chan struct{}
+}
+
+type inflight struct {
+	pub  *mqtt.Publish
+	sent time.Time
+}
+
+func retainedKey(tnt, topic string) string {
+	return retainedPrefix + "/" + tnt + "/" + topic
+}
+
+// ServeMQTT accepts MQTT 3.1.1 connections. Clients connect with an API key as the
+// password and publish and subscribe to the same topics as the Mq RPC endpoints.
+func (mq *Mq) ServeMQTT(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go mq.serveConn(conn)
+	}
+}
+
+func (mq *Mq) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+
+	conn.SetReadDeadline(time.Now().Add(connectTimeout))
+
+	p, err := mqtt.ReadPacket(r)
+	if err != nil || p.Type != mqtt.CONNECT {
+		return
+	}
+
+	c := &mqttConn{
+		mq:       mq,
+		conn:     conn,
+		subs:     map[string]*mqttSub{},
+		inflight: map[uint16]*inflight{},
+		acked:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+
+	connect, err := mqtt.ParseConnect(p)
+	if err != nil {
+		return
+	}
+
+	if code := c.connect(connect); code != mqtt.Accepted {
+		c.write(mqtt.CONNACK, 0, mqtt.ConnAck(code))
+		return
+	}
+
+	if err := c.write(mqtt.CONNACK, 0, mqtt.ConnAck(mqtt.Accepted)); err != nil {
+		return
+	}
+
+	log.Infof("Tenant %v connected over MQTT as %v", c.tenant, c.client)
+
+	go c.retry()
+
+	err = c.serve(r, connect.KeepAlive)
+
+	close(c.done)
+
+	c.Lock()
+	for filter, s := range c.subs {
+		c.unsubscribe(filter, s)
+	}
+	c.Unlock()
+
+	// the will is published unless the client disconnected cleanly
+	if err != nil && c.will != nil {
+		c.publish(c.will)
+	}
+
+	log.Infof("Tenant %v disconnected over MQTT as %v", c.tenant, c.client)
+}
+
+// connect authenticates the client returning the CONNACK code
+func (c *mqttConn) connect(connect *mqtt.Connect) byte {
+	if !connect.Supported() {
+		return mqtt.UnacceptableProtocol
+	}
+
+	// sessions aren't persisted so a client id is only required to resume one
+	if len(connect.ClientID) == 0 {
+		if !connect.CleanSession {
+			return mqtt.IdentifierRejected
+		}
+		connect.ClientID = uuid.New().String()
+	}
+
+	// the api key can be passed as the password or the username
+	key := connect.Password
+	if len(key) == 0 {
+		key = connect.Username
+	}
+	if len(key) == 0 {
+		return mqtt.NotAuthorized
+	}
+
+	acc, err := auth.Inspect(key)
+	if err != nil {
+		return mqtt.BadUsernameOrPassword
+	}
+
+	if connect.Will != nil && !mqtt.ValidTopic(connect.Will.Topic) {
+		return mqtt.NotAuthorized
+	}
+
+	c.tenant = tenant.FromAccount(acc)
+	c.client = connect.ClientID
+	c.will = connect.Will
+
+	return mqtt.Accepted
+}
+
+// serve handles packets until the client disconnects, returning nil on DISCONNECT
+func (c *mqttConn) serve(r *bufio.Reader, keepAlive uint16) error {
+	for {
+		// the client must send a packet within one and a half times the keep alive
+		if keepAlive > 0 {
+			c.conn.SetReadDeadline(time.Now().Add(time.Duration(keepAlive) * 1500 * time.Millisecond))
+		} else {
+			c.conn.SetReadDeadline(time.Time{})
+		}
+
+		p, err := mqtt.ReadPacket(r)
+		if err != nil {
+			return err
+		}
+
+		switch p.Type {
+		case mqtt.PUBLISH:
+			pub, err := mqtt.ParsePublish(p)
+			if err != nil {
+				return err
+			}
+			// QoS 2 isn't supported
+			if pub.QoS > 1 || !mqtt.ValidTopic(pub.Topic) {
+				return mqtt.ErrMalformed
+			}
+			if err := c.publish(pub); err != nil {
+				log.Errorf("Error publishing to %v over MQTT: %v", pub.Topic, err)
+				return err
+			}
+			if pub.QoS == 1 {
+				if err := c.write(mqtt.PUBACK, 0, mqtt.PacketID(pub.PacketID)); err != nil {
+					return err
+				}
+			}
+		case mqtt.PUBACK:
+			id, err := mqtt.ParsePacketID(p)
+			if err != nil {
+				return err
+			}
+			c.Lock()
+			delete(c.inflight, id)
+			c.Unlock()
+			select {
+			case c.acked <- struct{}{}:
+			default:
+			}
+		case mqtt.SUBSCRIBE:
+			sub, err := mqtt.ParseSubscribe(p)
+			if err != nil {
+				return err
+			}
+			if err := c.subscribe(sub); err != nil {
+				return err
+			}
+		case mqtt.UNSUBSCRIBE:
+			unsub, err := mqtt.ParseUnsubscribe(p)
+			if err != nil {
+				return err
+			}
+			c.Lock()
+			for _, filter := range unsub.Filters {
+				if s, ok := c.subs[filter]; ok {
+					c.unsubscribe(filter, s)
+				}
+			}
+			c.Unlock()
+			if err := c.write(mqtt.UNSUBACK, 0, mqtt.PacketID(unsub.PacketID)); err != nil {
+				return err
+			}
+		case mqtt.PINGREQ:
+			if err := c.write(mqtt.PINGRESP, 0, nil); err != nil {
+				return err
+			}
+		case mqtt.DISCONNECT:
+			return nil
+		default:
+			return mqtt.ErrMalformed
+		}
+	}
+}
+
+func (c *mqttConn) write(typ, flags byte, body []byte) error {
+	c.wmtx.Lock()
+	defer c.wmtx.Unlock()
+	return mqtt.WritePacket(c.conn, typ, flags, body)
+}
+
+// publish sends the message to subscribers and updates the retained message
+func (c *mqttConn) publish(pub *mqtt.Publish) error {
+	if pub.Retain {
+		key := retainedKey(c.tenant, pub.Topic)
+
+		// an empty retained message clears it
+		if len(pub.Payload) == 0 {
+			if err := store.Delete(key); err != nil && err != store.ErrNotFound {
+				return err
+			}
+			return nil
+		}
+
+		if err := store.Write(&store.Record{Key: key, Value: pub.Payload}); err != nil {
+			return err
+		}
+	}
+
+	return c.mq.publish(c.tenant, pub.Topic, pub.Payload)
+}
+
+func (c *mqttConn) subscribe(req *mqtt.Subscribe) error {
+	codes := make([]byte, len(req.Subscriptions))
+
+	var added []string
+
+	c.Lock()
+	for i, s := range req.Subscriptions {
+		if !mqtt.ValidFilter(s.Filter) || s.QoS > 2 {
+			codes[i] = mqtt.SubscribeFailure
+			continue
+		}
+
+		// QoS 2 is downgraded to 1
+		qos := s.QoS
+		if qos > 1 {
+			qos = 1
+		}
+		codes[i] = qos
+
+		// a subscription to the same filter replaces the existing one
+		if old, ok := c.subs[s.Filter]; ok {
+			c.unsubscribe(s.Filter, old)
+		}
+
+		sub := &mqttSub{
+			sub:  c.mq.subscribe(c.mq.filters, c.tenant, s.Filter, qos == 1),
+			qos:  qos,
+			exit: make(chan struct{}),
+		}
+		c.subs[s.Filter] = sub
+		added = append(added, s.Filter)
+
+		go c.deliver(sub)
+	}
+	c.Unlock()
+
+	if err := c.write(mqtt.SUBACK, 0, mqtt.SubAck(req.PacketID, codes)); err != nil {
+		return err
+	}
+
+	for _, filter := range added {
+		if err := c.sendRetained(filter); err != nil {
+			log.Errorf("Error sending retained messages for %v: %v", filter, err)
+		}
+	}
+
+	return nil
+}
+
+// unsubscribe stops the subscription, must hold the lock
+func (c *mqttConn) unsubscribe(filter string, s *mqttSub) {
+	c.mq.unsubscribe(s.sub)
+	close(s.exit)
+	delete(c.subs, filter)
+}
+
+// sendRetained sends the retained messages matching a new subscription
+func (c *mqttConn) sendRetained(filter string) error {
+	prefix := retainedKey(c.tenant, "")
+
+	recs, err := store.Read(prefix, store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	c.Lock()
+	s, ok := c.subs[filter]
+	c.Unlock()
+	if !ok {
+		return nil
+	}
+
+	for _, rec := range recs {
+		topic := strings.TrimPrefix(rec.Key, prefix)
+		if !mqtt.Match(filter, topic) {
+			continue
+		}
+		if err := c.send(&mqtt.Publish{
+			Topic:   topic,
+			Payload: rec.Value,
+			QoS:     s.qos,
+			Retain:  true,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deliver forwards the messages of a subscription to the client
+func (c *mqttConn) deliver(s *mqttSub) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-s.exit:
+			return
+		case <-s.sub.overflow:
+			// QoS 1 messages were lost, the client resubscribes on reconnect
+			c.conn.Close()
+			return
+		case msg := <-s.sub.ch:
+			if err := c.send(&mqtt.Publish{
+				Topic:   msg.topic,
+				Payload: msg.payload,
+				QoS:     s.qos,
+			}); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// send writes a PUBLISH tracking QoS 1 messages until they're acked. Once
+// too many are in flight it waits for acks, and gives up if none come.
+func (c *mqttConn) send(pub *mqtt.Publish) error {
+	if pub.QoS > 0 {
+		if err := c.track(pub); err != nil {
+			return err
+		}
+	}
+
+	flags, body := pub.Encode()
+	return c.write(mqtt.PUBLISH, flags, body)
+}
+
+// track assigns a packet id to the QoS 1 message and keeps it until acked
+func (c *mqttConn) track(pub *mqtt.Publish) error {
+	timeout := time.NewTimer(retryInterval * 3)
+	defer timeout.Stop()
+
+	for {
+		c.Lock()
+		if len(c.inflight) < maxInflight {
+			for {
+				c.packetID++
+				if _, ok := c.inflight[c.packetID]; !ok && c.packetID != 0 {
+					break
+				}
+			}
+			pub.PacketID = c.packetID
+			c.inflight[pub.PacketID] = &inflight{pub: pub, sent: time.Now()}
+			c.Unlock()
+			return nil
+		}
+		c.Unlock()
+
+		select {
+		case <-c.acked:
+		case <-c.done:
+			return errClosed
+		case <-timeout.C:
+			return errNotAcking
+		}
+	}
+}
+
+// retry resends QoS 1 messages which haven't been acked
+func (c *mqttConn) retry() {
+	ticker := time.NewTicker(retryInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		var due []*mqtt.Publish
+
+		c.Lock()
+		for _, in := range c.inflight {
+			if time.Since(in.sent) < retryInterval {
+				continue
+			}
+			in.sent = time.Now()
+			due = append(due, &mqtt.Publish{
+				Topic:    in.pub.Topic,
+				Payload:  in.pub.Payload,
+				QoS:      in.pub.QoS,
+				Retain:   in.pub.Retain,
+				PacketID: in.pub.PacketID,
+				Dup:      true,
+			})
+		}
+		c.Unlock()
+
+		for _, pub := range due {
+			flags, body := pub.Encode()
+			if err := c.write(mqtt.PUBLISH, flags, body); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/micro/services/mq/mqtt"
+)
+
+func TestTrack(t *testing.T) {
+	c := &mqttConn{
+		inflight: map[uint16]*inflight{},
+		acked:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	for i := 0; i < maxInflight; i++ {
+		if err := c.track(&mqtt.Publish{QoS: 1}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the next QoS 1 message waits for an ack rather than being downgraded
+	errs := make(chan error, 1)
+	pub := &mqtt.Publish{QoS: 1}
+	go func() { errs <- c.track(pub) }()
+
+	select {
+	case err := <-errs:
+		t.Fatalf("Expected to wait for an ack, got %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	c.Lock()
+	delete(c.inflight, 1)
+	c.Unlock()
+	c.acked <- struct{}{}
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if pub.QoS != 1 || pub.PacketID == 0 || len(c.inflight) != maxInflight {
+		t.Fatalf("Expected QoS 1 in flight, got %d %d of %d", pub.QoS, pub.PacketID, len(c.inflight))
+	}
+
+	// a closed connection stops waiting
+	go func() { errs <- c.track(&mqtt.Publish{QoS: 1}) }()
+	close(c.done)
+	if err := <-errs; err != errClosed {
+		t.Fatalf("Expected errClosed, got %v", err)
+	}
+}
@@ -0,0 +1,380 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	pb "github.com/micro/services/mq/proto"
+	"github.com/micro/services/pkg/tenant"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	queuePrefix = "queue"
+
+	// how long a message is leased to a subscriber before it's redelivered
+	queueLease = time.Minute
+	// how long a message waits to be acked by default before it's redelivered
+	defaultVisibilityTimeout = 30
+	maxVisibilityTimeout     = 60 * 60 * 12
+	// how often subscribers check for messages pushed on other replicas
+	queuePoll = time.Second
+)
+
+// queueKeys orders the keys of the messages of queues, see redis.Queues
+type queueKeys interface {
+	Push(ctx context.Context, queue, item string, at time.Time) error
+	Claim(ctx context.Context, queue string, lease time.Duration) (string, error)
+	Release(ctx context.Context, queue, item string) error
+	Remove(ctx context.Context, queue, item string) error
+	Len(ctx context.Context, queue string) (int64, error)
+	Claimed(ctx context.Context, queue string) (int64, error)
+	Delete(ctx context.Context, queue string) error
+}
+
+// queue is a durable work queue. Messages are persisted in the store and
+// their keys queued in Redis, where each is claimed by one subscriber of any
+// replica at a time.
+type queue struct {
+	sync.Mutex
+	// store prefix of the messages and the name of the queue
+	prefix string
+	keys   queueKeys
+	// whether messages stored before they were queued in Redis were added
+	loaded bool
+	// closed when a message is published on this replica
+	notify chan struct{}
+}
+
+func queueKey(tnt, name string) string {
+	return path.Join(queuePrefix, tnt, name) + "/"
+}
+
+// queue returns the queue of the tenant, creating it if need be
+func (mq *Mq) queue(tnt, name string) *queue {
+	key := queueKey(tnt, name)
+
+	mq.Lock()
+	defer mq.Unlock()
+
+	q, ok := mq.queues[key]
+	if !ok {
+		q = &queue{prefix: key, keys: mq.keys, notify: make(chan struct{})}
+		mq.queues[key] = q
+	}
+	return q
+}
+
+// load queues the messages in the store which aren't yet, must hold the lock
+func (q *queue) load() error {
+	if q.loaded {
+		return nil
+	}
+
+	keys, err := store.List(store.ListPrefix(q.prefix))
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		// keys start with the time of publishing
+		at := time.Now()
+		if nanos, err := strconv.ParseInt(strings.SplitN(strings.TrimPrefix(key, q.prefix), "/", 2)[0], 10, 64); err == nil {
+			at = time.Unix(0, nanos)
+		}
+		if err := q.keys.Push(context.Background(), q.prefix, key, at); err != nil {
+			return err
+		}
+	}
+	q.loaded = true
+
+	return nil
+}
+
+func (q *queue) push(msg []byte) error {
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.load(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	key := fmt.Sprintf("%s%019d/%s", q.prefix, now.UnixNano(), uuid.New().String())
+	if err := store.Write(&store.Record{Key: key, Value: msg}); err != nil {
+		return err
+	}
+	if err := q.keys.Push(context.Background(), q.prefix, key, now); err != nil {
+		store.Delete(key)
+		return err
+	}
+
+	// wake up the waiting subscribers
+	close(q.notify)
+	q.notify = make(chan struct{})
+
+	return nil
+}
+
+// pop claims the next key of the queue for the lease or returns a channel to
+// wait on if it's empty
+func (q *queue) pop(lease time.Duration) (string, <-chan struct{}, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.load(); err != nil {
+		return "", nil, err
+	}
+
+	key, err := q.keys.Claim(context.Background(), q.prefix, lease)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(key) == 0 {
+		return "", q.notify, nil
+	}
+
+	return key, nil, nil
+}
+
+// requeue puts back a message which couldn't be delivered
+func (q *queue) requeue(key string) {
+	if err := q.keys.Release(context.Background(), q.prefix, key); err != nil {
+		log.Errorf("Error requeueing message %v: %v", key, err)
+	}
+
+	q.Lock()
+	defer q.Unlock()
+
+	close(q.notify)
+	q.notify = make(chan struct{})
+}
+
+// done removes a delivered or acked message
+func (q *queue) done(key string) {
+	if err := store.Delete(key); err != nil {
+		log.Errorf("Error deleting delivered message %v: %v", key, err)
+	}
+	if err := q.keys.Remove(context.Background(), q.prefix, key); err != nil {
+		log.Errorf("Error removing delivered message %v: %v", key, err)
+	}
+}
+
+// depth returns the number of messages waiting and of those in flight,
+// delivered but not yet acked
+func (q *queue) depth() (int64, int64, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.load(); err != nil {
+		return 0, 0, err
+	}
+
+	waiting, err := q.keys.Len(context.Background(), q.prefix)
+	if err != nil {
+		return 0, 0, err
+	}
+	inFlight, err := q.keys.Claimed(context.Background(), q.prefix)
+	if err != nil {
+		return 0, 0, err
+	}
+	return waiting, inFlight, nil
+}
+
+func (q *queue) purge() (int64, error) {
+	q.Lock()
+	defer q.Unlock()
+
+	if err := q.load(); err != nil {
+		return 0, err
+	}
+
+	waiting, err := q.keys.Len(context.Background(), q.prefix)
+	if err != nil {
+		return 0, err
+	}
+	inFlight, err := q.keys.Claimed(context.Background(), q.prefix)
+	if err != nil {
+		return 0, err
+	}
+	purged := waiting + inFlight
+
+	// messages being delivered are purged too
+	keys, err := store.List(store.ListPrefix(q.prefix))
+	if err != nil {
+		return 0, err
+	}
+
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := q.keys.Delete(context.Background(), q.prefix); err != nil {
+		return 0, err
+	}
+
+	return purged, nil
+}
+
+// subscribeQueue sends each message to the stream, deleting it once sent or,
+// with manual ack, once acked. Messages not acked within the visibility
+// timeout are claimed by the next subscriber to pop the queue.
+func (mq *Mq) subscribeQueue(ctx context.Context, tnt string, req *pb.SubscribeRequest, stream pb.Mq_SubscribeStream) error {
+	lease := queueLease
+	if req.ManualAck {
+		if req.VisibilityTimeout == 0 {
+			req.VisibilityTimeout = defaultVisibilityTimeout
+		}
+		if req.VisibilityTimeout < 0 || req.VisibilityTimeout > maxVisibilityTimeout {
+			return errors.BadRequest("mq.subscribe", "visibility timeout must be between 1 and %d seconds", maxVisibilityTimeout)
+		}
+		lease = time.Duration(req.VisibilityTimeout) * time.Second
+	}
+
+	q := mq.queue(tnt, req.Queue)
+
+	log.Infof("Tenant %v subscribing to queue %v\n", tnt, req.Queue)
+
+	for {
+		key, wait, err := q.pop(lease)
+		if err != nil {
+			return errors.InternalServerError("mq.subscribe", "failed to read queue")
+		}
+
+		if len(key) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-wait:
+			case <-time.After(queuePoll):
+			}
+			continue
+		}
+
+		recs, err := store.Read(key)
+		if err == store.ErrNotFound {
+			// purged or delivered while queued
+			q.keys.Remove(context.Background(), q.prefix, key)
+			continue
+		}
+		if err != nil {
+			q.requeue(key)
+			return errors.InternalServerError("mq.subscribe", "failed to read queue")
+		}
+
+		d := &structpb.Struct{}
+		d.UnmarshalJSON(recs[0].Value)
+
+		if err := stream.Send(&pb.SubscribeResponse{
+			Queue:   req.Queue,
+			Message: d,
+			Id:      strings.TrimPrefix(key, q.prefix),
+		}); err != nil {
+			q.requeue(key)
+			return err
+		}
+
+		// acked messages stay claimed until acked or the lease runs out
+		if !req.ManualAck {
+			q.done(key)
+		}
+	}
+}
+
+func (mq *Mq) Ack(ctx context.Context, req *pb.AckRequest, rsp *pb.AckResponse) error {
+	if len(req.Queue) == 0 {
+		return errors.BadRequest("mq.ack", "queue is blank")
+	}
+	if len(req.Id) == 0 {
+		return errors.BadRequest("mq.ack", "id is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	q := mq.queue(id, req.Queue)
+	key := q.prefix + req.Id
+
+	if _, err := store.Read(key); err == store.ErrNotFound {
+		return errors.NotFound("mq.ack", "message not found")
+	} else if err != nil {
+		return errors.InternalServerError("mq.ack", "failed to read queue")
+	}
+
+	if req.Nack {
+		q.requeue(key)
+		return nil
+	}
+
+	q.done(key)
+
+	return nil
+}
+
+func (mq *Mq) publishQueue(tnt string, req *pb.PublishRequest) error {
+	b, _ := json.Marshal(req.Message.AsMap())
+
+	log.Infof("Tenant %v publishing to queue %v\n", tnt, req.Queue)
+
+	if err := mq.queue(tnt, req.Queue).push(b); err != nil {
+		log.Errorf("Error publishing to queue %v: %v", req.Queue, err)
+		return errors.InternalServerError("mq.publish", "failed to publish to queue")
+	}
+
+	return nil
+}
+
+func (mq *Mq) Depth(ctx context.Context, req *pb.DepthRequest, rsp *pb.DepthResponse) error {
+	if len(req.Queue) == 0 {
+		return errors.BadRequest("mq.depth", "queue is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	waiting, inFlight, err := mq.queue(id, req.Queue).depth()
+	if err != nil {
+		return errors.InternalServerError("mq.depth", "failed to read queue")
+	}
+	rsp.Depth = waiting + inFlight
+	rsp.InFlight = inFlight
+
+	return nil
+}
+
+func (mq *Mq) Purge(ctx context.Context, req *pb.PurgeRequest, rsp *pb.PurgeResponse) error {
+	if len(req.Queue) == 0 {
+		return errors.BadRequest("mq.purge", "queue is blank")
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	purged, err := mq.queue(id, req.Queue).purge()
+	if err != nil {
+		return errors.InternalServerError("mq.purge", "failed to purge queue")
+	}
+	rsp.Purged = purged
+
+	log.Infof("Tenant %v purged %d messages from queue %v", id, purged, req.Queue)
+
+	return nil
+}
@@ -0,0 +1,243 @@
+package handler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+	pb "github.com/micro/services/mq/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// keys queues the keys in memory
+type keys struct {
+	sync.Mutex
+	// when each item of each queue is visible from
+	queues map[string]map[string]time.Time
+}
+
+func newKeys() *keys {
+	return &keys{queues: map[string]map[string]time.Time{}}
+}
+
+func (k *keys) Push(ctx context.Context, queue, item string, at time.Time) error {
+	k.Lock()
+	defer k.Unlock()
+	if k.queues[queue] == nil {
+		k.queues[queue] = map[string]time.Time{}
+	}
+	if _, ok := k.queues[queue][item]; !ok {
+		k.queues[queue][item] = at
+	}
+	return nil
+}
+
+func (k *keys) Claim(ctx context.Context, queue string, lease time.Duration) (string, error) {
+	k.Lock()
+	defer k.Unlock()
+	var visible []string
+	for item, at := range k.queues[queue] {
+		if !at.After(time.Now()) {
+			visible = append(visible, item)
+		}
+	}
+	if len(visible) == 0 {
+		return "", nil
+	}
+	sort.Strings(visible)
+	k.queues[queue][visible[0]] = time.Now().Add(lease)
+	return visible[0], nil
+}
+
+func (k *keys) Release(ctx context.Context, queue, item string) error {
+	k.Lock()
+	defer k.Unlock()
+	if _, ok := k.queues[queue][item]; ok {
+		k.queues[queue][item] = time.Now()
+	}
+	return nil
+}
+
+func (k *keys) Remove(ctx context.Context, queue, item string) error {
+	k.Lock()
+	defer k.Unlock()
+	delete(k.queues[queue], item)
+	return nil
+}
+
+func (k *keys) count(queue string, claimed bool) int64 {
+	k.Lock()
+	defer k.Unlock()
+	var n int64
+	for _, at := range k.queues[queue] {
+		if at.After(time.Now()) == claimed {
+			n++
+		}
+	}
+	return n
+}
+
+func (k *keys) Len(ctx context.Context, queue string) (int64, error) {
+	return k.count(queue, false), nil
+}
+
+func (k *keys) Claimed(ctx context.Context, queue string) (int64, error) {
+	return k.count(queue, true), nil
+}
+
+func (k *keys) Delete(ctx context.Context, queue string) error {
+	k.Lock()
+	defer k.Unlock()
+	delete(k.queues, queue)
+	return nil
+}
+
+// expire ends the leases of the claimed items
+func (k *keys) expire() {
+	k.Lock()
+	defer k.Unlock()
+	for _, items := range k.queues {
+		for item := range items {
+			items[item] = time.Now()
+		}
+	}
+}
+
+// queueStream passes the messages sent on to a channel until it's closed
+type queueStream struct {
+	pb.Mq_SubscribeStream
+	ctx  context.Context
+	msgs chan *pb.SubscribeResponse
+}
+
+func (s *queueStream) Send(rsp *pb.SubscribeResponse) error {
+	select {
+	case s.msgs <- rsp:
+		return nil
+	case <-s.ctx.Done():
+		return s.ctx.Err()
+	}
+}
+
+// receive subscribes to the queue until n messages are sent, then goes away
+func receive(t *testing.T, mq *Mq, req *pb.SubscribeRequest, n int) []*pb.SubscribeResponse {
+	ctx, cancel := context.WithCancel(context.Background())
+	sub := &queueStream{ctx: ctx, msgs: make(chan *pb.SubscribeResponse)}
+	done := make(chan error)
+	go func() {
+		done <- mq.subscribeQueue(ctx, "default", req, sub)
+	}()
+
+	var ret []*pb.SubscribeResponse
+	for len(ret) < n {
+		select {
+		case msg := <-sub.msgs:
+			ret = append(ret, msg)
+		case <-time.After(time.Second):
+			t.Fatalf("received %d messages, want %d", len(ret), n)
+		}
+	}
+	cancel()
+	// a message being sent as the subscriber goes is put back
+	if err := <-done; err != nil && err != context.Canceled {
+		t.Fatal(err)
+	}
+	return ret
+}
+
+func depth(t *testing.T, mq *Mq) (int64, int64) {
+	rsp := new(pb.DepthResponse)
+	if err := mq.Depth(context.Background(), &pb.DepthRequest{Queue: "jobs"}, rsp); err != nil {
+		t.Fatal(err)
+	}
+	return rsp.Depth, rsp.InFlight
+}
+
+func TestQueueAck(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+	mq := newTestMq()
+	mq.keys = newKeys()
+	ctx := context.Background()
+
+	for _, n := range []float64{1, 2, 3} {
+		msg, _ := structpb.NewStruct(map[string]interface{}{"n": n})
+		if err := mq.Publish(ctx, &pb.PublishRequest{Queue: "jobs", Message: msg}, &pb.PublishResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a queueStream which goes away without acking doesn't lose the messages
+	manual := &pb.SubscribeRequest{Queue: "jobs", ManualAck: true}
+	msgs := receive(t, mq, manual, 2)
+	if d, f := depth(t, mq); d != 3 || f != 2 {
+		t.Fatalf("depth %d with %d in flight, want 3 with 2", d, f)
+	}
+
+	tcs := []struct {
+		name     string
+		req      *pb.AckRequest
+		code     int32
+		depth    int64
+		inFlight int64
+	}{
+		{"ack", &pb.AckRequest{Queue: "jobs", Id: msgs[0].Id}, 0, 2, 1},
+		{"ack again", &pb.AckRequest{Queue: "jobs", Id: msgs[0].Id}, 404, 2, 1},
+		{"nack", &pb.AckRequest{Queue: "jobs", Id: msgs[1].Id, Nack: true}, 0, 2, 0},
+		{"other queue", &pb.AckRequest{Queue: "other", Id: msgs[1].Id}, 404, 2, 0},
+		{"no id", &pb.AckRequest{Queue: "jobs"}, 400, 2, 0},
+		{"no queue", &pb.AckRequest{Id: msgs[1].Id}, 400, 2, 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := mq.Ack(ctx, tc.req, &pb.AckResponse{})
+			if merr, ok := err.(*errors.Error); tc.code == 0 && err != nil || tc.code > 0 && (!ok || merr.Code != tc.code) {
+				t.Fatalf("err = %v, want code %d", err, tc.code)
+			}
+			if d, f := depth(t, mq); d != tc.depth || f != tc.inFlight {
+				t.Errorf("depth %d with %d in flight, want %d with %d", d, f, tc.depth, tc.inFlight)
+			}
+		})
+	}
+
+	// the nacked message is delivered again
+	msgs = receive(t, mq, manual, 1)
+	if n := msgs[0].Message.AsMap()["n"]; n != float64(2) {
+		t.Fatalf("received %v, want the nacked message", n)
+	}
+
+	// and again once its lease runs out
+	mq.keys.(*keys).expire()
+	again := receive(t, mq, manual, 1)
+	if again[0].Id != msgs[0].Id {
+		t.Fatalf("received %v, want the unacked message %v", again[0].Id, msgs[0].Id)
+	}
+
+	// without manual ack messages are removed once sent
+	mq.keys.(*keys).expire()
+	receive(t, mq, &pb.SubscribeRequest{Queue: "jobs"}, 2)
+	if d, f := depth(t, mq); d != 0 || f != 0 {
+		t.Fatalf("depth %d with %d in flight, want an empty queue", d, f)
+	}
+}
+
+func TestSubscribeVisibility(t *testing.T) {
+	mq := newTestMq()
+	mq.keys = newKeys()
+
+	for _, timeout := range []int32{-1, maxVisibilityTimeout + 1} {
+		err := mq.subscribeQueue(context.Background(), "default", &pb.SubscribeRequest{Queue: "jobs", ManualAck: true, VisibilityTimeout: timeout}, &queueStream{})
+		if merr, ok := err.(*errors.Error); !ok || merr.Code != 400 {
+			t.Errorf("visibility timeout %d: err = %v, want a bad request", timeout, err)
+		}
+	}
+
+	err := mq.Subscribe(context.Background(), &pb.SubscribeRequest{Topic: "orders", ManualAck: true}, &queueStream{})
+	if merr, ok := err.(*errors.Error); !ok || merr.Code != 400 {
+		t.Errorf("manual ack on a topic: err = %v, want a bad request", err)
+	}
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"encoding/json"
+	"path"
+	"sync"
+
+	"github.com/asim/mq/broker"
+	log "github.com/micro/micro/v3/service/logger"
+)
+
+// message is published on a concrete topic
+type message struct {
+	topic   string
+	payload []byte
+}
+
+// envelope carries a message on the tenant's feed
+type envelope struct {
+	Topic   string `json:"topic"`
+	Payload []byte `json:"payload"`
+}
+
+// subscriber receives the messages of every tenant topic matching the filter
+type subscriber struct {
+	tenant string
+	filter string
+	ch     chan *message
+	// the trie the filter is matched with
+	trie *trie
+	// subscribers which can't lose messages are closed when they fall behind
+	lossless bool
+	overflow chan struct{}
+	once     sync.Once
+}
+
+// feed is the broker subscription of a tenant's messages shared by the
+// subscribers on this replica
+type feed struct {
+	subs int
+	ch   <-chan []byte
+	exit chan struct{}
+}
+
+const subscriberBuffer = 256
+
+// newPatterns returns the trie of subscribe patterns e.g orders.* or orders.>
+func newPatterns() *trie {
+	return newTrie(".", "*", ">", false)
+}
+
+// newFilters returns the trie of MQTT topic filters e.g sensors/+/temp or sensors/#
+func newFilters() *trie {
+	return newTrie("/", "+", "#", true)
+}
+
+// feedTopic is the broker topic every message of the tenant is published on
+// so subscribers on any replica can match them against their filters
+func feedTopic(tnt string) string {
+	return path.Join("feed", tnt)
+}
+
+func (mq *Mq) subscribe(t *trie, tnt, filter string, lossless bool) *subscriber {
+	s := &subscriber{
+		tenant:   tnt,
+		filter:   filter,
+		ch:       make(chan *message, subscriberBuffer),
+		trie:     t,
+		lossless: lossless,
+		overflow: make(chan struct{}),
+	}
+	t.add(s)
+	mq.follow(tnt)
+
+	return s
+}
+
+func (mq *Mq) unsubscribe(s *subscriber) {
+	s.trie.remove(s)
+	mq.unfollow(s.tenant)
+}
+
+// follow subscribes to the tenant's feed unless already subscribed
+func (mq *Mq) follow(tnt string) {
+	mq.Lock()
+	defer mq.Unlock()
+
+	if f, ok := mq.feeds[tnt]; ok {
+		f.subs++
+		return
+	}
+
+	ch, err := broker.Subscribe(feedTopic(tnt))
+	if err != nil {
+		log.Errorf("Error subscribing to the feed of %v: %v", tnt, err)
+		return
+	}
+
+	f := &feed{subs: 1, ch: ch, exit: make(chan struct{})}
+	mq.feeds[tnt] = f
+
+	go func() {
+		for {
+			var b []byte
+			var ok bool
+			select {
+			case <-f.exit:
+				return
+			case b, ok = <-ch:
+				if !ok {
+					return
+				}
+			}
+
+			env := new(envelope)
+			if err := json.Unmarshal(b, env); err != nil {
+				log.Errorf("Error decoding message on the feed of %v: %v", tnt, err)
+				continue
+			}
+			subs := append(mq.patterns.match(tnt, env.Topic), mq.filters.match(tnt, env.Topic)...)
+			mq.dispatch(subs, &message{topic: env.Topic, payload: env.Payload})
+		}
+	}()
+}
+
+// unfollow unsubscribes from the tenant's feed once nothing on this replica needs it
+func (mq *Mq) unfollow(tnt string) {
+	mq.Lock()
+	defer mq.Unlock()
+
+	f, ok := mq.feeds[tnt]
+	if !ok {
+		return
+	}
+
+	f.subs--
+	if f.subs > 0 {
+		return
+	}
+
+	delete(mq.feeds, tnt)
+	broker.Unsubscribe(feedTopic(tnt), f.ch)
+	close(f.exit)
+}
+
+// publish sends the message to the broker topic and the tenant's feed
+func (mq *Mq) publish(tnt, topic string, b []byte) error {
+	if err := broker.Publish(path.Join("event", tnt, topic), b); err != nil {
+		return err
+	}
+
+	env, err := json.Marshal(&envelope{Topic: topic, Payload: b})
+	if err != nil {
+		return err
+	}
+	return broker.Publish(feedTopic(tnt), env)
+}
+
+// dispatch hands the message to the subscribers without waiting on them.
+// Subscribers which fall behind miss it, unless they can't lose messages in
+// which case they're closed for their client to reconnect.
+func (mq *Mq) dispatch(subs []*subscriber, msg *message) {
+	for _, s := range subs {
+		select {
+		case s.ch <- msg:
+		default:
+			if s.lossless {
+				log.Errorf("Closing slow subscriber %v on %v", s.filter, msg.topic)
+				s.once.Do(func() { close(s.overflow) })
+				continue
+			}
+			log.Errorf("Dropped message on %v for slow subscriber %v", msg.topic, s.filter)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package handler
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestMq() *Mq {
+	return &Mq{
+		queues:   map[string]*queue{},
+		patterns: newPatterns(),
+		filters:  newFilters(),
+		feeds:    map[string]*feed{},
+	}
+}
+
+func TestFeed(t *testing.T) {
+	mq := newTestMq()
+
+	sub := mq.subscribe(mq.filters, "micro/1", "sensors/+/temp", false)
+	pattern := mq.subscribe(mq.patterns, "micro/1", "orders.*", false)
+	other := mq.subscribe(mq.filters, "micro/2", "sensors/#", false)
+
+	// the message comes back through the broker as it would from another replica
+	if err := mq.publish("micro/1", "sensors/kitchen/temp", []byte(`{"c":20}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg := <-sub.ch:
+		if msg.topic != "sensors/kitchen/temp" || string(msg.payload) != `{"c":20}` {
+			t.Fatalf("Unexpected message %v %s", msg.topic, msg.payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the message from the feed")
+	}
+
+	if err := mq.publish("micro/1", "orders.created", []byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case msg := <-pattern.ch:
+		if msg.topic != "orders.created" {
+			t.Fatalf("Unexpected topic %v", msg.topic)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected the pattern subscriber to get the message from the feed")
+	}
+
+	select {
+	case msg := <-other.ch:
+		t.Fatalf("Another tenant got %v", msg.topic)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	mq.unsubscribe(sub)
+	if len(mq.feeds) != 2 {
+		t.Fatalf("Expected the feed to stay open for the pattern, got %d", len(mq.feeds))
+	}
+	mq.unsubscribe(pattern)
+	mq.unsubscribe(other)
+	if len(mq.feeds) != 0 {
+		t.Fatalf("Expected the feeds to be closed, got %d", len(mq.feeds))
+	}
+}
+
+func TestDispatchOverflow(t *testing.T) {
+	tcs := []struct {
+		name     string
+		lossless bool
+		closed   bool
+	}{
+		{name: "at most once", lossless: false, closed: false},
+		{name: "at least once", lossless: true, closed: true},
+	}
+
+	for _, tc := range tcs {
+		mq := newTestMq()
+		s := mq.subscribe(mq.patterns, "micro/1", "orders.*", tc.lossless)
+
+		for i := 0; i <= subscriberBuffer; i++ {
+			mq.dispatch([]*subscriber{s}, &message{topic: "orders.created"})
+		}
+
+		select {
+		case <-s.overflow:
+			if !tc.closed {
+				t.Fatalf("%s: expected the subscriber to stay open", tc.name)
+			}
+		default:
+			if tc.closed {
+				t.Fatalf("%s: expected the subscriber to be closed", tc.name)
+			}
+		}
+		if len(s.ch) != subscriberBuffer {
+			t.Fatalf("%s: expected a full buffer, got %d", tc.name, len(s.ch))
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package handler
+
+import (
+	"strings"
+	"sync"
+)
+
+// trie matches published topics against subscriber filters level by level
+// so a publish only visits the nodes along its own topic.
+type trie struct {
+	sync.RWMutex
+
+	// separator of the topic levels
+	sep string
+	// wildcard matching a single level
+	one string
+	// wildcard matching the remaining levels, must be last
+	all string
+	// whether the all wildcard also matches the parent level
+	parent bool
+
+	// subscribers by tenant
+	root map[string]*node
+}
+
+type node struct {
+	children map[string]*node
+	subs     map[*subscriber]bool
+}
+
+func newTrie(sep, one, all string, parent bool) *trie {
+	return &trie{
+		sep:    sep,
+		one:    one,
+		all:    all,
+		parent: parent,
+		root:   map[string]*node{},
+	}
+}
+
+func newNode() *node {
+	return &node{
+		children: map[string]*node{},
+		subs:     map[*subscriber]bool{},
+	}
+}
+
+// wildcard returns whether the filter uses wildcards
+func (t *trie) wildcard(filter string) bool {
+	for _, level := range strings.Split(filter, t.sep) {
+		if level == t.one || level == t.all {
+			return true
+		}
+	}
+	return false
+}
+
+// valid returns whether the wildcards of the filter fill their level
+// and the all wildcard is last
+func (t *trie) valid(filter string) bool {
+	if len(filter) == 0 {
+		return false
+	}
+	levels := strings.Split(filter, t.sep)
+	for i, level := range levels {
+		if level == t.all && i != len(levels)-1 {
+			return false
+		}
+		if level != t.one && level != t.all && (strings.Contains(level, t.one) || strings.Contains(level, t.all)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (t *trie) add(s *subscriber) {
+	t.Lock()
+	defer t.Unlock()
+
+	n, ok := t.root[s.tenant]
+	if !ok {
+		n = newNode()
+		t.root[s.tenant] = n
+	}
+
+	for _, level := range strings.Split(s.filter, t.sep) {
+		child, ok := n.children[level]
+		if !ok {
+			child = newNode()
+			n.children[level] = child
+		}
+		n = child
+	}
+
+	n.subs[s] = true
+}
+
+func (t *trie) remove(s *subscriber) {
+	t.Lock()
+	defer t.Unlock()
+
+	root, ok := t.root[s.tenant]
+	if !ok {
+		return
+	}
+
+	levels := strings.Split(s.filter, t.sep)
+	path := []*node{root}
+
+	n := root
+	for _, level := range levels {
+		if n, ok = n.children[level]; !ok {
+			return
+		}
+		path = append(path, n)
+	}
+
+	delete(n.subs, s)
+
+	// prune the nodes left empty
+	for i := len(levels) - 1; i >= 0; i-- {
+		n := path[i+1]
+		if len(n.subs) > 0 || len(n.children) > 0 {
+			return
+		}
+		delete(path[i].children, levels[i])
+	}
+	if len(root.children) == 0 {
+		delete(t.root, s.tenant)
+	}
+}
+
+// match returns the subscribers of the tenant with a filter matching the topic
+func (t *trie) match(tnt, topic string) []*subscriber {
+	t.RLock()
+	defer t.RUnlock()
+
+	root, ok := t.root[tnt]
+	if !ok {
+		return nil
+	}
+
+	var subs []*subscriber
+	t.walk(root, strings.Split(topic, t.sep), 0, &subs)
+	return subs
+}
+
+func (t *trie) walk(n *node, levels []string, i int, subs *[]*subscriber) {
+	if i == len(levels) {
+		for s := range n.subs {
+			*subs = append(*subs, s)
+		}
+		// e.g sensors/# matches sensors
+		if c, ok := n.children[t.all]; ok && t.parent {
+			for s := range c.subs {
+				*subs = append(*subs, s)
+			}
+		}
+		return
+	}
+
+	// wildcards don't match topics starting with $
+	wild := i > 0 || !strings.HasPrefix(levels[0], "$")
+
+	if c, ok := n.children[levels[i]]; ok {
+		t.walk(c, levels, i+1, subs)
+	}
+	if !wild {
+		return
+	}
+	if c, ok := n.children[t.one]; ok && levels[i] != t.one {
+		t.walk(c, levels, i+1, subs)
+	}
+	if c, ok := n.children[t.all]; ok && levels[i] != t.all {
+		for s := range c.subs {
+			*subs = append(*subs, s)
+		}
+	}
+}
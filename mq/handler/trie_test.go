@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestTrie(t *testing.T) {
+	tr := newPatterns()
+
+	subs := map[string]*subscriber{}
+	for _, filter := range []string{"orders.created", "orders.*", "orders.>", "*.created", ">", "users.*"} {
+		s := &subscriber{tenant: "micro/1", filter: filter, trie: tr}
+		tr.add(s)
+		subs[filter] = s
+	}
+
+	// another tenant's subscribers never match
+	tr.add(&subscriber{tenant: "micro/2", filter: ">", trie: tr})
+
+	match := func(topic string) []string {
+		var filters []string
+		for _, s := range tr.match("micro/1", topic) {
+			filters = append(filters, s.filter)
+		}
+		sort.Strings(filters)
+		return filters
+	}
+
+	tcs := map[string][]string{
+		"orders.created":    {"*.created", ">", "orders.*", "orders.>", "orders.created"},
+		"orders.eu.created": {">", "orders.>"},
+		"orders":            {">"},
+		"users.deleted":     {">", "users.*"},
+	}
+
+	for topic, want := range tcs {
+		got := match(topic)
+		if len(got) != len(want) {
+			t.Fatalf("%v matched %v, want %v", topic, got, want)
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Fatalf("%v matched %v, want %v", topic, got, want)
+			}
+		}
+	}
+
+	for _, s := range subs {
+		tr.remove(s)
+	}
+	if got := match("orders.created"); len(got) > 0 {
+		t.Fatalf("Expected no matches after removing, got %v", got)
+	}
+	if _, ok := tr.root["micro/1"]; ok {
+		t.Fatal("Expected empty nodes to be pruned")
+	}
+}
+
+func TestTrieMQTT(t *testing.T) {
+	tr := newFilters()
+	for _, filter := range []string{"sensors/#", "sensors/+/temp", "#"} {
+		tr.add(&subscriber{tenant: "micro/1", filter: filter, trie: tr})
+	}
+
+	for topic, n := range map[string]int{
+		"sensors":        2,
+		"sensors/1/temp": 3,
+		"sensors/1":      2,
+		"$SYS/uptime":    0,
+	} {
+		if got := len(tr.match("micro/1", topic)); got != n {
+			t.Errorf("%v matched %d filters, want %d", topic, got, n)
+		}
+	}
+}
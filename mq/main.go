@@ -1,7 +1,10 @@
 package main
 
 import (
+	"net"
+
 	"github.com/micro/micro/v3/service"
+	"github.com/micro/micro/v3/service/config"
 	"github.com/micro/micro/v3/service/logger"
 	"github.com/micro/services/mq/handler"
 	pb "github.com/micro/services/mq/proto"
@@ -14,8 +17,27 @@ func main() {
 		service.Version("latest"),
 	)
 
+	h := handler.NewMq()
+
 	// Register handler
-	pb.RegisterMqHandler(srv.Server(), new(handler.Mq))
+	pb.RegisterMqHandler(srv.Server(), h)
+
+	// Serve MQTT clients
+	address := ":1883"
+	if v, err := config.Get("mq.mqtt_address"); err == nil {
+		address = v.String(address)
+	}
+
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	go func() {
+		if err := h.ServeMQTT(l); err != nil {
+			logger.Errorf("MQTT listener stopped: %v", err)
+		}
+	}()
 
 	// Run service
 	if err := srv.Run(); err != nil {
@@ -0,0 +1,113 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tcs := []struct {
+		filter string
+		topic  string
+		match  bool
+	}{
+		{"sensors/1/temp", "sensors/1/temp", true},
+		{"sensors/1/temp", "sensors/2/temp", false},
+		{"sensors/+/temp", "sensors/2/temp", true},
+		{"sensors/+/temp", "sensors/2/humidity", false},
+		{"sensors/+", "sensors/2/temp", false},
+		{"sensors/#", "sensors/2/temp", true},
+		{"sensors/#", "sensors", true},
+		{"#", "sensors/2/temp", true},
+		{"+/+", "/finance", true},
+		{"#", "$SYS/uptime", false},
+		{"$SYS/#", "$SYS/uptime", true},
+	}
+
+	for _, tc := range tcs {
+		if got := Match(tc.filter, tc.topic); got != tc.match {
+			t.Errorf("Match(%q, %q) = %v, want %v", tc.filter, tc.topic, got, tc.match)
+		}
+	}
+}
+
+func TestValidFilter(t *testing.T) {
+	for filter, valid := range map[string]bool{
+		"sensors/+/temp": true,
+		"sensors/#":      true,
+		"#":              true,
+		"":               false,
+		"sensors/#/temp": false,
+		"sensors+":       false,
+		"sensors/te#":    false,
+	} {
+		if got := ValidFilter(filter); got != valid {
+			t.Errorf("ValidFilter(%q) = %v, want %v", filter, got, valid)
+		}
+	}
+}
+
+func TestPublish(t *testing.T) {
+	pub := &Publish{
+		Topic:    "sensors/1/temp",
+		Payload:  bytes.Repeat([]byte("x"), 300),
+		QoS:      1,
+		Retain:   true,
+		PacketID: 7,
+	}
+
+	var buf bytes.Buffer
+	flags, body := pub.Encode()
+	if err := WritePacket(&buf, PUBLISH, flags, body); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ReadPacket(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != PUBLISH {
+		t.Fatalf("Expected PUBLISH got %d", p.Type)
+	}
+
+	got, err := ParsePublish(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Topic != pub.Topic || got.QoS != 1 || !got.Retain || got.PacketID != 7 || !bytes.Equal(got.Payload, pub.Payload) {
+		t.Fatalf("Unexpected publish %+v", got)
+	}
+}
+
+func TestConnect(t *testing.T) {
+	c := &Connect{
+		CleanSession: true,
+		KeepAlive:    60,
+		ClientID:     "device-1",
+		Password:     "api-key",
+		Will:         &Publish{Topic: "devices/1/status", Payload: []byte("offline"), QoS: 1, Retain: true},
+	}
+
+	var buf bytes.Buffer
+	flags, body := c.Encode()
+	if err := WritePacket(&buf, CONNECT, flags, body); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ReadPacket(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := ParseConnect(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.Supported() || got.ClientID != "device-1" || got.Password != "api-key" || got.KeepAlive != 60 {
+		t.Fatalf("Unexpected connect %+v", got)
+	}
+	if got.Will == nil || got.Will.Topic != "devices/1/status" || string(got.Will.Payload) != "offline" || !got.Will.Retain {
+		t.Fatalf("Unexpected will %+v", got.Will)
+	}
+}
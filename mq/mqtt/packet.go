@@ -0,0 +1,396 @@
+// Package mqtt encodes and decodes MQTT 3.1.1 control packets
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// Control packet types
+const (
+	CONNECT     byte = 1
+	CONNACK     byte = 2
+	PUBLISH     byte = 3
+	PUBACK      byte = 4
+	PUBREC      byte = 5
+	PUBREL      byte = 6
+	PUBCOMP     byte = 7
+	SUBSCRIBE   byte = 8
+	SUBACK      byte = 9
+	UNSUBSCRIBE byte = 10
+	UNSUBACK    byte = 11
+	PINGREQ     byte = 12
+	PINGRESP    byte = 13
+	DISCONNECT  byte = 14
+)
+
+// CONNACK return codes
+const (
+	Accepted              byte = 0
+	UnacceptableProtocol  byte = 1
+	IdentifierRejected    byte = 2
+	BadUsernameOrPassword byte = 4
+	NotAuthorized         byte = 5
+)
+
+// SubscribeFailure is the SUBACK return code of a rejected subscription
+const SubscribeFailure byte = 0x80
+
+const (
+	protocolName       = "MQTT"
+	protocolLevel byte = 4
+	// max bytes of the remaining length
+	maxLengthBytes = 4
+)
+
+// MaxPacketSize is the largest packet accepted
+var MaxPacketSize = 1024 * 1024
+
+var (
+	ErrMalformed    = errors.New("malformed packet")
+	ErrPacketTooBig = errors.New("packet too big")
+)
+
+// Packet is a control packet before its body is decoded
+type Packet struct {
+	Type  byte
+	Flags byte
+	Body  []byte
+}
+
+// Connect is the first packet sent by a client
+type Connect struct {
+	ProtocolName  string
+	ProtocolLevel byte
+	CleanSession  bool
+	KeepAlive     uint16
+	ClientID      string
+	Will          *Publish
+	Username      string
+	Password      string
+}
+
+// Publish carries an application message
+type Publish struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retain   bool
+	Dup      bool
+	PacketID uint16
+}
+
+// Subscription is a topic filter with the requested QoS
+type Subscription struct {
+	Filter string
+	QoS    byte
+}
+
+// Subscribe requests one or more subscriptions
+type Subscribe struct {
+	PacketID      uint16
+	Subscriptions []Subscription
+}
+
+// Unsubscribe removes one or more subscriptions
+type Unsubscribe struct {
+	PacketID uint16
+	Filters  []string
+}
+
+// ReadPacket reads the next packet from the reader
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	// remaining length is a variable length integer of up to 4 bytes
+	var length, shift int
+	for i := 0; ; i++ {
+		if i == maxLengthBytes {
+			return nil, ErrMalformed
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		length |= int(c&0x7f) << shift
+		if c&0x80 == 0 {
+			break
+		}
+		shift += 7
+	}
+
+	if length > MaxPacketSize {
+		return nil, ErrPacketTooBig
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	return &Packet{Type: b >> 4, Flags: b & 0x0f, Body: body}, nil
+}
+
+// WritePacket writes a packet with the fixed header
+func WritePacket(w io.Writer, typ, flags byte, body []byte) error {
+	buf := []byte{typ<<4 | flags&0x0f}
+
+	length := len(body)
+	for {
+		c := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			c |= 0x80
+		}
+		buf = append(buf, c)
+		if length == 0 {
+			break
+		}
+	}
+
+	_, err := w.Write(append(buf, body...))
+	return err
+}
+
+// reader decodes the fields of a packet body
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) byte() byte {
+	if r.err != nil || len(r.b) < 1 {
+		r.err = ErrMalformed
+		return 0
+	}
+	c := r.b[0]
+	r.b = r.b[1:]
+	return c
+}
+
+func (r *reader) uint16() uint16 {
+	if r.err != nil || len(r.b) < 2 {
+		r.err = ErrMalformed
+		return 0
+	}
+	v := binary.BigEndian.Uint16(r.b)
+	r.b = r.b[2:]
+	return v
+}
+
+func (r *reader) bytes() []byte {
+	n := int(r.uint16())
+	if r.err != nil || len(r.b) < n {
+		r.err = ErrMalformed
+		return nil
+	}
+	v := r.b[:n]
+	r.b = r.b[n:]
+	return v
+}
+
+func (r *reader) string() string {
+	return string(r.bytes())
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendString(b []byte, s string) []byte {
+	b = appendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// ParseConnect decodes a CONNECT packet
+func ParseConnect(p *Packet) (*Connect, error) {
+	r := &reader{b: p.Body}
+
+	c := &Connect{
+		ProtocolName:  r.string(),
+		ProtocolLevel: r.byte(),
+	}
+	flags := r.byte()
+	c.KeepAlive = r.uint16()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// the reserved flag must be zero
+	if flags&0x01 != 0 {
+		return nil, ErrMalformed
+	}
+
+	c.CleanSession = flags&0x02 != 0
+	c.ClientID = r.string()
+
+	if flags&0x04 != 0 {
+		c.Will = &Publish{
+			Topic:  r.string(),
+			QoS:    flags >> 3 & 0x03,
+			Retain: flags&0x20 != 0,
+		}
+		c.Will.Payload = r.bytes()
+	}
+	if flags&0x80 != 0 {
+		c.Username = r.string()
+	}
+	if flags&0x40 != 0 {
+		c.Password = r.string()
+	}
+
+	return c, r.err
+}
+
+// Supported returns whether the protocol is MQTT 3.1.1
+func (c *Connect) Supported() bool {
+	return c.ProtocolName == protocolName && c.ProtocolLevel == protocolLevel
+}
+
+// Encode returns the fixed header flags and body of a CONNECT packet
+func (c *Connect) Encode() (byte, []byte) {
+	var flags byte
+	if c.CleanSession {
+		flags |= 0x02
+	}
+	if c.Will != nil {
+		flags |= 0x04 | c.Will.QoS<<3
+		if c.Will.Retain {
+			flags |= 0x20
+		}
+	}
+	if len(c.Username) > 0 {
+		flags |= 0x80
+	}
+	if len(c.Password) > 0 {
+		flags |= 0x40
+	}
+
+	b := appendString(nil, protocolName)
+	b = append(b, protocolLevel, flags)
+	b = appendUint16(b, c.KeepAlive)
+	b = appendString(b, c.ClientID)
+	if c.Will != nil {
+		b = appendString(b, c.Will.Topic)
+		b = appendString(b, string(c.Will.Payload))
+	}
+	if len(c.Username) > 0 {
+		b = appendString(b, c.Username)
+	}
+	if len(c.Password) > 0 {
+		b = appendString(b, c.Password)
+	}
+
+	return 0, b
+}
+
+// ParsePublish decodes a PUBLISH packet
+func ParsePublish(p *Packet) (*Publish, error) {
+	r := &reader{b: p.Body}
+
+	pub := &Publish{
+		Dup:    p.Flags&0x08 != 0,
+		QoS:    p.Flags >> 1 & 0x03,
+		Retain: p.Flags&0x01 != 0,
+		Topic:  r.string(),
+	}
+	if pub.QoS > 0 {
+		pub.PacketID = r.uint16()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if pub.QoS > 2 {
+		return nil, ErrMalformed
+	}
+
+	pub.Payload = r.b
+
+	return pub, nil
+}
+
+// Encode returns the fixed header flags and body of a PUBLISH packet
+func (p *Publish) Encode() (byte, []byte) {
+	flags := p.QoS << 1
+	if p.Dup {
+		flags |= 0x08
+	}
+	if p.Retain {
+		flags |= 0x01
+	}
+
+	b := appendString(nil, p.Topic)
+	if p.QoS > 0 {
+		b = appendUint16(b, p.PacketID)
+	}
+
+	return flags, append(b, p.Payload...)
+}
+
+// ParseSubscribe decodes a SUBSCRIBE packet
+func ParseSubscribe(p *Packet) (*Subscribe, error) {
+	r := &reader{b: p.Body}
+
+	s := &Subscribe{PacketID: r.uint16()}
+	for r.err == nil && len(r.b) > 0 {
+		s.Subscriptions = append(s.Subscriptions, Subscription{
+			Filter: r.string(),
+			QoS:    r.byte(),
+		})
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	// a subscribe must have at least one filter
+	if len(s.Subscriptions) == 0 {
+		return nil, ErrMalformed
+	}
+
+	return s, nil
+}
+
+// ParseUnsubscribe decodes an UNSUBSCRIBE packet
+func ParseUnsubscribe(p *Packet) (*Unsubscribe, error) {
+	r := &reader{b: p.Body}
+
+	u := &Unsubscribe{PacketID: r.uint16()}
+	for r.err == nil && len(r.b) > 0 {
+		u.Filters = append(u.Filters, r.string())
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if len(u.Filters) == 0 {
+		return nil, ErrMalformed
+	}
+
+	return u, nil
+}
+
+// ParsePacketID decodes packets which only carry a packet id e.g PUBACK
+func ParsePacketID(p *Packet) (uint16, error) {
+	r := &reader{b: p.Body}
+	id := r.uint16()
+	return id, r.err
+}
+
+// ConnAck returns the body of a CONNACK packet
+func ConnAck(code byte) []byte {
+	return []byte{0, code}
+}
+
+// PacketID returns the body of packets which only carry a packet id
+func PacketID(id uint16) []byte {
+	return appendUint16(nil, id)
+}
+
+// SubAck returns the body of a SUBACK packet
+func SubAck(id uint16, codes []byte) []byte {
+	return append(PacketID(id), codes...)
+}
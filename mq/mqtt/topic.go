@@ -0,0 +1,55 @@
+package mqtt
+
+import "strings"
+
+// ValidTopic returns whether the topic can be published to
+func ValidTopic(topic string) bool {
+	return len(topic) > 0 && !strings.ContainsAny(topic, "+#\x00")
+}
+
+// ValidFilter returns whether the topic filter can be subscribed to.
+// A + matches a single level and must fill it, a # matches any number
+// of levels and must be the last level.
+func ValidFilter(filter string) bool {
+	if len(filter) == 0 || strings.Contains(filter, "\x00") {
+		return false
+	}
+
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i != len(levels)-1:
+			return false
+		case level != "+" && level != "#" && strings.ContainsAny(level, "+#"):
+			return false
+		}
+	}
+
+	return true
+}
+
+// Match returns whether the topic matches the filter
+func Match(filter, topic string) bool {
+	// wildcards don't match topics starting with $
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+
+	fl := strings.Split(filter, "/")
+	tl := strings.Split(topic, "/")
+
+	for i, level := range fl {
+		if level == "#" {
+			// also matches the parent level
+			return true
+		}
+		if i == len(tl) {
+			return false
+		}
+		if level != "+" && level != tl[i] {
+			return false
+		}
+	}
+
+	return len(fl) == len(tl)
+}
@@ -45,6 +45,9 @@ func NewMqEndpoints() []*api.Endpoint {
 type MqService interface {
 	Publish(ctx context.Context, in *PublishRequest, opts ...client.CallOption) (*PublishResponse, error)
 	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...client.CallOption) (Mq_SubscribeService, error)
+	Ack(ctx context.Context, in *AckRequest, opts ...client.CallOption) (*AckResponse, error)
+	Depth(ctx context.Context, in *DepthRequest, opts ...client.CallOption) (*DepthResponse, error)
+	Purge(ctx context.Context, in *PurgeRequest, opts ...client.CallOption) (*PurgeResponse, error)
 }
 
 type mqService struct {
@@ -118,17 +121,53 @@ func (x *mqServiceSubscribe) Recv() (*SubscribeResponse, error) {
 	return m, nil
 }
 
+func (c *mqService) Ack(ctx context.Context, in *AckRequest, opts ...client.CallOption) (*AckResponse, error) {
+	req := c.c.NewRequest(c.name, "Mq.Ack", in)
+	out := new(AckResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mqService) Depth(ctx context.Context, in *DepthRequest, opts ...client.CallOption) (*DepthResponse, error) {
+	req := c.c.NewRequest(c.name, "Mq.Depth", in)
+	out := new(DepthResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *mqService) Purge(ctx context.Context, in *PurgeRequest, opts ...client.CallOption) (*PurgeResponse, error) {
+	req := c.c.NewRequest(c.name, "Mq.Purge", in)
+	out := new(PurgeResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Mq service
 
 type MqHandler interface {
 	Publish(context.Context, *PublishRequest, *PublishResponse) error
 	Subscribe(context.Context, *SubscribeRequest, Mq_SubscribeStream) error
+	Ack(context.Context, *AckRequest, *AckResponse) error
+	Depth(context.Context, *DepthRequest, *DepthResponse) error
+	Purge(context.Context, *PurgeRequest, *PurgeResponse) error
 }
 
 func RegisterMqHandler(s server.Server, hdlr MqHandler, opts ...server.HandlerOption) error {
 	type mq interface {
 		Publish(ctx context.Context, in *PublishRequest, out *PublishResponse) error
 		Subscribe(ctx context.Context, stream server.Stream) error
+		Ack(ctx context.Context, in *AckRequest, out *AckResponse) error
+		Depth(ctx context.Context, in *DepthRequest, out *DepthResponse) error
+		Purge(ctx context.Context, in *PurgeRequest, out *PurgeResponse) error
 	}
 	type Mq struct {
 		mq
@@ -184,3 +223,15 @@ func (x *mqSubscribeStream) RecvMsg(m interface{}) error {
 func (x *mqSubscribeStream) Send(m *SubscribeResponse) error {
 	return x.stream.Send(m)
 }
+
+func (h *mqHandler) Ack(ctx context.Context, in *AckRequest, out *AckResponse) error {
+	return h.MqHandler.Ack(ctx, in, out)
+}
+
+func (h *mqHandler) Depth(ctx context.Context, in *DepthRequest, out *DepthResponse) error {
+	return h.MqHandler.Depth(ctx, in, out)
+}
+
+func (h *mqHandler) Purge(ctx context.Context, in *PurgeRequest, out *PurgeResponse) error {
+	return h.MqHandler.Purge(ctx, in, out)
+}
@@ -2,7 +2,6 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"time"
 
@@ -10,32 +9,39 @@ import (
 	"github.com/micro/micro/v3/service/client"
 	"github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/logger"
-	"github.com/micro/micro/v3/service/store"
 	streamPb "github.com/micro/services/mq/proto"
 	pb "github.com/micro/services/notes/proto"
 	pauth "github.com/micro/services/pkg/auth"
+	"github.com/micro/services/pkg/document"
 	adminpb "github.com/micro/services/pkg/service/proto"
-	"github.com/micro/services/pkg/tenant"
-	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // New returns an initialized Notes
 func New(c client.Client) *Notes {
 	return &Notes{
-		Stream: streamPb.NewMqService("mq", c),
+		docs: &document.Collection{
+			Service: "notes",
+			Type:    "note",
+			Key: func(tnt, id string) string {
+				return fmt.Sprintf("%s:%s", tnt, id)
+			},
+			New: func() document.Doc {
+				return new(pb.Note)
+			},
+			Title: func(d document.Doc) string {
+				return d.(*pb.Note).Title
+			},
+			Text: func(d document.Doc) string {
+				return d.(*pb.Note).Text
+			},
+			Stream: streamPb.NewMqService("mq", c),
+		},
 	}
 }
 
 // Notes implements the notes proto definition
 type Notes struct {
-	Stream streamPb.MqService
-}
-
-func newMessage(ev map[string]interface{}) *structpb.Struct {
-	st := new(structpb.Struct)
-	b, _ := json.Marshal(ev)
-	json.Unmarshal(b, st)
-	return st
+	docs *document.Collection
 }
 
 // Create inserts a new note in the store
@@ -44,11 +50,6 @@ func (h *Notes) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Creat
 		return errors.BadRequest("notes.create", "missing title and text")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
 	// generate a key (uuid v4)
 	id, err := uuid.NewUUID()
 	if err != nil {
@@ -63,26 +64,18 @@ func (h *Notes) Create(ctx context.Context, req *pb.CreateRequest, rsp *pb.Creat
 		Updated: t,
 		Title:   req.Title,
 		Text:    req.Text,
+		OwnerId: req.UserId,
+		Tags:    document.Tags(req.Tags),
+		Labels:  req.Labels,
 	}
 
-	key := fmt.Sprintf("%s:%s", tnt, id)
-	rec := store.NewRecord(key, note)
-
-	if err = store.Write(rec); err != nil {
-		return errors.InternalServerError("notes.created", "failed to create note")
+	if err := h.docs.Create(ctx, "notes.create", note); err != nil {
+		return err
 	}
 
 	// return the note in the response
 	rsp.Note = note
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "notes",
-		Message: newMessage(map[string]interface{}{
-			"event": "create",
-			"note":  note,
-		}),
-	})
-
 	return nil
 }
 
@@ -91,29 +84,14 @@ func (h *Notes) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadRespo
 		return errors.BadRequest("notes.read", "Missing Note ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := fmt.Sprintf("%s:%s", tnt, req.Id)
-
 	// read the specific note
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return errors.NotFound("notes.read", "Note not found")
-	} else if err != nil {
-		return errors.InternalServerError("notes.read", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the note
-	var note *pb.Note
-	if err := recs[0].Decode(&note); err != nil {
-		return errors.InternalServerError("notes.update", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Read(ctx, "notes.read", req.Id, req.UserId, document.Read)
+	if err != nil {
+		return err
 	}
 
 	// return the note
-	rsp.Note = note
+	rsp.Note = doc.(*pb.Note)
 
 	return nil
 }
@@ -128,98 +106,63 @@ func (h *Notes) Update(ctx context.Context, req *pb.UpdateRequest, rsp *pb.Updat
 		return errors.BadRequest("notes.update", "Missing Note ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := fmt.Sprintf("%s:%s", tnt, req.Note.Id)
-
 	// read the specific note
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return errors.NotFound("notes.update", "Note not found")
-	} else if err != nil {
-		return errors.InternalServerError("notes.update", "Error reading from store: %v", err.Error())
-	}
-
-	// Decode the note
-	var note *pb.Note
-	if err := recs[0].Decode(&note); err != nil {
-		return errors.InternalServerError("notes.update", "Error unmarshaling JSON: %v", err.Error())
+	doc, err := h.docs.Read(ctx, "notes.update", req.Note.Id, req.UserId, document.Write)
+	if err != nil {
+		return err
 	}
+	note := doc.(*pb.Note)
 
-	// Update the notes title and text
+	// Update the notes title, text, tags and labels
 	note.Title = req.Note.Title
 	note.Text = req.Note.Text
+	note.Tags = document.Tags(req.Note.Tags)
+	note.Labels = req.Note.Labels
 	note.Updated = time.Now().Format(time.RFC3339)
 
-	rec := store.NewRecord(key, note)
-
 	// Write the updated note to the store
-	if err = store.Write(rec); err != nil {
-		return errors.InternalServerError("notes.update", "Error writing to store: %v", err.Error())
+	if err := h.docs.Update(ctx, "notes.update", document.EventUpdate, note); err != nil {
+		return err
 	}
 
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "notes",
-		Message: newMessage(map[string]interface{}{
-			"event": "update",
-			"note":  note,
-		}),
-	})
-
 	rsp.Note = note
 
 	return nil
 }
 
-func (h *Notes) Events(ctx context.Context, req *pb.EventsRequest, stream pb.Notes_EventsStream) error {
-	backendStream, err := h.Stream.Subscribe(ctx, &streamPb.SubscribeRequest{
-		Topic: "notes",
-	})
-	if err != nil {
-		return errors.InternalServerError("notes.subscribe", "Failed to subscribe to notes")
+// Share gives another user access to the note
+func (h *Notes) Share(ctx context.Context, req *pb.ShareRequest, rsp *pb.ShareResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("notes.share", "Missing Note ID")
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-		}
-
-		// receive messages from the stream
-		msg, err := backendStream.Recv()
-		if err != nil {
-			return nil
-		}
-
-		v, err := msg.Message.MarshalJSON()
-		if err != nil {
-			continue
-		}
+	doc, err := h.docs.Read(ctx, "notes.share", req.Id, req.UserId, document.Owner)
+	if err != nil {
+		return err
+	}
+	note := doc.(*pb.Note)
 
-		rsp := new(pb.EventsResponse)
+	shares, err := document.Share("notes.share", note, req.ShareWith, req.Access)
+	if err != nil {
+		return err
+	}
+	note.Shares = shares
+	note.Updated = time.Now().Format(time.RFC3339)
 
-		if err := json.Unmarshal(v, rsp); err != nil {
-			continue
-		}
+	if err := h.docs.Update(ctx, "notes.share", document.EventUpdate, note); err != nil {
+		return err
+	}
 
-		note := rsp.Note
+	rsp.Note = note
 
-		// filter if necessary by id
-		if len(req.Id) > 0 && note.Id != req.Id {
-			continue
-		}
+	return nil
+}
 
+func (h *Notes) Events(ctx context.Context, req *pb.EventsRequest, stream pb.Notes_EventsStream) error {
+	return h.docs.Events(ctx, "notes.subscribe", req.Id, req.UserId, func(event string, doc document.Doc) error {
 		// send back the event to the client
-		if err := stream.Send(rsp); err != nil {
-			return nil
-		}
-	}
-
-	return nil
+		return stream.Send(&pb.EventsResponse{Event: event, Note: doc.(*pb.Note)})
+	})
 }
 
 // Delete removes the note from the store, looking up using ID
@@ -229,68 +172,39 @@ func (h *Notes) Delete(ctx context.Context, req *pb.DeleteRequest, rsp *pb.Delet
 		return errors.BadRequest("notes.delete", "Missing Note ID")
 	}
 
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := fmt.Sprintf("%s:%s", tnt, req.Id)
-
-	// read the specific note
-	recs, err := store.Read(key)
-	if err == store.ErrNotFound {
-		return nil
-	} else if err != nil {
-		return errors.InternalServerError("notes.delete", "Error reading from store: %v", err.Error())
+	doc, err := h.docs.Delete(ctx, "notes.delete", req.Id, req.UserId)
+	if err != nil {
+		return err
 	}
-
-	// Decode the note
-	var note *pb.Note
-	if err := recs[0].Decode(&note); err != nil {
-		return errors.InternalServerError("notes.delete", "Error unmarshaling JSON: %v", err.Error())
+	if doc != nil {
+		rsp.Note = doc.(*pb.Note)
 	}
 
-	// now delete it
-	if err := store.Delete(key); err != nil && err != store.ErrNotFound {
-		return errors.InternalServerError("notes.delete", "Failed to delete note")
-	}
-
-	h.Stream.Publish(ctx, &streamPb.PublishRequest{
-		Topic: "notes",
-		Message: newMessage(map[string]interface{}{
-			"event": "delete",
-			"note":  note,
-		}),
-	})
-
-	rsp.Note = note
-
 	return nil
 }
 
-// List returns all of the notes in the store
+// List returns the notes in the store the user can read
 func (h *Notes) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListResponse) error {
-	tnt, ok := tenant.FromContext(ctx)
-	if !ok {
-		tnt = "default"
-	}
-
-	key := fmt.Sprintf("%s:", tnt)
-
-	// Retrieve all of the records in the store
-	recs, err := store.Read(key, store.ReadPrefix())
+	docs, total, err := h.docs.List(ctx, "notes.list", &document.Query{
+		UserId:  req.UserId,
+		Tags:    req.Tags,
+		Labels:  req.Labels,
+		Search:  req.Search,
+		OrderBy: req.OrderBy,
+		Order:   req.Order,
+		Limit:   int(req.Limit),
+		Offset:  int(req.Offset),
+	})
 	if err != nil {
-		return errors.InternalServerError("notes.list", "Error reading from store: %v", err.Error())
+		return err
 	}
 
 	// Initialize the response notes slice
-	rsp.Notes = make([]*pb.Note, len(recs))
+	rsp.Notes = make([]*pb.Note, len(docs))
+	rsp.Total = int32(total)
 
-	// Unmarshal the notes into the response
-	for i, r := range recs {
-		if err := r.Decode(&rsp.Notes[i]); err != nil {
-			return errors.InternalServerError("notes.list", "Error decoding note: %v", err.Error())
-		}
+	for i, doc := range docs {
+		rsp.Notes[i] = doc.(*pb.Note)
 	}
 
 	return nil
@@ -307,18 +221,12 @@ func (h *Notes) DeleteData(ctx context.Context, request *adminpb.DeleteDataReque
 		return errors.BadRequest(method, "Missing tenant ID")
 	}
 
-	keys, err := store.List(store.ListPrefix(request.TenantId))
+	deleted, err := h.docs.DeleteTenant(request.TenantId)
 	if err != nil {
 		return err
 	}
 
-	for _, k := range keys {
-		if err := store.Delete(k); err != nil {
-			return err
-		}
-	}
-
-	logger.Infof("Deleted %d keys for %s", len(keys), request.TenantId)
+	logger.Infof("Deleted %d keys for %s", deleted, request.TenantId)
 	return nil
 }
 
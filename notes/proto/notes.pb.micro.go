@@ -48,6 +48,7 @@ type NotesService interface {
 	Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error)
 	Update(ctx context.Context, in *UpdateRequest, opts ...client.CallOption) (*UpdateResponse, error)
 	Events(ctx context.Context, in *EventsRequest, opts ...client.CallOption) (Notes_EventsService, error)
+	Share(ctx context.Context, in *ShareRequest, opts ...client.CallOption) (*ShareResponse, error)
 }
 
 type notesService struct {
@@ -161,6 +162,16 @@ func (x *notesServiceEvents) Recv() (*EventsResponse, error) {
 	return m, nil
 }
 
+func (c *notesService) Share(ctx context.Context, in *ShareRequest, opts ...client.CallOption) (*ShareResponse, error) {
+	req := c.c.NewRequest(c.name, "Notes.Share", in)
+	out := new(ShareResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Notes service
 
 type NotesHandler interface {
@@ -170,6 +181,7 @@ type NotesHandler interface {
 	Delete(context.Context, *DeleteRequest, *DeleteResponse) error
 	Update(context.Context, *UpdateRequest, *UpdateResponse) error
 	Events(context.Context, *EventsRequest, Notes_EventsStream) error
+	Share(context.Context, *ShareRequest, *ShareResponse) error
 }
 
 func RegisterNotesHandler(s server.Server, hdlr NotesHandler, opts ...server.HandlerOption) error {
@@ -180,6 +192,7 @@ func RegisterNotesHandler(s server.Server, hdlr NotesHandler, opts ...server.Han
 		Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error
 		Update(ctx context.Context, in *UpdateRequest, out *UpdateResponse) error
 		Events(ctx context.Context, stream server.Stream) error
+		Share(ctx context.Context, in *ShareRequest, out *ShareResponse) error
 	}
 	type Notes struct {
 		notes
@@ -251,3 +264,7 @@ func (x *notesEventsStream) RecvMsg(m interface{}) error {
 func (x *notesEventsStream) Send(m *EventsResponse) error {
 	return x.stream.Send(m)
 }
+
+func (h *notesHandler) Share(ctx context.Context, in *ShareRequest, out *ShareResponse) error {
+	return h.NotesHandler.Share(ctx, in, out)
+}
@@ -0,0 +1,638 @@
+// Package document is the storage shared by the notes, lists and comments services.
+// Documents have tags, labels and an owner who can share them with other users.
+package document
+
+import (
+	"context"
+	"encoding/json"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	mqpb "github.com/micro/services/mq/proto"
+	"github.com/micro/services/pkg/index"
+	"github.com/micro/services/pkg/tenant"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// access users can be given to a document
+const (
+	Read  = "read"
+	Write = "write"
+	// only the owner can delete and share a document
+	Owner = "owner"
+)
+
+// events published when documents change
+const (
+	EventCreate = "create"
+	EventUpdate = "update"
+	EventDelete = "delete"
+)
+
+const (
+	maxTags        = 20
+	maxLabels      = 20
+	maxShares      = 100
+	maxLabelLength = 64
+
+	// document ids by the words of their title and text
+	indexPrefix = "docindex/"
+)
+
+// Doc is the document type of a service, implemented by its generated proto message
+type Doc interface {
+	GetId() string
+	GetCreated() string
+	GetUpdated() string
+	GetOwnerId() string
+	GetTags() []string
+	GetLabels() map[string]string
+	GetShares() map[string]string
+}
+
+// Collection stores the documents of a service
+type Collection struct {
+	// name of the service e.g notes
+	Service string
+	// name of a document in events e.g note
+	Type string
+	// Key returns the store key of a document. A blank id returns
+	// the prefix of all the tenant's documents
+	Key func(tenant, id string) string
+	// New returns an empty document to decode into
+	New func() Doc
+	// Title returns the title documents are searched and ordered by
+	Title func(Doc) string
+	// Text returns the rest of the text documents are searched by
+	Text func(Doc) string
+	// Stream publishes the document events
+	Stream mqpb.MqService
+}
+
+// Query filters, orders and pages the documents listed
+type Query struct {
+	// only documents the user can read
+	UserId string
+	// only the documents with the ids, unless nil
+	Ids []string
+	// documents with all the tags
+	Tags []string
+	// documents with all the labels
+	Labels map[string]string
+	// whole words in the title or text
+	Search string
+	// created, updated or title, defaults to created
+	OrderBy string
+	// asc or desc, defaults to asc
+	Order  string
+	Limit  int
+	Offset int
+}
+
+// CanAccess returns whether the user has the access to the document. Documents
+// created without an owner can be accessed by anyone in the tenant.
+func CanAccess(doc Doc, userId, access string) bool {
+	owner := doc.GetOwnerId()
+	if len(owner) == 0 || userId == owner {
+		return true
+	}
+	if len(userId) == 0 {
+		return false
+	}
+
+	switch doc.GetShares()[userId] {
+	case Write:
+		return access == Read || access == Write
+	case Read:
+		return access == Read
+	}
+
+	return false
+}
+
+// Share returns the shares with the user given the access, removing them if blank
+func Share(method string, doc Doc, userId, access string) (map[string]string, error) {
+	if len(userId) == 0 {
+		return nil, errors.BadRequest(method, "missing user to share with")
+	}
+	if len(doc.GetOwnerId()) == 0 {
+		return nil, errors.BadRequest(method, "only documents with an owner can be shared")
+	}
+	if userId == doc.GetOwnerId() {
+		return nil, errors.BadRequest(method, "can't share a document with its owner")
+	}
+
+	shares := map[string]string{}
+	for k, v := range doc.GetShares() {
+		shares[k] = v
+	}
+
+	switch access {
+	case Read, Write:
+		shares[userId] = access
+	case "":
+		delete(shares, userId)
+	default:
+		return nil, errors.BadRequest(method, "access must be read or write")
+	}
+
+	if len(shares) > maxShares {
+		return nil, errors.BadRequest(method, "shared with at most %d users", maxShares)
+	}
+
+	return shares, nil
+}
+
+// Tags returns the unique non blank tags
+func Tags(tags []string) []string {
+	seen := map[string]bool{}
+	var ret []string
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if len(t) == 0 || seen[t] {
+			continue
+		}
+		seen[t] = true
+		ret = append(ret, t)
+	}
+	return ret
+}
+
+func (c *Collection) validate(method string, doc Doc) error {
+	if len(doc.GetTags()) > maxTags {
+		return errors.BadRequest(method, "at most %d tags", maxTags)
+	}
+	for _, t := range doc.GetTags() {
+		if len(t) > maxLabelLength {
+			return errors.BadRequest(method, "tags must be at most %d characters", maxLabelLength)
+		}
+	}
+	if len(doc.GetLabels()) > maxLabels {
+		return errors.BadRequest(method, "at most %d labels", maxLabels)
+	}
+	for k, v := range doc.GetLabels() {
+		if len(k) == 0 || len(k) > maxLabelLength || len(v) > maxLabelLength {
+			return errors.BadRequest(method, "labels must be at most %d characters", maxLabelLength)
+		}
+	}
+	return nil
+}
+
+func newMessage(ev map[string]interface{}) *structpb.Struct {
+	st := new(structpb.Struct)
+	b, _ := json.Marshal(ev)
+	json.Unmarshal(b, st)
+	return st
+}
+
+// Publish sends the event to subscribers of the service's events
+func (c *Collection) Publish(ctx context.Context, event string, doc Doc) {
+	if _, err := c.Stream.Publish(ctx, &mqpb.PublishRequest{
+		Topic: c.Service,
+		Message: newMessage(map[string]interface{}{
+			"event": event,
+			c.Type:  doc,
+		}),
+	}); err != nil {
+		logger.Errorf("Error publishing %v event for %v %v: %v", event, c.Type, doc.GetId(), err)
+	}
+}
+
+// Create stores a new document
+func (c *Collection) Create(ctx context.Context, method string, doc Doc) error {
+	if err := c.validate(method, doc); err != nil {
+		return err
+	}
+
+	tnt := tenant.OrDefault(ctx)
+	if err := store.Write(store.NewRecord(c.Key(tnt, doc.GetId()), doc)); err != nil {
+		return errors.InternalServerError(method, "failed to create %s", c.Type)
+	}
+	if err := c.index(tnt, nil, doc); err != nil {
+		logger.Errorf("Error indexing %s %v: %v", c.Type, doc.GetId(), err)
+	}
+
+	c.Publish(ctx, EventCreate, doc)
+
+	return nil
+}
+
+// Read returns the document if the user has the access to it
+func (c *Collection) Read(ctx context.Context, method, id, userId, access string) (Doc, error) {
+	doc, err := c.read(tenant.OrDefault(ctx), id)
+	if err == store.ErrNotFound {
+		return nil, errors.NotFound(method, "%s%s not found", strings.ToUpper(c.Type[:1]), c.Type[1:])
+	} else if err != nil {
+		return nil, errors.InternalServerError(method, "Error reading from store: %v", err.Error())
+	}
+
+	if !CanAccess(doc, userId, access) {
+		return nil, errors.Forbidden(method, "%s access to the %s required", access, c.Type)
+	}
+
+	return doc, nil
+}
+
+// read returns the stored document
+func (c *Collection) read(tnt, id string) (Doc, error) {
+	recs, err := store.Read(c.Key(tnt, id))
+	if err != nil {
+		return nil, err
+	}
+
+	doc := c.New()
+	if err := recs[0].Decode(doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Update stores a changed document publishing the event
+func (c *Collection) Update(ctx context.Context, method, event string, doc Doc) error {
+	if err := c.validate(method, doc); err != nil {
+		return err
+	}
+
+	tnt := tenant.OrDefault(ctx)
+
+	// the words of the stored document are moved in the index
+	prev, err := c.read(tnt, doc.GetId())
+	if err != nil && err != store.ErrNotFound {
+		return errors.InternalServerError(method, "Error reading from store: %v", err.Error())
+	}
+
+	if err := store.Write(store.NewRecord(c.Key(tnt, doc.GetId()), doc)); err != nil {
+		return errors.InternalServerError(method, "Error writing to store: %v", err.Error())
+	}
+	if err := c.index(tnt, prev, doc); err != nil {
+		logger.Errorf("Error indexing %s %v: %v", c.Type, doc.GetId(), err)
+	}
+
+	c.Publish(ctx, event, doc)
+
+	return nil
+}
+
+// Delete removes the document if the user owns it, returning nil if it doesn't exist
+func (c *Collection) Delete(ctx context.Context, method, id, userId string) (Doc, error) {
+	doc, err := c.Read(ctx, method, id, userId, Owner)
+	if merr, ok := err.(*errors.Error); ok && merr.Code == 404 {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	tnt := tenant.OrDefault(ctx)
+	if err := store.Delete(c.Key(tnt, id)); err != nil && err != store.ErrNotFound {
+		return nil, errors.InternalServerError(method, "Failed to delete %s", c.Type)
+	}
+	if err := c.index(tnt, doc, nil); err != nil {
+		logger.Errorf("Error unindexing %s %v: %v", c.Type, id, err)
+	}
+
+	c.Publish(ctx, EventDelete, doc)
+
+	return doc, nil
+}
+
+// List returns a page of the documents matching the query along with the total
+// matched. Documents are searched by the whole words of their title and text.
+// Without a search or ids all the tenant's documents are read, since the total,
+// the access and the order by title all need every document.
+func (c *Collection) List(ctx context.Context, method string, q *Query) ([]Doc, int, error) {
+	tnt := tenant.OrDefault(ctx)
+	words := index.Terms(q.Search)
+	if len(q.Search) > 0 && len(words) == 0 {
+		return nil, 0, errors.BadRequest(method, "search words must be at least %d characters", index.MinTermLength)
+	}
+
+	var candidates []Doc
+
+	// the documents read by id rather than all the tenant's
+	ids := q.Ids
+
+	if len(words) > 0 {
+		found, err := c.search(tnt, words)
+		if err != nil {
+			return nil, 0, errors.InternalServerError(method, "Error searching %ss: %v", c.Type, err.Error())
+		}
+		ids = intersect(ids, found)
+	}
+
+	if ids != nil {
+		for _, id := range ids {
+			doc, err := c.read(tnt, id)
+			if err == store.ErrNotFound {
+				continue
+			} else if err != nil {
+				return nil, 0, errors.InternalServerError(method, "Error reading from store: %v", err.Error())
+			}
+			candidates = append(candidates, doc)
+		}
+	} else {
+		recs, err := store.Read(c.Key(tnt, ""), store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return nil, 0, errors.InternalServerError(method, "Error reading from store: %v", err.Error())
+		}
+		for _, r := range recs {
+			doc := c.New()
+			if err := r.Decode(doc); err != nil {
+				return nil, 0, errors.InternalServerError(method, "Error decoding %s: %v", c.Type, err.Error())
+			}
+			candidates = append(candidates, doc)
+		}
+	}
+
+	var docs []Doc
+
+	for _, doc := range candidates {
+		if !CanAccess(doc, q.UserId, Read) {
+			continue
+		}
+		if !c.matches(doc, q, words) {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+
+	less := func(i, j int) bool {
+		return docs[i].GetCreated() < docs[j].GetCreated()
+	}
+	switch q.OrderBy {
+	case "", "created":
+	case "updated":
+		less = func(i, j int) bool {
+			return docs[i].GetUpdated() < docs[j].GetUpdated()
+		}
+	case "title":
+		less = func(i, j int) bool {
+			return strings.ToLower(c.Title(docs[i])) < strings.ToLower(c.Title(docs[j]))
+		}
+	default:
+		return nil, 0, errors.BadRequest(method, "order_by must be created, updated or title")
+	}
+
+	switch q.Order {
+	case "", "asc":
+		sort.SliceStable(docs, less)
+	case "desc":
+		sort.SliceStable(docs, func(i, j int) bool { return less(j, i) })
+	default:
+		return nil, 0, errors.BadRequest(method, "order must be asc or desc")
+	}
+
+	total := len(docs)
+
+	if q.Offset < 0 || q.Limit < 0 {
+		return nil, 0, errors.BadRequest(method, "invalid limit or offset")
+	}
+	if q.Offset > len(docs) {
+		q.Offset = len(docs)
+	}
+	docs = docs[q.Offset:]
+	if q.Limit > 0 && len(docs) > q.Limit {
+		docs = docs[:q.Limit]
+	}
+
+	return docs, total, nil
+}
+
+// matches returns whether the document has the tags, labels and search words of the query
+func (c *Collection) matches(doc Doc, q *Query, words []string) bool {
+	tags := map[string]bool{}
+	for _, t := range doc.GetTags() {
+		tags[t] = true
+	}
+	for _, t := range q.Tags {
+		if !tags[t] {
+			return false
+		}
+	}
+
+	labels := doc.GetLabels()
+	for k, v := range q.Labels {
+		if l, ok := labels[k]; !ok || l != v {
+			return false
+		}
+	}
+
+	if len(words) == 0 {
+		return true
+	}
+
+	// the index is checked against the words of the document
+	text := map[string]bool{}
+	for _, t := range c.terms(doc) {
+		text[t] = true
+	}
+	for _, w := range words {
+		if !text[w] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// terms returns the words the document is searched by
+func (c *Collection) terms(doc Doc) []string {
+	return index.Terms(c.Title(doc) + " " + c.Text(doc))
+}
+
+func (c *Collection) indexKey(tnt, term, id string) string {
+	return path.Join(indexPrefix, c.Service, tnt, term, id)
+}
+
+// index replaces the words of the previous document with those of the next,
+// either of which is nil when the document is created or deleted
+func (c *Collection) index(tnt string, prev, next Doc) error {
+	add := map[string]bool{}
+	if next != nil {
+		for _, t := range c.terms(next) {
+			add[t] = true
+		}
+	}
+
+	if prev != nil {
+		for _, t := range c.terms(prev) {
+			if add[t] {
+				delete(add, t)
+				continue
+			}
+			if err := store.Delete(c.indexKey(tnt, t, prev.GetId())); err != nil && err != store.ErrNotFound {
+				return err
+			}
+		}
+	}
+
+	for t := range add {
+		if err := store.Write(&store.Record{Key: c.indexKey(tnt, t, next.GetId())}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ensureIndex indexes the documents created before the index
+func (c *Collection) ensureIndex(tnt string) error {
+	// the marker is outside the prefix of the index keys
+	return index.Backfill(path.Join(indexPrefix, c.Service, tnt), func() error {
+		recs, err := store.Read(c.Key(tnt, ""), store.ReadPrefix())
+		if err != nil && err != store.ErrNotFound {
+			return err
+		}
+		for _, rec := range recs {
+			doc := c.New()
+			if err := rec.Decode(doc); err != nil {
+				continue
+			}
+			if err := c.index(tnt, nil, doc); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// search returns the ids of the documents with every word
+func (c *Collection) search(tnt string, words []string) ([]string, error) {
+	if err := c.ensureIndex(tnt); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+
+	for i, word := range words {
+		prefix := path.Join(indexPrefix, c.Service, tnt, word) + "/"
+
+		keys, err := store.List(store.ListPrefix(prefix))
+		if err != nil {
+			return nil, err
+		}
+
+		found := map[string]bool{}
+		for _, key := range keys {
+			found[strings.TrimPrefix(key, prefix)] = true
+		}
+
+		if i == 0 {
+			for id := range found {
+				ids = append(ids, id)
+			}
+			continue
+		}
+
+		both := []string{}
+		for _, id := range ids {
+			if found[id] {
+				both = append(both, id)
+			}
+		}
+		ids = both
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// intersect returns the ids in both, or all of b if a is nil
+func intersect(a, b []string) []string {
+	if a == nil {
+		return b
+	}
+	in := map[string]bool{}
+	for _, id := range b {
+		in[id] = true
+	}
+	ret := []string{}
+	for _, id := range a {
+		if in[id] {
+			ret = append(ret, id)
+		}
+	}
+	return ret
+}
+
+// DeleteTenant removes the documents of the tenant and their index
+func (c *Collection) DeleteTenant(tnt string) (int, error) {
+	marker := path.Join(indexPrefix, c.Service, tnt)
+	if err := store.Delete(marker); err != nil && err != store.ErrNotFound {
+		return 0, err
+	}
+
+	var deleted int
+	for _, prefix := range []string{c.Key(tnt, ""), marker + "/"} {
+		keys, err := store.List(store.ListPrefix(prefix))
+		if err != nil {
+			return deleted, err
+		}
+		for _, k := range keys {
+			if err := store.Delete(k); err != nil {
+				return deleted, err
+			}
+		}
+		deleted += len(keys)
+	}
+	return deleted, nil
+}
+
+// Events sends the events of the documents the user can read, or of a single document if an id is set
+func (c *Collection) Events(ctx context.Context, method, id, userId string, send func(event string, doc Doc) error) error {
+	backendStream, err := c.Stream.Subscribe(ctx, &mqpb.SubscribeRequest{
+		Topic: c.Service,
+	})
+	if err != nil {
+		return errors.InternalServerError(method, "Failed to subscribe to %s", c.Service)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
+
+		// receive messages from the stream
+		msg, err := backendStream.Recv()
+		if err != nil {
+			return nil
+		}
+
+		v, err := msg.Message.MarshalJSON()
+		if err != nil {
+			continue
+		}
+
+		var ev map[string]json.RawMessage
+		if err := json.Unmarshal(v, &ev); err != nil {
+			continue
+		}
+
+		var event string
+		if err := json.Unmarshal(ev["event"], &event); err != nil {
+			continue
+		}
+
+		doc := c.New()
+		if err := json.Unmarshal(ev[c.Type], doc); err != nil {
+			continue
+		}
+
+		// filter if necessary by id
+		if len(id) > 0 && doc.GetId() != id {
+			continue
+		}
+		if !CanAccess(doc, userId, Read) {
+			continue
+		}
+
+		// send back the event to the client
+		if err := send(event, doc); err != nil {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package document
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/micro/micro/v3/service/client"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+	mqpb "github.com/micro/services/mq/proto"
+)
+
+// doc is a document with a title and text
+type doc struct {
+	Id      string
+	Created string
+	Updated string
+	OwnerId string
+	Tags    []string
+	Labels  map[string]string
+	Shares  map[string]string
+	Title   string
+	Text    string
+}
+
+func (d *doc) GetId() string                { return d.Id }
+func (d *doc) GetCreated() string           { return d.Created }
+func (d *doc) GetUpdated() string           { return d.Updated }
+func (d *doc) GetOwnerId() string           { return d.OwnerId }
+func (d *doc) GetTags() []string            { return d.Tags }
+func (d *doc) GetLabels() map[string]string { return d.Labels }
+func (d *doc) GetShares() map[string]string { return d.Shares }
+
+// stream drops the events published
+type stream struct {
+	mqpb.MqService
+}
+
+func (s *stream) Publish(ctx context.Context, req *mqpb.PublishRequest, opts ...client.CallOption) (*mqpb.PublishResponse, error) {
+	return &mqpb.PublishResponse{}, nil
+}
+
+func newCollection() *Collection {
+	store.DefaultStore = memory.NewStore()
+
+	return &Collection{
+		Service: "docs",
+		Type:    "doc",
+		Key: func(tnt, id string) string {
+			return "doc/" + tnt + "/" + id
+		},
+		New: func() Doc {
+			return new(doc)
+		},
+		Title: func(d Doc) string {
+			return d.(*doc).Title
+		},
+		Text: func(d Doc) string {
+			return d.(*doc).Text
+		},
+		Stream: new(stream),
+	}
+}
+
+func ids(docs []Doc) string {
+	var ret []string
+	for _, d := range docs {
+		ret = append(ret, d.GetId())
+	}
+	return fmt.Sprint(ret)
+}
+
+func TestCanAccess(t *testing.T) {
+	shared := &doc{OwnerId: "owner", Shares: map[string]string{"reader": Read, "writer": Write}}
+
+	tcs := []struct {
+		name   string
+		doc    *doc
+		userId string
+		access string
+		ok     bool
+	}{
+		{"no owner", &doc{}, "", Owner, true},
+		{"owner", shared, "owner", Owner, true},
+		{"reader reads", shared, "reader", Read, true},
+		{"reader writes", shared, "reader", Write, false},
+		{"writer writes", shared, "writer", Write, true},
+		{"writer reads", shared, "writer", Read, true},
+		{"writer deletes", shared, "writer", Owner, false},
+		{"stranger", shared, "stranger", Read, false},
+		{"no user", shared, "", Read, false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if ok := CanAccess(tc.doc, tc.userId, tc.access); ok != tc.ok {
+				t.Errorf("CanAccess(%v, %v) = %v, want %v", tc.userId, tc.access, ok, tc.ok)
+			}
+		})
+	}
+}
+
+func TestShare(t *testing.T) {
+	shared := &doc{OwnerId: "owner", Shares: map[string]string{"reader": Read}}
+
+	tcs := []struct {
+		name   string
+		doc    *doc
+		userId string
+		access string
+		shares map[string]string
+		err    bool
+	}{
+		{"add", shared, "writer", Write, map[string]string{"reader": Read, "writer": Write}, false},
+		{"change", shared, "reader", Write, map[string]string{"reader": Write}, false},
+		{"remove", shared, "reader", "", map[string]string{}, false},
+		{"remove unknown", shared, "stranger", "", map[string]string{"reader": Read}, false},
+		{"no user", shared, "", Read, nil, true},
+		{"no owner", &doc{}, "reader", Read, nil, true},
+		{"owner", shared, "owner", Read, nil, true},
+		{"bad access", shared, "writer", Owner, nil, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			shares, err := Share("docs.share", tc.doc, tc.userId, tc.access)
+			if (err != nil) != tc.err {
+				t.Fatalf("err = %v, want error %v", err, tc.err)
+			}
+			if fmt.Sprint(shares) != fmt.Sprint(tc.shares) {
+				t.Errorf("shares = %v, want %v", shares, tc.shares)
+			}
+		})
+	}
+
+	// the document's shares aren't changed
+	if len(shared.Shares) != 1 || shared.Shares["reader"] != Read {
+		t.Errorf("document shares changed to %v", shared.Shares)
+	}
+}
+
+func TestList(t *testing.T) {
+	c := newCollection()
+	ctx := context.Background()
+
+	for _, d := range []*doc{
+		{Id: "a", Created: "1", Updated: "5", Title: "Banana", Text: "shopping list", Tags: []string{"food"}},
+		{Id: "b", Created: "2", Updated: "4", Title: "apple", Text: "Meeting notes", Labels: map[string]string{"team": "x"}},
+		{Id: "c", Created: "3", Updated: "3", Title: "Cherry", Text: "meeting agenda", Tags: []string{"food"}},
+		{Id: "d", Created: "4", Updated: "2", Title: "date", Text: "private meeting", OwnerId: "alice"},
+		{Id: "e", Created: "5", Updated: "1", Title: "elder", Text: "shared meeting", OwnerId: "alice", Shares: map[string]string{"bob": Read}},
+	} {
+		if err := c.Create(ctx, "docs.create", d); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name  string
+		query Query
+		ids   string
+		total int
+		err   bool
+	}{
+		{name: "created", query: Query{}, ids: "[a b c]", total: 3},
+		{name: "owner", query: Query{UserId: "alice"}, ids: "[a b c d e]", total: 5},
+		{name: "shared", query: Query{UserId: "bob"}, ids: "[a b c e]", total: 4},
+		{name: "updated", query: Query{OrderBy: "updated"}, ids: "[c b a]", total: 3},
+		{name: "title desc", query: Query{OrderBy: "title", Order: "desc"}, ids: "[c a b]", total: 3},
+		{name: "page", query: Query{UserId: "alice", Limit: 2, Offset: 1}, ids: "[b c]", total: 5},
+		{name: "past the end", query: Query{Offset: 10}, ids: "[]", total: 3},
+		{name: "tags", query: Query{Tags: []string{"food"}}, ids: "[a c]", total: 2},
+		{name: "labels", query: Query{Labels: map[string]string{"team": "x"}}, ids: "[b]", total: 1},
+		{name: "search", query: Query{UserId: "alice", Search: "MEETING"}, ids: "[b c d e]", total: 4},
+		{name: "search all words", query: Query{UserId: "alice", Search: "meeting notes"}, ids: "[b]", total: 1},
+		{name: "search whole words", query: Query{Search: "meet"}, ids: "[]", total: 0},
+		{name: "search access", query: Query{UserId: "bob", Search: "meeting", Order: "desc"}, ids: "[e c b]", total: 3},
+		{name: "ids", query: Query{Ids: []string{"c", "a", "z"}}, ids: "[a c]", total: 2},
+		{name: "no ids", query: Query{Ids: []string{}}, ids: "[]", total: 0},
+		{name: "ids and search", query: Query{Ids: []string{"a", "b"}, Search: "meeting"}, ids: "[b]", total: 1},
+		{name: "search too short", query: Query{Search: "a"}, err: true},
+		{name: "bad order", query: Query{Order: "up"}, err: true},
+		{name: "bad order by", query: Query{OrderBy: "size"}, err: true},
+		{name: "bad offset", query: Query{Offset: -1}, err: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.query
+			docs, total, err := c.List(ctx, "docs.list", &q)
+			if (err != nil) != tc.err {
+				t.Fatalf("err = %v, want error %v", err, tc.err)
+			}
+			if tc.err {
+				return
+			}
+			if ids(docs) != tc.ids || total != tc.total {
+				t.Errorf("got %v of %d, want %v of %d", ids(docs), total, tc.ids, tc.total)
+			}
+		})
+	}
+}
+
+func TestIndex(t *testing.T) {
+	c := newCollection()
+	ctx := context.Background()
+
+	search := func(words string) string {
+		docs, _, err := c.List(ctx, "docs.list", &Query{Search: words})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ids(docs)
+	}
+
+	// documents stored before the index are indexed when first searched
+	if err := store.Write(store.NewRecord(c.Key("default", "old"), &doc{Id: "old", Text: "legacy text"})); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("legacy"); got != "[old]" {
+		t.Errorf("legacy = %v, want [old]", got)
+	}
+
+	d := &doc{Id: "new", Title: "first draft"}
+	if err := c.Create(ctx, "docs.create", d); err != nil {
+		t.Fatal(err)
+	}
+	d.Title = "final copy"
+	if err := c.Update(ctx, "docs.update", EventUpdate, d); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("draft"); got != "[]" {
+		t.Errorf("draft = %v after update", got)
+	}
+	if got := search("final"); got != "[new]" {
+		t.Errorf("final = %v, want [new]", got)
+	}
+
+	if _, err := c.Delete(ctx, "docs.delete", "new", ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := search("final"); got != "[]" {
+		t.Errorf("final = %v after delete", got)
+	}
+
+	// deleting the tenant removes its index
+	if _, err := c.DeleteTenant("default"); err != nil {
+		t.Fatal(err)
+	}
+	keys, _ := store.List()
+	if len(keys) > 0 {
+		t.Errorf("keys left after deleting the tenant: %v", keys)
+	}
+}
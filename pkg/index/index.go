@@ -0,0 +1,51 @@
+// Package index has helpers for the indexes services keep in the store
+package index
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/micro/micro/v3/service/store"
+)
+
+const (
+	// words indexed are between these lengths
+	MinTermLength = 2
+	MaxTermLength = 64
+)
+
+// Terms splits the text into the unique lower case words which are indexed
+func Terms(text string) []string {
+	seen := map[string]bool{}
+	var ret []string
+
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		if len(word) < MinTermLength || len(word) > MaxTermLength || seen[word] {
+			continue
+		}
+		seen[word] = true
+		ret = append(ret, word)
+	}
+
+	return ret
+}
+
+// Backfill runs fn to index the records stored before the index existed,
+// unless the marker says it already has. The marker is written once fn
+// succeeds so an interrupted backfill runs again, and should be outside the
+// prefix of the index keys so listing them doesn't include it.
+func Backfill(marker string, fn func() error) error {
+	if _, err := store.Read(marker); err == nil {
+		return nil
+	} else if err != store.ErrNotFound {
+		return err
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	return store.Write(&store.Record{Key: marker})
+}
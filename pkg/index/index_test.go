@@ -0,0 +1,60 @@
+package index
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+)
+
+func TestTerms(t *testing.T) {
+	tcs := []struct {
+		text  string
+		terms []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"a b cd", []string{"cd"}},
+		{"go go GO", []string{"go"}},
+		{"ship v2.0 now", []string{"ship", "v2", "now"}},
+		{"", nil},
+		{strings.Repeat("x", MaxTermLength+1) + " ok", []string{"ok"}},
+	}
+
+	for _, tc := range tcs {
+		got := Terms(tc.text)
+		if strings.Join(got, ",") != strings.Join(tc.terms, ",") {
+			t.Fatalf("%q: expected %v, got %v", tc.text, tc.terms, got)
+		}
+	}
+}
+
+func TestBackfill(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+
+	var runs int
+	fail := errors.New("failed")
+
+	tcs := []struct {
+		name string
+		err  error
+		runs int
+	}{
+		{"failed", fail, 1},
+		{"runs again", nil, 2},
+		{"marked", nil, 2},
+	}
+	for _, tc := range tcs {
+		err := Backfill("marker", func() error {
+			runs++
+			return tc.err
+		})
+		if err != tc.err {
+			t.Fatalf("%s: err = %v, want %v", tc.name, err, tc.err)
+		}
+		if runs != tc.runs {
+			t.Fatalf("%s: ran %d times, want %d", tc.name, runs, tc.runs)
+		}
+	}
+}
@@ -1,4 +1,5 @@
-package handler
+// Package network has helpers for calling out to user provided hosts
+package network
 
 import (
 	"net"
@@ -30,7 +31,8 @@ func init() {
 	}
 }
 
-func isPrivateIP(host string) bool {
+// IsPrivateIP returns whether the host resolves to a loopback, link-local or private address
+func IsPrivateIP(host string) bool {
 	var addr string
 
 	// split on host port
@@ -0,0 +1,77 @@
+package query
+
+import (
+	"strings"
+)
+
+// Match returns whether the document satisfies every query. Fields are
+// looked up by their dot separated path e.g a.b.c and missing fields never match.
+func Match(queries []Query, doc map[string]interface{}) bool {
+	for _, q := range queries {
+		val, ok := lookup(doc, q.Field)
+		if !ok || !compare(val, q.Op, q.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+func lookup(doc map[string]interface{}, field string) (interface{}, bool) {
+	var val interface{} = doc
+	for _, part := range strings.Split(field, ".") {
+		m, ok := val.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if val, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return val, true
+}
+
+func compare(val interface{}, op int, want interface{}) bool {
+	// decoded JSON numbers are float64 while parsed ones are int64
+	if n, ok := want.(int64); ok {
+		f, ok := number(val)
+		if !ok {
+			return op == NotEquals
+		}
+		w := float64(n)
+		switch op {
+		case Equals:
+			return f == w
+		case NotEquals:
+			return f != w
+		case LessThan:
+			return f < w
+		case LessThanEquals:
+			return f <= w
+		case GreaterThan:
+			return f > w
+		case GreaterThanEquals:
+			return f >= w
+		}
+		return false
+	}
+
+	switch op {
+	case Equals:
+		return val == want
+	case NotEquals:
+		return val != want
+	}
+	return false
+}
+
+func number(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -1,4 +1,5 @@
-package handler
+// Package query parses the query grammar of the db service e.g a == 12 and name != "nandos"
+package query
 
 import (
 	"errors"
@@ -25,34 +26,34 @@ const (
 	itemBoolFalse
 
 	// ops
-	itemEquals
-	itemNotEquals
-	itemLessThan
-	itemGreaterThan
-	itemLessThanEquals
-	itemGreaterThanEquals
+	Equals
+	NotEquals
+	LessThan
+	GreaterThan
+	LessThanEquals
+	GreaterThanEquals
 )
 
 var opToString = map[int]string{
-	itemEquals:            "==",
-	itemNotEquals:         "!=",
-	itemLessThan:          "<",
-	itemGreaterThan:       ">",
-	itemLessThanEquals:    "<=",
-	itemGreaterThanEquals: ">=",
+	Equals:            "==",
+	NotEquals:         "!=",
+	LessThan:          "<",
+	GreaterThan:       ">",
+	LessThanEquals:    "<=",
+	GreaterThanEquals: ">=",
 }
 
 var expressions = []lexer.TokenExpr{
 	{`[ ]+`, itemIgnore}, // Whitespace
-	{`==`, itemEquals},
-	{`!=`, itemNotEquals},
+	{`==`, Equals},
+	{`!=`, NotEquals},
 	{`false`, itemBoolFalse},
 	{`true`, itemBoolTrue},
 	{`and`, itemAnd},
-	{`<=`, itemLessThanEquals},
-	{`>=`, itemGreaterThanEquals},
-	{`<`, itemLessThan},
-	{`>`, itemGreaterThan},
+	{`<=`, LessThanEquals},
+	{`>=`, GreaterThanEquals},
+	{`<`, LessThan},
+	{`>`, GreaterThan},
 	{`[0-9]+`, itemInt},
 	{`"(?:[^"\\]|\\.)*"`, itemString},
 	{"`" + `(?:[^"\\]|\\.)*` + "`", itemString},
@@ -90,7 +91,7 @@ func Parse(q string) ([]Query, error) {
 		}
 
 		// is an op
-		if token.Typ >= itemEquals {
+		if token.Typ >= Equals {
 			current.Op = token.Typ
 			continue
 		}
@@ -101,7 +102,7 @@ func Parse(q string) ([]Query, error) {
 			current.Field = token.Text
 		case itemString:
 			switch current.Op {
-			case itemEquals, itemNotEquals:
+			case Equals, NotEquals:
 			default:
 				return nil, fmt.Errorf("operator '%v' can't be used with strings", opToString[current.Op])
 			}
@@ -116,14 +117,14 @@ func Parse(q string) ([]Query, error) {
 			current.Value = to
 		case itemBoolTrue:
 			switch current.Op {
-			case itemEquals, itemNotEquals:
+			case Equals, NotEquals:
 			default:
 				return nil, fmt.Errorf("operator '%v' can't be used with bools", opToString[current.Op])
 			}
 			current.Value = true
 		case itemBoolFalse:
 			switch current.Op {
-			case itemEquals, itemNotEquals:
+			case Equals, NotEquals:
 			default:
 				return nil, fmt.Errorf("operator '%v' can't be used with bools", opToString[current.Op])
 			}
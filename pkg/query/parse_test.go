@@ -0,0 +1,238 @@
+package query
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/crufter/lexer"
+)
+
+func TestLexing(t *testing.T) {
+	tokens, err := lexer.Lex("a == 12", expressions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 3 {
+		t.Fatal(tokens)
+	}
+	if tokens[0].Typ != itemFieldName || tokens[1].Typ != Equals || tokens[2].Typ != itemInt {
+		t.Fatal(tokens)
+	}
+
+	tokens, err = lexer.Lex(`a == 12 and name != 'nandos'`, expressions)
+	if tokens[0].Typ != itemFieldName ||
+		tokens[1].Typ != Equals ||
+		tokens[2].Typ != itemInt ||
+		tokens[3].Typ != itemAnd ||
+		tokens[4].Typ != itemFieldName ||
+		tokens[5].Typ != NotEquals ||
+		tokens[6].Typ != itemString {
+		t.Fatal(tokens)
+	}
+}
+
+type tCase struct {
+	Q   string
+	E   []Query
+	Err error
+}
+
+func TestParsing(t *testing.T) {
+	tCases := []tCase{
+		tCase{
+			Q: `a == 12 and name != "nandos"`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(12),
+					Op:    Equals,
+				},
+				Query{
+					Field: "name",
+					Value: "nandos",
+					Op:    NotEquals,
+				},
+			},
+		},
+		tCase{
+			Q: `a.b.c == 12 and name != "nandos"`,
+			E: []Query{
+				Query{
+					Field: "a.b.c",
+					Value: int64(12),
+					Op:    Equals,
+				},
+				Query{
+					Field: "name",
+					Value: "nandos",
+					Op:    NotEquals,
+				},
+			},
+		},
+		tCase{
+			Q: `a == 12 and name != "nan'dos"`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(12),
+					Op:    Equals,
+				},
+				Query{
+					Field: "name",
+					Value: "nan'dos",
+					Op:    NotEquals,
+				},
+			},
+		},
+		tCase{
+			Q: `id == '795c1e56-d1f3-495d-b9cb-d84a56ffb39c'`,
+			E: []Query{
+				Query{
+					Field: "id",
+					Value: "795c1e56-d1f3-495d-b9cb-d84a56ffb39c",
+					Op:    Equals,
+				},
+			},
+		},
+		tCase{
+			Q: `a == 12 and name != 'nandos'`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(12),
+					Op:    Equals,
+				},
+				Query{
+					Field: "name",
+					Value: "nandos",
+					Op:    NotEquals,
+				},
+			},
+		},
+		tCase{
+			Q: "a == 12 and name != `nandos`",
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(12),
+					Op:    Equals,
+				},
+				Query{
+					Field: "name",
+					Value: "nandos",
+					Op:    NotEquals,
+				},
+			},
+		},
+		// test escaping quotes
+		tCase{
+			Q: `a == 12 and name != 'He said ""yes""!'`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(12),
+					Op:    Equals,
+				},
+				Query{
+					Field: "name",
+					Value: `He said "yes"!`,
+					Op:    NotEquals,
+				},
+			},
+		},
+		tCase{
+			Q: `a == false and b == true`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: false,
+					Op:    Equals,
+				},
+				Query{
+					Field: "b",
+					Value: true,
+					Op:    Equals,
+				},
+			},
+		},
+		// a < 20
+		tCase{
+			Q: `a < 20`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(20),
+					Op:    LessThan,
+				},
+			},
+		},
+		tCase{
+			Q: `a <= 20`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(20),
+					Op:    LessThanEquals,
+				},
+			},
+		},
+		tCase{
+			Q: `a > 20`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(20),
+					Op:    GreaterThan,
+				},
+			},
+		},
+		tCase{
+			Q: `a >= 20`,
+			E: []Query{
+				Query{
+					Field: "a",
+					Value: int64(20),
+					Op:    GreaterThanEquals,
+				},
+			},
+		},
+	}
+	for _, tCase := range tCases {
+		fmt.Println("Parsing", tCase.Q)
+		qs, err := Parse(tCase.Q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(qs, tCase.E) {
+			t.Fatal("Expected", tCase.E, "got", qs)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	doc := map[string]interface{}{
+		"type": "signup",
+		"age":  float64(30),
+		"user": map[string]interface{}{"admin": true},
+	}
+	tCases := map[string]bool{
+		`type == "signup"`:                    true,
+		`type != "signup"`:                    false,
+		`age > 20 and age <= 30`:              true,
+		`age < 30`:                            false,
+		`user.admin == true`:                  true,
+		`user.admin == true and type == "no"`: false,
+		`missing == 1`:                        false,
+		`type == 1`:                           false,
+	}
+	for q, want := range tCases {
+		qs, err := Parse(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := Match(qs, doc); got != want {
+			t.Fatalf("%v: expected %v got %v", q, want, got)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package redis
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Leases hands out time limited locks shared between replicas, e.g. to elect
+// a leader or to make sure a piece of work is only done once.
+type Leases struct {
+	prefix string
+	client *redis.Client
+}
+
+// acquireScript takes the lease if it's free or extends it if already held
+// by the same holder.
+var acquireScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+if holder then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+return 1
+`)
+
+// releaseScript only deletes the lease if it's still held by the holder
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func NewLeases(prefix string) *Leases {
+	return &Leases{
+		prefix: Key(prefix, "lease"),
+		client: newClient(),
+	}
+}
+
+// Acquire takes or renews the lease for the holder. It returns false if the
+// lease is held by someone else.
+func (l *Leases) Acquire(ctx context.Context, key, holder string, ttl time.Duration) (bool, error) {
+	ok, err := acquireScript.Run(ctx, l.client, []string{Key(l.prefix, key)}, holder, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return ok == 1, nil
+}
+
+// Release gives up the lease if it's held by the holder
+func (l *Leases) Release(ctx context.Context, key, holder string) error {
+	return releaseScript.Run(ctx, l.client, []string{Key(l.prefix, key)}, holder).Err()
+}
+
+// Claim takes a lease which can't be renewed. Only the first caller for the
+// key within the ttl gets true.
+func (l *Leases) Claim(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return l.client.SetNX(ctx, Key(l.prefix, key), 1, ttl).Result()
+}
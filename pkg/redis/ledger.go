@@ -0,0 +1,284 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrUnbalanced        = errors.New("postings do not balance")
+	ErrBalanceChanged    = errors.New("balance changed")
+	ErrIdempotencyReused = errors.New("idempotency key reused for a different request")
+	ErrStatusChanged     = errors.New("status changed")
+)
+
+// Posting is a change to a counter made as part of a journal entry
+type Posting struct {
+	Key    string
+	Path   string
+	Amount int64
+	// whether the counter may go below zero
+	Overdraft bool
+	// whether the posting must leave the counter at exactly zero
+	Close bool
+}
+
+// Guard makes a post conditional on the status of something e.g a hold,
+// moving it to a new status in the same atomic step.
+type Guard struct {
+	Key string
+	// the status required, a missing status counts as From
+	From string
+	To   string
+	// how long the new status is kept, zero keeps it forever
+	TTL time.Duration
+}
+
+// Ledger applies balanced postings to counters and records them in an
+// append only journal in a single atomic step, so balances can always be
+// rebuilt from the journal.
+type Ledger struct {
+	prefix  string
+	counter *Counter
+}
+
+// postScript checks the idempotency key, the guarded status, the funds of
+// every debited counter and that closing postings zero their counter before
+// applying any posting. It returns the stored entry, or the entry previously
+// stored under the idempotency key if it was made by the same request.
+var postScript = redis.NewScript(`
+local journal = KEYS[1]
+local idempotency = KEYS[2]
+local fingerprint = KEYS[3]
+local guard = KEYS[4]
+local entry = ARGV[1]
+local ttl = tonumber(ARGV[2])
+local n = #KEYS - 4
+
+if ARGV[3] == "1" then
+	local existing = redis.call("GET", idempotency)
+	if existing then
+		local previous = redis.call("GET", fingerprint)
+		if previous and previous ~= ARGV[4] then
+			return {-3, idempotency}
+		end
+		return {0, existing}
+	end
+end
+
+if ARGV[5] == "1" then
+	local status = redis.call("GET", guard) or ARGV[6]
+	if status ~= ARGV[6] then
+		return {-4, status}
+	end
+end
+
+for i = 1, n do
+	local amount = tonumber(ARGV[7 + i * 2])
+	local mode = ARGV[8 + i * 2]
+	if mode == "close" then
+		local balance = tonumber(redis.call("GET", KEYS[4 + i]) or "0")
+		if balance + amount ~= 0 then
+			return {-2, KEYS[4 + i]}
+		end
+	elseif amount < 0 and mode == "0" then
+		local balance = tonumber(redis.call("GET", KEYS[4 + i]) or "0")
+		if balance + amount < 0 then
+			return {-1, KEYS[4 + i]}
+		end
+	end
+end
+
+for i = 1, n do
+	redis.call("INCRBY", KEYS[4 + i], ARGV[7 + i * 2])
+end
+
+redis.call("RPUSH", journal, entry)
+
+if ARGV[3] == "1" then
+	redis.call("SET", idempotency, entry, "EX", ttl)
+	redis.call("SET", fingerprint, ARGV[4], "EX", ttl)
+end
+
+if ARGV[5] == "1" then
+	if tonumber(ARGV[8]) > 0 then
+		redis.call("SET", guard, ARGV[7], "PX", ARGV[8])
+	else
+		redis.call("SET", guard, ARGV[7])
+	end
+end
+
+return {1, entry}
+`)
+
+// resetScript sets a counter only if nothing was posted to the journal since it was read
+var resetScript = redis.NewScript(`
+if redis.call("LLEN", KEYS[1]) ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[2], ARGV[2])
+return 1
+`)
+
+func NewLedger(prefix string, c *Counter) *Ledger {
+	return &Ledger{
+		prefix:  Key(prefix, "ledger"),
+		counter: c,
+	}
+}
+
+func (l *Ledger) journalKey(journal string) string {
+	return fmt.Sprintf("%s:journal:%s", l.prefix, journal)
+}
+
+func (l *Ledger) statusKey(journal, key string) string {
+	return fmt.Sprintf("%s:status:%s:%s", l.prefix, journal, key)
+}
+
+// Post atomically applies the postings and appends the entry to the journal.
+// If an idempotency key is given and was used within the ttl the postings are
+// not applied again and the originally stored entry is returned instead,
+// with replayed set to true. The fingerprint identifies the request made with
+// the key; reusing the key for a different request fails with
+// ErrIdempotencyReused. A closing posting which wouldn't leave its counter
+// at zero fails with ErrBalanceChanged, and a guard whose status isn't the
+// one required fails with ErrStatusChanged.
+func (l *Ledger) Post(ctx context.Context, journal, idempotencyKey, fingerprint string, ttl time.Duration, guard *Guard, postings []Posting, entry []byte) (stored []byte, replayed bool, err error) {
+	var sum int64
+	for _, p := range postings {
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return nil, false, ErrUnbalanced
+	}
+
+	idempotent := "0"
+	if len(idempotencyKey) > 0 {
+		idempotent = "1"
+	}
+
+	guarded, from, to, guardKey, guardTTL := "0", "", "", "", int64(0)
+	if guard != nil {
+		guarded, from, to, guardKey, guardTTL = "1", guard.From, guard.To, guard.Key, guard.TTL.Milliseconds()
+	}
+
+	keys := []string{
+		l.journalKey(journal),
+		fmt.Sprintf("%s:idempotency:%s:%s", l.prefix, journal, idempotencyKey),
+		fmt.Sprintf("%s:fingerprint:%s:%s", l.prefix, journal, idempotencyKey),
+		l.statusKey(journal, guardKey),
+	}
+	args := []interface{}{entry, int64(ttl.Seconds()), idempotent, fingerprint, guarded, from, to, guardTTL}
+	for _, p := range postings {
+		mode := "0"
+		switch {
+		case p.Close:
+			mode = "close"
+		case p.Overdraft:
+			mode = "1"
+		}
+		keys = append(keys, l.counter.key(p.Key, p.Path))
+		args = append(args, p.Amount, mode)
+	}
+
+	res, err := postScript.Run(ctx, l.counter.client, keys, args...).Result()
+	if err != nil {
+		return nil, false, err
+	}
+
+	vals, ok := res.([]interface{})
+	if !ok || len(vals) != 2 {
+		return nil, false, fmt.Errorf("unexpected ledger response %v", res)
+	}
+
+	status, _ := vals[0].(int64)
+	val, _ := vals[1].(string)
+
+	switch status {
+	case -1:
+		return nil, false, ErrInsufficientFunds
+	case -2:
+		return nil, false, ErrBalanceChanged
+	case -3:
+		return nil, false, ErrIdempotencyReused
+	case -4:
+		return nil, false, ErrStatusChanged
+	case 0:
+		return []byte(val), true, nil
+	default:
+		return []byte(val), false, nil
+	}
+}
+
+// Status returns the status of a guard, or an empty string if it has none
+func (l *Ledger) Status(ctx context.Context, journal, key string) (string, error) {
+	status, err := l.counter.client.Get(ctx, l.statusKey(journal, key)).Result()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return status, err
+}
+
+// Len returns the number of entries in the journal
+func (l *Ledger) Len(ctx context.Context, journal string) (int64, error) {
+	return l.counter.client.LLen(ctx, l.journalKey(journal)).Result()
+}
+
+// Range returns the journal entries between start and stop inclusive
+func (l *Ledger) Range(ctx context.Context, journal string, start, stop int64) ([][]byte, error) {
+	vals, err := l.counter.client.LRange(ctx, l.journalKey(journal), start, stop).Result()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([][]byte, len(vals))
+	for i, v := range vals {
+		ret[i] = []byte(v)
+	}
+	return ret, nil
+}
+
+// Snapshot atomically reads the journal length along with the counters at
+// path for each of the keys.
+func (l *Ledger) Snapshot(ctx context.Context, journal, path string, keys ...string) (int64, []int64, error) {
+	var length *redis.IntCmd
+	gets := make([]*redis.StringCmd, len(keys))
+
+	_, err := l.counter.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		length = pipe.LLen(ctx, l.journalKey(journal))
+		for i, k := range keys {
+			gets[i] = pipe.Get(ctx, l.counter.key(k, path))
+		}
+		return nil
+	})
+	if err != nil && err != redis.Nil {
+		return 0, nil, err
+	}
+
+	balances := make([]int64, len(keys))
+	for i, g := range gets {
+		v, err := g.Int64()
+		if err != nil && err != redis.Nil {
+			return 0, nil, err
+		}
+		balances[i] = v
+	}
+	return length.Val(), balances, nil
+}
+
+// Reset sets the counter to the given value if the journal still has the
+// given length, i.e. nothing was posted since the snapshot was taken.
+func (l *Ledger) Reset(ctx context.Context, journal string, length int64, key, path string, value int64) (bool, error) {
+	res, err := resetScript.Run(ctx, l.counter.client,
+		[]string{l.journalKey(journal), l.counter.key(key, path)},
+		strconv.FormatInt(length, 10), value).Int()
+	if err != nil {
+		return false, err
+	}
+	return res == 1, nil
+}
@@ -0,0 +1,177 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func newTestLedger(t *testing.T) (*Ledger, *Counter) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(mr.Close)
+
+	c := &Counter{
+		prefix: Key("test", "counter"),
+		client: redis.NewClient(&redis.Options{Addr: mr.Addr()}),
+	}
+	return NewLedger("test", c), c
+}
+
+func TestLedgerPost(t *testing.T) {
+	l, c := newTestLedger(t)
+	ctx := context.Background()
+
+	credit := []Posting{
+		{Key: "ext", Path: "bal", Amount: -100, Overdraft: true},
+		{Key: "a", Path: "bal", Amount: 100},
+	}
+	if _, _, err := l.Post(ctx, "j", "", "", time.Hour, nil, credit, []byte("1")); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		name     string
+		postings []Posting
+		err      error
+		balance  int64
+	}{
+		{
+			name:     "unbalanced",
+			postings: []Posting{{Key: "a", Path: "bal", Amount: -10}},
+			err:      ErrUnbalanced,
+			balance:  100,
+		},
+		{
+			name: "insufficient funds",
+			postings: []Posting{
+				{Key: "a", Path: "bal", Amount: -101},
+				{Key: "b", Path: "bal", Amount: 101},
+			},
+			err:     ErrInsufficientFunds,
+			balance: 100,
+		},
+		{
+			name: "close with the wrong balance",
+			postings: []Posting{
+				{Key: "a", Path: "bal", Amount: -60, Close: true},
+				{Key: "closing", Path: "bal", Amount: 60, Overdraft: true},
+			},
+			err:     ErrBalanceChanged,
+			balance: 100,
+		},
+		{
+			name: "transfer",
+			postings: []Posting{
+				{Key: "a", Path: "bal", Amount: -60},
+				{Key: "b", Path: "bal", Amount: 60},
+			},
+			balance: 40,
+		},
+		{
+			name: "close",
+			postings: []Posting{
+				{Key: "a", Path: "bal", Amount: -40, Close: true},
+				{Key: "closing", Path: "bal", Amount: 40, Overdraft: true},
+			},
+			balance: 0,
+		},
+	}
+
+	for _, tc := range tcs {
+		_, _, err := l.Post(ctx, "j", "", "", time.Hour, nil, tc.postings, []byte(tc.name))
+		if err != tc.err {
+			t.Fatalf("%s: expected error %v, got %v", tc.name, tc.err, err)
+		}
+		bal, err := c.Read(ctx, "a", "bal")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bal != tc.balance {
+			t.Fatalf("%s: expected balance %d, got %d", tc.name, tc.balance, bal)
+		}
+	}
+
+	// only the applied entries are journaled
+	if n, err := l.Len(ctx, "j"); err != nil || n != 3 {
+		t.Fatalf("Expected 3 journal entries, got %d %v", n, err)
+	}
+}
+
+func TestLedgerIdempotency(t *testing.T) {
+	l, c := newTestLedger(t)
+	ctx := context.Background()
+
+	credit := []Posting{
+		{Key: "ext", Path: "bal", Amount: -100, Overdraft: true},
+		{Key: "a", Path: "bal", Amount: 100},
+	}
+
+	stored, replayed, err := l.Post(ctx, "j", "key", "credit", time.Hour, nil, credit, []byte("first"))
+	if err != nil || replayed || string(stored) != "first" {
+		t.Fatalf("Unexpected first post %s %v %v", stored, replayed, err)
+	}
+
+	// a retry returns the original entry without applying it again
+	stored, replayed, err = l.Post(ctx, "j", "key", "credit", time.Hour, nil, credit, []byte("second"))
+	if err != nil || !replayed || string(stored) != "first" {
+		t.Fatalf("Unexpected retry %s %v %v", stored, replayed, err)
+	}
+
+	// the same key can't be reused for another request
+	if _, _, err := l.Post(ctx, "j", "key", "debit", time.Hour, nil, credit, []byte("third")); err != ErrIdempotencyReused {
+		t.Fatalf("Expected ErrIdempotencyReused, got %v", err)
+	}
+
+	if bal, _ := c.Read(ctx, "a", "bal"); bal != 100 {
+		t.Fatalf("Expected balance 100, got %d", bal)
+	}
+	if n, _ := l.Len(ctx, "j"); n != 1 {
+		t.Fatalf("Expected 1 journal entry, got %d", n)
+	}
+}
+
+func TestLedgerGuard(t *testing.T) {
+	l, c := newTestLedger(t)
+	ctx := context.Background()
+
+	hold := []Posting{
+		{Key: "ext", Path: "bal", Amount: -100, Overdraft: true},
+		{Key: "held", Path: "bal", Amount: 100, Overdraft: true},
+	}
+	if _, _, err := l.Post(ctx, "j", "", "", time.Hour, nil, hold, []byte("hold")); err != nil {
+		t.Fatal(err)
+	}
+
+	release := []Posting{
+		{Key: "held", Path: "bal", Amount: -100, Overdraft: true},
+		{Key: "a", Path: "bal", Amount: 100},
+	}
+
+	// a missing status counts as the one required
+	voided := &Guard{Key: "h1", From: "held", To: "voided", TTL: time.Hour}
+	if _, _, err := l.Post(ctx, "j", "", "", time.Hour, voided, release, []byte("void")); err != nil {
+		t.Fatal(err)
+	}
+
+	// releasing again fails long after any idempotency key would be gone
+	expired := &Guard{Key: "h1", From: "held", To: "expired", TTL: time.Hour}
+	if _, _, err := l.Post(ctx, "j", "", "", time.Hour, expired, release, []byte("expire")); err != ErrStatusChanged {
+		t.Fatalf("Expected ErrStatusChanged, got %v", err)
+	}
+
+	if status, err := l.Status(ctx, "j", "h1"); err != nil || status != "voided" {
+		t.Fatalf("Expected status voided, got %q %v", status, err)
+	}
+	if status, err := l.Status(ctx, "j", "h2"); err != nil || status != "" {
+		t.Fatalf("Expected no status, got %q %v", status, err)
+	}
+	if bal, _ := c.Read(ctx, "a", "bal"); bal != 100 {
+		t.Fatalf("Expected balance 100, got %d", bal)
+	}
+}
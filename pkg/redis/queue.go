@@ -0,0 +1,85 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Queues are work queues shared between replicas. Items are ordered by when
+// they become visible, then by their name, and are leased to one consumer at
+// a time until removed or the lease runs out.
+type Queues struct {
+	prefix string
+	client *redis.Client
+}
+
+// claimScript takes the first visible item and hides it until the lease ends
+var claimScript = redis.NewScript(`
+local items = redis.call("ZRANGEBYSCORE", KEYS[1], "-inf", ARGV[1], "LIMIT", 0, 1)
+if #items == 0 then
+	return false
+end
+redis.call("ZADD", KEYS[1], ARGV[2], items[1])
+return items[1]
+`)
+
+func NewQueues(prefix string) *Queues {
+	return &Queues{
+		prefix: Key(prefix, "queue"),
+		client: newClient(),
+	}
+}
+
+func (q *Queues) key(queue string) string {
+	return Key(q.prefix, queue)
+}
+
+// millis is the score of an item visible from the time
+func millis(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+// Push adds the item to the queue, visible from the given time. Items already
+// queued are left as they are.
+func (q *Queues) Push(ctx context.Context, queue, item string, at time.Time) error {
+	return q.client.ZAddNX(ctx, q.key(queue), &redis.Z{Score: float64(millis(at)), Member: item}).Err()
+}
+
+// Claim leases the first visible item to the caller, it returns an empty
+// string if there's none.
+func (q *Queues) Claim(ctx context.Context, queue string, lease time.Duration) (string, error) {
+	now := time.Now()
+	item, err := claimScript.Run(ctx, q.client, []string{q.key(queue)}, millis(now), millis(now.Add(lease))).Text()
+	if err == redis.Nil {
+		return "", nil
+	}
+	return item, err
+}
+
+// Release makes a claimed item visible again straight away
+func (q *Queues) Release(ctx context.Context, queue, item string) error {
+	return q.client.ZAddXX(ctx, q.key(queue), &redis.Z{Score: float64(millis(time.Now())), Member: item}).Err()
+}
+
+// Remove takes the item off the queue once it's been handled
+func (q *Queues) Remove(ctx context.Context, queue, item string) error {
+	return q.client.ZRem(ctx, q.key(queue), item).Err()
+}
+
+// Len returns the number of visible items, claimed ones aren't counted
+func (q *Queues) Len(ctx context.Context, queue string) (int64, error) {
+	return q.client.ZCount(ctx, q.key(queue), "-inf", strconv.FormatInt(millis(time.Now()), 10)).Result()
+}
+
+// Claimed returns the number of items leased to a consumer
+func (q *Queues) Claimed(ctx context.Context, queue string) (int64, error) {
+	return q.client.ZCount(ctx, q.key(queue), "("+strconv.FormatInt(millis(time.Now()), 10), "+inf").Result()
+}
+
+// Delete drops the queue and everything on it
+func (q *Queues) Delete(ctx context.Context, queue string) error {
+	return q.client.Del(ctx, q.key(queue)).Err()
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestQueues(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	q := &Queues{prefix: "test", client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	ctx := context.Background()
+	now := time.Now().Add(-time.Second)
+
+	// items pushed in the same millisecond are ordered by name
+	for _, item := range []string{"b", "a", "c"} {
+		if err := q.Push(ctx, "q", item, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// consumers on different replicas each get a different item
+	var claimed []string
+	for i := 0; i < 4; i++ {
+		item, err := q.Claim(ctx, "q", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		claimed = append(claimed, item)
+	}
+	if claimed[0] != "a" || claimed[1] != "b" || claimed[2] != "c" || claimed[3] != "" {
+		t.Fatalf("Expected a, b, c then nothing, got %v", claimed)
+	}
+	if n, _ := q.Len(ctx, "q"); n != 0 {
+		t.Fatalf("Expected claimed items to be hidden, got %d", n)
+	}
+	if n, _ := q.Claimed(ctx, "q"); n != 3 {
+		t.Fatalf("Expected 3 claimed items, got %d", n)
+	}
+
+	// a failed delivery puts the item back, pushing it again doesn't
+	q.Release(ctx, "q", "b")
+	q.Push(ctx, "q", "c", now)
+	q.Remove(ctx, "q", "a")
+	if item, _ := q.Claim(ctx, "q", time.Minute); item != "b" {
+		t.Fatalf("Expected b to be released, got %q", item)
+	}
+
+	// an expired lease makes the item visible again
+	if item, _ := q.Claim(ctx, "q", -time.Minute); item != "" {
+		t.Fatalf("Expected nothing visible, got %q", item)
+	}
+	q.Push(ctx, "q", "d", now)
+	if item, _ := q.Claim(ctx, "q", -time.Hour); item != "d" {
+		t.Fatalf("Expected d, got %q", item)
+	}
+	if item, _ := q.Claim(ctx, "q", time.Minute); item != "d" {
+		t.Fatalf("Expected d to be claimed again after its lease, got %q", item)
+	}
+
+	q.Delete(ctx, "q")
+	if item, _ := q.Claim(ctx, "q", time.Minute); item != "" {
+		t.Fatalf("Expected an empty queue, got %q", item)
+	}
+}
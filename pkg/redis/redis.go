@@ -32,16 +32,20 @@ func Key(args ...string) string {
 	return strings.Join(args, ":")
 }
 
+func (c *Counter) key(key, path string) string {
+	return fmt.Sprintf("%s:%s:%s", c.prefix, key, path)
+}
+
 func (c *Counter) Incr(ctx context.Context, key, path string, delta int64) (int64, error) {
-	return c.client.IncrBy(ctx, fmt.Sprintf("%s:%s:%s", c.prefix, key, path), delta).Result()
+	return c.client.IncrBy(ctx, c.key(key, path), delta).Result()
 }
 
 func (c *Counter) Decr(ctx context.Context, key, path string, delta int64) (int64, error) {
-	return c.client.DecrBy(ctx, fmt.Sprintf("%s:%s:%s", c.prefix, key, path), delta).Result()
+	return c.client.DecrBy(ctx, c.key(key, path), delta).Result()
 }
 
 func (c *Counter) Read(ctx context.Context, key, path string) (int64, error) {
-	ret, err := c.client.Get(ctx, fmt.Sprintf("%s:%s:%s", c.prefix, key, path)).Int64()
+	ret, err := c.client.Get(ctx, c.key(key, path)).Int64()
 	if err == redis.Nil {
 		return 0, nil
 	}
@@ -49,7 +53,15 @@ func (c *Counter) Read(ctx context.Context, key, path string) (int64, error) {
 }
 
 func (c *Counter) Reset(ctx context.Context, key, path string) error {
-	return c.client.Set(ctx, fmt.Sprintf("%s:%s:%s", c.prefix, key, path), 0, 0).Err()
+	return c.client.Set(ctx, c.key(key, path), 0, 0).Err()
+}
+
+// Remove deletes the counter at the path of the key
+func (c *Counter) Remove(ctx context.Context, key, path string) error {
+	if err := c.client.Del(ctx, c.key(key, path)).Err(); err != nil && err != redis.Nil {
+		return err
+	}
+	return nil
 }
 
 func (c *Counter) Delete(ctx context.Context, key string) error {
@@ -73,6 +85,13 @@ func (c *Counter) Delete(ctx context.Context, key string) error {
 }
 
 func NewCounter(prefix string) *Counter {
+	return &Counter{
+		prefix: Key(prefix, "counter"),
+		client: newClient(),
+	}
+}
+
+func newClient() *redis.Client {
 	var redisConfig Config
 
 	val, err := config.Get("micro.redis")
@@ -104,8 +123,5 @@ func NewCounter(prefix string) *Counter {
 		log.Fatalf("Failed to ping redis: %v", err)
 	}
 
-	return &Counter{
-		prefix: Key(prefix, "counter"),
-		client: rc,
-	}
+	return rc
 }
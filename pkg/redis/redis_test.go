@@ -0,0 +1,41 @@
+package redis
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCounterRemove(t *testing.T) {
+	_, c := newTestLedger(t)
+	ctx := context.Background()
+
+	for _, path := range []string{"upvotes", "views"} {
+		if _, err := c.Incr(ctx, "a", path, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// removing a counter which doesn't exist isn't an error
+	for _, path := range []string{"upvotes", "missing"} {
+		if err := c.Remove(ctx, "a", path); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		path  string
+		count int64
+	}{
+		{"upvotes", 0},
+		{"views", 2},
+	}
+	for _, tc := range tcs {
+		n, err := c.Read(ctx, "a", tc.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != tc.count {
+			t.Errorf("%s = %d, want %d", tc.path, n, tc.count)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package redis
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Schedule is a set of items ordered by when they're due, shared between
+// replicas, e.g. to find what expired without scanning everything.
+type Schedule struct {
+	key    string
+	client *redis.Client
+}
+
+func NewSchedule(prefix, name string) *Schedule {
+	return &Schedule{
+		key:    Key(prefix, "schedule", name),
+		client: newClient(),
+	}
+}
+
+// Add schedules the item, moving it if it's already scheduled
+func (s *Schedule) Add(ctx context.Context, item string, due time.Time) error {
+	return s.client.ZAdd(ctx, s.key, &redis.Z{Score: float64(due.Unix()), Member: item}).Err()
+}
+
+// Remove unschedules the item
+func (s *Schedule) Remove(ctx context.Context, item string) error {
+	return s.client.ZRem(ctx, s.key, item).Err()
+}
+
+// Due returns up to limit items due at or before the time, earliest first
+func (s *Schedule) Due(ctx context.Context, at time.Time, limit int64) ([]string, error) {
+	return s.client.ZRangeByScore(ctx, s.key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   strconv.FormatInt(at.Unix(), 10),
+		Count: limit,
+	}).Result()
+}
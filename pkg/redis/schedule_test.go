@@ -0,0 +1,44 @@
+package redis
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestSchedule(t *testing.T) {
+	mr, err := miniredis.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mr.Close()
+
+	s := &Schedule{key: "test", client: redis.NewClient(&redis.Options{Addr: mr.Addr()})}
+	ctx := context.Background()
+	now := time.Now()
+
+	s.Add(ctx, "c", now.Add(time.Hour))
+	s.Add(ctx, "b", now.Add(-time.Minute))
+	s.Add(ctx, "a", now.Add(-time.Hour))
+
+	due, err := s.Due(ctx, now, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(due) != 2 || due[0] != "a" || due[1] != "b" {
+		t.Fatalf("Expected a and b to be due, got %v", due)
+	}
+
+	if due, _ := s.Due(ctx, now, 1); len(due) != 1 || due[0] != "a" {
+		t.Fatalf("Expected the earliest item, got %v", due)
+	}
+
+	s.Remove(ctx, "a")
+	s.Add(ctx, "b", now.Add(time.Hour))
+	if due, _ := s.Due(ctx, now, 10); len(due) != 0 {
+		t.Fatalf("Expected nothing due, got %v", due)
+	}
+}
@@ -66,6 +66,15 @@ func NewContext(id, issuer, owner string) context.Context {
 	})
 }
 
+// OrDefault returns the tenant or "default" when the context has none
+func OrDefault(ctx context.Context) string {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return "default"
+	}
+	return id
+}
+
 // Get the tenant and default where needed
 func Id(ctx context.Context) string {
 	id, ok := FromContext(ctx)
@@ -12,6 +12,7 @@ import (
 	merrors "github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/logger"
 	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/pkg/auth"
 	"github.com/micro/services/pkg/tenant"
 	pb "github.com/micro/services/secret/proto"
 )
@@ -68,13 +69,51 @@ func (s *Secret) Get(ctx context.Context, req *pb.GetRequest, rsp *pb.GetRespons
 		tnt = "micro"
 	}
 
-	key := path.Join(tnt, req.Key)
+	v, val, err := s.read("secret.get", tnt, req.Key, req.Path)
+	if err != nil {
+		return err
+	}
+
+	// set response values
+	rsp.Key = req.Key
+	rsp.Path = req.Path
+	rsp.Value = string(val)
+	rsp.Created = v.Created.Format(time.RFC3339Nano)
+	rsp.Updated = v.Updated.Format(time.RFC3339Nano)
+
+	return nil
+}
+
+// Resolve lets other services read the secrets of a tenant
+func (s *Secret) Resolve(ctx context.Context, req *pb.ResolveRequest, rsp *pb.ResolveResponse) error {
+	method := "secret.Resolve"
+	if _, err := auth.VerifyMicroAdmin(ctx, method); err != nil {
+		return err
+	}
+
+	if len(req.TenantId) == 0 {
+		return merrors.BadRequest(method, "missing tenant id")
+	}
+
+	_, val, err := s.read(method, req.TenantId, req.Key, req.Path)
+	if err != nil {
+		return err
+	}
+
+	rsp.Value = string(val)
+
+	return nil
+}
+
+// read decrypts the value of a key, or the part of it at path
+func (s *Secret) read(method, tnt, k, p string) (*Value, []byte, error) {
+	key := path.Join(tnt, k)
 
 	rec, err := store.Read(key)
 	if err == store.ErrNotFound {
-		return merrors.NotFound("secret.get", "Not found")
+		return nil, nil, merrors.NotFound(method, "Not found")
 	} else if err != nil {
-		return merrors.BadRequest("secret.get", err.Error())
+		return nil, nil, merrors.BadRequest(method, err.Error())
 	}
 
 	// extract value
@@ -84,20 +123,20 @@ func (s *Secret) Get(ctx context.Context, req *pb.GetRequest, rsp *pb.GetRespons
 	//decode the val
 	dec, err := base64.StdEncoding.DecodeString(v.Data)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	// decrypt it
 	decrypted, err := decrypt(string(dec), []byte(s.Key))
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	var val []byte
 
 	// check path
-	if len(req.Path) > 0 {
-		path := strings.Replace(req.Path, "/", ".", -1)
+	if len(p) > 0 {
+		path := strings.Replace(p, "/", ".", -1)
 		vals := config.NewJSONValues([]byte(decrypted))
 		val = vals.Get(path).Bytes()
 	} else {
@@ -105,14 +144,7 @@ func (s *Secret) Get(ctx context.Context, req *pb.GetRequest, rsp *pb.GetRespons
 		val = []byte(decrypted)
 	}
 
-	// set response values
-	rsp.Key = req.Key
-	rsp.Path = req.Path
-	rsp.Value = string(val)
-	rsp.Created = v.Created.Format(time.RFC3339Nano)
-	rsp.Updated = v.Updated.Format(time.RFC3339Nano)
-
-	return nil
+	return v, val, nil
 }
 
 func (s *Secret) Set(ctx context.Context, req *pb.SetRequest, rsp *pb.SetResponse) error {
@@ -46,6 +46,8 @@ type SecretService interface {
 	Set(ctx context.Context, in *SetRequest, opts ...client.CallOption) (*SetResponse, error)
 	Delete(ctx context.Context, in *DeleteRequest, opts ...client.CallOption) (*DeleteResponse, error)
 	List(ctx context.Context, in *ListRequest, opts ...client.CallOption) (*ListResponse, error)
+	// Get the value of a tenant's secret. Only available to micro services.
+	Resolve(ctx context.Context, in *ResolveRequest, opts ...client.CallOption) (*ResolveResponse, error)
 }
 
 type secretService struct {
@@ -100,6 +102,16 @@ func (c *secretService) List(ctx context.Context, in *ListRequest, opts ...clien
 	return out, nil
 }
 
+func (c *secretService) Resolve(ctx context.Context, in *ResolveRequest, opts ...client.CallOption) (*ResolveResponse, error) {
+	req := c.c.NewRequest(c.name, "Secret.Resolve", in)
+	out := new(ResolveResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Secret service
 
 type SecretHandler interface {
@@ -107,6 +119,8 @@ type SecretHandler interface {
 	Set(context.Context, *SetRequest, *SetResponse) error
 	Delete(context.Context, *DeleteRequest, *DeleteResponse) error
 	List(context.Context, *ListRequest, *ListResponse) error
+	// Get the value of a tenant's secret. Only available to micro services.
+	Resolve(context.Context, *ResolveRequest, *ResolveResponse) error
 }
 
 func RegisterSecretHandler(s server.Server, hdlr SecretHandler, opts ...server.HandlerOption) error {
@@ -115,6 +129,7 @@ func RegisterSecretHandler(s server.Server, hdlr SecretHandler, opts ...server.H
 		Set(ctx context.Context, in *SetRequest, out *SetResponse) error
 		Delete(ctx context.Context, in *DeleteRequest, out *DeleteResponse) error
 		List(ctx context.Context, in *ListRequest, out *ListResponse) error
+		Resolve(ctx context.Context, in *ResolveRequest, out *ResolveResponse) error
 	}
 	type Secret struct {
 		secret
@@ -142,3 +157,7 @@ func (h *secretHandler) Delete(ctx context.Context, in *DeleteRequest, out *Dele
 func (h *secretHandler) List(ctx context.Context, in *ListRequest, out *ListResponse) error {
 	return h.SecretHandler.List(ctx, in, out)
 }
+
+func (h *secretHandler) Resolve(ctx context.Context, in *ResolveRequest, out *ResolveResponse) error {
+	return h.SecretHandler.Resolve(ctx, in, out)
+}
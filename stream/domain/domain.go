@@ -1,23 +1,40 @@
 package domain
 
 import (
+	"context"
 	"errors"
-	"net/url"
+	"fmt"
+	"path"
+	"sort"
 	"strings"
-	"sync"
 	"time"
 
-	"github.com/PuerkitoBio/goquery"
-	"github.com/golang/groupcache/lru"
 	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/events"
+	"github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
 )
 
 const (
 	defaultStream  = "_"
 	maxMessageSize = 512
 	maxMessages    = 1000
-	maxStreams     = 1000
-	streamTTL      = 8.64e13
+
+	// how long messages are kept for by default and at most
+	defaultRetention = 24 * time.Hour
+	maxRetention     = 365 * 24 * time.Hour
+
+	channelPrefix = "channel/"
+	messagePrefix = "message/"
+	// message keys by id for replay
+	messageIdPrefix = "messageid/"
+	eventPrefix     = "stream/"
+)
+
+var (
+	ErrNotFound         = errors.New("not found")
+	ErrInvalidReplay    = errors.New("message to replay from not found")
+	ErrInvalidRetention = errors.New("invalid retention")
 )
 
 type Metadata struct {
@@ -33,40 +50,34 @@ type Metadata struct {
 type Stream struct {
 	Id          string
 	Description string
-	Messages    []*Message
 	Updated     int64
+	// nanoseconds messages are kept for
+	Retention time.Duration
 }
 
 type Message struct {
-	Id       string
-	Text     string
-	Created  int64 `json:",string"`
-	Stream   string
-	Metadata *Metadata
+	Id          string
+	Text        string
+	Created     int64 `json:",string"`
+	Stream      string
+	Metadata    *Metadata
+	Author      *Author
+	Attachments []*Attachment
+	// arbitrary json set by the sender
+	Data map[string]interface{}
 }
 
-type Store struct {
-	Created int64
-	Updates chan *Message
-
-	mtx       sync.RWMutex
-	Streams   *lru.Cache
-	streams   map[string]*Stream
-	metadatas map[string]*Metadata
+type Author struct {
+	Id    string
+	Name  string
+	Image string
 }
 
-var (
-	C = newStore()
-)
-
-func newStore() *Store {
-	return &Store{
-		Created:   time.Now().UnixNano(),
-		Streams:   lru.New(maxStreams),
-		Updates:   make(chan *Message, 100),
-		streams:   make(map[string]*Stream),
-		metadatas: make(map[string]*Metadata),
-	}
+// Attachment is an image or file uploaded with a message
+type Attachment struct {
+	Type string
+	Name string
+	Url  string
 }
 
 func newStream(id, desc string) *Stream {
@@ -74,299 +85,298 @@ func newStream(id, desc string) *Stream {
 		Id:          id,
 		Description: desc,
 		Updated:     time.Now().UnixNano(),
+		Retention:   defaultRetention,
 	}
 }
 
-func newMessage(text, stream string) *Message {
+func NewMessage(text string) *Message {
 	return &Message{
 		Id:      uuid.New().String(),
 		Text:    text,
 		Created: time.Now().UnixNano(),
-		Stream:  stream,
 	}
 }
 
-func getMetadata(uri string) *Metadata {
-	u, err := url.Parse(uri)
-	if err != nil {
-		return nil
-	}
+// messageKey orders the messages of a stream by the time they were created
+func messageKey(stream string, created int64, id string) string {
+	return fmt.Sprintf("%s%s/%019d/%s", messagePrefix, stream, created, id)
+}
 
-	d, err := goquery.NewDocument(u.String())
-	if err != nil {
-		return nil
+func readStream(id string) (*Stream, error) {
+	recs, err := store.Read(channelPrefix+id, store.ReadLimit(1))
+	if err == store.ErrNotFound {
+		return nil, ErrNotFound
+	} else if err != nil {
+		return nil, err
 	}
 
-	g := &Metadata{
-		Created: time.Now().UnixNano(),
+	s := new(Stream)
+	if err := recs[0].Decode(s); err != nil {
+		return nil, err
 	}
+	return s, nil
+}
 
-	for _, node := range d.Find("meta").Nodes {
-		if len(node.Attr) < 2 {
-			continue
-		}
-
-		p := strings.Split(node.Attr[0].Val, ":")
-		if len(p) < 2 || (p[0] != "twitter" && p[0] != "og") {
-			continue
-		}
+func writeStream(s *Stream) error {
+	return store.Write(store.NewRecord(channelPrefix+s.Id, s))
+}
 
-		switch p[1] {
-		case "site_name":
-			g.Site = node.Attr[1].Val
-		case "site":
-			if len(g.Site) == 0 {
-				g.Site = node.Attr[1].Val
-			}
-		case "title":
-			g.Title = node.Attr[1].Val
-		case "description":
-			g.Description = node.Attr[1].Val
-		case "card", "type":
-			g.Type = node.Attr[1].Val
-		case "url":
-			g.Url = node.Attr[1].Val
-		case "image":
-			if len(p) > 2 && p[2] == "src" {
-				g.Image = node.Attr[1].Val
-			} else if len(g.Image) == 0 {
-				g.Image = node.Attr[1].Val
-			}
-		}
-	}
+// writeMessage stores the message until the retention of the stream passes
+func writeMessage(message *Message, retention time.Duration) error {
+	key := messageKey(message.Stream, message.Created, message.Id)
 
-	if len(g.Type) == 0 || len(g.Image) == 0 || len(g.Title) == 0 || len(g.Url) == 0 {
+	// expire from when the message was created
+	expiry := retention - time.Since(time.Unix(0, message.Created))
+	if expiry <= 0 {
 		return nil
 	}
 
-	return g
-}
-
-func (c *Store) CreateStream(name, description string) {
-	c.mtx.Lock()
-	ch, ok := c.streams[name]
-	if ok {
-		ch.Description = description
-	} else {
-		ch = newStream(name, description)
+	rec := store.NewRecord(key, message)
+	rec.Expiry = expiry
+	if err := store.Write(rec); err != nil {
+		return err
 	}
-	c.streams[name] = ch
-	c.mtx.Unlock()
+
+	return store.Write(&store.Record{
+		Key:    path.Join(messageIdPrefix, message.Stream, message.Id),
+		Value:  []byte(key),
+		Expiry: expiry,
+	})
 }
 
-func (c *Store) Metadata(t *Message) {
-	parts := strings.Split(t.Text, " ")
-	for _, part := range parts {
-		g := getMetadata(part)
+// addMetadata stores the link metadata of the first url in the message which has any
+func addMetadata(message *Message, retention time.Duration) {
+	for _, part := range strings.Fields(message.Text) {
+		if !strings.HasPrefix(part, "http://") && !strings.HasPrefix(part, "https://") {
+			continue
+		}
+		g, err := Unfurl(part)
+		if err != nil {
+			logger.Errorf("Error unfurling %v: %v", part, err)
+			continue
+		}
 		if g == nil {
 			continue
 		}
-		c.mtx.Lock()
-		c.metadatas[t.Id] = g
-		c.mtx.Unlock()
+		message.Metadata = g
+		if err := writeMessage(message, retention); err != nil {
+			logger.Errorf("Error writing metadata for message %v: %v", message.Id, err)
+		}
 		return
 	}
 }
 
-func (c *Store) ListStreams() map[string]*Stream {
-	c.mtx.RLock()
-	streams := c.streams
-	c.mtx.RUnlock()
-	return streams
+// readMessages reads the messages with the keys
+func readMessages(keys []string) ([]*Message, error) {
+	var messages []*Message
+	for _, key := range keys {
+		recs, err := store.Read(key, store.ReadLimit(1))
+		if err == store.ErrNotFound {
+			// expired
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		m := new(Message)
+		if err := recs[0].Decode(m); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, nil
 }
 
-func (c *Store) Save(message *Message) {
-	c.mtx.Lock()
-	defer c.mtx.Unlock()
-
-	var stream *Stream
+// messageKeys lists the keys of the stream's messages in the order created
+func messageKeys(stream string) ([]string, error) {
+	keys, err := store.List(store.ListPrefix(messagePrefix + stream + "/"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
 
-	if obj, ok := c.Streams.Get(message.Stream); ok {
-		stream = obj.(*Stream)
-	} else {
-		stream = newStream(message.Stream, "")
-		c.Streams.Add(message.Stream, stream)
+func CreateChannel(name, description string, retention time.Duration) error {
+	if retention < 0 || retention > maxRetention {
+		return ErrInvalidRetention
+	}
+	if retention == 0 {
+		retention = defaultRetention
 	}
 
-	stream.Messages = append(stream.Messages, message)
-	if len(stream.Messages) > maxMessages {
-		stream.Messages = stream.Messages[1:]
+	s, err := readStream(name)
+	if err == ErrNotFound {
+		s = newStream(name, description)
+	} else if err != nil {
+		return err
 	}
-	stream.Updated = time.Now().UnixNano()
-}
 
-func (c *Store) Retrieve(message string, streem string, direction, last, limit int64) []*Message {
-	c.mtx.RLock()
-	defer c.mtx.RUnlock()
+	s.Description = description
+	s.Retention = retention
 
-	var stream *Stream
+	return writeStream(s)
+}
 
-	if message, ok := c.Streams.Get(streem); ok {
-		stream = message.(*Stream)
-	} else {
-		return []*Message{}
+// ListChannels returns the channels with the prefix
+func ListChannels(prefix string) ([]*Stream, error) {
+	recs, err := store.Read(channelPrefix+prefix, store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
 	}
 
-	if len(message) == 0 {
-		var messages []*Message
-
-		if limit <= 0 {
-			return messages
+	var streams []*Stream
+	for _, rec := range recs {
+		s := new(Stream)
+		if err := rec.Decode(s); err != nil {
+			return nil, err
 		}
+		streams = append(streams, s)
+	}
+	return streams, nil
+}
 
-		li := int(limit)
-
-		// go back in time
-		if direction < 0 {
-			for i := len(stream.Messages) - 1; i >= 0; i-- {
-				if len(messages) >= li {
-					return messages
-				}
-
-				message := stream.Messages[i]
+// ListMessages returns the latest messages in the channel in chronological order
+func ListMessages(channel string, limit int64) ([]*Message, error) {
+	if limit <= 0 {
+		limit = 25
+	}
+	if limit > maxMessages {
+		limit = maxMessages
+	}
 
-				if message.Created < last {
-					if g, ok := c.metadatas[message.Id]; ok {
-						tc := *message
-						tc.Metadata = g
-						messages = append(messages, &tc)
-					} else {
-						messages = append(messages, message)
-					}
-				}
-			}
-			return messages
-		}
+	// default stream
+	if len(channel) == 0 {
+		channel = defaultStream
+	}
 
-		start := 0
-		if len(stream.Messages) > li {
-			start = len(stream.Messages) - li
-		}
+	// the latest keys, then in the order created
+	keys, err := store.List(
+		store.ListPrefix(messagePrefix+channel+"/"),
+		store.ListOrder(store.OrderDesc),
+		store.ListLimit(uint(limit)),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+		keys[i], keys[j] = keys[j], keys[i]
+	}
 
-		for i := start; i < len(stream.Messages); i++ {
-			if len(messages) >= li {
-				return messages
-			}
+	return readMessages(keys)
+}
 
-			message := stream.Messages[i]
+// Replay calls fn with each message sent after the message id or since the
+// time in the order sent. Messages are read one at a time as fn returns so
+// replaying a long history doesn't load it all.
+func Replay(channel, messageId string, since time.Time, fn func(*Message) error) error {
+	keys, err := messageKeys(channel)
+	if err != nil {
+		return err
+	}
 
-			if message.Created > last {
-				if g, ok := c.metadatas[message.Id]; ok {
-					tc := *message
-					tc.Metadata = g
-					messages = append(messages, &tc)
-				} else {
-					messages = append(messages, message)
-				}
-			}
+	var start int
+	if len(messageId) > 0 {
+		recs, err := store.Read(path.Join(messageIdPrefix, channel, messageId), store.ReadLimit(1))
+		if err == store.ErrNotFound {
+			return ErrInvalidReplay
+		} else if err != nil {
+			return err
 		}
-		return messages
+		start = sort.SearchStrings(keys, string(recs[0].Value)) + 1
+	} else {
+		start = sort.SearchStrings(keys, messageKey(channel, since.UnixNano(), ""))
+	}
+	if start > len(keys) {
+		start = len(keys)
 	}
 
-	// retrieve one
-	for _, t := range stream.Messages {
-		var messages []*Message
-		if message == t.Id {
-			if g, ok := c.metadatas[t.Id]; ok {
-				tc := *t
-				tc.Metadata = g
-				messages = append(messages, &tc)
-			} else {
-				messages = append(messages, t)
+	for _, key := range keys[start:] {
+		messages, err := readMessages([]string{key})
+		if err != nil {
+			return err
+		}
+		for _, m := range messages {
+			if err := fn(m); err != nil {
+				return err
 			}
-			return messages
 		}
 	}
-
-	return []*Message{}
+	return nil
 }
 
-func (c *Store) Run() {
-	t1 := time.NewTicker(time.Hour)
-	t2 := time.NewTicker(time.Minute)
-	streams := make(map[string]*Stream)
-
-	for {
-		select {
-		case message := <-c.Updates:
-			c.Save(message)
-			ch, ok := streams[message.Stream]
-			if !ok {
-				ch = newStream(message.Stream, "")
-				streams[message.Stream] = ch
-			}
-			ch.Updated = time.Now().UnixNano()
-			streams[message.Stream] = ch
-			go c.Metadata(message)
-		case <-t1.C:
-			now := time.Now().UnixNano()
-			for stream, ch := range streams {
-				if d := now - ch.Updated; d > streamTTL {
-					c.Streams.Remove(stream)
-					delete(streams, stream)
+// Subscribe returns the messages sent to the channel until the context is done
+func Subscribe(ctx context.Context, channel string) (<-chan *Message, error) {
+	// without a group the consumer isn't durable and goes with the subscriber
+	evs, err := events.Consume(eventPrefix+channel, events.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *Message)
+
+	go func() {
+		defer close(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case ev, ok := <-evs:
+				if !ok {
+					return
 				}
-			}
-			c.mtx.Lock()
-			for metadata, g := range c.metadatas {
-				if d := now - g.Created; d > streamTTL {
-					delete(c.metadatas, metadata)
+				m := new(Message)
+				if err := ev.Unmarshal(m); err != nil {
+					logger.Errorf("Error decoding message on %v: %v", channel, err)
+					continue
+				}
+				select {
+				case ch <- m:
+				case <-ctx.Done():
+					return
 				}
 			}
-			c.mtx.Unlock()
-		case <-t2.C:
-			c.mtx.Lock()
-			c.streams = streams
-			c.mtx.Unlock()
 		}
-	}
-}
+	}()
 
-func CreateChannel(name, description string) {
-	C.CreateStream(name, description)
+	return ch, nil
 }
 
-func ListChannels() map[string]*Stream {
-	return C.ListStreams()
-}
-
-func ListMessages(channel string, limit int64) []*Message {
-	message := ""
-	last := int64(0)
-	direction := int64(1)
-
-	if limit <= 0 {
-		limit = 25
-	}
-
+// SendMessage stores the message created with NewMessage and sends it to subscribers
+func SendMessage(channel string, m *Message) error {
 	// default stream
 	if len(channel) == 0 {
 		channel = defaultStream
 	}
 
-	return C.Retrieve(message, channel, direction, last, limit)
-}
+	// default length
+	if len(m.Text) > maxMessageSize {
+		m.Text = m.Text[:maxMessageSize]
+	}
 
-func SendMessage(channel, message string) error {
-	// default stream
-	if len(channel) == 0 {
-		channel = defaultStream
+	// channels are created by sending to them
+	s, err := readStream(channel)
+	if err == ErrNotFound {
+		s = newStream(channel, "")
+	} else if err != nil {
+		return err
 	}
 
-	// default length
-	if len(message) > maxMessageSize {
-		message = message[:maxMessageSize]
+	m.Stream = channel
+
+	if err := writeMessage(m, s.Retention); err != nil {
+		return err
 	}
 
-	select {
-	case C.Updates <- newMessage(message, channel):
-	case <-time.After(time.Second):
-		return errors.New("timed out creating message")
+	s.Updated = m.Created
+	if err := writeStream(s); err != nil {
+		return err
 	}
 
-	return nil
-}
+	if err := events.Publish(eventPrefix+channel, m); err != nil {
+		return err
+	}
+
+	go addMetadata(m, s.Retention)
 
-// TODO: streams per user
-func Setup() {
-	go C.Run()
+	return nil
 }
@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+)
+
+func TestReplay(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+
+	start := time.Now().Add(-time.Hour)
+	var sent []*Message
+	for i := 0; i < 10; i++ {
+		m := &Message{Id: fmt.Sprintf("m%d", i), Text: "hello", Created: start.Add(time.Duration(i) * time.Minute).UnixNano(), Stream: "c"}
+		if err := writeMessage(m, defaultRetention); err != nil {
+			t.Fatal(err)
+		}
+		sent = append(sent, m)
+	}
+
+	stop := errors.New("stop")
+
+	tcs := []struct {
+		name      string
+		messageId string
+		since     time.Time
+		// stop after this many messages, 0 for all
+		stopAt int
+		ids    []string
+		err    error
+	}{
+		{name: "after message", messageId: "m6", ids: []string{"m7", "m8", "m9"}},
+		{name: "after last", messageId: "m9"},
+		{name: "since time", since: time.Unix(0, sent[8].Created), ids: []string{"m8", "m9"}},
+		{name: "since before all", since: start.Add(-time.Minute), stopAt: 2, ids: []string{"m0", "m1"}, err: stop},
+		{name: "unknown message", messageId: "nope", err: ErrInvalidReplay},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			var ids []string
+			err := Replay("c", tc.messageId, tc.since, func(m *Message) error {
+				ids = append(ids, m.Id)
+				if len(ids) == tc.stopAt {
+					return stop
+				}
+				return nil
+			})
+			if err != tc.err {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tc.ids) {
+				t.Errorf("ids = %v, want %v", ids, tc.ids)
+			}
+		})
+	}
+}
+
+func TestListMessages(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		m := &Message{Id: fmt.Sprintf("m%d", i), Text: "hello", Created: start.Add(time.Duration(i) * time.Minute).UnixNano(), Stream: "c"}
+		if err := writeMessage(m, defaultRetention); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a channel named like the start of another
+	if err := writeMessage(&Message{Id: "other", Created: time.Now().UnixNano(), Stream: "c2"}, defaultRetention); err != nil {
+		t.Fatal(err)
+	}
+
+	tcs := []struct {
+		limit int64
+		ids   string
+	}{
+		{3, "[m7 m8 m9]"},
+		{1, "[m9]"},
+		{20, "[m0 m1 m2 m3 m4 m5 m6 m7 m8 m9]"},
+	}
+	for _, tc := range tcs {
+		msgs, err := ListMessages("c", tc.limit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []string
+		for _, m := range msgs {
+			ids = append(ids, m.Id)
+		}
+		if fmt.Sprint(ids) != tc.ids {
+			t.Errorf("limit %d: ids = %v, want %v", tc.limit, ids, tc.ids)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/pkg/network"
+)
+
+const (
+	unfurlPrefix = "unfurl/"
+
+	// how long link metadata is cached for, and links without any
+	unfurlExpiry     = 24 * time.Hour
+	unfurlMissExpiry = time.Hour
+
+	unfurlTimeout = 5 * time.Second
+	// max bytes of a page read for its metadata
+	maxPageSize = 1 << 20
+)
+
+// privateUnfurl is whether a host can't be unfurled
+var privateUnfurl = network.IsPrivateIP
+
+var unfurlClient = &http.Client{
+	Timeout: unfurlTimeout,
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 {
+			return fmt.Errorf("stopped after 10 redirects")
+		}
+		if privateUnfurl(req.URL.Host) {
+			return fmt.Errorf("redirected to a private address")
+		}
+		return nil
+	},
+}
+
+func unfurlKey(uri string) string {
+	return fmt.Sprintf("%s%x", unfurlPrefix, sha256.Sum256([]byte(uri)))
+}
+
+func getMetadata(uri string) *Metadata {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+	if privateUnfurl(u.Host) {
+		return nil
+	}
+
+	rsp, err := unfurlClient.Get(u.String())
+	if err != nil {
+		return nil
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		return nil
+	}
+
+	d, err := goquery.NewDocumentFromReader(io.LimitReader(rsp.Body, maxPageSize))
+	if err != nil {
+		return nil
+	}
+
+	g := &Metadata{
+		Created: time.Now().UnixNano(),
+	}
+
+	for _, node := range d.Find("meta").Nodes {
+		if len(node.Attr) < 2 {
+			continue
+		}
+
+		p := strings.Split(node.Attr[0].Val, ":")
+		if len(p) < 2 || (p[0] != "twitter" && p[0] != "og") {
+			continue
+		}
+
+		switch p[1] {
+		case "site_name":
+			g.Site = node.Attr[1].Val
+		case "site":
+			if len(g.Site) == 0 {
+				g.Site = node.Attr[1].Val
+			}
+		case "title":
+			g.Title = node.Attr[1].Val
+		case "description":
+			g.Description = node.Attr[1].Val
+		case "card", "type":
+			g.Type = node.Attr[1].Val
+		case "url":
+			g.Url = node.Attr[1].Val
+		case "image":
+			if len(p) > 2 && p[2] == "src" {
+				g.Image = node.Attr[1].Val
+			} else if len(g.Image) == 0 {
+				g.Image = node.Attr[1].Val
+			}
+		}
+	}
+
+	if len(g.Type) == 0 || len(g.Image) == 0 || len(g.Title) == 0 || len(g.Url) == 0 {
+		return nil
+	}
+
+	return g
+}
+
+// Unfurl returns the Open Graph or Twitter card metadata of the url, nil if it has none.
+// Results are cached including urls without any metadata.
+func Unfurl(uri string) (*Metadata, error) {
+	key := unfurlKey(uri)
+
+	recs, err := store.Read(key, store.ReadLimit(1))
+	if err == nil {
+		g := new(Metadata)
+		if err := recs[0].Decode(g); err != nil {
+			return nil, err
+		}
+		// cached miss
+		if len(g.Url) == 0 {
+			return nil, nil
+		}
+		return g, nil
+	} else if err != store.ErrNotFound {
+		return nil, err
+	}
+
+	g := getMetadata(uri)
+
+	// misses are cached for less time in case the page changes
+	cached, expiry := g, unfurlExpiry
+	if g == nil {
+		cached, expiry = &Metadata{Created: time.Now().UnixNano()}, unfurlMissExpiry
+	}
+
+	rec := store.NewRecord(key, cached)
+	rec.Expiry = expiry
+	if err := store.Write(rec); err != nil {
+		return nil, err
+	}
+
+	return g, nil
+}
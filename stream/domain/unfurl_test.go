@@ -0,0 +1,82 @@
+package domain
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+	"github.com/micro/services/pkg/network"
+)
+
+const cardPage = `<html><head>
+<meta property="og:type" content="article">
+<meta property="og:title" content="Hello">
+<meta property="og:url" content="https://example.com/hello">
+<meta property="og:image" content="https://example.com/hello.png">
+<meta property="og:site_name" content="Example">
+</head></html>`
+
+func TestUnfurl(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+	privateUnfurl = func(string) bool { return false }
+	defer func() { privateUnfurl = network.IsPrivateIP }()
+
+	var fetches int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		switch r.URL.Path {
+		case "/card":
+			fmt.Fprint(w, cardPage)
+		case "/plain":
+			fmt.Fprint(w, "<html><head><title>plain</title></head></html>")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	tcs := []struct {
+		name    string
+		path    string
+		title   string
+		fetches int32
+	}{
+		{"card", "/card", "Hello", 1},
+		{"cached card", "/card", "Hello", 1},
+		{"no metadata", "/plain", "", 2},
+		{"cached miss", "/plain", "", 2},
+		{"not found", "/missing", "", 3},
+		{"cached not found", "/missing", "", 3},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			g, err := Unfurl(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var title string
+			if g != nil {
+				title = g.Title
+			}
+			if title != tc.title {
+				t.Errorf("title = %q, want %q", title, tc.title)
+			}
+			if n := atomic.LoadInt32(&fetches); n != tc.fetches {
+				t.Errorf("fetched %d times, want %d", n, tc.fetches)
+			}
+		})
+	}
+
+	// private addresses aren't fetched
+	privateUnfurl = network.IsPrivateIP
+	if g, err := Unfurl(srv.URL + "/card?private"); err != nil || g != nil {
+		t.Errorf("got %v %v unfurling a private address", g, err)
+	}
+	if n := atomic.LoadInt32(&fetches); n != 3 {
+		t.Errorf("fetched %d times, want 3", n)
+	}
+}
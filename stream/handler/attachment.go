@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"net/url"
+	"path"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	imagepb "github.com/micro/services/image/proto"
+	spacepb "github.com/micro/services/space/proto"
+	"github.com/micro/services/stream/domain"
+	pb "github.com/micro/services/stream/proto"
+)
+
+const (
+	maxAttachments = 10
+
+	attachmentImage = "image"
+	attachmentFile  = "file"
+)
+
+// upload stores the attachments sent as base64 with the image or space service
+func (s *Stream) upload(ctx context.Context, channel string, attachments []*pb.Attachment) ([]*domain.Attachment, error) {
+	if len(attachments) > maxAttachments {
+		return nil, errors.BadRequest("stream.sendmessage", "at most %d attachments", maxAttachments)
+	}
+
+	var ret []*domain.Attachment
+
+	for _, a := range attachments {
+		if a.Type != attachmentImage && a.Type != attachmentFile {
+			return nil, errors.BadRequest("stream.sendmessage", "attachment type must be image or file")
+		}
+		if len(a.Name) == 0 {
+			return nil, errors.BadRequest("stream.sendmessage", "attachment name is blank")
+		}
+
+		att := &domain.Attachment{Type: a.Type, Name: a.Name, Url: a.Url}
+
+		// already uploaded elsewhere
+		if len(a.Base64) == 0 {
+			u, err := url.Parse(a.Url)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+				return nil, errors.BadRequest("stream.sendmessage", "attachment needs a url or base64 contents")
+			}
+			ret = append(ret, att)
+			continue
+		}
+
+		// unique name so attachments don't overwrite each other
+		name := uuid.New().String() + "-" + path.Base(a.Name)
+
+		switch a.Type {
+		case attachmentImage:
+			rsp, err := s.image.Upload(ctx, &imagepb.UploadRequest{
+				Base64: a.Base64,
+				Name:   name,
+			})
+			if err != nil {
+				logger.Errorf("Error uploading image to %v: %v", channel, err)
+				return nil, errors.InternalServerError("stream.sendmessage", "error uploading image")
+			}
+			att.Url = rsp.Url
+		case attachmentFile:
+			b, err := base64.StdEncoding.DecodeString(a.Base64)
+			if err != nil {
+				return nil, errors.BadRequest("stream.sendmessage", "invalid base64 attachment")
+			}
+			rsp, err := s.space.Create(ctx, &spacepb.CreateRequest{
+				Object:     b,
+				Name:       path.Join("stream", channel, name),
+				Visibility: "public",
+			})
+			if err != nil {
+				logger.Errorf("Error uploading file to %v: %v", channel, err)
+				return nil, errors.InternalServerError("stream.sendmessage", "error uploading file")
+			}
+			att.Url = rsp.Url
+		}
+
+		ret = append(ret, att)
+	}
+
+	return ret, nil
+}
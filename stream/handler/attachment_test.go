@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/micro/micro/v3/service/client"
+	imagepb "github.com/micro/services/image/proto"
+	spacepb "github.com/micro/services/space/proto"
+	pb "github.com/micro/services/stream/proto"
+)
+
+// images uploads images to a fake url
+type images struct {
+	imagepb.ImageService
+}
+
+func (i *images) Upload(ctx context.Context, req *imagepb.UploadRequest, opts ...client.CallOption) (*imagepb.UploadResponse, error) {
+	return &imagepb.UploadResponse{Url: "https://images/" + req.Name}, nil
+}
+
+// space stores files at a fake url
+type space struct {
+	spacepb.SpaceService
+}
+
+func (s *space) Create(ctx context.Context, req *spacepb.CreateRequest, opts ...client.CallOption) (*spacepb.CreateResponse, error) {
+	return &spacepb.CreateResponse{Url: "https://space/" + req.Name}, nil
+}
+
+func TestUpload(t *testing.T) {
+	s := &Stream{image: new(images), space: new(space)}
+	data := base64.StdEncoding.EncodeToString([]byte("hello"))
+
+	tcs := []struct {
+		name        string
+		attachments []*pb.Attachment
+		// prefix of the url of each attachment
+		urls []string
+		err  bool
+	}{
+		{"none", nil, nil, false},
+		{"linked", []*pb.Attachment{{Type: "image", Name: "a.png", Url: "https://example.com/a.png"}}, []string{"https://example.com/a.png"}, false},
+		{"image", []*pb.Attachment{{Type: "image", Name: "a.png", Base64: data}}, []string{"https://images/"}, false},
+		{"file", []*pb.Attachment{{Type: "file", Name: "../a.txt", Base64: data}}, []string{"https://space/stream/general/"}, false},
+		{"both", []*pb.Attachment{{Type: "image", Name: "a.png", Base64: data}, {Type: "file", Name: "a.txt", Base64: data}}, []string{"https://images/", "https://space/"}, false},
+		{"too many", make([]*pb.Attachment, maxAttachments+1), nil, true},
+		{"bad type", []*pb.Attachment{{Type: "video", Name: "a.mp4", Base64: data}}, nil, true},
+		{"no name", []*pb.Attachment{{Type: "image", Base64: data}}, nil, true},
+		{"no contents", []*pb.Attachment{{Type: "file", Name: "a.txt"}}, nil, true},
+		{"bad url", []*pb.Attachment{{Type: "file", Name: "a.txt", Url: "file:///etc/passwd"}}, nil, true},
+		{"bad base64", []*pb.Attachment{{Type: "file", Name: "a.txt", Base64: "%%%"}}, nil, true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := s.upload(context.Background(), "general", tc.attachments)
+			if (err != nil) != tc.err {
+				t.Fatalf("err = %v, want error %v", err, tc.err)
+			}
+			if len(got) != len(tc.urls) {
+				t.Fatalf("got %d attachments, want %d", len(got), len(tc.urls))
+			}
+			for i, a := range got {
+				if !strings.HasPrefix(a.Url, tc.urls[i]) {
+					t.Errorf("url %v, want prefix %v", a.Url, tc.urls[i])
+				}
+				if strings.Contains(a.Url, "..") {
+					t.Errorf("url %v escapes the channel", a.Url)
+				}
+			}
+		})
+	}
+}
@@ -2,21 +2,98 @@ package handler
 
 import (
 	"context"
+	"net/url"
 	"path"
 	"strings"
 	"time"
 
+	"github.com/micro/micro/v3/service"
+	"github.com/micro/micro/v3/service/auth"
 	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+	imagepb "github.com/micro/services/image/proto"
 	"github.com/micro/services/pkg/tenant"
+	spacepb "github.com/micro/services/space/proto"
 	"github.com/micro/services/stream/domain"
 	pb "github.com/micro/services/stream/proto"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
-type Stream struct{}
+const (
+	maxAuthorSize = 256
+	maxDataSize   = 4096
 
-func New() *Stream {
-	domain.Setup()
-	return &Stream{}
+	// allowance for the clocks of the replicas when telling which replayed
+	// messages the subscriber may also receive
+	replayOverlap = time.Minute
+)
+
+type Stream struct {
+	// used to upload attachments
+	image imagepb.ImageService
+	space spacepb.SpaceService
+}
+
+func New(srv *service.Service) *Stream {
+	return &Stream{
+		image: imagepb.NewImageService("image", srv.Client()),
+		space: spacepb.NewSpaceService("space", srv.Client()),
+	}
+}
+
+// toProto converts a message sent to the channel
+func toProto(channel string, message *domain.Message) *pb.Message {
+	metadata := map[string]string{}
+
+	if message.Metadata != nil {
+		metadata["created"] = time.Unix(0, message.Metadata.Created).Format(time.RFC3339Nano)
+		metadata["title"] = message.Metadata.Title
+		metadata["description"] = message.Metadata.Description
+		metadata["type"] = message.Metadata.Type
+		metadata["image"] = message.Metadata.Image
+		metadata["url"] = message.Metadata.Url
+		metadata["site"] = message.Metadata.Site
+	}
+
+	msg := &pb.Message{
+		Id:        message.Id,
+		Text:      message.Text,
+		Timestamp: time.Unix(0, message.Created).Format(time.RFC3339Nano),
+		Channel:   channel,
+		Metadata:  metadata,
+	}
+
+	if message.Author != nil {
+		msg.Author = &pb.Author{
+			Id:    message.Author.Id,
+			Name:  message.Author.Name,
+			Image: message.Author.Image,
+		}
+	}
+
+	for _, a := range message.Attachments {
+		msg.Attachments = append(msg.Attachments, &pb.Attachment{
+			Type: a.Type,
+			Name: a.Name,
+			Url:  a.Url,
+		})
+	}
+
+	if message.Data != nil {
+		data, err := structpb.NewStruct(message.Data)
+		if err != nil {
+			logger.Errorf("Error converting data of message %v: %v", message.Id, err)
+		}
+		msg.Data = data
+	}
+
+	return msg
+}
+
+// validChannel returns whether the name is a single level of the tenant's
+// channels, so it can't list the messages of another or reach outside them
+func validChannel(name string) bool {
+	return len(name) > 0 && !strings.Contains(name, "/") && !strings.Contains(name, "..") && name != "."
 }
 
 func (s *Stream) CreateChannel(ctx context.Context, req *pb.CreateChannelRequest, rsp *pb.CreateChannelResponse) error {
@@ -29,8 +106,16 @@ func (s *Stream) CreateChannel(ctx context.Context, req *pb.CreateChannelRequest
 	if len(req.Name) == 0 {
 		return errors.BadRequest("stream.createchannel", "name is blank")
 	}
+	if !validChannel(req.Name) {
+		return errors.BadRequest("stream.createchannel", "name can't contain / or ..")
+	}
 
-	domain.CreateChannel(path.Join(id, req.Name), req.Description)
+	if err := domain.CreateChannel(path.Join(id, req.Name), req.Description, time.Duration(req.Retention)*time.Second); err == domain.ErrInvalidRetention {
+		return errors.BadRequest("stream.createchannel", "retention must be at most a year")
+	} else if err != nil {
+		logger.Errorf("Error creating channel %v: %v", req.Name, err)
+		return errors.InternalServerError("stream.createchannel", "error creating channel")
+	}
 
 	return nil
 }
@@ -39,7 +124,10 @@ func (s *Stream) SendMessage(ctx context.Context, req *pb.SendMessageRequest, rs
 	if len(req.Channel) == 0 {
 		return errors.BadRequest("stream.sendmessage", "channel is blank")
 	}
-	if len(req.Text) == 0 {
+	if !validChannel(req.Channel) {
+		return errors.BadRequest("stream.sendmessage", "channel can't contain / or ..")
+	}
+	if len(req.Text) == 0 && len(req.Attachments) == 0 {
 		return errors.BadRequest("stream.sendmessage", "message is blank")
 	}
 
@@ -52,17 +140,60 @@ func (s *Stream) SendMessage(ctx context.Context, req *pb.SendMessageRequest, rs
 	// create tenant based channels
 	channel := path.Join(id, req.Channel)
 
+	message := domain.NewMessage(req.Text)
+
+	// the author defaults to the account sending the message
+	author := req.Author
+	if author == nil {
+		author = new(pb.Author)
+	}
+	if len(author.Id) == 0 {
+		if acc, ok := auth.AccountFromContext(ctx); ok {
+			author.Id = acc.ID
+		}
+	}
+	if len(author.Id)+len(author.Name)+len(author.Image) > maxAuthorSize {
+		return errors.BadRequest("stream.sendmessage", "author is too long")
+	}
+	if len(author.Id) > 0 || len(author.Name) > 0 {
+		message.Author = &domain.Author{
+			Id:    author.Id,
+			Name:  author.Name,
+			Image: author.Image,
+		}
+	}
+
+	if req.Data != nil {
+		b, err := req.Data.MarshalJSON()
+		if err != nil || len(b) > maxDataSize {
+			return errors.BadRequest("stream.sendmessage", "data must be json up to %d bytes", maxDataSize)
+		}
+		message.Data = req.Data.AsMap()
+	}
+
+	attachments, err := s.upload(ctx, req.Channel, req.Attachments)
+	if err != nil {
+		return err
+	}
+	message.Attachments = attachments
+
 	// sendmessage the message
-	if err := domain.SendMessage(channel, req.Text); err != nil {
-		return errors.InternalServerError("stream.sendmessage", err.Error())
+	if err := domain.SendMessage(channel, message); err != nil {
+		logger.Errorf("Error sending message to %v: %v", channel, err)
+		return errors.InternalServerError("stream.sendmessage", "error sending message")
 	}
 
+	rsp.Message = toProto(req.Channel, message)
+
 	return nil
 }
 
 func (s *Stream) ListMessages(ctx context.Context, req *pb.ListMessagesRequest, rsp *pb.ListMessagesResponse) error {
 	if len(req.Channel) == 0 {
-		return errors.BadRequest("stream.sendmessage", "channel is blank")
+		return errors.BadRequest("stream.listmessages", "channel is blank")
+	}
+	if !validChannel(req.Channel) {
+		return errors.BadRequest("stream.listmessages", "channel can't contain / or ..")
 	}
 	if req.Limit <= 0 {
 		req.Limit = 25
@@ -77,26 +208,14 @@ func (s *Stream) ListMessages(ctx context.Context, req *pb.ListMessagesRequest,
 	channel := path.Join(id, req.Channel)
 	rsp.Channel = req.Channel
 
-	for _, message := range domain.ListMessages(channel, int64(req.Limit)) {
-		metadata := map[string]string{}
-
-		if message.Metadata != nil {
-			metadata["created"] = time.Unix(0, message.Metadata.Created).Format(time.RFC3339Nano)
-			metadata["title"] = message.Metadata.Title
-			metadata["description"] = message.Metadata.Description
-			metadata["type"] = message.Metadata.Type
-			metadata["image"] = message.Metadata.Image
-			metadata["url"] = message.Metadata.Url
-			metadata["site"] = message.Metadata.Site
-		}
+	messages, err := domain.ListMessages(channel, int64(req.Limit))
+	if err != nil {
+		logger.Errorf("Error listing messages for %v: %v", channel, err)
+		return errors.InternalServerError("stream.listmessages", "error listing messages")
+	}
 
-		rsp.Messages = append(rsp.Messages, &pb.Message{
-			Id:        message.Id,
-			Text:      message.Text,
-			Timestamp: time.Unix(0, message.Created).Format(time.RFC3339Nano),
-			Channel:   req.Channel,
-			Metadata:  metadata,
-		})
+	for _, message := range messages {
+		rsp.Messages = append(rsp.Messages, toProto(req.Channel, message))
 	}
 
 	return nil
@@ -109,19 +228,114 @@ func (s *Stream) ListChannels(ctx context.Context, req *pb.ListChannelsRequest,
 		id = "default"
 	}
 
-	for _, channel := range domain.ListChannels() {
-		if !strings.HasPrefix(channel.Id, id+"/") {
-			continue
-		}
+	channels, err := domain.ListChannels(id + "/")
+	if err != nil {
+		logger.Errorf("Error listing channels: %v", err)
+		return errors.InternalServerError("stream.listchannels", "error listing channels")
+	}
 
+	for _, channel := range channels {
 		name := strings.TrimPrefix(channel.Id, id+"/")
 
 		rsp.Channels = append(rsp.Channels, &pb.Channel{
 			Name:        name,
 			Description: channel.Description,
 			LastActive:  time.Unix(0, channel.Updated).Format(time.RFC3339Nano),
+			Retention:   int64(channel.Retention / time.Second),
 		})
 	}
 
 	return nil
 }
+
+func (s *Stream) Subscribe(ctx context.Context, req *pb.SubscribeRequest, stream pb.Stream_SubscribeStream) error {
+	if len(req.Channel) == 0 {
+		return errors.BadRequest("stream.subscribe", "channel is blank")
+	}
+	if !validChannel(req.Channel) {
+		return errors.BadRequest("stream.subscribe", "channel can't contain / or ..")
+	}
+
+	var since time.Time
+	if len(req.Timestamp) > 0 {
+		t, err := time.Parse(time.RFC3339Nano, req.Timestamp)
+		if err != nil {
+			return errors.BadRequest("stream.subscribe", "invalid timestamp")
+		}
+		since = t
+	}
+
+	id, ok := tenant.FromContext(ctx)
+	if !ok {
+		id = "default"
+	}
+
+	// create tenant based channels
+	channel := path.Join(id, req.Channel)
+
+	// subscribe before replaying so no messages are missed in between
+	subscribed := time.Now().Add(-replayOverlap)
+	messages, err := domain.Subscribe(ctx, channel)
+	if err != nil {
+		logger.Errorf("Error subscribing to %v: %v", channel, err)
+		return errors.InternalServerError("stream.subscribe", "error subscribing")
+	}
+
+	// messages sent since subscribing which the replay already sent
+	replayed := map[string]bool{}
+
+	if len(req.MessageId) > 0 || !since.IsZero() {
+		var sendErr error
+		err := domain.Replay(channel, req.MessageId, since, func(message *domain.Message) error {
+			if message.Created >= subscribed.UnixNano() {
+				replayed[message.Id] = true
+			}
+			sendErr = stream.Send(&pb.SubscribeResponse{Message: toProto(req.Channel, message)})
+			return sendErr
+		})
+		if sendErr != nil {
+			return nil
+		} else if err == domain.ErrInvalidReplay {
+			return errors.BadRequest("stream.subscribe", "message not found")
+		} else if err != nil {
+			logger.Errorf("Error replaying %v: %v", channel, err)
+			return errors.InternalServerError("stream.subscribe", "error replaying messages")
+		}
+	}
+
+	for message := range messages {
+		if replayed[message.Id] {
+			continue
+		}
+		if err := stream.Send(&pb.SubscribeResponse{Message: toProto(req.Channel, message)}); err != nil {
+			return nil
+		}
+	}
+
+	return nil
+}
+
+func (s *Stream) Unfurl(ctx context.Context, req *pb.UnfurlRequest, rsp *pb.UnfurlResponse) error {
+	u, err := url.Parse(req.Url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return errors.BadRequest("stream.unfurl", "invalid url")
+	}
+
+	g, err := domain.Unfurl(u.String())
+	if err != nil {
+		logger.Errorf("Error unfurling %v: %v", req.Url, err)
+		return errors.InternalServerError("stream.unfurl", "error unfurling url")
+	}
+	if g == nil {
+		return errors.NotFound("stream.unfurl", "no preview found")
+	}
+
+	rsp.Title = g.Title
+	rsp.Description = g.Description
+	rsp.Type = g.Type
+	rsp.Image = g.Image
+	rsp.Url = g.Url
+	rsp.Site = g.Site
+
+	return nil
+}
@@ -0,0 +1,24 @@
+package handler
+
+import "testing"
+
+func TestValidChannel(t *testing.T) {
+	tcs := []struct {
+		name  string
+		valid bool
+	}{
+		{"general", true},
+		{"dev.ops", true},
+		{"", false},
+		{"foo/bar", false},
+		{"..", false},
+		{".", false},
+		{"a..b", false},
+		{"../other", false},
+	}
+	for _, tc := range tcs {
+		if got := validChannel(tc.name); got != tc.valid {
+			t.Errorf("validChannel(%q) = %v, want %v", tc.name, got, tc.valid)
+		}
+	}
+}
@@ -15,7 +15,7 @@ func main() {
 	)
 
 	// Register handler
-	pb.RegisterStreamHandler(srv.Server(), handler.New())
+	pb.RegisterStreamHandler(srv.Server(), handler.New(srv))
 
 	// Run service
 	if err := srv.Run(); err != nil {
@@ -6,6 +6,7 @@ package stream
 import (
 	fmt "fmt"
 	proto "github.com/golang/protobuf/proto"
+	_ "google.golang.org/protobuf/types/known/structpb"
 	math "math"
 )
 
@@ -46,6 +47,8 @@ type StreamService interface {
 	SendMessage(ctx context.Context, in *SendMessageRequest, opts ...client.CallOption) (*SendMessageResponse, error)
 	ListMessages(ctx context.Context, in *ListMessagesRequest, opts ...client.CallOption) (*ListMessagesResponse, error)
 	ListChannels(ctx context.Context, in *ListChannelsRequest, opts ...client.CallOption) (*ListChannelsResponse, error)
+	Subscribe(ctx context.Context, in *SubscribeRequest, opts ...client.CallOption) (Stream_SubscribeService, error)
+	Unfurl(ctx context.Context, in *UnfurlRequest, opts ...client.CallOption) (*UnfurlResponse, error)
 }
 
 type streamService struct {
@@ -100,6 +103,65 @@ func (c *streamService) ListChannels(ctx context.Context, in *ListChannelsReques
 	return out, nil
 }
 
+func (c *streamService) Subscribe(ctx context.Context, in *SubscribeRequest, opts ...client.CallOption) (Stream_SubscribeService, error) {
+	req := c.c.NewRequest(c.name, "Stream.Subscribe", &SubscribeRequest{})
+	stream, err := c.c.Stream(ctx, req, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.Send(in); err != nil {
+		return nil, err
+	}
+	return &streamServiceSubscribe{stream}, nil
+}
+
+type Stream_SubscribeService interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Recv() (*SubscribeResponse, error)
+}
+
+type streamServiceSubscribe struct {
+	stream client.Stream
+}
+
+func (x *streamServiceSubscribe) Close() error {
+	return x.stream.Close()
+}
+
+func (x *streamServiceSubscribe) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *streamServiceSubscribe) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *streamServiceSubscribe) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *streamServiceSubscribe) Recv() (*SubscribeResponse, error) {
+	m := new(SubscribeResponse)
+	err := x.stream.Recv(m)
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *streamService) Unfurl(ctx context.Context, in *UnfurlRequest, opts ...client.CallOption) (*UnfurlResponse, error) {
+	req := c.c.NewRequest(c.name, "Stream.Unfurl", in)
+	out := new(UnfurlResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Stream service
 
 type StreamHandler interface {
@@ -107,6 +169,8 @@ type StreamHandler interface {
 	SendMessage(context.Context, *SendMessageRequest, *SendMessageResponse) error
 	ListMessages(context.Context, *ListMessagesRequest, *ListMessagesResponse) error
 	ListChannels(context.Context, *ListChannelsRequest, *ListChannelsResponse) error
+	Subscribe(context.Context, *SubscribeRequest, Stream_SubscribeStream) error
+	Unfurl(context.Context, *UnfurlRequest, *UnfurlResponse) error
 }
 
 func RegisterStreamHandler(s server.Server, hdlr StreamHandler, opts ...server.HandlerOption) error {
@@ -115,6 +179,8 @@ func RegisterStreamHandler(s server.Server, hdlr StreamHandler, opts ...server.H
 		SendMessage(ctx context.Context, in *SendMessageRequest, out *SendMessageResponse) error
 		ListMessages(ctx context.Context, in *ListMessagesRequest, out *ListMessagesResponse) error
 		ListChannels(ctx context.Context, in *ListChannelsRequest, out *ListChannelsResponse) error
+		Subscribe(ctx context.Context, stream server.Stream) error
+		Unfurl(ctx context.Context, in *UnfurlRequest, out *UnfurlResponse) error
 	}
 	type Stream struct {
 		stream
@@ -142,3 +208,47 @@ func (h *streamHandler) ListMessages(ctx context.Context, in *ListMessagesReques
 func (h *streamHandler) ListChannels(ctx context.Context, in *ListChannelsRequest, out *ListChannelsResponse) error {
 	return h.StreamHandler.ListChannels(ctx, in, out)
 }
+
+func (h *streamHandler) Subscribe(ctx context.Context, stream server.Stream) error {
+	m := new(SubscribeRequest)
+	if err := stream.Recv(m); err != nil {
+		return err
+	}
+	return h.StreamHandler.Subscribe(ctx, m, &streamSubscribeStream{stream})
+}
+
+type Stream_SubscribeStream interface {
+	Context() context.Context
+	SendMsg(interface{}) error
+	RecvMsg(interface{}) error
+	Close() error
+	Send(*SubscribeResponse) error
+}
+
+type streamSubscribeStream struct {
+	stream server.Stream
+}
+
+func (x *streamSubscribeStream) Close() error {
+	return x.stream.Close()
+}
+
+func (x *streamSubscribeStream) Context() context.Context {
+	return x.stream.Context()
+}
+
+func (x *streamSubscribeStream) SendMsg(m interface{}) error {
+	return x.stream.Send(m)
+}
+
+func (x *streamSubscribeStream) RecvMsg(m interface{}) error {
+	return x.stream.Recv(m)
+}
+
+func (x *streamSubscribeStream) Send(m *SubscribeResponse) error {
+	return x.stream.Send(m)
+}
+
+func (h *streamHandler) Unfurl(ctx context.Context, in *UnfurlRequest, out *UnfurlResponse) error {
+	return h.StreamHandler.Unfurl(ctx, in, out)
+}
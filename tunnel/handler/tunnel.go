@@ -16,6 +16,7 @@ import (
 	"github.com/micro/micro/v3/service/errors"
 	"github.com/micro/micro/v3/service/logger"
 	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/pkg/network"
 	pb "github.com/micro/services/tunnel/proto"
 )
 
@@ -132,7 +133,7 @@ func (e *Tunnel) Send(ctx context.Context, req *pb.SendRequest, rsp *pb.SendResp
 	}
 
 	// check if its a private ip
-	if isPrivateIP(uri.Host) {
+	if network.IsPrivateIP(uri.Host) {
 		logger.Infof("Blocked private host %v", uri.Host)
 		return errors.BadRequest("tunnel.send", "cannot send to private ip")
 	}
@@ -47,19 +47,30 @@ type passwordResetCode struct {
 }
 
 type Domain struct {
-	store      store.Store
-	sengridKey string
-	fromEmail  string
-	verifyUrl  string
+	store         store.Store
+	sengridKey    string
+	fromEmail     string
+	verifyUrl     string
+	sessionExpiry time.Duration
+	// webauthn relying party defaults
+	rpID     string
+	rpOrigin string
+	rpName   string
 }
 
 var (
 	// TODO: use the config to drive this value
 	defaultSender = "noreply@email.m3ocontent.com"
+
+	defaultSessionExpiry = time.Hour * 24 * 7
+
+	// how often a session is written back when it's read
+	sessionTouchInterval = time.Minute
 )
 
 func New(st store.Store) *Domain {
-	var key, email, url string
+	var key, email, url, rpID, rpOrigin, rpName string
+	sessionExpiry := defaultSessionExpiry
 	cfg, err := config.Get("micro.user.sendgrid.api_key")
 	if err == nil {
 		key = cfg.String("")
@@ -72,16 +83,36 @@ func New(st store.Store) *Domain {
 	if err == nil {
 		url = cfg.String("http://localhost:8080/user/VerifyEmail")
 	}
+	cfg, err = config.Get("micro.user.session_expiry")
+	if err == nil {
+		sessionExpiry = cfg.Duration(defaultSessionExpiry)
+	}
+	cfg, err = config.Get("micro.user.webauthn.rp_id")
+	if err == nil {
+		rpID = cfg.String("")
+	}
+	cfg, err = config.Get("micro.user.webauthn.rp_origin")
+	if err == nil {
+		rpOrigin = cfg.String("")
+	}
+	cfg, err = config.Get("micro.user.webauthn.rp_name")
+	if err == nil {
+		rpName = cfg.String("M3O")
+	}
 	if len(key) == 0 {
 		logger.Info("No email key found")
 	} else {
 		logger.Info("Email key found")
 	}
 	return &Domain{
-		sengridKey: key,
-		store:      st,
-		fromEmail:  email,
-		verifyUrl:  url,
+		sengridKey:    key,
+		store:         st,
+		fromEmail:     email,
+		verifyUrl:     url,
+		sessionExpiry: sessionExpiry,
+		rpID:          rpID,
+		rpOrigin:      rpOrigin,
+		rpName:        rpName,
 	}
 }
 
@@ -181,16 +212,43 @@ func (domain *Domain) CreateSession(ctx context.Context, sess *user.Session) err
 	}
 
 	if sess.Expires == 0 {
-		sess.Expires = time.Now().Add(time.Hour * 24 * 7).Unix()
+		sess.Expires = time.Now().Add(domain.sessionExpiry).Unix()
 	}
 
+	if sess.LastSeen == 0 {
+		sess.LastSeen = sess.Created
+	}
+
+	return domain.writeSession(ctx, sess)
+}
+
+// TouchSession marks the session as seen and slides its expiry forward.
+// To save writes the session is only updated once per touch interval.
+func (domain *Domain) TouchSession(ctx context.Context, sess *user.Session) error {
+	now := time.Now()
+	if now.Sub(time.Unix(sess.LastSeen, 0)) < sessionTouchInterval {
+		return nil
+	}
+
+	sess.LastSeen = now.Unix()
+	sess.Expires = now.Add(domain.sessionExpiry).Unix()
+
+	return domain.writeSession(ctx, sess)
+}
+
+// writeSession stores the session under its id and in the user's session index.
+// The records expire along with the session.
+func (domain *Domain) writeSession(ctx context.Context, sess *user.Session) error {
 	val, err := json.Marshal(sess)
 	if err != nil {
 		return err
 	}
+	expiry := time.Until(time.Unix(sess.Expires, 0))
+
 	record := &store.Record{
-		Key:   generateSessionStoreKey(ctx, sess.Id),
-		Value: val,
+		Key:    generateSessionStoreKey(ctx, sess.Id),
+		Value:  val,
+		Expiry: expiry,
 	}
 
 	if err := domain.store.Write(record); err != nil {
@@ -198,15 +256,41 @@ func (domain *Domain) CreateSession(ctx context.Context, sess *user.Session) err
 	}
 
 	record = &store.Record{
-		Key:   generateSessionUserStoreKey(ctx, sess.UserId, sess.Id),
-		Value: val,
+		Key:    generateSessionUserStoreKey(ctx, sess.UserId, sess.Id),
+		Value:  val,
+		Expiry: expiry,
 	}
-	return store.Write(record)
+	return domain.store.Write(record)
+}
+
+// ListSessions returns the unexpired sessions of the user
+func (domain *Domain) ListSessions(ctx context.Context, userID string) ([]*user.Session, error) {
+	recs, err := domain.store.Read(generateSessionUserStoreKey(ctx, userID, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	sessions := make([]*user.Session, 0, len(recs))
+	for _, rec := range recs {
+		sess := &user.Session{}
+		if err := json.Unmarshal(rec.Value, sess); err != nil {
+			return nil, err
+		}
+		if sess.Expires < now {
+			continue
+		}
+		sessions = append(sessions, sess)
+	}
+	return sessions, nil
 }
 
 func (domain *Domain) DeleteSession(ctx context.Context, id string) error {
 	sessKey := generateSessionStoreKey(ctx, id)
 	recs, err := domain.store.Read(sessKey)
+	if err == store.ErrNotFound {
+		return ErrNotFound
+	}
 	if err != nil {
 		return err
 	}
@@ -295,6 +379,9 @@ func (domain *Domain) CreateToken(ctx context.Context, email, token string) erro
 
 func (domain *Domain) ReadSession(ctx context.Context, id string) (*user.Session, error) {
 	records, err := domain.store.Read(generateSessionStoreKey(ctx, id))
+	if err == store.ErrNotFound {
+		return nil, ErrNotFound
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -466,8 +553,10 @@ func (domain *Domain) Update(ctx context.Context, user *user.Account) error {
 		keysToDelete = append(keysToDelete, generateAccountUsernameStoreKey(ctx, old.Username))
 	}
 
-	// update user
+	// update user, keeping the roles and groups which are managed separately
 	user.Created = old.Created
+	user.Roles = old.Roles
+	user.Groups = old.Groups
 	user.Updated = time.Now().Unix()
 	val, err := json.Marshal(user)
 	if err != nil {
@@ -497,6 +586,9 @@ func (domain *Domain) Update(ctx context.Context, user *user.Account) error {
 func (domain *Domain) ReadUserByKey(ctx context.Context, key string) (*user.Account, error) {
 	var result = &user.Account{}
 	records, err := domain.store.Read(key)
+	if err == store.ErrNotFound {
+		return result, ErrNotFound
+	}
 	if err != nil {
 		return result, err
 	}
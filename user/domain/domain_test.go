@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/store/memory"
+	user "github.com/micro/services/user/proto"
+)
+
+func newTestDomain() *Domain {
+	return &Domain{store: memory.NewStore(), sessionExpiry: time.Hour}
+}
+
+func TestTouchSession(t *testing.T) {
+	d := newTestDomain()
+	ctx := context.Background()
+	now := time.Now()
+
+	tcs := []struct {
+		name     string
+		lastSeen time.Time
+		touched  bool
+	}{
+		{"just seen", now.Add(-time.Second), false},
+		{"seen a while ago", now.Add(-sessionTouchInterval - time.Second), true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			sess := &user.Session{Id: tc.name, UserId: "u", LastSeen: tc.lastSeen.Unix(), Expires: now.Add(time.Minute).Unix()}
+			if err := d.CreateSession(ctx, sess); err != nil {
+				t.Fatal(err)
+			}
+			expires := sess.Expires
+
+			if err := d.TouchSession(ctx, sess); err != nil {
+				t.Fatal(err)
+			}
+			stored, err := d.ReadSession(ctx, sess.Id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if touched := stored.Expires > expires; touched != tc.touched {
+				t.Errorf("touched = %v, want %v", touched, tc.touched)
+			}
+			if tc.touched && stored.Expires < now.Add(d.sessionExpiry).Unix() {
+				t.Errorf("expiry %v not slid to the session expiry", time.Unix(stored.Expires, 0))
+			}
+		})
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	d := newTestDomain()
+	ctx := context.Background()
+
+	for _, sess := range []*user.Session{
+		{Id: "a", UserId: "alice"},
+		{Id: "b", UserId: "alice", UserAgent: "phone"},
+		{Id: "c", UserId: "bob"},
+	} {
+		if err := d.CreateSession(ctx, sess); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name     string
+		userId   string
+		sessions int
+	}{
+		{"alice", "alice", 2},
+		{"bob", "bob", 1},
+		{"none", "carol", 0},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			sessions, err := d.ListSessions(ctx, tc.userId)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != tc.sessions {
+				t.Fatalf("got %d sessions, want %d", len(sessions), tc.sessions)
+			}
+			for _, sess := range sessions {
+				if sess.UserId != tc.userId {
+					t.Errorf("session %v of %v listed for %v", sess.Id, sess.UserId, tc.userId)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteSession(t *testing.T) {
+	d := newTestDomain()
+	ctx := context.Background()
+
+	for _, id := range []string{"a", "b"} {
+		if err := d.CreateSession(ctx, &user.Session{Id: id, UserId: "alice"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name     string
+		id       string
+		err      error
+		sessions int
+	}{
+		{"revoke", "a", nil, 1},
+		{"revoked", "a", ErrNotFound, 1},
+		{"missing", "x", ErrNotFound, 1},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := d.DeleteSession(ctx, tc.id); err != tc.err {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if _, err := d.ReadSession(ctx, tc.id); err != ErrNotFound {
+				t.Errorf("session %v readable after revoking", tc.id)
+			}
+			sessions, err := d.ListSessions(ctx, "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(sessions) != tc.sessions {
+				t.Errorf("got %d sessions, want %d", len(sessions), tc.sessions)
+			}
+		})
+	}
+
+	if err := d.DeleteAllSessions(ctx, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.ReadSession(ctx, "b"); err != ErrNotFound {
+		t.Errorf("session b readable after revoking all")
+	}
+}
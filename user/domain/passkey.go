@@ -0,0 +1,129 @@
+package domain
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/micro/micro/v3/service/store"
+
+	user "github.com/micro/services/user/proto"
+)
+
+// Passkey is a webauthn credential registered to an account
+type Passkey struct {
+	Name       string              `json:"name"`
+	Created    int64               `json:"created"`
+	LastUsed   int64               `json:"lastUsed"`
+	Credential webauthn.Credential `json:"credential"`
+}
+
+// Id returns the base64url encoded credential id
+func (p *Passkey) Id() string {
+	return base64.RawURLEncoding.EncodeToString(p.Credential.ID)
+}
+
+// Proto returns the public representation of the passkey
+func (p *Passkey) Proto() *user.Passkey {
+	return &user.Passkey{
+		Id:       p.Id(),
+		Name:     p.Name,
+		Created:  p.Created,
+		LastUsed: p.LastUsed,
+	}
+}
+
+// ErrPasskeysNotConfigured is returned when no relying party is configured
+var ErrPasskeysNotConfigured = errors.New("passkeys are not configured")
+
+// PasskeyCeremony holds the state of a registration or login between its begin and finish calls
+type PasskeyCeremony struct {
+	UserID  string               `json:"userId"`
+	Name    string               `json:"name"`
+	Session webauthn.SessionData `json:"session"`
+}
+
+// WebAuthnConfig returns the configured relying party. It's never taken from
+// a request since the origin is what protects passkeys from phishing.
+func (domain *Domain) WebAuthnConfig() (*webauthn.Config, error) {
+	if len(domain.rpID) == 0 || len(domain.rpOrigin) == 0 {
+		return nil, ErrPasskeysNotConfigured
+	}
+	rpName := domain.rpName
+	if len(rpName) == 0 {
+		rpName = "M3O"
+	}
+	return &webauthn.Config{
+		RPID:          domain.rpID,
+		RPOrigins:     []string{domain.rpOrigin},
+		RPDisplayName: rpName,
+	}, nil
+}
+
+// SavePasskey stores the passkey, replacing any existing one with the same credential id
+func (domain *Domain) SavePasskey(ctx context.Context, userId string, passkey *Passkey) error {
+	val, err := json.Marshal(passkey)
+	if err != nil {
+		return err
+	}
+	return domain.store.Write(&store.Record{
+		Key:   generatePasskeyStoreKey(ctx, userId, passkey.Id()),
+		Value: val,
+	})
+}
+
+// ListPasskeys returns the passkeys registered to the account
+func (domain *Domain) ListPasskeys(ctx context.Context, userId string) ([]*Passkey, error) {
+	records, err := domain.store.Read(generatePasskeyStoreKey(ctx, userId, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	passkeys := make([]*Passkey, 0, len(records))
+	for _, rec := range records {
+		passkey := &Passkey{}
+		if err := json.Unmarshal(rec.Value, passkey); err != nil {
+			return nil, err
+		}
+		passkeys = append(passkeys, passkey)
+	}
+	return passkeys, nil
+}
+
+// SavePasskeyCeremony stores the ceremony state until it expires
+func (domain *Domain) SavePasskeyCeremony(ctx context.Context, id string, ceremony *PasskeyCeremony, expiry time.Duration) error {
+	val, err := json.Marshal(ceremony)
+	if err != nil {
+		return err
+	}
+	return domain.store.Write(&store.Record{
+		Key:    generatePasskeyCeremonyStoreKey(ctx, id),
+		Value:  val,
+		Expiry: expiry,
+	})
+}
+
+// ConsumePasskeyCeremony reads and deletes the ceremony state so it can only be finished once
+func (domain *Domain) ConsumePasskeyCeremony(ctx context.Context, id string) (*PasskeyCeremony, error) {
+	key := generatePasskeyCeremonyStoreKey(ctx, id)
+	records, err := domain.store.Read(key)
+	if err == store.ErrNotFound || (err == nil && len(records) == 0) {
+		return nil, errors.New("passkey session not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := domain.store.Delete(key); err != nil {
+		return nil, err
+	}
+
+	ceremony := &PasskeyCeremony{}
+	if err := json.Unmarshal(records[0].Value, ceremony); err != nil {
+		return nil, err
+	}
+	return ceremony, nil
+}
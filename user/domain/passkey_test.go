@@ -0,0 +1,36 @@
+package domain
+
+import (
+	"testing"
+)
+
+func TestWebAuthnConfig(t *testing.T) {
+	tcs := []struct {
+		name   string
+		domain *Domain
+		rpName string
+		err    error
+	}{
+		{"configured", &Domain{rpID: "example.com", rpOrigin: "https://example.com", rpName: "Example"}, "Example", nil},
+		{"default name", &Domain{rpID: "example.com", rpOrigin: "https://example.com"}, "M3O", nil},
+		{"missing id", &Domain{rpOrigin: "https://example.com"}, "", ErrPasskeysNotConfigured},
+		{"missing origin", &Domain{rpID: "example.com"}, "", ErrPasskeysNotConfigured},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg, err := tc.domain.WebAuthnConfig()
+			if err != tc.err {
+				t.Fatalf("err = %v, want %v", err, tc.err)
+			}
+			if err != nil {
+				return
+			}
+			if cfg.RPID != tc.domain.rpID || len(cfg.RPOrigins) != 1 || cfg.RPOrigins[0] != tc.domain.rpOrigin {
+				t.Errorf("relying party %v %v, want %v %v", cfg.RPID, cfg.RPOrigins, tc.domain.rpID, tc.domain.rpOrigin)
+			}
+			if cfg.RPDisplayName != tc.rpName {
+				t.Errorf("name = %v, want %v", cfg.RPDisplayName, tc.rpName)
+			}
+		})
+	}
+}
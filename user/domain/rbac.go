@@ -0,0 +1,244 @@
+package domain
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+
+	user "github.com/micro/services/user/proto"
+)
+
+// Allowed reports whether the permission grants the action on the resource.
+// A "*" matches anything and a trailing "*" matches any suffix, so
+// "orders/*" allows "orders/123" but not "invoices/123".
+func Allowed(perm *user.Permission, resource, action string) bool {
+	return match(perm.Resource, resource) && match(perm.Action, action)
+}
+
+func match(pattern, value string) bool {
+	if pattern == "*" || pattern == value {
+		return true
+	}
+	if strings.HasSuffix(pattern, "*") {
+		return strings.HasPrefix(value, strings.TrimSuffix(pattern, "*"))
+	}
+	return false
+}
+
+func (domain *Domain) CreateRole(ctx context.Context, role *user.Role) error {
+	role.Created = time.Now().Unix()
+	role.Updated = role.Created
+	return domain.writeRole(ctx, role)
+}
+
+func (domain *Domain) UpdateRole(ctx context.Context, role *user.Role) error {
+	old, err := domain.ReadRole(ctx, role.Id)
+	if err != nil {
+		return err
+	}
+	role.Created = old.Created
+	role.Updated = time.Now().Unix()
+	return domain.writeRole(ctx, role)
+}
+
+func (domain *Domain) writeRole(ctx context.Context, role *user.Role) error {
+	val, err := json.Marshal(role)
+	if err != nil {
+		return err
+	}
+	return domain.store.Write(&store.Record{
+		Key:   generateRoleStoreKey(ctx, role.Id),
+		Value: val,
+	})
+}
+
+func (domain *Domain) ReadRole(ctx context.Context, id string) (*user.Role, error) {
+	records, err := domain.store.Read(generateRoleStoreKey(ctx, id))
+	if err == store.ErrNotFound || (err == nil && len(records) == 0) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	role := &user.Role{}
+	if err := json.Unmarshal(records[0].Value, role); err != nil {
+		return nil, err
+	}
+	return role, nil
+}
+
+func (domain *Domain) DeleteRole(ctx context.Context, id string) error {
+	return domain.store.Delete(generateRoleStoreKey(ctx, id))
+}
+
+func (domain *Domain) ListRoles(ctx context.Context) ([]*user.Role, error) {
+	records, err := domain.store.Read(generateRoleStoreKey(ctx, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	roles := make([]*user.Role, 0, len(records))
+	for _, rec := range records {
+		role := &user.Role{}
+		if err := json.Unmarshal(rec.Value, role); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+func (domain *Domain) CreateGroup(ctx context.Context, group *user.Group) error {
+	group.Created = time.Now().Unix()
+	group.Updated = group.Created
+	return domain.writeGroup(ctx, group)
+}
+
+func (domain *Domain) UpdateGroup(ctx context.Context, group *user.Group) error {
+	old, err := domain.ReadGroup(ctx, group.Id)
+	if err != nil {
+		return err
+	}
+	group.Created = old.Created
+	group.Updated = time.Now().Unix()
+	return domain.writeGroup(ctx, group)
+}
+
+func (domain *Domain) writeGroup(ctx context.Context, group *user.Group) error {
+	val, err := json.Marshal(group)
+	if err != nil {
+		return err
+	}
+	return domain.store.Write(&store.Record{
+		Key:   generateGroupStoreKey(ctx, group.Id),
+		Value: val,
+	})
+}
+
+func (domain *Domain) ReadGroup(ctx context.Context, id string) (*user.Group, error) {
+	records, err := domain.store.Read(generateGroupStoreKey(ctx, id))
+	if err == store.ErrNotFound || (err == nil && len(records) == 0) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	group := &user.Group{}
+	if err := json.Unmarshal(records[0].Value, group); err != nil {
+		return nil, err
+	}
+	return group, nil
+}
+
+func (domain *Domain) DeleteGroup(ctx context.Context, id string) error {
+	return domain.store.Delete(generateGroupStoreKey(ctx, id))
+}
+
+func (domain *Domain) ListGroups(ctx context.Context) ([]*user.Group, error) {
+	records, err := domain.store.Read(generateGroupStoreKey(ctx, ""), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	groups := make([]*user.Group, 0, len(records))
+	for _, rec := range records {
+		group := &user.Group{}
+		if err := json.Unmarshal(rec.Value, group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
+
+// UpdateMembership replaces the roles and groups of an account, leaving the
+// rest of the account untouched.
+func (domain *Domain) UpdateMembership(ctx context.Context, userId string, roles, groups []string) error {
+	account, err := domain.Read(ctx, userId)
+	if err != nil {
+		return err
+	}
+
+	account.Roles = roles
+	account.Groups = groups
+	account.Updated = time.Now().Unix()
+
+	val, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	return domain.batchWrite([]*store.Record{
+		{Key: generateAccountStoreKey(ctx, account.Id), Value: val},
+		{Key: generateAccountUsernameStoreKey(ctx, account.Username), Value: val},
+		{Key: generateAccountEmailStoreKey(ctx, account.Email), Value: val},
+	})
+}
+
+// EffectiveRoles returns the ids of the roles held by the account directly
+// or through its groups. Groups which no longer exist are skipped.
+func (domain *Domain) EffectiveRoles(ctx context.Context, account *user.Account) ([]string, error) {
+	seen := map[string]bool{}
+	var roles []string
+
+	add := func(ids []string) {
+		for _, id := range ids {
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			roles = append(roles, id)
+		}
+	}
+
+	add(account.Roles)
+
+	for _, id := range account.Groups {
+		group, err := domain.ReadGroup(ctx, id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		add(group.Roles)
+	}
+
+	return roles, nil
+}
+
+// CheckPermission returns the id of the first role held by the user which
+// allows the action on the resource, or an empty string if none do.
+func (domain *Domain) CheckPermission(ctx context.Context, userId, resource, action string) (string, error) {
+	account, err := domain.Read(ctx, userId)
+	if err != nil {
+		return "", err
+	}
+
+	roles, err := domain.EffectiveRoles(ctx, account)
+	if err != nil {
+		return "", err
+	}
+
+	for _, id := range roles {
+		role, err := domain.ReadRole(ctx, id)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		for _, perm := range role.Permissions {
+			if Allowed(perm, resource, action) {
+				return role.Id, nil
+			}
+		}
+	}
+
+	return "", nil
+}
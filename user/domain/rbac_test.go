@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"testing"
+
+	user "github.com/micro/services/user/proto"
+)
+
+func TestAllowed(t *testing.T) {
+	tcs := []struct {
+		name     string
+		perm     *user.Permission
+		resource string
+		action   string
+		allowed  bool
+	}{
+		{"exact", &user.Permission{Resource: "orders", Action: "read"}, "orders", "read", true},
+		{"wrong action", &user.Permission{Resource: "orders", Action: "read"}, "orders", "write", false},
+		{"wrong resource", &user.Permission{Resource: "orders", Action: "read"}, "invoices", "read", false},
+		{"any action", &user.Permission{Resource: "orders", Action: "*"}, "orders", "delete", true},
+		{"any resource", &user.Permission{Resource: "*", Action: "read"}, "invoices/1", "read", true},
+		{"prefix", &user.Permission{Resource: "orders/*", Action: "read"}, "orders/123", "read", true},
+		{"prefix mismatch", &user.Permission{Resource: "orders/*", Action: "read"}, "invoices/123", "read", false},
+		{"prefix is not parent", &user.Permission{Resource: "orders/*", Action: "read"}, "orders", "read", false},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Allowed(tc.perm, tc.resource, tc.action); got != tc.allowed {
+				t.Errorf("Allowed(%v, %q, %q) = %v, want %v", tc.perm, tc.resource, tc.action, got, tc.allowed)
+			}
+		})
+	}
+}
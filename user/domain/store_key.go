@@ -73,3 +73,19 @@ func generateSessionUserStoreKey(ctx context.Context, userID, sessionID string)
 func generateVerificationTokenStoreKey(token string) string {
 	return fmt.Sprintf("user/verification-token/%s", token)
 }
+
+func generateRoleStoreKey(ctx context.Context, roleId string) string {
+	return fmt.Sprintf("%srole/%s", getStoreKeyPrefix(ctx), roleId)
+}
+
+func generateGroupStoreKey(ctx context.Context, groupId string) string {
+	return fmt.Sprintf("%sgroup/%s", getStoreKeyPrefix(ctx), groupId)
+}
+
+func generatePasskeyStoreKey(ctx context.Context, userId, credentialId string) string {
+	return fmt.Sprintf("%spasskey/%s/%s", getStoreKeyPrefix(ctx), userId, credentialId)
+}
+
+func generatePasskeyCeremonyStoreKey(ctx context.Context, id string) string {
+	return fmt.Sprintf("%spasskey-ceremony/%s", getStoreKeyPrefix(ctx), id)
+}
@@ -363,19 +363,36 @@ func (s *User) Login(ctx context.Context, req *pb.LoginRequest, rsp *pb.LoginRes
 	if err := bcrypt.CompareHashAndPassword(hh, []byte(x+salt+req.Password)); err != nil {
 		return errors.Unauthorized("user.login", err.Error())
 	}
+
 	// save session
+	sess, err := s.createSession(ctx, accounts[0], req.UserAgent, req.Ip)
+	if err != nil {
+		return errors.InternalServerError("user.Login", err.Error())
+	}
+	rsp.Session = sess
+	return nil
+}
+
+// createSession saves a new session for the account, embedding the roles it currently holds
+func (s *User) createSession(ctx context.Context, account *pb.Account, userAgent, ip string) (*pb.Session, error) {
+	roles, err := s.domain.EffectiveRoles(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
 	sess := &pb.Session{
-		Id:      random(128),
-		Created: time.Now().Unix(),
-		Expires: time.Now().Add(time.Hour * 24 * 7).Unix(),
-		UserId:  accounts[0].Id,
+		Id:        random(128),
+		Created:   time.Now().Unix(),
+		UserId:    account.Id,
+		Roles:     roles,
+		UserAgent: userAgent,
+		Ip:        ip,
 	}
 
 	if err := s.domain.CreateSession(ctx, sess); err != nil {
-		return errors.InternalServerError("user.Login", err.Error())
+		return nil, err
 	}
-	rsp.Session = sess
-	return nil
+	return sess, nil
 }
 
 func (s *User) Logout(ctx context.Context, req *pb.LogoutRequest, rsp *pb.LogoutResponse) error {
@@ -394,10 +411,58 @@ func (s *User) ReadSession(ctx context.Context, req *pb.ReadSessionRequest, rsp
 	if err != nil {
 		return err
 	}
+
+	if sess.Expires < time.Now().Unix() {
+		s.domain.DeleteSession(ctx, sess.Id)
+		return errors.Unauthorized("user.ReadSession", "session expired")
+	}
+
+	// sliding expiry
+	if err := s.domain.TouchSession(ctx, sess); err != nil {
+		logger.Errorf("Failed to touch session %s: %v", sess.Id, err)
+	}
+
 	rsp.Session = sess
 	return nil
 }
 
+func (s *User) ListSessions(ctx context.Context, req *pb.ListSessionsRequest, rsp *pb.ListSessionsResponse) error {
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("user.ListSessions", "Missing user_id param")
+	}
+
+	sessions, err := s.domain.ListSessions(ctx, req.UserId)
+	if err != nil {
+		return errors.InternalServerError("user.ListSessions", err.Error())
+	}
+
+	rsp.Sessions = sessions
+	return nil
+}
+
+func (s *User) RevokeSession(ctx context.Context, req *pb.RevokeSessionRequest, rsp *pb.RevokeSessionResponse) error {
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("user.RevokeSession", "Missing user_id param")
+	}
+	if len(req.SessionId) == 0 {
+		return errors.BadRequest("user.RevokeSession", "Missing session_id param")
+	}
+
+	sess, err := s.domain.ReadSession(ctx, req.SessionId)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.RevokeSession", "session not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.RevokeSession", err.Error())
+	}
+
+	// only allow revoking the sessions of the given user
+	if sess.UserId != req.UserId {
+		return errors.NotFound("user.RevokeSession", "session not found")
+	}
+
+	return s.domain.DeleteSession(ctx, sess.Id)
+}
+
 func (s *User) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest, rsp *pb.VerifyEmailResponse) error {
 	if len(req.Token) == 0 {
 		return errors.BadRequest("user.verifytoken", "missing token")
@@ -606,14 +671,8 @@ func (s *User) VerifyToken(ctx context.Context, req *pb.VerifyTokenRequest, rsp
 		return err
 	}
 
-	sess := &pb.Session{
-		Id:      random(128),
-		Created: time.Now().Unix(),
-		Expires: time.Now().Add(time.Hour * 24 * 7).Unix(),
-		UserId:  account.Id,
-	}
-
-	if err := s.domain.CreateSession(ctx, sess); err != nil {
+	sess, err := s.createSession(ctx, account, req.UserAgent, req.Ip)
+	if err != nil {
 		rsp.IsValid = false
 		rsp.Message = "Creation of a new session has failed"
 		return errors.InternalServerError("VerifyToken.createSession", err.Error())
@@ -0,0 +1,306 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/logger"
+
+	"github.com/micro/services/user/domain"
+	pb "github.com/micro/services/user/proto"
+)
+
+const (
+	// how long a user has to complete a passkey registration or login
+	passkeyCeremonyExpiry = time.Minute * 5
+)
+
+// webauthnUser adapts an account and its passkeys to the webauthn library
+type webauthnUser struct {
+	account  *pb.Account
+	passkeys []*domain.Passkey
+}
+
+func (u *webauthnUser) WebAuthnID() []byte {
+	return []byte(u.account.Id)
+}
+
+func (u *webauthnUser) WebAuthnName() string {
+	return u.account.Email
+}
+
+func (u *webauthnUser) WebAuthnDisplayName() string {
+	return u.account.Username
+}
+
+func (u *webauthnUser) WebAuthnIcon() string {
+	return ""
+}
+
+func (u *webauthnUser) WebAuthnCredentials() []webauthn.Credential {
+	creds := make([]webauthn.Credential, len(u.passkeys))
+	for i, p := range u.passkeys {
+		creds[i] = p.Credential
+	}
+	return creds
+}
+
+func (s *User) webauthnUser(ctx context.Context, account *pb.Account) (*webauthnUser, error) {
+	passkeys, err := s.domain.ListPasskeys(ctx, account.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &webauthnUser{account: account, passkeys: passkeys}, nil
+}
+
+// webauthn returns the webauthn library for the configured relying party
+func (s *User) webauthn(method string) (*webauthn.WebAuthn, error) {
+	cfg, err := s.domain.WebAuthnConfig()
+	if err != nil {
+		return nil, errors.InternalServerError(method, err.Error())
+	}
+	wa, err := webauthn.New(cfg)
+	if err != nil {
+		return nil, errors.InternalServerError(method, err.Error())
+	}
+	return wa, nil
+}
+
+func (s *User) BeginPasskeyRegistration(ctx context.Context, req *pb.BeginPasskeyRegistrationRequest, rsp *pb.BeginPasskeyRegistrationResponse) error {
+	method := "user.BeginPasskeyRegistration"
+	if len(req.UserId) == 0 {
+		return errors.BadRequest(method, "Missing user_id param")
+	}
+
+	account, err := s.domain.Read(ctx, req.UserId)
+	if err == domain.ErrNotFound {
+		return errors.NotFound(method, "user not found")
+	} else if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	wa, err := s.webauthn(method)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.webauthnUser(ctx, account)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	// don't register the same authenticator twice
+	var exclude []protocol.CredentialDescriptor
+	for _, cred := range user.WebAuthnCredentials() {
+		exclude = append(exclude, protocol.CredentialDescriptor{
+			Type:         protocol.PublicKeyCredentialType,
+			CredentialID: cred.ID,
+		})
+	}
+
+	options, session, err := wa.BeginRegistration(user, webauthn.WithExclusions(exclude))
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	id := random(64)
+	ceremony := &domain.PasskeyCeremony{
+		UserID:  account.Id,
+		Name:    strings.TrimSpace(req.Name),
+		Session: *session,
+	}
+	if err := s.domain.SavePasskeyCeremony(ctx, id, ceremony, passkeyCeremonyExpiry); err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	rsp.SessionId = id
+	rsp.Options = string(b)
+	return nil
+}
+
+func (s *User) FinishPasskeyRegistration(ctx context.Context, req *pb.FinishPasskeyRegistrationRequest, rsp *pb.FinishPasskeyRegistrationResponse) error {
+	method := "user.FinishPasskeyRegistration"
+	if len(req.SessionId) == 0 {
+		return errors.BadRequest(method, "Missing session_id param")
+	}
+	if len(req.Credential) == 0 {
+		return errors.BadRequest(method, "Missing credential param")
+	}
+
+	ceremony, err := s.domain.ConsumePasskeyCeremony(ctx, req.SessionId)
+	if err != nil {
+		return errors.BadRequest(method, err.Error())
+	}
+
+	account, err := s.domain.Read(ctx, ceremony.UserID)
+	if err == domain.ErrNotFound {
+		return errors.NotFound(method, "user not found")
+	} else if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	wa, err := s.webauthn(method)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBody(bytes.NewReader([]byte(req.Credential)))
+	if err != nil {
+		return errors.BadRequest(method, "invalid credential")
+	}
+
+	user, err := s.webauthnUser(ctx, account)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	cred, err := wa.CreateCredential(user, ceremony.Session, parsed)
+	if err != nil {
+		logger.Errorf("Failed to register passkey for %s: %v", account.Id, err)
+		return errors.BadRequest(method, "invalid credential")
+	}
+
+	passkey := &domain.Passkey{
+		Name:       ceremony.Name,
+		Created:    time.Now().Unix(),
+		Credential: *cred,
+	}
+	if err := s.domain.SavePasskey(ctx, account.Id, passkey); err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	rsp.Passkey = passkey.Proto()
+	return nil
+}
+
+func (s *User) BeginPasskeyLogin(ctx context.Context, req *pb.BeginPasskeyLoginRequest, rsp *pb.BeginPasskeyLoginResponse) error {
+	method := "user.BeginPasskeyLogin"
+	username := strings.ToLower(req.Username)
+	email := strings.ToLower(req.Email)
+	if len(username) == 0 && len(email) == 0 {
+		return errors.BadRequest(method, "Missing username or email param")
+	}
+
+	accounts, err := s.domain.Search(ctx, username, email)
+	if err == domain.ErrNotFound || (err == nil && len(accounts) == 0) {
+		return errors.NotFound(method, "account not found")
+	} else if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	user, err := s.webauthnUser(ctx, accounts[0])
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+	if len(user.passkeys) == 0 {
+		return errors.BadRequest(method, "no passkeys registered")
+	}
+
+	wa, err := s.webauthn(method)
+	if err != nil {
+		return err
+	}
+
+	options, session, err := wa.BeginLogin(user)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	id := random(64)
+	ceremony := &domain.PasskeyCeremony{
+		UserID:  accounts[0].Id,
+		Session: *session,
+	}
+	if err := s.domain.SavePasskeyCeremony(ctx, id, ceremony, passkeyCeremonyExpiry); err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	rsp.SessionId = id
+	rsp.Options = string(b)
+	return nil
+}
+
+func (s *User) FinishPasskeyLogin(ctx context.Context, req *pb.FinishPasskeyLoginRequest, rsp *pb.FinishPasskeyLoginResponse) error {
+	method := "user.FinishPasskeyLogin"
+	if len(req.SessionId) == 0 {
+		return errors.BadRequest(method, "Missing session_id param")
+	}
+	if len(req.Credential) == 0 {
+		return errors.BadRequest(method, "Missing credential param")
+	}
+
+	ceremony, err := s.domain.ConsumePasskeyCeremony(ctx, req.SessionId)
+	if err != nil {
+		return errors.BadRequest(method, err.Error())
+	}
+
+	account, err := s.domain.Read(ctx, ceremony.UserID)
+	if err == domain.ErrNotFound {
+		return errors.Unauthorized(method, "account not found")
+	} else if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	wa, err := s.webauthn(method)
+	if err != nil {
+		return err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBody(bytes.NewReader([]byte(req.Credential)))
+	if err != nil {
+		return errors.BadRequest(method, "invalid credential")
+	}
+
+	user, err := s.webauthnUser(ctx, account)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	cred, err := wa.ValidateLogin(user, ceremony.Session, parsed)
+	if err != nil {
+		return errors.Unauthorized(method, "invalid credential")
+	}
+
+	// a sign counter which didn't increase suggests a cloned authenticator
+	if cred.Authenticator.CloneWarning {
+		logger.Warnf("Passkey sign counter did not increase for user %s", account.Id)
+		return errors.Unauthorized(method, "invalid credential")
+	}
+
+	// store the new sign counter
+	for _, p := range user.passkeys {
+		if !bytes.Equal(p.Credential.ID, cred.ID) {
+			continue
+		}
+		p.Credential = *cred
+		p.LastUsed = time.Now().Unix()
+		if err := s.domain.SavePasskey(ctx, account.Id, p); err != nil {
+			return errors.InternalServerError(method, err.Error())
+		}
+		break
+	}
+
+	sess, err := s.createSession(ctx, account, req.UserAgent, req.Ip)
+	if err != nil {
+		return errors.InternalServerError(method, err.Error())
+	}
+
+	rsp.Session = sess
+	return nil
+}
@@ -0,0 +1,352 @@
+package handler
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+
+	"github.com/micro/services/user/domain"
+	pb "github.com/micro/services/user/proto"
+)
+
+// validatePermissions makes sure every permission names a resource and an action
+func validatePermissions(method string, perms []*pb.Permission) error {
+	for _, p := range perms {
+		p.Resource = strings.TrimSpace(p.Resource)
+		p.Action = strings.TrimSpace(p.Action)
+		if p.Resource == "" || p.Action == "" {
+			return errors.BadRequest(method, "permission requires a resource and action")
+		}
+	}
+	return nil
+}
+
+// validateRoles makes sure the given role ids exist
+func (s *User) validateRoles(ctx context.Context, method string, ids []string) error {
+	for _, id := range ids {
+		_, err := s.domain.ReadRole(ctx, id)
+		if err == domain.ErrNotFound {
+			return errors.BadRequest(method, "role %s not found", id)
+		}
+		if err != nil {
+			return errors.InternalServerError(method, err.Error())
+		}
+	}
+	return nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
+
+func remove(ids []string, id string) []string {
+	var ret []string
+	for _, v := range ids {
+		if v != id {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func (s *User) CreateRole(ctx context.Context, req *pb.CreateRoleRequest, rsp *pb.CreateRoleResponse) error {
+	if len(req.Name) == 0 {
+		return errors.BadRequest("user.CreateRole", "missing name")
+	}
+	if err := validatePermissions("user.CreateRole", req.Permissions); err != nil {
+		return err
+	}
+
+	id := strings.TrimSpace(req.Id)
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	if _, err := s.domain.ReadRole(ctx, id); err == nil {
+		return errors.BadRequest("user.CreateRole", "role already exists")
+	} else if err != domain.ErrNotFound {
+		return errors.InternalServerError("user.CreateRole", err.Error())
+	}
+
+	role := &pb.Role{
+		Id:          id,
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+
+	if err := s.domain.CreateRole(ctx, role); err != nil {
+		return errors.InternalServerError("user.CreateRole", err.Error())
+	}
+
+	rsp.Role = role
+	return nil
+}
+
+func (s *User) ReadRole(ctx context.Context, req *pb.ReadRoleRequest, rsp *pb.ReadRoleResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("user.ReadRole", "missing id")
+	}
+
+	role, err := s.domain.ReadRole(ctx, req.Id)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.ReadRole", "role not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.ReadRole", err.Error())
+	}
+
+	rsp.Role = role
+	return nil
+}
+
+func (s *User) UpdateRole(ctx context.Context, req *pb.UpdateRoleRequest, rsp *pb.UpdateRoleResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("user.UpdateRole", "missing id")
+	}
+	if len(req.Name) == 0 {
+		return errors.BadRequest("user.UpdateRole", "missing name")
+	}
+	if err := validatePermissions("user.UpdateRole", req.Permissions); err != nil {
+		return err
+	}
+
+	role := &pb.Role{
+		Id:          req.Id,
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+
+	err := s.domain.UpdateRole(ctx, role)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.UpdateRole", "role not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.UpdateRole", err.Error())
+	}
+
+	rsp.Role = role
+	return nil
+}
+
+func (s *User) DeleteRole(ctx context.Context, req *pb.DeleteRoleRequest, rsp *pb.DeleteRoleResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("user.DeleteRole", "missing id")
+	}
+	return s.domain.DeleteRole(ctx, req.Id)
+}
+
+func (s *User) ListRoles(ctx context.Context, req *pb.ListRolesRequest, rsp *pb.ListRolesResponse) error {
+	roles, err := s.domain.ListRoles(ctx)
+	if err != nil {
+		return errors.InternalServerError("user.ListRoles", "Error retrieving role list")
+	}
+	rsp.Roles = roles
+	return nil
+}
+
+func (s *User) CreateGroup(ctx context.Context, req *pb.CreateGroupRequest, rsp *pb.CreateGroupResponse) error {
+	if len(req.Name) == 0 {
+		return errors.BadRequest("user.CreateGroup", "missing name")
+	}
+	if err := s.validateRoles(ctx, "user.CreateGroup", req.Roles); err != nil {
+		return err
+	}
+
+	id := strings.TrimSpace(req.Id)
+	if id == "" {
+		id = uuid.New().String()
+	}
+
+	if _, err := s.domain.ReadGroup(ctx, id); err == nil {
+		return errors.BadRequest("user.CreateGroup", "group already exists")
+	} else if err != domain.ErrNotFound {
+		return errors.InternalServerError("user.CreateGroup", err.Error())
+	}
+
+	group := &pb.Group{
+		Id:          id,
+		Name:        req.Name,
+		Description: req.Description,
+		Roles:       req.Roles,
+	}
+
+	if err := s.domain.CreateGroup(ctx, group); err != nil {
+		return errors.InternalServerError("user.CreateGroup", err.Error())
+	}
+
+	rsp.Group = group
+	return nil
+}
+
+func (s *User) ReadGroup(ctx context.Context, req *pb.ReadGroupRequest, rsp *pb.ReadGroupResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("user.ReadGroup", "missing id")
+	}
+
+	group, err := s.domain.ReadGroup(ctx, req.Id)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.ReadGroup", "group not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.ReadGroup", err.Error())
+	}
+
+	rsp.Group = group
+	return nil
+}
+
+func (s *User) UpdateGroup(ctx context.Context, req *pb.UpdateGroupRequest, rsp *pb.UpdateGroupResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("user.UpdateGroup", "missing id")
+	}
+	if len(req.Name) == 0 {
+		return errors.BadRequest("user.UpdateGroup", "missing name")
+	}
+	if err := s.validateRoles(ctx, "user.UpdateGroup", req.Roles); err != nil {
+		return err
+	}
+
+	group := &pb.Group{
+		Id:          req.Id,
+		Name:        req.Name,
+		Description: req.Description,
+		Roles:       req.Roles,
+	}
+
+	err := s.domain.UpdateGroup(ctx, group)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.UpdateGroup", "group not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.UpdateGroup", err.Error())
+	}
+
+	rsp.Group = group
+	return nil
+}
+
+func (s *User) DeleteGroup(ctx context.Context, req *pb.DeleteGroupRequest, rsp *pb.DeleteGroupResponse) error {
+	if len(req.Id) == 0 {
+		return errors.BadRequest("user.DeleteGroup", "missing id")
+	}
+	return s.domain.DeleteGroup(ctx, req.Id)
+}
+
+func (s *User) ListGroups(ctx context.Context, req *pb.ListGroupsRequest, rsp *pb.ListGroupsResponse) error {
+	groups, err := s.domain.ListGroups(ctx)
+	if err != nil {
+		return errors.InternalServerError("user.ListGroups", "Error retrieving group list")
+	}
+	rsp.Groups = groups
+	return nil
+}
+
+func (s *User) AssignRole(ctx context.Context, req *pb.AssignRoleRequest, rsp *pb.AssignRoleResponse) error {
+	if len(req.UserId) == 0 || len(req.RoleId) == 0 {
+		return errors.BadRequest("user.AssignRole", "missing user_id or role_id")
+	}
+	if err := s.validateRoles(ctx, "user.AssignRole", []string{req.RoleId}); err != nil {
+		return err
+	}
+
+	account, err := s.domain.Read(ctx, req.UserId)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.AssignRole", "user not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.AssignRole", err.Error())
+	}
+
+	if contains(account.Roles, req.RoleId) {
+		return nil
+	}
+
+	return s.domain.UpdateMembership(ctx, account.Id, append(account.Roles, req.RoleId), account.Groups)
+}
+
+func (s *User) RevokeRole(ctx context.Context, req *pb.RevokeRoleRequest, rsp *pb.RevokeRoleResponse) error {
+	if len(req.UserId) == 0 || len(req.RoleId) == 0 {
+		return errors.BadRequest("user.RevokeRole", "missing user_id or role_id")
+	}
+
+	account, err := s.domain.Read(ctx, req.UserId)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.RevokeRole", "user not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.RevokeRole", err.Error())
+	}
+
+	if !contains(account.Roles, req.RoleId) {
+		return nil
+	}
+
+	return s.domain.UpdateMembership(ctx, account.Id, remove(account.Roles, req.RoleId), account.Groups)
+}
+
+func (s *User) AddToGroup(ctx context.Context, req *pb.AddToGroupRequest, rsp *pb.AddToGroupResponse) error {
+	if len(req.UserId) == 0 || len(req.GroupId) == 0 {
+		return errors.BadRequest("user.AddToGroup", "missing user_id or group_id")
+	}
+
+	if _, err := s.domain.ReadGroup(ctx, req.GroupId); err == domain.ErrNotFound {
+		return errors.NotFound("user.AddToGroup", "group not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.AddToGroup", err.Error())
+	}
+
+	account, err := s.domain.Read(ctx, req.UserId)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.AddToGroup", "user not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.AddToGroup", err.Error())
+	}
+
+	if contains(account.Groups, req.GroupId) {
+		return nil
+	}
+
+	return s.domain.UpdateMembership(ctx, account.Id, account.Roles, append(account.Groups, req.GroupId))
+}
+
+func (s *User) RemoveFromGroup(ctx context.Context, req *pb.RemoveFromGroupRequest, rsp *pb.RemoveFromGroupResponse) error {
+	if len(req.UserId) == 0 || len(req.GroupId) == 0 {
+		return errors.BadRequest("user.RemoveFromGroup", "missing user_id or group_id")
+	}
+
+	account, err := s.domain.Read(ctx, req.UserId)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.RemoveFromGroup", "user not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.RemoveFromGroup", err.Error())
+	}
+
+	if !contains(account.Groups, req.GroupId) {
+		return nil
+	}
+
+	return s.domain.UpdateMembership(ctx, account.Id, account.Roles, remove(account.Groups, req.GroupId))
+}
+
+func (s *User) CheckPermission(ctx context.Context, req *pb.CheckPermissionRequest, rsp *pb.CheckPermissionResponse) error {
+	if len(req.UserId) == 0 {
+		return errors.BadRequest("user.CheckPermission", "missing user_id")
+	}
+	if len(req.Resource) == 0 || len(req.Action) == 0 {
+		return errors.BadRequest("user.CheckPermission", "missing resource or action")
+	}
+
+	roleId, err := s.domain.CheckPermission(ctx, req.UserId, req.Resource, req.Action)
+	if err == domain.ErrNotFound {
+		return errors.NotFound("user.CheckPermission", "user not found")
+	} else if err != nil {
+		return errors.InternalServerError("user.CheckPermission", err.Error())
+	}
+
+	rsp.Allowed = len(roleId) > 0
+	rsp.RoleId = roleId
+	return nil
+}
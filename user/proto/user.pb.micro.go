@@ -58,6 +58,27 @@ type UserService interface {
 	List(ctx context.Context, in *ListRequest, opts ...client.CallOption) (*ListResponse, error)
 	SendMagicLink(ctx context.Context, in *SendMagicLinkRequest, opts ...client.CallOption) (*SendMagicLinkResponse, error)
 	VerifyToken(ctx context.Context, in *VerifyTokenRequest, opts ...client.CallOption) (*VerifyTokenResponse, error)
+	CreateRole(ctx context.Context, in *CreateRoleRequest, opts ...client.CallOption) (*CreateRoleResponse, error)
+	ReadRole(ctx context.Context, in *ReadRoleRequest, opts ...client.CallOption) (*ReadRoleResponse, error)
+	UpdateRole(ctx context.Context, in *UpdateRoleRequest, opts ...client.CallOption) (*UpdateRoleResponse, error)
+	DeleteRole(ctx context.Context, in *DeleteRoleRequest, opts ...client.CallOption) (*DeleteRoleResponse, error)
+	ListRoles(ctx context.Context, in *ListRolesRequest, opts ...client.CallOption) (*ListRolesResponse, error)
+	CreateGroup(ctx context.Context, in *CreateGroupRequest, opts ...client.CallOption) (*CreateGroupResponse, error)
+	ReadGroup(ctx context.Context, in *ReadGroupRequest, opts ...client.CallOption) (*ReadGroupResponse, error)
+	UpdateGroup(ctx context.Context, in *UpdateGroupRequest, opts ...client.CallOption) (*UpdateGroupResponse, error)
+	DeleteGroup(ctx context.Context, in *DeleteGroupRequest, opts ...client.CallOption) (*DeleteGroupResponse, error)
+	ListGroups(ctx context.Context, in *ListGroupsRequest, opts ...client.CallOption) (*ListGroupsResponse, error)
+	AssignRole(ctx context.Context, in *AssignRoleRequest, opts ...client.CallOption) (*AssignRoleResponse, error)
+	RevokeRole(ctx context.Context, in *RevokeRoleRequest, opts ...client.CallOption) (*RevokeRoleResponse, error)
+	AddToGroup(ctx context.Context, in *AddToGroupRequest, opts ...client.CallOption) (*AddToGroupResponse, error)
+	RemoveFromGroup(ctx context.Context, in *RemoveFromGroupRequest, opts ...client.CallOption) (*RemoveFromGroupResponse, error)
+	CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...client.CallOption) (*CheckPermissionResponse, error)
+	ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...client.CallOption) (*ListSessionsResponse, error)
+	RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...client.CallOption) (*RevokeSessionResponse, error)
+	BeginPasskeyRegistration(ctx context.Context, in *BeginPasskeyRegistrationRequest, opts ...client.CallOption) (*BeginPasskeyRegistrationResponse, error)
+	FinishPasskeyRegistration(ctx context.Context, in *FinishPasskeyRegistrationRequest, opts ...client.CallOption) (*FinishPasskeyRegistrationResponse, error)
+	BeginPasskeyLogin(ctx context.Context, in *BeginPasskeyLoginRequest, opts ...client.CallOption) (*BeginPasskeyLoginResponse, error)
+	FinishPasskeyLogin(ctx context.Context, in *FinishPasskeyLoginRequest, opts ...client.CallOption) (*FinishPasskeyLoginResponse, error)
 }
 
 type userService struct {
@@ -232,6 +253,216 @@ func (c *userService) VerifyToken(ctx context.Context, in *VerifyTokenRequest, o
 	return out, nil
 }
 
+func (c *userService) CreateRole(ctx context.Context, in *CreateRoleRequest, opts ...client.CallOption) (*CreateRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "User.CreateRole", in)
+	out := new(CreateRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) ReadRole(ctx context.Context, in *ReadRoleRequest, opts ...client.CallOption) (*ReadRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "User.ReadRole", in)
+	out := new(ReadRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) UpdateRole(ctx context.Context, in *UpdateRoleRequest, opts ...client.CallOption) (*UpdateRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "User.UpdateRole", in)
+	out := new(UpdateRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) DeleteRole(ctx context.Context, in *DeleteRoleRequest, opts ...client.CallOption) (*DeleteRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "User.DeleteRole", in)
+	out := new(DeleteRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) ListRoles(ctx context.Context, in *ListRolesRequest, opts ...client.CallOption) (*ListRolesResponse, error) {
+	req := c.c.NewRequest(c.name, "User.ListRoles", in)
+	out := new(ListRolesResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) CreateGroup(ctx context.Context, in *CreateGroupRequest, opts ...client.CallOption) (*CreateGroupResponse, error) {
+	req := c.c.NewRequest(c.name, "User.CreateGroup", in)
+	out := new(CreateGroupResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) ReadGroup(ctx context.Context, in *ReadGroupRequest, opts ...client.CallOption) (*ReadGroupResponse, error) {
+	req := c.c.NewRequest(c.name, "User.ReadGroup", in)
+	out := new(ReadGroupResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) UpdateGroup(ctx context.Context, in *UpdateGroupRequest, opts ...client.CallOption) (*UpdateGroupResponse, error) {
+	req := c.c.NewRequest(c.name, "User.UpdateGroup", in)
+	out := new(UpdateGroupResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) DeleteGroup(ctx context.Context, in *DeleteGroupRequest, opts ...client.CallOption) (*DeleteGroupResponse, error) {
+	req := c.c.NewRequest(c.name, "User.DeleteGroup", in)
+	out := new(DeleteGroupResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) ListGroups(ctx context.Context, in *ListGroupsRequest, opts ...client.CallOption) (*ListGroupsResponse, error) {
+	req := c.c.NewRequest(c.name, "User.ListGroups", in)
+	out := new(ListGroupsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) AssignRole(ctx context.Context, in *AssignRoleRequest, opts ...client.CallOption) (*AssignRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "User.AssignRole", in)
+	out := new(AssignRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) RevokeRole(ctx context.Context, in *RevokeRoleRequest, opts ...client.CallOption) (*RevokeRoleResponse, error) {
+	req := c.c.NewRequest(c.name, "User.RevokeRole", in)
+	out := new(RevokeRoleResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) AddToGroup(ctx context.Context, in *AddToGroupRequest, opts ...client.CallOption) (*AddToGroupResponse, error) {
+	req := c.c.NewRequest(c.name, "User.AddToGroup", in)
+	out := new(AddToGroupResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) RemoveFromGroup(ctx context.Context, in *RemoveFromGroupRequest, opts ...client.CallOption) (*RemoveFromGroupResponse, error) {
+	req := c.c.NewRequest(c.name, "User.RemoveFromGroup", in)
+	out := new(RemoveFromGroupResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) CheckPermission(ctx context.Context, in *CheckPermissionRequest, opts ...client.CallOption) (*CheckPermissionResponse, error) {
+	req := c.c.NewRequest(c.name, "User.CheckPermission", in)
+	out := new(CheckPermissionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) ListSessions(ctx context.Context, in *ListSessionsRequest, opts ...client.CallOption) (*ListSessionsResponse, error) {
+	req := c.c.NewRequest(c.name, "User.ListSessions", in)
+	out := new(ListSessionsResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) RevokeSession(ctx context.Context, in *RevokeSessionRequest, opts ...client.CallOption) (*RevokeSessionResponse, error) {
+	req := c.c.NewRequest(c.name, "User.RevokeSession", in)
+	out := new(RevokeSessionResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) BeginPasskeyRegistration(ctx context.Context, in *BeginPasskeyRegistrationRequest, opts ...client.CallOption) (*BeginPasskeyRegistrationResponse, error) {
+	req := c.c.NewRequest(c.name, "User.BeginPasskeyRegistration", in)
+	out := new(BeginPasskeyRegistrationResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) FinishPasskeyRegistration(ctx context.Context, in *FinishPasskeyRegistrationRequest, opts ...client.CallOption) (*FinishPasskeyRegistrationResponse, error) {
+	req := c.c.NewRequest(c.name, "User.FinishPasskeyRegistration", in)
+	out := new(FinishPasskeyRegistrationResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) BeginPasskeyLogin(ctx context.Context, in *BeginPasskeyLoginRequest, opts ...client.CallOption) (*BeginPasskeyLoginResponse, error) {
+	req := c.c.NewRequest(c.name, "User.BeginPasskeyLogin", in)
+	out := new(BeginPasskeyLoginResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *userService) FinishPasskeyLogin(ctx context.Context, in *FinishPasskeyLoginRequest, opts ...client.CallOption) (*FinishPasskeyLoginResponse, error) {
+	req := c.c.NewRequest(c.name, "User.FinishPasskeyLogin", in)
+	out := new(FinishPasskeyLoginResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for User service
 
 type UserHandler interface {
@@ -251,6 +482,27 @@ type UserHandler interface {
 	List(context.Context, *ListRequest, *ListResponse) error
 	SendMagicLink(context.Context, *SendMagicLinkRequest, *SendMagicLinkResponse) error
 	VerifyToken(context.Context, *VerifyTokenRequest, *VerifyTokenResponse) error
+	CreateRole(context.Context, *CreateRoleRequest, *CreateRoleResponse) error
+	ReadRole(context.Context, *ReadRoleRequest, *ReadRoleResponse) error
+	UpdateRole(context.Context, *UpdateRoleRequest, *UpdateRoleResponse) error
+	DeleteRole(context.Context, *DeleteRoleRequest, *DeleteRoleResponse) error
+	ListRoles(context.Context, *ListRolesRequest, *ListRolesResponse) error
+	CreateGroup(context.Context, *CreateGroupRequest, *CreateGroupResponse) error
+	ReadGroup(context.Context, *ReadGroupRequest, *ReadGroupResponse) error
+	UpdateGroup(context.Context, *UpdateGroupRequest, *UpdateGroupResponse) error
+	DeleteGroup(context.Context, *DeleteGroupRequest, *DeleteGroupResponse) error
+	ListGroups(context.Context, *ListGroupsRequest, *ListGroupsResponse) error
+	AssignRole(context.Context, *AssignRoleRequest, *AssignRoleResponse) error
+	RevokeRole(context.Context, *RevokeRoleRequest, *RevokeRoleResponse) error
+	AddToGroup(context.Context, *AddToGroupRequest, *AddToGroupResponse) error
+	RemoveFromGroup(context.Context, *RemoveFromGroupRequest, *RemoveFromGroupResponse) error
+	CheckPermission(context.Context, *CheckPermissionRequest, *CheckPermissionResponse) error
+	ListSessions(context.Context, *ListSessionsRequest, *ListSessionsResponse) error
+	RevokeSession(context.Context, *RevokeSessionRequest, *RevokeSessionResponse) error
+	BeginPasskeyRegistration(context.Context, *BeginPasskeyRegistrationRequest, *BeginPasskeyRegistrationResponse) error
+	FinishPasskeyRegistration(context.Context, *FinishPasskeyRegistrationRequest, *FinishPasskeyRegistrationResponse) error
+	BeginPasskeyLogin(context.Context, *BeginPasskeyLoginRequest, *BeginPasskeyLoginResponse) error
+	FinishPasskeyLogin(context.Context, *FinishPasskeyLoginRequest, *FinishPasskeyLoginResponse) error
 }
 
 func RegisterUserHandler(s server.Server, hdlr UserHandler, opts ...server.HandlerOption) error {
@@ -271,6 +523,27 @@ func RegisterUserHandler(s server.Server, hdlr UserHandler, opts ...server.Handl
 		List(ctx context.Context, in *ListRequest, out *ListResponse) error
 		SendMagicLink(ctx context.Context, in *SendMagicLinkRequest, out *SendMagicLinkResponse) error
 		VerifyToken(ctx context.Context, in *VerifyTokenRequest, out *VerifyTokenResponse) error
+		CreateRole(ctx context.Context, in *CreateRoleRequest, out *CreateRoleResponse) error
+		ReadRole(ctx context.Context, in *ReadRoleRequest, out *ReadRoleResponse) error
+		UpdateRole(ctx context.Context, in *UpdateRoleRequest, out *UpdateRoleResponse) error
+		DeleteRole(ctx context.Context, in *DeleteRoleRequest, out *DeleteRoleResponse) error
+		ListRoles(ctx context.Context, in *ListRolesRequest, out *ListRolesResponse) error
+		CreateGroup(ctx context.Context, in *CreateGroupRequest, out *CreateGroupResponse) error
+		ReadGroup(ctx context.Context, in *ReadGroupRequest, out *ReadGroupResponse) error
+		UpdateGroup(ctx context.Context, in *UpdateGroupRequest, out *UpdateGroupResponse) error
+		DeleteGroup(ctx context.Context, in *DeleteGroupRequest, out *DeleteGroupResponse) error
+		ListGroups(ctx context.Context, in *ListGroupsRequest, out *ListGroupsResponse) error
+		AssignRole(ctx context.Context, in *AssignRoleRequest, out *AssignRoleResponse) error
+		RevokeRole(ctx context.Context, in *RevokeRoleRequest, out *RevokeRoleResponse) error
+		AddToGroup(ctx context.Context, in *AddToGroupRequest, out *AddToGroupResponse) error
+		RemoveFromGroup(ctx context.Context, in *RemoveFromGroupRequest, out *RemoveFromGroupResponse) error
+		CheckPermission(ctx context.Context, in *CheckPermissionRequest, out *CheckPermissionResponse) error
+		ListSessions(ctx context.Context, in *ListSessionsRequest, out *ListSessionsResponse) error
+		RevokeSession(ctx context.Context, in *RevokeSessionRequest, out *RevokeSessionResponse) error
+		BeginPasskeyRegistration(ctx context.Context, in *BeginPasskeyRegistrationRequest, out *BeginPasskeyRegistrationResponse) error
+		FinishPasskeyRegistration(ctx context.Context, in *FinishPasskeyRegistrationRequest, out *FinishPasskeyRegistrationResponse) error
+		BeginPasskeyLogin(ctx context.Context, in *BeginPasskeyLoginRequest, out *BeginPasskeyLoginResponse) error
+		FinishPasskeyLogin(ctx context.Context, in *FinishPasskeyLoginRequest, out *FinishPasskeyLoginResponse) error
 	}
 	type User struct {
 		user
@@ -346,3 +619,87 @@ func (h *userHandler) SendMagicLink(ctx context.Context, in *SendMagicLinkReques
 func (h *userHandler) VerifyToken(ctx context.Context, in *VerifyTokenRequest, out *VerifyTokenResponse) error {
 	return h.UserHandler.VerifyToken(ctx, in, out)
 }
+
+func (h *userHandler) CreateRole(ctx context.Context, in *CreateRoleRequest, out *CreateRoleResponse) error {
+	return h.UserHandler.CreateRole(ctx, in, out)
+}
+
+func (h *userHandler) ReadRole(ctx context.Context, in *ReadRoleRequest, out *ReadRoleResponse) error {
+	return h.UserHandler.ReadRole(ctx, in, out)
+}
+
+func (h *userHandler) UpdateRole(ctx context.Context, in *UpdateRoleRequest, out *UpdateRoleResponse) error {
+	return h.UserHandler.UpdateRole(ctx, in, out)
+}
+
+func (h *userHandler) DeleteRole(ctx context.Context, in *DeleteRoleRequest, out *DeleteRoleResponse) error {
+	return h.UserHandler.DeleteRole(ctx, in, out)
+}
+
+func (h *userHandler) ListRoles(ctx context.Context, in *ListRolesRequest, out *ListRolesResponse) error {
+	return h.UserHandler.ListRoles(ctx, in, out)
+}
+
+func (h *userHandler) CreateGroup(ctx context.Context, in *CreateGroupRequest, out *CreateGroupResponse) error {
+	return h.UserHandler.CreateGroup(ctx, in, out)
+}
+
+func (h *userHandler) ReadGroup(ctx context.Context, in *ReadGroupRequest, out *ReadGroupResponse) error {
+	return h.UserHandler.ReadGroup(ctx, in, out)
+}
+
+func (h *userHandler) UpdateGroup(ctx context.Context, in *UpdateGroupRequest, out *UpdateGroupResponse) error {
+	return h.UserHandler.UpdateGroup(ctx, in, out)
+}
+
+func (h *userHandler) DeleteGroup(ctx context.Context, in *DeleteGroupRequest, out *DeleteGroupResponse) error {
+	return h.UserHandler.DeleteGroup(ctx, in, out)
+}
+
+func (h *userHandler) ListGroups(ctx context.Context, in *ListGroupsRequest, out *ListGroupsResponse) error {
+	return h.UserHandler.ListGroups(ctx, in, out)
+}
+
+func (h *userHandler) AssignRole(ctx context.Context, in *AssignRoleRequest, out *AssignRoleResponse) error {
+	return h.UserHandler.AssignRole(ctx, in, out)
+}
+
+func (h *userHandler) RevokeRole(ctx context.Context, in *RevokeRoleRequest, out *RevokeRoleResponse) error {
+	return h.UserHandler.RevokeRole(ctx, in, out)
+}
+
+func (h *userHandler) AddToGroup(ctx context.Context, in *AddToGroupRequest, out *AddToGroupResponse) error {
+	return h.UserHandler.AddToGroup(ctx, in, out)
+}
+
+func (h *userHandler) RemoveFromGroup(ctx context.Context, in *RemoveFromGroupRequest, out *RemoveFromGroupResponse) error {
+	return h.UserHandler.RemoveFromGroup(ctx, in, out)
+}
+
+func (h *userHandler) CheckPermission(ctx context.Context, in *CheckPermissionRequest, out *CheckPermissionResponse) error {
+	return h.UserHandler.CheckPermission(ctx, in, out)
+}
+
+func (h *userHandler) ListSessions(ctx context.Context, in *ListSessionsRequest, out *ListSessionsResponse) error {
+	return h.UserHandler.ListSessions(ctx, in, out)
+}
+
+func (h *userHandler) RevokeSession(ctx context.Context, in *RevokeSessionRequest, out *RevokeSessionResponse) error {
+	return h.UserHandler.RevokeSession(ctx, in, out)
+}
+
+func (h *userHandler) BeginPasskeyRegistration(ctx context.Context, in *BeginPasskeyRegistrationRequest, out *BeginPasskeyRegistrationResponse) error {
+	return h.UserHandler.BeginPasskeyRegistration(ctx, in, out)
+}
+
+func (h *userHandler) FinishPasskeyRegistration(ctx context.Context, in *FinishPasskeyRegistrationRequest, out *FinishPasskeyRegistrationResponse) error {
+	return h.UserHandler.FinishPasskeyRegistration(ctx, in, out)
+}
+
+func (h *userHandler) BeginPasskeyLogin(ctx context.Context, in *BeginPasskeyLoginRequest, out *BeginPasskeyLoginResponse) error {
+	return h.UserHandler.BeginPasskeyLogin(ctx, in, out)
+}
+
+func (h *userHandler) FinishPasskeyLogin(ctx context.Context, in *FinishPasskeyLoginRequest, out *FinishPasskeyLoginResponse) error {
+	return h.UserHandler.FinishPasskeyLogin(ctx, in, out)
+}
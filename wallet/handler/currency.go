@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/micro/micro/v3/service/store"
+	currency "github.com/micro/services/currency/proto"
+	pb "github.com/micro/services/wallet/proto"
+)
+
+const (
+	// the counterparty of conversions, one per currency
+	exchangeID = "$exchange$"
+	// maximum number of decimal places of a minor unit
+	maxPrecision = 8
+)
+
+var (
+	currencyFormat = regexp.MustCompile("^[A-Z0-9]{3,10}$")
+	// the ISO 4217 codes the currency service converts
+	isoFormat = regexp.MustCompile("^[A-Z]{3}$")
+)
+
+// readAccount returns the wallet. The default wallet exists implicitly.
+func readAccount(tnt, id string) (*pb.Account, error) {
+	recs, err := store.Read(fmt.Sprintf("%s/%s/%s", accountPrefix, tnt, id), store.ReadLimit(1))
+	if err == store.ErrNotFound && id == "default" {
+		return &pb.Account{Id: id, Name: "Default account"}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, store.ErrNotFound
+	}
+
+	acc := new(pb.Account)
+	if err := recs[0].Decode(&acc); err != nil {
+		return nil, err
+	}
+	return acc, nil
+}
+
+// validateCurrency normalises the currency code and checks the precision
+func validateCurrency(code string, precision int32) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) > 0 && !currencyFormat.MatchString(code) {
+		return "", fmt.Errorf("invalid currency code %s", code)
+	}
+	if precision < 0 || precision > maxPrecision {
+		return "", fmt.Errorf("precision must be between 0 and %d", maxPrecision)
+	}
+	return code, nil
+}
+
+// sameCurrency reports whether funds can move between the wallets as is
+func sameCurrency(a, b *pb.Account) bool {
+	return a.Currency == b.Currency && a.Precision == b.Precision
+}
+
+// convertible reports whether the currency service can convert between the wallets
+func convertible(from, to *pb.Account) bool {
+	return isoFormat.MatchString(from.Currency) && isoFormat.MatchString(to.Currency)
+}
+
+// convert returns the amount in minor units of the target wallet and the rate applied
+func (b *Wallet) convert(ctx context.Context, from, to *pb.Account, amount int64) (int64, float64, error) {
+	rsp, err := b.currency.Convert(ctx, &currency.ConvertRequest{
+		From: from.Currency,
+		To:   to.Currency,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if rsp.Rate <= 0 {
+		return 0, 0, fmt.Errorf("no rate from %s to %s", from.Currency, to.Currency)
+	}
+
+	scale := math.Pow10(int(to.Precision - from.Precision))
+	return int64(math.Round(float64(amount) * rsp.Rate * scale)), rsp.Rate, nil
+}
+
+// conversionMetadata describes the conversion applied in a transfer
+func conversionMetadata(from, to *pb.Account, rate float64, amount int64) map[string]string {
+	return map[string]string{
+		"from_currency":    from.Currency,
+		"to_currency":      to.Currency,
+		"rate":             strconv.FormatFloat(rate, 'f', -1, 64),
+		"converted_amount": strconv.FormatInt(amount, 10),
+	}
+}
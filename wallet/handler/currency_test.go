@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"testing"
+
+	"github.com/micro/micro/v3/service/client"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+	currency "github.com/micro/services/currency/proto"
+	"github.com/micro/services/pkg/tenant"
+	pb "github.com/micro/services/wallet/proto"
+)
+
+// rates converts at fixed rates
+type rates struct {
+	currency.CurrencyService
+	rates map[string]float64
+}
+
+func (r *rates) Convert(ctx context.Context, req *currency.ConvertRequest, opts ...client.CallOption) (*currency.ConvertResponse, error) {
+	rate, ok := r.rates[req.From+req.To]
+	if !ok {
+		return nil, errors.BadRequest("currency.convert", "invalid code")
+	}
+	return &currency.ConvertResponse{From: req.From, To: req.To, Rate: rate}, nil
+}
+
+func TestConvert(t *testing.T) {
+	w := &Wallet{currency: &rates{rates: map[string]float64{
+		"USDEUR": 0.9,
+		"USDJPY": 150,
+		"JPYUSD": 0.0067,
+	}}}
+
+	tcs := []struct {
+		name   string
+		from   *pb.Account
+		to     *pb.Account
+		amount int64
+		want   int64
+		err    bool
+	}{
+		{name: "same precision", from: &pb.Account{Currency: "USD", Precision: 2}, to: &pb.Account{Currency: "EUR", Precision: 2}, amount: 1000, want: 900},
+		{name: "to less precision", from: &pb.Account{Currency: "USD", Precision: 2}, to: &pb.Account{Currency: "JPY"}, amount: 1000, want: 1500},
+		{name: "to more precision", from: &pb.Account{Currency: "JPY"}, to: &pb.Account{Currency: "USD", Precision: 2}, amount: 1500, want: 1005},
+		{name: "rounded", from: &pb.Account{Currency: "USD", Precision: 2}, to: &pb.Account{Currency: "EUR", Precision: 2}, amount: 1, want: 1},
+		{name: "no rate", from: &pb.Account{Currency: "EUR", Precision: 2}, to: &pb.Account{Currency: "USD", Precision: 2}, amount: 1, err: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := w.convert(context.Background(), tc.from, tc.to, tc.amount)
+			if (err != nil) != tc.err {
+				t.Fatalf("err = %v, want error %v", err, tc.err)
+			}
+			if got != tc.want {
+				t.Errorf("convert(%d) = %d, want %d", tc.amount, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTransferConvertible(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+	ctx := tenant.NewContext("t", "micro", "t")
+	w := &Wallet{currency: &rates{rates: map[string]float64{"USDEUR": 0.9}}}
+
+	for _, req := range []*pb.CreateRequest{
+		{Id: "usd", Currency: "USD", Precision: 2},
+		{Id: "eur", Currency: "EUR", Precision: 2},
+		{Id: "abc", Currency: "ABC", Precision: 2},
+		{Id: "credits", Currency: "CREDITS"},
+	} {
+		if err := w.Create(ctx, req, &pb.CreateResponse{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name    string
+		from    string
+		to      string
+		convert bool
+	}{
+		{name: "not converting", from: "usd", to: "eur"},
+		{name: "custom code", from: "usd", to: "credits", convert: true},
+		{name: "no currency", from: "default", to: "usd", convert: true},
+		{name: "unknown code", from: "usd", to: "abc", convert: true},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			err := w.Transfer(ctx, &pb.TransferRequest{FromId: tc.from, ToId: tc.to, Amount: 100, Convert: tc.convert}, &pb.TransferResponse{})
+			if merr, ok := err.(*errors.Error); !ok || merr.Code != 400 {
+				t.Errorf("err = %v, want a bad request", err)
+			}
+		})
+	}
+}
+
+func TestCreateExisting(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+	ctx := tenant.NewContext("t", "micro", "t")
+	w := new(Wallet)
+
+	if err := w.Create(ctx, &pb.CreateRequest{Id: "w", Currency: "USD", Precision: 2}, &pb.CreateResponse{}); err != nil {
+		t.Fatal(err)
+	}
+
+	err := w.Create(ctx, &pb.CreateRequest{Id: "w", Currency: "JPY"}, &pb.CreateResponse{})
+	if merr, ok := err.(*errors.Error); !ok || merr.Code != 409 {
+		t.Fatalf("err = %v, want a conflict", err)
+	}
+
+	acc, err := readAccount("micro/t", "w")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if acc.Currency != "USD" || acc.Precision != 2 {
+		t.Errorf("wallet changed to %v %d", acc.Currency, acc.Precision)
+	}
+}
@@ -0,0 +1,461 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/pkg/redis"
+	"github.com/micro/services/pkg/tenant"
+	pb "github.com/micro/services/wallet/proto"
+)
+
+const (
+	holdPrefix = "hold"
+	// the account holding the reserved funds of a wallet
+	heldID = "$held$"
+
+	holdHeld     = "held"
+	holdCaptured = "captured"
+	holdVoided   = "voided"
+	holdExpired  = "expired"
+
+	defaultHoldExpiry = time.Hour * 24 * 7
+	// how long settled holds are kept around
+	settledHoldExpiry = time.Hour * 24 * 30
+	// how often expired holds are released
+	holdReleaseInterval = time.Minute
+	// number of expired holds released at a time
+	holdReleaseBatch = 100
+	// only the replica holding the lease releases expired holds
+	holdLease    = "holds"
+	holdLeaseTTL = holdReleaseInterval * 3
+)
+
+// Hold is an amount reserved in a wallet until it's captured, voided or expires
+type Hold struct {
+	ID        string
+	Tenant    string
+	WalletID  string
+	Amount    int64
+	Captured  int64
+	Reference string
+	Visible   bool
+	Status    string
+	Created   time.Time
+	Expires   time.Time
+}
+
+func (h *Hold) proto() *pb.Hold {
+	return &pb.Hold{
+		Id:        h.ID,
+		WalletId:  h.WalletID,
+		Amount:    h.Amount,
+		Captured:  h.Captured,
+		Reference: h.Reference,
+		Status:    h.Status,
+		Created:   h.Created.Format(time.RFC3339Nano),
+		Expires:   h.Expires.Format(time.RFC3339Nano),
+	}
+}
+
+func heldWallet(walletID string) string {
+	return redis.Key(heldID, walletID)
+}
+
+func holdKey(tnt, id string) string {
+	return fmt.Sprintf("%s/%s/%s", holdPrefix, tnt, id)
+}
+
+func readHold(tnt, id string) (*Hold, error) {
+	return readHoldKey(holdKey(tnt, id))
+}
+
+func readHoldKey(key string) (*Hold, error) {
+	recs, err := store.Read(key, store.ReadLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	h := new(Hold)
+	if err := json.Unmarshal(recs[0].Value, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func writeHold(h *Hold) error {
+	rec := store.NewRecord(holdKey(h.Tenant, h.ID), h)
+	if h.Status != holdHeld {
+		rec.Expiry = settledHoldExpiry
+	}
+	return store.Write(rec)
+}
+
+// holdFromEntry rebuilds a hold from the journal entry which created it
+func holdFromEntry(entry *Entry) *Hold {
+	h := &Hold{
+		ID:        entry.Metadata["hold_id"],
+		Tenant:    entry.ActionedBy,
+		Reference: entry.Reference,
+		Visible:   entry.Visible,
+		Status:    holdHeld,
+		Created:   entry.Created,
+	}
+	for _, p := range entry.Postings {
+		if p.Amount < 0 {
+			h.WalletID = p.WalletID
+			h.Amount = -p.Amount
+		}
+	}
+	h.Expires, _ = time.Parse(time.RFC3339Nano, entry.Metadata["expires"])
+	return h
+}
+
+// settledStatus records how a hold was settled e.g captured:500
+func settledStatus(status string, captured int64) string {
+	return redis.Key(status, strconv.FormatInt(captured, 10))
+}
+
+func parseSettledStatus(val string) (string, int64) {
+	parts := strings.SplitN(val, ":", 2)
+	if len(parts) != 2 {
+		return val, 0
+	}
+	captured, _ := strconv.ParseInt(parts[1], 10, 64)
+	return parts[0], captured
+}
+
+// settle releases the held funds, debiting the captured amount from the ledger
+// and returning the rest to the wallet. The hold's status in the ledger guards
+// the postings so a hold is only ever settled once; if it was settled
+// elsewhere the hold reflects that settlement instead.
+func (b *Wallet) settle(ctx context.Context, h *Hold, capture int64, status string) error {
+	postings := []Posting{
+		{WalletID: heldWallet(h.WalletID), Amount: -h.Amount, Overdraft: true},
+	}
+	if capture > 0 {
+		postings = append(postings, Posting{WalletID: externalID, Amount: capture, Overdraft: true})
+	}
+	if rest := h.Amount - capture; rest > 0 {
+		postings = append(postings, Posting{WalletID: h.WalletID, Amount: rest})
+	}
+
+	_, err := b.post(ctx, h.Tenant, &Entry{
+		Postings:  postings,
+		Reference: h.Reference,
+		Visible:   h.Visible,
+		Metadata: map[string]string{
+			"hold_id":  h.ID,
+			"type":     status,
+			"captured": strconv.FormatInt(capture, 10),
+		},
+		// holds created before the status was kept have none and count as held
+		Guard: &redis.Guard{
+			Key:  redis.Key(holdPrefix, h.ID),
+			From: holdHeld,
+			To:   settledStatus(status, capture),
+			TTL:  settledHoldExpiry,
+		},
+	})
+	switch err {
+	case nil:
+		h.Status = status
+		h.Captured = capture
+	case redis.ErrStatusChanged:
+		settled, err := b.l.Status(ctx, h.Tenant, redis.Key(holdPrefix, h.ID))
+		if err != nil {
+			return err
+		}
+		h.Status, h.Captured = parseSettledStatus(settled)
+	default:
+		return err
+	}
+
+	if err := writeHold(h); err != nil {
+		return err
+	}
+
+	if err := b.holds.Remove(ctx, holdKey(h.Tenant, h.ID)); err != nil {
+		log.Errorf("Error unscheduling hold %s: %s", h.ID, err)
+	}
+
+	return nil
+}
+
+// releaseExpiredHolds periodically voids holds which passed their expiry.
+// Only the replica holding the lease releases them.
+func (b *Wallet) releaseExpiredHolds() {
+	t := time.NewTicker(holdReleaseInterval)
+	defer t.Stop()
+
+	var leader bool
+
+	for range t.C {
+		ctx := context.Background()
+
+		ok, err := b.leases.Acquire(ctx, holdLease, b.id, holdLeaseTTL)
+		if err != nil {
+			log.Errorf("Error acquiring hold lease %s", err)
+			continue
+		}
+		if !ok {
+			leader = false
+			continue
+		}
+
+		// holds made before they were scheduled by expiry are picked up once
+		if !leader {
+			b.scheduleHolds(ctx)
+			leader = true
+		}
+
+		b.releaseDueHolds(ctx)
+	}
+}
+
+// releaseDueHolds voids the holds scheduled to expire by now
+func (b *Wallet) releaseDueHolds(ctx context.Context) {
+	for {
+		keys, err := b.holds.Due(ctx, time.Now(), holdReleaseBatch)
+		if err != nil {
+			log.Errorf("Error reading expired holds %s", err)
+			return
+		}
+
+		for _, key := range keys {
+			h, err := readHoldKey(key)
+			if err == store.ErrNotFound {
+				b.holds.Remove(ctx, key)
+				continue
+			}
+			if err != nil {
+				log.Errorf("Error reading hold %s: %s", key, err)
+				return
+			}
+			if h.Status != holdHeld {
+				b.holds.Remove(ctx, key)
+				continue
+			}
+			// try again on the next tick
+			if err := b.settle(ctx, h, 0, holdExpired); err != nil {
+				log.Errorf("Error releasing hold %s: %s", h.ID, err)
+				return
+			}
+		}
+
+		if len(keys) < holdReleaseBatch {
+			return
+		}
+	}
+}
+
+// scheduleHolds schedules the expiry of every hold still held
+func (b *Wallet) scheduleHolds(ctx context.Context) {
+	recs, err := store.Read(holdPrefix+"/", store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		log.Errorf("Error reading holds %s", err)
+		return
+	}
+
+	for _, rec := range recs {
+		h := new(Hold)
+		if err := json.Unmarshal(rec.Value, h); err != nil {
+			log.Errorf("Error decoding hold %s: %s", rec.Key, err)
+			continue
+		}
+		if h.Status != holdHeld {
+			continue
+		}
+		if err := b.holds.Add(ctx, rec.Key, h.Expires); err != nil {
+			log.Errorf("Error scheduling hold %s: %s", h.ID, err)
+		}
+	}
+}
+
+// pendingHold returns the hold if it can still be settled
+func (b *Wallet) pendingHold(ctx context.Context, method, holdID string) (*Hold, error) {
+	tnt, ok := tenant.FromContext(ctx)
+	if !ok {
+		return nil, errors.BadRequest(method, "unauthorized")
+	}
+
+	if len(holdID) == 0 {
+		return nil, errors.BadRequest(method, "Missing hold id")
+	}
+
+	h, err := readHold(tnt, holdID)
+	if err == store.ErrNotFound {
+		return nil, errors.NotFound(method, "hold not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Status == holdHeld && h.Expires.Before(time.Now()) {
+		if err := b.settle(ctx, h, 0, holdExpired); err != nil {
+			log.Errorf("Error releasing hold %s: %s", h.ID, err)
+			return nil, errors.InternalServerError(method, "Error releasing hold")
+		}
+	}
+
+	if h.Status != holdHeld {
+		return nil, errors.BadRequest(method, "hold is %s", h.Status)
+	}
+
+	return h, nil
+}
+
+func (b *Wallet) Hold(ctx context.Context, request *pb.HoldRequest, response *pb.HoldResponse) error {
+	tnt, ok := tenant.FromContext(ctx)
+	if !ok {
+		return errors.BadRequest("wallet.hold", "unauthorized")
+	}
+
+	if len(request.Id) == 0 {
+		request.Id = "default"
+	}
+
+	if len(request.Reference) == 0 {
+		return errors.BadRequest("wallet.hold", "Missing reference")
+	}
+
+	if request.Amount <= 0 {
+		return errors.BadRequest("wallet.hold", "amount must be positive")
+	}
+
+	expiry := defaultHoldExpiry
+	if request.Expiry > 0 {
+		expiry = time.Duration(request.Expiry) * time.Second
+	}
+
+	id := uuid.New().String()
+	key, fingerprint := idempotent("hold", request.Id, request)
+
+	// move the funds out of the available balance
+	entry, err := b.post(ctx, tnt, &Entry{
+		Postings: []Posting{
+			{WalletID: request.Id, Amount: -request.Amount},
+			{WalletID: heldWallet(request.Id), Amount: request.Amount, Overdraft: true},
+		},
+		Reference:      request.Reference,
+		Visible:        request.Visible,
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+		Metadata: map[string]string{
+			"hold_id": id,
+			"type":    holdHeld,
+			"expires": time.Now().Add(expiry).Format(time.RFC3339Nano),
+		},
+	})
+	if err == redis.ErrInsufficientFunds {
+		return errors.BadRequest("wallet.hold", "insufficient credit")
+	}
+	if err == redis.ErrIdempotencyReused {
+		return errors.Conflict("wallet.hold", err.Error())
+	}
+	if err != nil {
+		log.Errorf("Error posting hold %s", err)
+		return errors.InternalServerError("wallet.hold", "Error holding funds")
+	}
+
+	// a replayed request returns the existing hold
+	if held := entry.Metadata["hold_id"]; held != id {
+		h, err := readHold(tnt, held)
+		if err == nil && h.Status == holdHeld {
+			// in case scheduling failed the first time
+			if err := b.holds.Add(ctx, holdKey(tnt, h.ID), h.Expires); err != nil {
+				return err
+			}
+		}
+		if err == nil {
+			response.Hold = h.proto()
+			return nil
+		}
+		if err != store.ErrNotFound {
+			return err
+		}
+	}
+
+	h := holdFromEntry(entry)
+	if err := writeHold(h); err != nil {
+		return err
+	}
+	if err := b.holds.Add(ctx, holdKey(tnt, h.ID), h.Expires); err != nil {
+		return err
+	}
+
+	response.Hold = h.proto()
+
+	return nil
+}
+
+func (b *Wallet) Capture(ctx context.Context, request *pb.CaptureRequest, response *pb.CaptureResponse) error {
+	h, err := b.pendingHold(ctx, "wallet.capture", request.HoldId)
+	if err != nil {
+		return err
+	}
+
+	amount := request.Amount
+	if amount == 0 {
+		amount = h.Amount
+	}
+	if amount < 0 || amount > h.Amount {
+		return errors.BadRequest("wallet.capture", "amount must be between 1 and %d", h.Amount)
+	}
+
+	if err := b.settle(ctx, h, amount, holdCaptured); err != nil {
+		log.Errorf("Error capturing hold %s: %s", h.ID, err)
+		return errors.InternalServerError("wallet.capture", "Error capturing hold")
+	}
+
+	if h.Status != holdCaptured || h.Captured != amount {
+		return errors.Conflict("wallet.capture", "hold is %s", h.Status)
+	}
+
+	response.Hold = h.proto()
+
+	return nil
+}
+
+func (b *Wallet) Void(ctx context.Context, request *pb.VoidRequest, response *pb.VoidResponse) error {
+	h, err := b.pendingHold(ctx, "wallet.void", request.HoldId)
+	if err != nil {
+		return err
+	}
+
+	if err := b.settle(ctx, h, 0, holdVoided); err != nil {
+		log.Errorf("Error voiding hold %s: %s", h.ID, err)
+		return errors.InternalServerError("wallet.void", "Error voiding hold")
+	}
+
+	if h.Status != holdVoided {
+		return errors.Conflict("wallet.void", "hold is %s", h.Status)
+	}
+
+	response.Hold = h.proto()
+
+	return nil
+}
+
+// balances returns the total balance of a wallet and the part of it not on hold
+func (b *Wallet) balances(ctx context.Context, tnt, walletID string) (int64, int64, error) {
+	available, err := b.c.Read(ctx, redis.Key(tnt, walletID), balancePath)
+	if err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+	held, err := b.c.Read(ctx, redis.Key(tnt, heldWallet(walletID)), balancePath)
+	if err != nil && err != redis.Nil {
+		return 0, 0, err
+	}
+	return available + held, available, nil
+}
@@ -0,0 +1,24 @@
+package handler
+
+import "testing"
+
+func TestSettledStatus(t *testing.T) {
+	for _, tc := range []struct {
+		status   string
+		captured int64
+	}{
+		{holdCaptured, 500},
+		{holdVoided, 0},
+		{holdExpired, 0},
+	} {
+		status, captured := parseSettledStatus(settledStatus(tc.status, tc.captured))
+		if status != tc.status || captured != tc.captured {
+			t.Fatalf("Expected %s %d, got %s %d", tc.status, tc.captured, status, captured)
+		}
+	}
+
+	// a hold with no status yet
+	if status, captured := parseSettledStatus(holdHeld); status != holdHeld || captured != 0 {
+		t.Fatalf("Unexpected %s %d", status, captured)
+	}
+}
@@ -0,0 +1,282 @@
+package handler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/micro/micro/v3/service/errors"
+	"github.com/micro/micro/v3/service/store"
+	pauth "github.com/micro/services/pkg/auth"
+	"github.com/micro/services/pkg/redis"
+	pb "github.com/micro/services/wallet/proto"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	balancePath = "$balance$"
+	// the counterparty of credits and debits, i.e. funds entering or leaving the wallets
+	externalID = "$external$"
+	// the counterparty of the balance left in a wallet when it's deleted
+	closingID = "$closing$"
+	// how long idempotency keys are remembered
+	idempotencyTTL = time.Hour * 24
+	// number of journal entries read at a time when reconciling
+	reconcileBatch = 1000
+)
+
+// Entry is a balanced journal entry recording a movement of funds
+type Entry struct {
+	ID             string
+	Created        time.Time
+	Postings       []Posting
+	Reference      string
+	Visible        bool
+	ActionedBy     string
+	IdempotencyKey string
+	Metadata       map[string]string
+	// identifies the request made with the idempotency key
+	Fingerprint string `json:"-"`
+	// status the entry is conditional on
+	Guard *redis.Guard `json:"-"`
+}
+
+// Posting is the amount credited (positive) or debited (negative) to a wallet
+type Posting struct {
+	WalletID string
+	Amount   int64
+	// whether the wallet may go below zero
+	Overdraft bool `json:"-"`
+	// whether the posting must leave the wallet at exactly zero
+	Close bool `json:"-"`
+}
+
+// idempotent returns the idempotency key of the request scoped to the
+// operation and wallet, along with a fingerprint of the rest of the request
+// so a key reused for a different request can be rejected.
+func idempotent(op, walletID string, req proto.Message) (string, string) {
+	msg := proto.Clone(req).ProtoReflect()
+	field := msg.Descriptor().Fields().ByName("idempotency_key")
+	key := msg.Get(field).String()
+	if len(key) == 0 {
+		return "", ""
+	}
+
+	msg.Clear(field)
+	b, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg.Interface())
+	if err != nil {
+		return "", ""
+	}
+	sum := sha256.Sum256(b)
+
+	return redis.Key(op, walletID, key), hex.EncodeToString(sum[:])
+}
+
+// post records the entry in the journal and applies its postings in one
+// atomic step. Entries with a previously used idempotency key are not
+// applied again; the original entry is returned instead, unless the key was
+// used for a different request.
+func (b *Wallet) post(ctx context.Context, tnt string, entry *Entry) (*Entry, error) {
+	entry.ID = uuid.New().String()
+	entry.Created = time.Now()
+	entry.ActionedBy = tnt
+
+	postings := make([]redis.Posting, len(entry.Postings))
+	for i, p := range entry.Postings {
+		postings[i] = redis.Posting{
+			Key:       redis.Key(tnt, p.WalletID),
+			Path:      balancePath,
+			Amount:    p.Amount,
+			Overdraft: p.Overdraft,
+			Close:     p.Close,
+		}
+	}
+
+	val, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	stored, _, err := b.l.Post(ctx, tnt, entry.IdempotencyKey, entry.Fingerprint, idempotencyTTL, entry.Guard, postings, val)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := new(Entry)
+	if err := json.Unmarshal(stored, ret); err != nil {
+		return nil, err
+	}
+
+	// write the history, also when replayed in case the original call failed
+	// after posting. Reconcile restores anything still missing.
+	if err := storeTransactions(ret); err != nil {
+		return nil, err
+	}
+
+	return ret, nil
+}
+
+// storeTransactions writes a transaction record for each wallet in the entry
+func storeTransactions(entry *Entry) error {
+	for _, p := range entry.Postings {
+		// internal ledger accounts have no history
+		if strings.HasPrefix(p.WalletID, "$") {
+			continue
+		}
+
+		trx, err := json.Marshal(&Transaction{
+			ID:         entry.ID,
+			Created:    entry.Created,
+			Amount:     p.Amount,
+			Reference:  entry.Reference,
+			Visible:    entry.Visible,
+			WalletID:   p.WalletID,
+			ActionedBy: entry.ActionedBy,
+			Metadata:   entry.Metadata,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := store.Write(&store.Record{
+			Key:   transactionKey(entry.ActionedBy, p.WalletID, entry.Created, entry.ID),
+			Value: trx,
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walletIDs returns the ids of all wallets of the tenant, including the default wallet
+func walletIDs(tnt string) ([]string, error) {
+	recs, err := store.Read(fmt.Sprintf("%s/%s/", accountPrefix, tnt), store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return nil, err
+	}
+
+	ids := []string{"default"}
+	for _, rec := range recs {
+		acc := new(pb.Account)
+		if err := rec.Decode(&acc); err != nil {
+			return nil, err
+		}
+		if acc.Id == "default" {
+			continue
+		}
+		ids = append(ids, acc.Id)
+	}
+	return ids, nil
+}
+
+func (b *Wallet) Reconcile(ctx context.Context, req *pb.ReconcileRequest, rsp *pb.ReconcileResponse) error {
+	method := "wallet.Reconcile"
+	if _, err := pauth.VerifyMicroAdmin(ctx, method); err != nil {
+		return err
+	}
+
+	if len(req.TenantId) == 0 {
+		return errors.BadRequest(method, "Missing tenant ID")
+	}
+	tnt := req.TenantId
+
+	ids := []string{req.Id}
+	if len(req.Id) == 0 {
+		var err error
+		ids, err = walletIDs(tnt)
+		if err != nil {
+			return errors.InternalServerError(method, "Error listing wallets")
+		}
+	}
+
+	length, balances, err := b.l.Snapshot(ctx, tnt, balancePath, ids...)
+	if err != nil {
+		return errors.InternalServerError(method, "Error reading balances")
+	}
+
+	// the transactions recorded for each wallet
+	recorded := map[string]map[string]bool{}
+	for _, id := range ids {
+		keys, err := store.List(store.ListPrefix(transactionsPrefix(tnt, id)))
+		if err != nil {
+			return errors.InternalServerError(method, "Error listing transactions")
+		}
+		recorded[id] = map[string]bool{}
+		for _, k := range keys {
+			// keys end in the transaction id
+			recorded[id][k[strings.LastIndex(k, "/")+1:]] = true
+		}
+	}
+
+	// replay the journal up to the snapshot
+	journal := map[string]int64{}
+	missing := map[string][]*Entry{}
+	for start := int64(0); start < length; start += reconcileBatch {
+		stop := start + reconcileBatch - 1
+		if stop >= length {
+			stop = length - 1
+		}
+		vals, err := b.l.Range(ctx, tnt, start, stop)
+		if err != nil {
+			return errors.InternalServerError(method, "Error reading journal")
+		}
+		for _, val := range vals {
+			entry := new(Entry)
+			if err := json.Unmarshal(val, entry); err != nil {
+				return errors.InternalServerError(method, "Error decoding journal entry")
+			}
+			for _, p := range entry.Postings {
+				seen, ok := recorded[p.WalletID]
+				if !ok {
+					continue
+				}
+				journal[p.WalletID] += p.Amount
+				if !seen[entry.ID] {
+					missing[p.WalletID] = append(missing[p.WalletID], entry)
+				}
+			}
+		}
+	}
+
+	for i, id := range ids {
+		if balances[i] == journal[id] && len(missing[id]) == 0 {
+			continue
+		}
+
+		rec := &pb.Reconciliation{
+			Id:                  id,
+			Balance:             balances[i],
+			JournalBalance:      journal[id],
+			MissingTransactions: int64(len(missing[id])),
+		}
+
+		if req.Fix {
+			if balances[i] != journal[id] {
+				ok, err := b.l.Reset(ctx, tnt, length, redis.Key(tnt, id), balancePath, journal[id])
+				if err != nil {
+					return errors.InternalServerError(method, "Error resetting balance")
+				}
+				if !ok {
+					return errors.Conflict(method, "Journal changed during reconciliation, try again")
+				}
+			}
+			for _, entry := range missing[id] {
+				if err := storeTransactions(entry); err != nil {
+					return errors.InternalServerError(method, "Error restoring transaction")
+				}
+			}
+			rec.Fixed = true
+		}
+
+		rsp.Mismatches = append(rsp.Mismatches, rec)
+	}
+
+	rsp.Checked = int64(len(ids))
+
+	return nil
+}
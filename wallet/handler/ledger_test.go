@@ -0,0 +1,45 @@
+package handler
+
+import (
+	"testing"
+
+	pb "github.com/micro/services/wallet/proto"
+)
+
+func TestIdempotent(t *testing.T) {
+	credit := &pb.CreditRequest{Id: "a", Amount: 10, Reference: "top up", IdempotencyKey: "k"}
+
+	key, fingerprint := idempotent("credit", credit.Id, credit)
+	if key != "credit:a:k" || len(fingerprint) == 0 {
+		t.Fatalf("Unexpected key %q fingerprint %q", key, fingerprint)
+	}
+
+	// the request itself is left alone
+	if credit.IdempotencyKey != "k" {
+		t.Fatal("Expected the request to keep its idempotency key")
+	}
+
+	tcs := []struct {
+		name        string
+		op          string
+		req         *pb.CreditRequest
+		key         string
+		fingerprint bool
+	}{
+		{name: "retry", op: "credit", req: &pb.CreditRequest{Id: "a", Amount: 10, Reference: "top up", IdempotencyKey: "k"}, key: "credit:a:k", fingerprint: true},
+		{name: "other amount", op: "credit", req: &pb.CreditRequest{Id: "a", Amount: 20, Reference: "top up", IdempotencyKey: "k"}, key: "credit:a:k"},
+		{name: "other wallet", op: "credit", req: &pb.CreditRequest{Id: "b", Amount: 10, Reference: "top up", IdempotencyKey: "k"}, key: "credit:b:k"},
+		{name: "other operation", op: "debit", req: &pb.CreditRequest{Id: "a", Amount: 10, Reference: "top up", IdempotencyKey: "k"}, key: "debit:a:k", fingerprint: true},
+		{name: "no key", op: "credit", req: &pb.CreditRequest{Id: "a", Amount: 10, Reference: "top up"}},
+	}
+
+	for _, tc := range tcs {
+		k, f := idempotent(tc.op, tc.req.Id, tc.req)
+		if k != tc.key {
+			t.Fatalf("%s: expected key %q, got %q", tc.name, tc.key, k)
+		}
+		if (f == fingerprint) != tc.fingerprint {
+			t.Fatalf("%s: expected same fingerprint %v", tc.name, tc.fingerprint)
+		}
+	}
+}
@@ -0,0 +1,521 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/micro/micro/v3/service/errors"
+	log "github.com/micro/micro/v3/service/logger"
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/services/pkg/tenant"
+	pb "github.com/micro/services/wallet/proto"
+)
+
+const (
+	// number of transaction keys listed at a time
+	transactionBatch = 100
+
+	// balances of wallets at the start of a day
+	checkpointPrefix   = "checkpoint"
+	checkpointInterval = 24 * time.Hour
+	// how long after a day starts its balance is kept
+	checkpointSettle = time.Hour
+)
+
+// transactionFilter selects transactions from the history of a wallet
+type transactionFilter struct {
+	From      time.Time
+	To        time.Time
+	MinAmount int64
+	MaxAmount int64
+	Type      string
+	Reference string
+	Metadata  map[string]string
+}
+
+func (f *transactionFilter) match(trx *Transaction) bool {
+	if !f.From.IsZero() && trx.Created.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !trx.Created.Before(f.To) {
+		return false
+	}
+
+	amount := trx.Amount
+	if amount < 0 {
+		amount = -amount
+	}
+	if f.MinAmount > 0 && amount < f.MinAmount {
+		return false
+	}
+	if f.MaxAmount > 0 && amount > f.MaxAmount {
+		return false
+	}
+
+	switch f.Type {
+	case "credit":
+		if trx.Amount < 0 {
+			return false
+		}
+	case "debit":
+		if trx.Amount > 0 {
+			return false
+		}
+	}
+
+	if len(f.Reference) > 0 && !strings.Contains(strings.ToLower(trx.Reference), strings.ToLower(f.Reference)) {
+		return false
+	}
+
+	for k, v := range f.Metadata {
+		if trx.Metadata[k] != v {
+			return false
+		}
+	}
+
+	return true
+}
+
+// transactionKey orders the history of a wallet by time
+func transactionKey(tnt, walletID string, created time.Time, id string) string {
+	return fmt.Sprintf("%s%019d/%s", transactionsPrefix(tnt, walletID), created.UnixNano(), id)
+}
+
+func transactionsPrefix(tnt, walletID string) string {
+	return fmt.Sprintf("%s/%s/%s/", transactionPrefix, tnt, walletID)
+}
+
+// keyTime returns the time of a transaction from its key
+func keyTime(prefix, key string) time.Time {
+	parts := strings.SplitN(strings.TrimPrefix(key, prefix), "/", 2)
+	nanos, _ := strconv.ParseInt(parts[0], 10, 64)
+	return time.Unix(0, nanos)
+}
+
+// migrateTransactions moves the history of a wallet written before it was
+// ordered by time to time ordered keys. It only runs once per wallet.
+func migrateTransactions(tnt, walletID string) error {
+	marker := fmt.Sprintf("%s/%s/%s/%s", migratedPrefix, transactionPrefix, tnt, walletID)
+	_, err := store.Read(marker, store.ReadLimit(1))
+	if err == nil {
+		return nil
+	}
+	if err != store.ErrNotFound {
+		return err
+	}
+
+	prefix := transactionsPrefix(tnt, walletID)
+	recs, err := store.Read(prefix, store.ReadPrefix())
+	if err != nil && err != store.ErrNotFound {
+		return err
+	}
+
+	for _, rec := range recs {
+		// already time ordered
+		if strings.Contains(strings.TrimPrefix(rec.Key, prefix), "/") {
+			continue
+		}
+		trx := new(Transaction)
+		if err := json.Unmarshal(rec.Value, trx); err != nil {
+			return err
+		}
+		if err := store.Write(&store.Record{
+			Key:   transactionKey(tnt, walletID, trx.Created, trx.ID),
+			Value: rec.Value,
+		}); err != nil {
+			return err
+		}
+		if err := store.Delete(rec.Key); err != nil {
+			return err
+		}
+	}
+
+	return store.Write(&store.Record{Key: marker, Value: []byte("{}")})
+}
+
+// eachTransaction calls fn with the history of a wallet from the time up to
+// but not including the other, oldest first. Earlier transactions are
+// skipped by their key without being read.
+func eachTransaction(tnt, walletID string, from, to time.Time, fn func(*Transaction) error) error {
+	if err := migrateTransactions(tnt, walletID); err != nil {
+		return err
+	}
+
+	prefix := transactionsPrefix(tnt, walletID)
+
+	for offset := uint(0); ; offset += transactionBatch {
+		keys, err := store.List(store.ListPrefix(prefix), store.ListOffset(offset), store.ListLimit(transactionBatch))
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			created := keyTime(prefix, key)
+			if created.Before(from) {
+				continue
+			}
+			if !created.Before(to) {
+				return nil
+			}
+			trx, err := readTransaction(key)
+			if err == store.ErrNotFound {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := fn(trx); err != nil {
+				return err
+			}
+		}
+
+		if len(keys) < transactionBatch {
+			return nil
+		}
+	}
+}
+
+func checkpointsPrefix(tnt, walletID string) string {
+	return fmt.Sprintf("%s/%s/%s/", checkpointPrefix, tnt, walletID)
+}
+
+func checkpointKey(tnt, walletID string, at time.Time) string {
+	return fmt.Sprintf("%s%019d", checkpointsPrefix(tnt, walletID), at.UnixNano())
+}
+
+// lastCheckpoint returns the latest balance checkpoint of the wallet at or
+// before the time, or the zero time if there's none
+func lastCheckpoint(tnt, walletID string, at time.Time) (time.Time, int64, error) {
+	prefix := checkpointsPrefix(tnt, walletID)
+
+	// one checkpoint a day at most
+	keys, err := store.List(store.ListPrefix(prefix))
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	sort.Strings(keys)
+
+	max := checkpointKey(tnt, walletID, at)
+	i := sort.Search(len(keys), func(i int) bool { return keys[i] > max })
+	if i == 0 {
+		return time.Time{}, 0, nil
+	}
+
+	recs, err := store.Read(keys[i-1], store.ReadLimit(1))
+	if err == store.ErrNotFound {
+		return time.Time{}, 0, nil
+	} else if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	var balance int64
+	if err := json.Unmarshal(recs[0].Value, &balance); err != nil {
+		return time.Time{}, 0, err
+	}
+	nanos, _ := strconv.ParseInt(strings.TrimPrefix(keys[i-1], prefix), 10, 64)
+	return time.Unix(0, nanos), balance, nil
+}
+
+// openingBalance returns the balance of the wallet before the time. The
+// balance at the start of each day is kept once computed so only the
+// transactions since the day started and any since the last kept day are read.
+func openingBalance(tnt, walletID string, at time.Time) (int64, error) {
+	day := at.Truncate(checkpointInterval)
+
+	since, balance, err := lastCheckpoint(tnt, walletID, day)
+	if err != nil {
+		return 0, err
+	}
+
+	sum := func(from, to time.Time) error {
+		return eachTransaction(tnt, walletID, from, to, func(trx *Transaction) error {
+			balance += trx.Amount
+			return nil
+		})
+	}
+
+	if since.Before(day) {
+		if err := sum(since, day); err != nil {
+			return 0, err
+		}
+		// transactions are stored as they're made so the past can't change
+		if time.Since(day) > checkpointSettle {
+			b, _ := json.Marshal(balance)
+			if err := store.Write(&store.Record{Key: checkpointKey(tnt, walletID, day), Value: b}); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if err := sum(day, at); err != nil {
+		return 0, err
+	}
+	return balance, nil
+}
+
+func readTransaction(key string) (*Transaction, error) {
+	recs, err := store.Read(key, store.ReadLimit(1))
+	if err != nil {
+		return nil, err
+	}
+	if len(recs) == 0 {
+		return nil, store.ErrNotFound
+	}
+	trx := new(Transaction)
+	if err := json.Unmarshal(recs[0].Value, trx); err != nil {
+		return nil, err
+	}
+	return trx, nil
+}
+
+// transactionPage reads up to limit transactions after the cursor which
+// match the filter, returning the cursor of the next page if there is one.
+// Transactions before the filter's from time are skipped by their key
+// without being read.
+func transactionPage(tnt, walletID string, filter *transactionFilter, cursor *pageCursor, limit int) ([]*Transaction, string, error) {
+	if err := migrateTransactions(tnt, walletID); err != nil {
+		return nil, "", err
+	}
+
+	prefix := transactionsPrefix(tnt, walletID)
+
+	var offset uint
+	if cursor != nil {
+		var err error
+		offset, err = cursor.seek(prefix)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	var page []*Transaction
+	// the key and offset after the last transaction of the page
+	var last string
+	var next uint
+
+	for {
+		keys, err := store.List(store.ListPrefix(prefix), store.ListOffset(offset), store.ListLimit(transactionBatch))
+		if err != nil {
+			return nil, "", err
+		}
+
+		for _, key := range keys {
+			created := keyTime(prefix, key)
+			if !filter.From.IsZero() && created.Before(filter.From) {
+				offset++
+				continue
+			}
+			if !filter.To.IsZero() && !created.Before(filter.To) {
+				return page, "", nil
+			}
+
+			trx, err := readTransaction(key)
+			if err == store.ErrNotFound {
+				offset++
+				continue
+			}
+			if err != nil {
+				return nil, "", err
+			}
+			if !trx.Visible || !filter.match(trx) {
+				offset++
+				continue
+			}
+
+			// there's at least one more transaction
+			if limit > 0 && len(page) == limit {
+				return page, encodeCursor(&pageCursor{Offset: next, Key: strings.TrimPrefix(last, prefix)}), nil
+			}
+
+			page = append(page, trx)
+			offset++
+			last, next = key, offset
+		}
+
+		if len(keys) < transactionBatch {
+			return page, "", nil
+		}
+	}
+}
+
+func (trx *Transaction) proto() *pb.Transaction {
+	return &pb.Transaction{
+		Id:        trx.ID,
+		Created:   trx.Created.Format(time.RFC3339Nano),
+		Amount:    trx.Amount,
+		Reference: trx.Reference,
+		Metadata:  trx.Metadata,
+	}
+}
+
+// pageCursor points after the last transaction of a page by the offset and
+// key of the next transaction
+type pageCursor struct {
+	Offset uint
+	// key of the last transaction of the page without the wallet's prefix
+	Key string
+}
+
+func encodeCursor(c *pageCursor) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d/%s", c.Offset, c.Key)))
+}
+
+func decodeCursor(cursor string) (*pageCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.SplitN(string(b), "/", 3)
+	if len(parts) < 2 {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	first, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	// cursors from before the offset was kept are the time and id
+	if len(parts) == 2 {
+		return &pageCursor{Key: fmt.Sprintf("%019d/%s", first, parts[1])}, nil
+	}
+
+	return &pageCursor{Offset: uint(first), Key: parts[1] + "/" + parts[2]}, nil
+}
+
+// seek returns the offset of the first key after the cursor's. If the
+// history changed since the cursor was made the key is looked up instead.
+func (c *pageCursor) seek(prefix string) (uint, error) {
+	if c.Offset > 0 {
+		keys, err := store.List(store.ListPrefix(prefix), store.ListOffset(c.Offset-1), store.ListLimit(1))
+		if err != nil {
+			return 0, err
+		}
+		if len(keys) == 1 && keys[0] == prefix+c.Key {
+			return c.Offset, nil
+		}
+	}
+
+	keys, err := store.List(store.ListPrefix(prefix))
+	if err != nil {
+		return 0, err
+	}
+	sort.Strings(keys)
+	return uint(sort.Search(len(keys), func(i int) bool { return keys[i] > prefix+c.Key })), nil
+}
+
+func parseTime(method, field, val string) (time.Time, error) {
+	if len(val) == 0 {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, errors.BadRequest(method, "%s must be an RFC3339 time", field)
+	}
+	return t, nil
+}
+
+func (b *Wallet) Statement(ctx context.Context, request *pb.StatementRequest, response *pb.StatementResponse) error {
+	tnt, ok := tenant.FromContext(ctx)
+	if !ok {
+		return errors.BadRequest("wallet.statement", "unauthorized")
+	}
+
+	if len(request.Id) == 0 {
+		request.Id = "default"
+	}
+
+	if len(request.From) == 0 {
+		return errors.BadRequest("wallet.statement", "Missing from")
+	}
+	from, err := parseTime("wallet.statement", "from", request.From)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime("wallet.statement", "to", request.To)
+	if err != nil {
+		return err
+	}
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if !from.Before(to) {
+		return errors.BadRequest("wallet.statement", "from must be before to")
+	}
+
+	switch request.Format {
+	case "":
+		request.Format = "json"
+	case "json", "csv":
+	default:
+		return errors.BadRequest("wallet.statement", "format must be json or csv")
+	}
+
+	acc, err := readAccount(tnt, request.Id)
+	if err == store.ErrNotFound {
+		return errors.NotFound("wallet.statement", "wallet not found")
+	}
+	if err != nil {
+		return err
+	}
+
+	opening, err := openingBalance(tnt, request.Id, from)
+	if err != nil {
+		log.Errorf("Error reading opening balance %s", err)
+		return errors.InternalServerError("wallet.statement", "Error reading transactions")
+	}
+
+	response.Id = acc.Id
+	response.Currency = acc.Currency
+	response.From = from.Format(time.RFC3339Nano)
+	response.To = to.Format(time.RFC3339Nano)
+	response.OpeningBalance = opening
+
+	buf := new(bytes.Buffer)
+	w := csv.NewWriter(buf)
+	w.Write([]string{"id", "created", "reference", "amount", "balance"})
+
+	balance := opening
+	err = eachTransaction(tnt, request.Id, from, to, func(trx *Transaction) error {
+		balance += trx.Amount
+		if trx.Amount < 0 {
+			response.Debits -= trx.Amount
+		} else {
+			response.Credits += trx.Amount
+		}
+
+		if request.Format == "csv" {
+			return w.Write([]string{
+				trx.ID,
+				trx.Created.Format(time.RFC3339Nano),
+				trx.Reference,
+				strconv.FormatInt(trx.Amount, 10),
+				strconv.FormatInt(balance, 10),
+			})
+		}
+		response.Transactions = append(response.Transactions, trx.proto())
+		return nil
+	})
+	if err != nil {
+		log.Errorf("Error reading transactions %s", err)
+		return errors.InternalServerError("wallet.statement", "Error reading transactions")
+	}
+
+	response.ClosingBalance = balance
+
+	if request.Format == "csv" {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return err
+		}
+		response.Csv = buf.String()
+	}
+
+	return nil
+}
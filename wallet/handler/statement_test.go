@@ -0,0 +1,199 @@
+package handler
+
+import (
+	"encoding/base64"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/micro/micro/v3/service/store"
+	"github.com/micro/micro/v3/service/store/memory"
+)
+
+func TestCursor(t *testing.T) {
+	c := &pageCursor{Offset: 12, Key: "0000000000000000042/abc"}
+	got, err := decodeCursor(encodeCursor(c))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *c {
+		t.Fatalf("Expected %v, got %v", c, got)
+	}
+
+	// cursors made before the offset was kept
+	legacy := base64.RawURLEncoding.EncodeToString([]byte("42/abc"))
+	got, err = decodeCursor(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Offset != 0 || got.Key != "0000000000000000042/abc" {
+		t.Fatalf("Unexpected legacy cursor %v", got)
+	}
+
+	for _, bad := range []string{"!", base64.RawURLEncoding.EncodeToString([]byte("nope")), base64.RawURLEncoding.EncodeToString([]byte("x/y/z"))} {
+		if _, err := decodeCursor(bad); err == nil {
+			t.Fatalf("Expected %q to be invalid", bad)
+		}
+	}
+}
+
+func TestTransactionPage(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < 250; i++ {
+		amount := int64(i + 1)
+		if i%2 == 1 {
+			amount = -amount
+		}
+		if err := storeTransactions(&Entry{
+			ID:         fmt.Sprintf("trx-%03d", i),
+			Created:    start.Add(time.Duration(i) * time.Second),
+			Postings:   []Posting{{WalletID: "w", Amount: amount}},
+			Visible:    true,
+			ActionedBy: "t",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name   string
+		filter *transactionFilter
+		limit  int
+		ids    []string
+	}{
+		{name: "all", filter: &transactionFilter{}, limit: 0, ids: []string{"trx-000", "trx-249"}},
+		{name: "credits", filter: &transactionFilter{Type: "credit"}, limit: 30, ids: []string{"trx-000", "trx-248"}},
+		{name: "from", filter: &transactionFilter{From: start.Add(200 * time.Second)}, limit: 7, ids: []string{"trx-200", "trx-249"}},
+		{name: "to", filter: &transactionFilter{To: start.Add(10 * time.Second)}, limit: 3, ids: []string{"trx-000", "trx-009"}},
+	}
+
+	for _, tc := range tcs {
+		var ids []string
+		var cursor *pageCursor
+		for {
+			page, next, err := transactionPage("t", "w", tc.filter, cursor, tc.limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tc.limit > 0 && len(page) > tc.limit {
+				t.Fatalf("%s: page of %d over the limit", tc.name, len(page))
+			}
+			for _, trx := range page {
+				ids = append(ids, trx.ID)
+			}
+			if len(next) == 0 {
+				break
+			}
+			if cursor, err = decodeCursor(next); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(ids) == 0 || ids[0] != tc.ids[0] || ids[len(ids)-1] != tc.ids[1] {
+			t.Fatalf("%s: expected %v to %v, got %v", tc.name, tc.ids[0], tc.ids[1], ids)
+		}
+		for i := 1; i < len(ids); i++ {
+			if ids[i] <= ids[i-1] {
+				t.Fatalf("%s: out of order or repeated %v", tc.name, ids)
+			}
+		}
+	}
+
+	// a transaction recorded in the middle of the history moves the cursor's
+	// offset, which is then found by its key
+	page, next, err := transactionPage("t", "w", &transactionFilter{}, nil, 10)
+	if err != nil || len(page) != 10 {
+		t.Fatal(page, err)
+	}
+	storeTransactions(&Entry{ID: "early", Created: start.Add(-time.Minute), Postings: []Posting{{WalletID: "w", Amount: 1}}, Visible: true, ActionedBy: "t"})
+	cursor, _ := decodeCursor(next)
+	page, _, err = transactionPage("t", "w", &transactionFilter{}, cursor, 1)
+	if err != nil || len(page) != 1 || page[0].ID != "trx-010" {
+		t.Fatalf("Expected trx-010 after the cursor, got %v %v", page, err)
+	}
+}
+
+func TestMigrateTransactions(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+
+	now := time.Now()
+	for i, id := range []string{"b", "a", "c"} {
+		trx := &Transaction{ID: id, Created: now.Add(time.Duration(i) * time.Second), Amount: 1, Visible: true}
+		store.Write(store.NewRecord(fmt.Sprintf("%s/t/w/%s", transactionPrefix, id), trx))
+	}
+
+	var history []*Transaction
+	err := eachTransaction("t", "w", time.Time{}, now.Add(time.Minute), func(trx *Transaction) error {
+		history = append(history, trx)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].ID != "b" || history[1].ID != "a" || history[2].ID != "c" {
+		t.Fatalf("Expected the history in time order, got %v", history)
+	}
+
+	prefix := transactionsPrefix("t", "w")
+	keys, _ := store.List(store.ListPrefix(prefix))
+	for _, k := range keys {
+		if keyTime(prefix, k).Unix() == 0 {
+			t.Fatalf("Expected only time ordered keys, got %v", keys)
+		}
+	}
+}
+
+func TestOpeningBalance(t *testing.T) {
+	store.DefaultStore = memory.NewStore()
+
+	day := time.Now().Truncate(checkpointInterval).Add(-3 * checkpointInterval)
+	for i := 0; i < 6; i++ {
+		if err := storeTransactions(&Entry{
+			ID:         fmt.Sprintf("trx-%d", i),
+			Created:    day.Add(time.Duration(i) * 12 * time.Hour),
+			Postings:   []Posting{{WalletID: "w", Amount: int64(1) << i}},
+			Visible:    true,
+			ActionedBy: "t",
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tcs := []struct {
+		name string
+		at   time.Time
+		want int64
+	}{
+		{"before any", day.Add(-time.Hour), 0},
+		{"start of first day", day, 0},
+		{"within first day", day.Add(13 * time.Hour), 3},
+		{"start of second day", day.Add(checkpointInterval), 3},
+		{"within third day", day.Add(2*checkpointInterval + time.Minute), 31},
+		{"earlier again", day.Add(time.Hour), 1},
+		{"after all", day.Add(4 * checkpointInterval), 63},
+	}
+	for _, tc := range tcs {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := openingBalance("t", "w", tc.at)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("opening balance = %d, want %d", got, tc.want)
+			}
+		})
+	}
+
+	// the balance at the start of each past day is kept
+	for i, want := range []int64{0, 3, 15} {
+		at, balance, err := lastCheckpoint("t", "w", day.Add(time.Duration(i)*checkpointInterval))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !at.Equal(day.Add(time.Duration(i)*checkpointInterval)) || balance != want {
+			t.Errorf("day %d checkpoint %v of %d, want %d", i, at, balance, want)
+		}
+	}
+}
@@ -2,10 +2,9 @@ package handler
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"sort"
-	"sync"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,6 +12,7 @@ import (
 	"github.com/micro/micro/v3/service/errors"
 	log "github.com/micro/micro/v3/service/logger"
 	"github.com/micro/micro/v3/service/store"
+	currency "github.com/micro/services/currency/proto"
 	"github.com/micro/services/pkg/redis"
 	"github.com/micro/services/pkg/tenant"
 	pb "github.com/micro/services/wallet/proto"
@@ -22,6 +22,7 @@ const (
 	accountPrefix     = "account"
 	counterPrefix     = "wallet"
 	transactionPrefix = "transaction"
+	migratedPrefix    = "migrated"
 )
 
 // Transaction represents a wallet transaction
@@ -37,48 +38,31 @@ type Transaction struct {
 }
 
 type Wallet struct {
-	c *redis.Counter
-	// for wallet transfers
-	mtx sync.Mutex
-}
-
-func storeTransaction(userID string, delta int64, walletID, reference string, visible bool, meta map[string]string) (*Transaction, error) {
-	// record it
-	rec := &Transaction{
-		ID:         uuid.New().String(),
-		Created:    time.Now(),
-		Amount:     delta,
-		Reference:  reference,
-		Visible:    visible,
-		WalletID:   walletID,
-		ActionedBy: userID,
-		Metadata:   meta,
-	}
-
-	trx, err := json.Marshal(rec)
-	if err != nil {
-		return nil, err
-	}
-
-	if err := store.Write(&store.Record{
-		Key:   fmt.Sprintf("%s/%s/%s/%s", transactionPrefix, userID, walletID, rec.ID),
-		Value: trx,
-	}); err != nil {
-		return nil, err
-	}
-	return rec, nil
+	c        *redis.Counter
+	l        *redis.Ledger
+	currency currency.CurrencyService
+	// holds by when they expire
+	holds  *redis.Schedule
+	leases *redis.Leases
+	// id of this replica
+	id string
 }
 
 func NewHandler(svc *service.Service) *Wallet {
-	return &Wallet{
-		c: redis.NewCounter(counterPrefix),
-	}
+	c := redis.NewCounter(counterPrefix)
+	w := &Wallet{
+		c:        c,
+		l:        redis.NewLedger(counterPrefix, c),
+		currency: currency.NewCurrencyService("currency", svc.Client()),
+		holds:    redis.NewSchedule(counterPrefix, holdPrefix),
+		leases:   redis.NewLeases(counterPrefix),
+		id:       uuid.New().String(),
+	}
+	go w.releaseExpiredHolds()
+	return w
 }
 
 func (b *Wallet) Transfer(ctx context.Context, req *pb.TransferRequest, rsp *pb.TransferResponse) error {
-	b.mtx.Lock()
-	defer b.mtx.Unlock()
-
 	tnt, ok := tenant.FromContext(ctx)
 	if !ok {
 		return errors.BadRequest("wallet.transfer", "unauthorized")
@@ -88,37 +72,82 @@ func (b *Wallet) Transfer(ctx context.Context, req *pb.TransferRequest, rsp *pb.
 		return errors.BadRequest("wallet.transfer", "missing ids")
 	}
 
-	// check the wallets exist
-	for _, id := range []string{req.FromId, req.ToId} {
-		_, err := store.Read(fmt.Sprintf("%s/%s/%s", accountPrefix, tnt, id), store.ReadLimit(1))
-		if err != nil {
-			return errors.BadRequest("wallet.transfer", "invalid account")
-		}
+	if req.FromId == req.ToId {
+		return errors.BadRequest("wallet.transfer", "cannot transfer to the same wallet")
 	}
 
-	amount, err := b.c.Read(ctx, redis.Key(tnt, req.FromId), "$balance$")
-	if amount < req.Amount {
-		return errors.BadRequest("wallet.transfer", "insufficient credit")
+	if req.Amount <= 0 {
+		return errors.BadRequest("wallet.transfer", "amount must be positive")
 	}
 
-	_, err = b.c.Decr(ctx, redis.Key(tnt, req.FromId), "$balance$", req.Amount)
+	// check the wallets exist
+	from, err := readAccount(tnt, req.FromId)
 	if err != nil {
-		return err
+		return errors.BadRequest("wallet.transfer", "invalid account")
 	}
-
-	_, err = storeTransaction(tnt, -req.Amount, req.FromId, req.Reference, req.Visible, nil)
+	to, err := readAccount(tnt, req.ToId)
 	if err != nil {
-		return err
+		return errors.BadRequest("wallet.transfer", "invalid account")
 	}
 
-	_, err = b.c.Incr(ctx, redis.Key(tnt, req.ToId), "$balance$", req.Amount)
-	if err != nil {
-		return err
+	key, fingerprint := idempotent("transfer", req.FromId, req)
+
+	entry := &Entry{
+		Postings: []Posting{
+			{WalletID: req.FromId, Amount: -req.Amount},
+			{WalletID: req.ToId, Amount: req.Amount},
+		},
+		Reference:      req.Reference,
+		Visible:        req.Visible,
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+	}
+
+	if !sameCurrency(from, to) {
+		if !req.Convert {
+			return errors.BadRequest("wallet.transfer", "currency mismatch, set convert to transfer between %s and %s", from.Currency, to.Currency)
+		}
+		if !convertible(from, to) {
+			return errors.BadRequest("wallet.transfer", "can't convert between %s and %s", from.Currency, to.Currency)
+		}
+
+		amount, rate, err := b.convert(ctx, from, to, req.Amount)
+		if merr, ok := err.(*errors.Error); ok && merr.Code == 400 {
+			return errors.BadRequest("wallet.transfer", "can't convert between %s and %s", from.Currency, to.Currency)
+		} else if err != nil {
+			log.Errorf("Error converting %s to %s: %s", from.Currency, to.Currency, err)
+			return errors.InternalServerError("wallet.transfer", "Error converting currency")
+		}
+		if amount <= 0 {
+			return errors.BadRequest("wallet.transfer", "amount too small to convert")
+		}
+
+		// each currency balances against its own exchange account
+		entry.Postings = []Posting{
+			{WalletID: req.FromId, Amount: -req.Amount},
+			{WalletID: redis.Key(exchangeID, from.Currency), Amount: req.Amount, Overdraft: true},
+			{WalletID: redis.Key(exchangeID, to.Currency), Amount: -amount, Overdraft: true},
+			{WalletID: req.ToId, Amount: amount},
+		}
+		entry.Metadata = conversionMetadata(from, to, rate, amount)
 	}
 
-	_, err = storeTransaction(tnt, req.Amount, req.ToId, req.Reference, req.Visible, nil)
+	entry, err = b.post(ctx, tnt, entry)
+	if err == redis.ErrInsufficientFunds {
+		return errors.BadRequest("wallet.transfer", "insufficient credit")
+	}
+	if err == redis.ErrIdempotencyReused {
+		return errors.Conflict("wallet.transfer", err.Error())
+	}
 	if err != nil {
-		return err
+		log.Errorf("Error posting transfer %s", err)
+		return errors.InternalServerError("wallet.transfer", "Error making transfer")
+	}
+
+	rsp.TransactionId = entry.ID
+	rsp.Amount = entry.Postings[len(entry.Postings)-1].Amount
+	if rate, ok := entry.Metadata["rate"]; ok {
+		rsp.Rate, _ = strconv.ParseFloat(rate, 64)
 	}
 
 	return nil
@@ -138,19 +167,38 @@ func (b *Wallet) Credit(ctx context.Context, request *pb.CreditRequest, response
 		return errors.BadRequest("wallet.credit", "Missing reference")
 	}
 
-	// TODO idempotency
-	// increment the wallet
-	currBal, err := b.c.Incr(ctx, redis.Key(tnt, request.Id), "$balance$", request.Amount)
+	if request.Amount <= 0 {
+		return errors.BadRequest("wallet.credit", "amount must be positive")
+	}
+
+	key, fingerprint := idempotent("credit", request.Id, request)
+
+	// credit the wallet from outside the ledger
+	_, err := b.post(ctx, tnt, &Entry{
+		Postings: []Posting{
+			{WalletID: externalID, Amount: -request.Amount, Overdraft: true},
+			{WalletID: request.Id, Amount: request.Amount},
+		},
+		Reference:      request.Reference,
+		Visible:        request.Visible,
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+	})
+	if err == redis.ErrIdempotencyReused {
+		return errors.Conflict("wallet.credit", err.Error())
+	}
 	if err != nil {
-		return err
+		log.Errorf("Error posting credit %s", err)
+		return errors.InternalServerError("wallet.credit", "Error crediting wallet")
 	}
 
-	response.Balance = currBal
-	_, err = storeTransaction(tnt, request.Amount, request.Id, request.Reference, request.Visible, nil)
+	currBal, err := b.c.Read(ctx, redis.Key(tnt, request.Id), balancePath)
 	if err != nil {
 		return err
 	}
 
+	response.Balance = currBal
+
 	return nil
 }
 
@@ -168,20 +216,38 @@ func (b *Wallet) Debit(ctx context.Context, request *pb.DebitRequest, response *
 		request.Id = "default"
 	}
 
-	// TODO idempotency
-	// decrement the wallet
-	currBal, err := b.c.Decr(ctx, redis.Key(tnt, request.Id), "$balance$", request.Amount)
-	if err != nil {
-		return err
+	if request.Amount <= 0 {
+		return errors.BadRequest("wallet.debit", "amount must be positive")
 	}
 
-	response.Balance = currBal
+	key, fingerprint := idempotent("debit", request.Id, request)
 
-	_, err = storeTransaction(tnt, -request.Amount, request.Id, request.Reference, request.Visible, nil)
+	// debit the wallet to outside the ledger
+	_, err := b.post(ctx, tnt, &Entry{
+		Postings: []Posting{
+			{WalletID: request.Id, Amount: -request.Amount, Overdraft: true},
+			{WalletID: externalID, Amount: request.Amount, Overdraft: true},
+		},
+		Reference:      request.Reference,
+		Visible:        request.Visible,
+		IdempotencyKey: key,
+		Fingerprint:    fingerprint,
+	})
+	if err == redis.ErrIdempotencyReused {
+		return errors.Conflict("wallet.debit", err.Error())
+	}
+	if err != nil {
+		log.Errorf("Error posting debit %s", err)
+		return errors.InternalServerError("wallet.debit", "Error debiting wallet")
+	}
+
+	currBal, err := b.c.Read(ctx, redis.Key(tnt, request.Id), balancePath)
 	if err != nil {
 		return err
 	}
 
+	response.Balance = currBal
+
 	return nil
 }
 
@@ -195,13 +261,14 @@ func (b *Wallet) Balance(ctx context.Context, request *pb.BalanceRequest, respon
 		request.Id = "default"
 	}
 
-	currBal, err := b.c.Read(ctx, redis.Key(tnt, request.Id), "$balance$")
-	if err != nil && err != redis.Nil {
+	currBal, available, err := b.balances(ctx, tnt, request.Id)
+	if err != nil {
 		log.Errorf("Error reading from counter %s", err)
 		return errors.InternalServerError("wallet.Balance", "Error retrieving balance")
 	}
 
 	response.Balance = currBal
+	response.Available = available
 	return nil
 }
 
@@ -215,34 +282,56 @@ func (b *Wallet) Transactions(ctx context.Context, request *pb.TransactionsReque
 		request.Id = "default"
 	}
 
-	recs, err := store.Read(fmt.Sprintf("%s/%s/%s/", transactionPrefix, tnt, request.Id), store.ReadPrefix())
+	if request.Limit < 0 {
+		return errors.BadRequest("wallet.transactions", "limit must not be negative")
+	}
+
+	switch request.Type {
+	case "", "credit", "debit":
+	default:
+		return errors.BadRequest("wallet.transactions", "type must be credit or debit")
+	}
+
+	from, err := parseTime("wallet.transactions", "from", request.From)
+	if err != nil {
+		return err
+	}
+	to, err := parseTime("wallet.transactions", "to", request.To)
 	if err != nil {
 		return err
 	}
 
-	ret := []*pb.Transaction{}
-	for _, rec := range recs {
-		var trx Transaction
-		if err := json.Unmarshal(rec.Value, &trx); err != nil {
-			return err
-		}
-		if !trx.Visible {
-			continue
+	filter := &transactionFilter{
+		From:      from,
+		To:        to,
+		MinAmount: request.MinAmount,
+		MaxAmount: request.MaxAmount,
+		Type:      request.Type,
+		Reference: request.Reference,
+		Metadata:  request.Metadata,
+	}
+
+	var cursor *pageCursor
+	if len(request.Cursor) > 0 {
+		cursor, err = decodeCursor(request.Cursor)
+		if err != nil {
+			return errors.BadRequest("wallet.transactions", "invalid cursor")
 		}
-		ret = append(ret, &pb.Transaction{
-			Id:        trx.ID,
-			Created:   trx.Created.Format(time.RFC3339Nano),
-			Amount:    trx.Amount,
-			Reference: trx.Reference,
-			Metadata:  trx.Metadata,
-		})
 	}
 
-	sort.Slice(ret, func(i, j int) bool {
-		return ret[i].Created < ret[j].Created
-	})
+	history, next, err := transactionPage(tnt, request.Id, filter, cursor, int(request.Limit))
+	if err != nil {
+		log.Errorf("Error reading transactions %s", err)
+		return errors.InternalServerError("wallet.transactions", "Error reading transactions")
+	}
+
+	ret := []*pb.Transaction{}
+	for _, trx := range history {
+		ret = append(ret, trx.proto())
+	}
 
 	response.Transactions = ret
+	response.Cursor = next
 
 	return nil
 }
@@ -259,13 +348,32 @@ func (b *Wallet) Create(ctx context.Context, request *pb.CreateRequest, response
 		id = uuid.New().String()
 	}
 
+	// reserved for internal ledger accounts
+	if strings.HasPrefix(id, "$") {
+		return errors.BadRequest("wallet.create", "invalid id")
+	}
+
+	code, err := validateCurrency(request.Currency, request.Precision)
+	if err != nil {
+		return errors.BadRequest("wallet.create", err.Error())
+	}
+
 	// create a composite key
 	key := fmt.Sprintf("%s/%s/%s", accountPrefix, tnt, id)
 
+	// the balance of an existing wallet is in its currency and precision
+	if _, err := store.Read(key, store.ReadLimit(1)); err == nil {
+		return errors.Conflict("wallet.create", "wallet %s already exists", id)
+	} else if err != store.ErrNotFound {
+		return errors.InternalServerError("wallet.create", "Error reading wallet")
+	}
+
 	acc := &pb.Account{
 		Id:          id,
 		Name:        request.Name,
 		Description: request.Description,
+		Currency:    code,
+		Precision:   request.Precision,
 	}
 
 	// create a new record
@@ -293,19 +401,46 @@ func (b *Wallet) Delete(ctx context.Context, request *pb.DeleteRequest, response
 	userID := tnt
 	walletID := request.Id
 
-	// delete the account
-	key := fmt.Sprintf("%s/%s/%s", accountPrefix, userID, walletID)
-	if err := store.Delete(key); err != nil {
-		return err
+	// held funds would be stranded once the wallet is gone
+	bal, available, err := b.balances(ctx, userID, walletID)
+	if err != nil {
+		log.Errorf("Error reading from counter %s", err)
+		return errors.InternalServerError("wallet.delete", "Error reading balance")
+	}
+	if bal != available {
+		return errors.BadRequest("wallet.delete", "wallet has funds on hold, capture or void them first")
+	}
+
+	// close the wallet against the closing account so the journal still balances
+	if available != 0 {
+		_, err := b.post(ctx, userID, &Entry{
+			Postings: []Posting{
+				{WalletID: walletID, Amount: -available, Close: true},
+				{WalletID: closingID, Amount: available, Overdraft: true},
+			},
+			Reference: "wallet deleted",
+			Metadata: map[string]string{
+				"type": "close",
+			},
+		})
+		if err == redis.ErrBalanceChanged {
+			return errors.Conflict("wallet.delete", "balance changed while deleting, try again")
+		}
+		if err != nil {
+			log.Errorf("Error posting closing entry %s", err)
+			return errors.InternalServerError("wallet.delete", "Error closing wallet")
+		}
 	}
 
-	// delete the wallet
-	if err := b.c.Delete(ctx, redis.Key(userID, walletID)); err != nil {
+	// delete the account. The counter is left at zero rather than deleted
+	// so nothing posted concurrently is lost from the journal's balances
+	key := fmt.Sprintf("%s/%s/%s", accountPrefix, userID, walletID)
+	if err := store.Delete(key); err != nil {
 		return err
 	}
 
 	// delete all related transactions
-	recs, err := store.List(store.ListPrefix(fmt.Sprintf("%s/%s/%s/", transactionPrefix, userID, walletID)))
+	recs, err := store.List(store.ListPrefix(transactionsPrefix(userID, walletID)))
 	if err != nil {
 		return err
 	}
@@ -340,14 +475,15 @@ func (w *Wallet) Read(ctx context.Context, req *pb.ReadRequest, rsp *pb.ReadResp
 	acc := new(pb.Account)
 	recs[0].Decode(&acc)
 
-	bal, err := w.c.Read(ctx, redis.Key(tnt, acc.Id), "$balance$")
-	if err != nil && err != redis.Nil {
+	bal, available, err := w.balances(ctx, tnt, acc.Id)
+	if err != nil {
 		log.Errorf("Error reading from counter %s", err)
 		return errors.BadRequest("wallet.read", "error reading balance")
 	}
 
 	// set balance
 	acc.Balance = bal
+	acc.Available = available
 
 	rsp.Account = acc
 
@@ -371,14 +507,15 @@ func (w *Wallet) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListResp
 		acc := new(pb.Account)
 		rec.Decode(&acc)
 
-		bal, err := w.c.Read(ctx, redis.Key(tnt, acc.Id), "$balance$")
-		if err != nil && err != redis.Nil {
+		bal, available, err := w.balances(ctx, tnt, acc.Id)
+		if err != nil {
 			log.Errorf("Error reading from counter %s", err)
 			continue
 		}
 
 		// set balance
 		acc.Balance = bal
+		acc.Available = available
 		rsp.Accounts = append(rsp.Accounts, acc)
 	}
 
@@ -387,17 +524,18 @@ func (w *Wallet) List(ctx context.Context, req *pb.ListRequest, rsp *pb.ListResp
 		return nil
 	}
 
-	bal, err := w.c.Read(ctx, redis.Key(tnt, "default"), "$balance$")
-	if err != nil && err != redis.Nil {
+	bal, available, err := w.balances(ctx, tnt, "default")
+	if err != nil {
 		log.Errorf("Error reading from counter %s", err)
 		return nil
 	}
 
 	// add default
 	rsp.Accounts = append(rsp.Accounts, &pb.Account{
-		Id:      "default",
-		Name:    "Default account",
-		Balance: bal,
+		Id:        "default",
+		Name:      "Default account",
+		Balance:   bal,
+		Available: available,
 	})
 
 	return nil
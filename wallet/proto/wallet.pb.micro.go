@@ -51,6 +51,11 @@ type WalletService interface {
 	List(ctx context.Context, in *ListRequest, opts ...client.CallOption) (*ListResponse, error)
 	Transactions(ctx context.Context, in *TransactionsRequest, opts ...client.CallOption) (*TransactionsResponse, error)
 	Transfer(ctx context.Context, in *TransferRequest, opts ...client.CallOption) (*TransferResponse, error)
+	Reconcile(ctx context.Context, in *ReconcileRequest, opts ...client.CallOption) (*ReconcileResponse, error)
+	Hold(ctx context.Context, in *HoldRequest, opts ...client.CallOption) (*HoldResponse, error)
+	Capture(ctx context.Context, in *CaptureRequest, opts ...client.CallOption) (*CaptureResponse, error)
+	Void(ctx context.Context, in *VoidRequest, opts ...client.CallOption) (*VoidResponse, error)
+	Statement(ctx context.Context, in *StatementRequest, opts ...client.CallOption) (*StatementResponse, error)
 }
 
 type walletService struct {
@@ -155,6 +160,56 @@ func (c *walletService) Transfer(ctx context.Context, in *TransferRequest, opts
 	return out, nil
 }
 
+func (c *walletService) Reconcile(ctx context.Context, in *ReconcileRequest, opts ...client.CallOption) (*ReconcileResponse, error) {
+	req := c.c.NewRequest(c.name, "Wallet.Reconcile", in)
+	out := new(ReconcileResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletService) Hold(ctx context.Context, in *HoldRequest, opts ...client.CallOption) (*HoldResponse, error) {
+	req := c.c.NewRequest(c.name, "Wallet.Hold", in)
+	out := new(HoldResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletService) Capture(ctx context.Context, in *CaptureRequest, opts ...client.CallOption) (*CaptureResponse, error) {
+	req := c.c.NewRequest(c.name, "Wallet.Capture", in)
+	out := new(CaptureResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletService) Void(ctx context.Context, in *VoidRequest, opts ...client.CallOption) (*VoidResponse, error) {
+	req := c.c.NewRequest(c.name, "Wallet.Void", in)
+	out := new(VoidResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *walletService) Statement(ctx context.Context, in *StatementRequest, opts ...client.CallOption) (*StatementResponse, error) {
+	req := c.c.NewRequest(c.name, "Wallet.Statement", in)
+	out := new(StatementResponse)
+	err := c.c.Call(ctx, req, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // Server API for Wallet service
 
 type WalletHandler interface {
@@ -167,6 +222,11 @@ type WalletHandler interface {
 	List(context.Context, *ListRequest, *ListResponse) error
 	Transactions(context.Context, *TransactionsRequest, *TransactionsResponse) error
 	Transfer(context.Context, *TransferRequest, *TransferResponse) error
+	Reconcile(context.Context, *ReconcileRequest, *ReconcileResponse) error
+	Hold(context.Context, *HoldRequest, *HoldResponse) error
+	Capture(context.Context, *CaptureRequest, *CaptureResponse) error
+	Void(context.Context, *VoidRequest, *VoidResponse) error
+	Statement(context.Context, *StatementRequest, *StatementResponse) error
 }
 
 func RegisterWalletHandler(s server.Server, hdlr WalletHandler, opts ...server.HandlerOption) error {
@@ -180,6 +240,11 @@ func RegisterWalletHandler(s server.Server, hdlr WalletHandler, opts ...server.H
 		List(ctx context.Context, in *ListRequest, out *ListResponse) error
 		Transactions(ctx context.Context, in *TransactionsRequest, out *TransactionsResponse) error
 		Transfer(ctx context.Context, in *TransferRequest, out *TransferResponse) error
+		Reconcile(ctx context.Context, in *ReconcileRequest, out *ReconcileResponse) error
+		Hold(ctx context.Context, in *HoldRequest, out *HoldResponse) error
+		Capture(ctx context.Context, in *CaptureRequest, out *CaptureResponse) error
+		Void(ctx context.Context, in *VoidRequest, out *VoidResponse) error
+		Statement(ctx context.Context, in *StatementRequest, out *StatementResponse) error
 	}
 	type Wallet struct {
 		wallet
@@ -227,3 +292,23 @@ func (h *walletHandler) Transactions(ctx context.Context, in *TransactionsReques
 func (h *walletHandler) Transfer(ctx context.Context, in *TransferRequest, out *TransferResponse) error {
 	return h.WalletHandler.Transfer(ctx, in, out)
 }
+
+func (h *walletHandler) Reconcile(ctx context.Context, in *ReconcileRequest, out *ReconcileResponse) error {
+	return h.WalletHandler.Reconcile(ctx, in, out)
+}
+
+func (h *walletHandler) Hold(ctx context.Context, in *HoldRequest, out *HoldResponse) error {
+	return h.WalletHandler.Hold(ctx, in, out)
+}
+
+func (h *walletHandler) Capture(ctx context.Context, in *CaptureRequest, out *CaptureResponse) error {
+	return h.WalletHandler.Capture(ctx, in, out)
+}
+
+func (h *walletHandler) Void(ctx context.Context, in *VoidRequest, out *VoidResponse) error {
+	return h.WalletHandler.Void(ctx, in, out)
+}
+
+func (h *walletHandler) Statement(ctx context.Context, in *StatementRequest, out *StatementResponse) error {
+	return h.WalletHandler.Statement(ctx, in, out)
+}